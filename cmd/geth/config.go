@@ -32,6 +32,7 @@ import (
 	"github.com/ethereum/go-ethereum/dashboard"
 	"github.com/ethereum/go-ethereum/eth"
 	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/raft"
@@ -224,7 +225,8 @@ func RegisterRaftService(stack *node.Node, ctx *cli.Context, cfg gethConfig, eth
 		privkey := cfg.Node.NodeKey()
 		strId := enode.PubkeyToIDV4(&privkey.PublicKey).String()
 		blockTimeNanos := time.Duration(blockTimeMillis) * time.Millisecond
-		peers := cfg.Node.StaticNodes()[0]
+		static := cfg.Node.StaticNodes()
+		peers := append(static[p2p.UnknownShard], static[0]...)
 
 		// @sourav, todo: currently I  have just made the syntax correct
 		// We have to add peers appropriately for each shard to make this
@@ -126,6 +126,7 @@ var (
 		utils.MyShardFlag,
 		utils.NumShardFlag,
 		utils.RefNodesFlag,
+		utils.RefHeadersOnlyFlag,
 		utils.NetworkIdFlag,
 		utils.RPCCORSDomainFlag,
 		utils.RPCVirtualHostsFlag,
@@ -179,6 +180,8 @@ var (
 		utils.MetricsInfluxDBUsernameFlag,
 		utils.MetricsInfluxDBPasswordFlag,
 		utils.MetricsInfluxDBHostTagFlag,
+		utils.EventLogDirFlag,
+		utils.EventLogLimitFlag,
 	}
 )
 
@@ -289,10 +292,46 @@ func geth(ctx *cli.Context) error {
 	// Check if a valid consensus is used
 	quorumValidateConsensus(node, ctx.GlobalBool(utils.RaftModeFlag.Name))
 
-	node.Wait()
+	// Rejoin the network whenever the reference chain moves the local validator
+	for waitShardSwitch(node) {
+		if err := node.Restart(); err != nil {
+			utils.Fatalf("Failed to restart node in new shard: %v", err)
+		}
+		startAuxiliaryServices(ctx, node)
+	}
 	return nil
 }
 
+// waitShardSwitch blocks until the node stops, returning false, or until the
+// reference chain moved the local validator to another shard, returning true.
+func waitShardSwitch(stack *node.Node) bool {
+	stopped := make(chan struct{})
+	go func() {
+		stack.Wait()
+		close(stopped)
+	}()
+	var ethereum *eth.Ethereum
+	if err := stack.Service(&ethereum); err != nil {
+		<-stopped
+		return false
+	}
+	switches := make(chan eth.ShardSwitchEvent, 1)
+	sub := ethereum.SubscribeShardSwitchEvent(switches)
+	defer sub.Unsubscribe()
+
+	if shard, ok := ethereum.PendingShardSwitch(); ok {
+		log.Warn("Restarting services in new shard", "shard", shard)
+		return true
+	}
+	select {
+	case ev := <-switches:
+		log.Warn("Restarting services in new shard", "shard", ev.Shard)
+		return true
+	case <-stopped:
+		return false
+	}
+}
+
 // startNode boots up the system node and all registered protocols, after which
 // it unlocks any requested accounts, and starts the RPC/IPC interfaces and the
 // miner.
@@ -354,7 +393,12 @@ func startNode(ctx *cli.Context, stack *node.Node) {
 			}
 		}
 	}()
+	startAuxiliaryServices(ctx, stack)
+}
 
+// startAuxiliaryServices starts the services that need a running node, such as
+// the permissions service and the miner.
+func startAuxiliaryServices(ctx *cli.Context, stack *node.Node) {
 	// Quorum
 	//
 	// checking if permissions is enabled and staring the permissions service
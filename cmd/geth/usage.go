@@ -256,6 +256,8 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.MetricsInfluxDBUsernameFlag,
 			utils.MetricsInfluxDBPasswordFlag,
 			utils.MetricsInfluxDBHostTagFlag,
+			utils.EventLogDirFlag,
+			utils.EventLogLimitFlag,
 		},
 	},
 	{
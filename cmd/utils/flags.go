@@ -52,6 +52,7 @@ import (
 	"github.com/ethereum/go-ethereum/les"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/metrics/eventlog"
 	"github.com/ethereum/go-ethereum/metrics/influxdb"
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/p2p"
@@ -146,6 +147,10 @@ var (
 		Usage: "Number of nodes in reference shard",
 		Value: eth.DefaultConfig.RefNodes,
 	}
+	RefHeadersOnlyFlag = cli.BoolFlag{
+		Name:  "refheadersonly",
+		Usage: "Follow the reference chain by headers and cross-shard receipt proofs instead of executing it (shard nodes only)",
+	}
 	NetworkIdFlag = cli.Uint64Flag{
 		Name:  "networkid",
 		Usage: "Network identifier (integer, 1=Frontier, 2=Morden (disused), 3=Ropsten, 4=Rinkeby, 5=Ottoman)",
@@ -681,6 +686,15 @@ var (
 		Usage: "InfluxDB `host` tag attached to all measurements",
 		Value: "localhost",
 	}
+	EventLogDirFlag = DirectoryFlag{
+		Name:  "eventlog.dir",
+		Usage: "Directory to record cross-shard events into as JSON lines (relative to the datadir, default = disabled)",
+	}
+	EventLogLimitFlag = cli.UintFlag{
+		Name:  "eventlog.limit",
+		Usage: "Size in bytes after which the cross-shard event file is rotated",
+		Value: eventlog.DefaultLimit,
+	}
 
 	EWASMInterpreterFlag = cli.StringFlag{
 		Name:  "vm.ewasm",
@@ -1238,9 +1252,18 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	if ctx.GlobalIsSet(RefNodesFlag.Name) {
 		cfg.RefNodes = ctx.GlobalUint64(RefNodesFlag.Name)
 	}
+	if ctx.GlobalIsSet(RefHeadersOnlyFlag.Name) {
+		cfg.RefHeadersOnly = ctx.GlobalBool(RefHeadersOnlyFlag.Name)
+	}
 	if ctx.GlobalIsSet(NetworkIdFlag.Name) {
 		cfg.NetworkId = ctx.GlobalUint64(NetworkIdFlag.Name)
 	}
+	if ctx.GlobalIsSet(EventLogDirFlag.Name) {
+		cfg.EventLogDir = ctx.GlobalString(EventLogDirFlag.Name)
+	}
+	if ctx.GlobalIsSet(EventLogLimitFlag.Name) {
+		cfg.EventLogLimit = ctx.GlobalUint(EventLogLimitFlag.Name)
+	}
 
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheDatabaseFlag.Name) {
 		cfg.DatabaseCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheDatabaseFlag.Name) / 100
@@ -1373,7 +1396,11 @@ func RegisterEthService(stack *node.Node, cfg *eth.Config) <-chan *eth.Ethereum
 				ls, _ := les.NewLesServer(fullNode, cfg)
 				fullNode.AddLesServer(ls)
 			}
-			nodeChan <- fullNode
+			// The service is created again whenever the node restarts
+			select {
+			case nodeChan <- fullNode:
+			default:
+			}
 			return fullNode, err
 		})
 	}
@@ -1532,7 +1559,7 @@ func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chai
 	var (
 		fdlock sync.RWMutex
 	)
-	chain, err = core.NewBlockChain(chainDb, cache, config, engine, vmcfg, nil, false, uint64(0), uint64(1), nil, nil, nil, nil, fdlock, nil, nil, nil, nil, "")
+	chain, err = core.NewBlockChain(chainDb, cache, config, engine, vmcfg, nil, false, uint64(0), uint64(1), nil, nil, nil, nil, fdlock, nil, nil, nil)
 	if err != nil {
 		Fatalf("Can't create BlockChain: %v", err)
 	}
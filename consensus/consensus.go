@@ -140,4 +140,12 @@ type Istanbul interface {
 
 	// Stop stops the engine
 	Stop() error
+
+	// VerifyStateCommit checks whether a shard header reported to the reference
+	// chain carries enough committed seals from the validators of its shard.
+	VerifyStateCommit(chain ChainReader, header *types.Header) error
+
+	// SetShards updates the validators of every shard after the reference
+	// chain reassigned them.
+	SetShards(shards map[uint64][]common.Address)
 }
@@ -44,9 +44,10 @@ type Backend interface {
 	// BroadcastOthers sends messages to validators from the valAddresses
 	BroadcastOthers(valAddress []common.Address, payload []byte) error
 
-	// Commit delivers an approved proposal to backend.
+	// Commit delivers an approved proposal to backend, along with the
+	// committed seals and the validators that put them.
 	// The delivered proposal will be put into blockchain.
-	Commit(proposal Proposal, seals [][]byte) error
+	Commit(proposal Proposal, seals [][]byte, committers []common.Address) error
 
 	// Verify verifies the proposal. If a consensus.ErrFutureBlock error is returned,
 	// the time difference of the proposal and current time is also returned.
@@ -55,6 +56,10 @@ type Backend interface {
 	// Sign signs input data with the backend's private key
 	Sign([]byte) ([]byte, error)
 
+	// SignCommittedSeal returns the committed seal of the proposal, signed
+	// with the backend's BLS key once aggregate seals are enabled for it
+	SignCommittedSeal(proposal Proposal) ([]byte, error)
+
 	// CheckSignature verifies the signature by checking if it's signed by
 	// the given validator
 	CheckSignature(data []byte, addr common.Address, sig []byte) error
@@ -74,5 +79,12 @@ type Backend interface {
 	// HasBadBlock returns whether the block with the hash is a bad block
 	HasBadProposal(hash common.Hash) bool
 
+	// SaveRoundState persists the encoded round state of core, so that it
+	// survives a restart of the node
+	SaveRoundState(data []byte) error
+
+	// LoadRoundState retrieves the round state saved last, or nil if none was
+	LoadRoundState() ([]byte, error)
+
 	Close() error
 }
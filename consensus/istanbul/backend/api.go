@@ -19,7 +19,9 @@ package backend
 import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
@@ -42,6 +44,12 @@ func (api *API) NodeAddress() common.Address {
 	return api.istanbul.Address()
 }
 
+// GetBLSKey returns the BLS public key the node signs committed seals with and
+// its proof of possession, to be registered in the genesis of the network.
+func (api *API) GetBLSKey() *params.BLSKey {
+	return api.istanbul.BLSKey()
+}
+
 // GetSignersFromBlock returns the signers and minter for a given block number, or the
 // latest block available if none is specified
 func (api *API) GetSignersFromBlock(number *rpc.BlockNumber) (*BlockSigners, error) {
@@ -176,3 +184,133 @@ func (api *API) Discard(address common.Address) {
 
 	delete(api.istanbul.candidates, address)
 }
+
+// Moves returns the shard moves the node tries to push through, mapped to the
+// shard each validator should move to.
+func (api *API) Moves() map[common.Address]uint64 {
+	api.istanbul.candidatesLock.RLock()
+	defer api.istanbul.candidatesLock.RUnlock()
+
+	moves := make(map[common.Address]uint64)
+	for address, shard := range api.istanbul.moves {
+		moves[address] = shard
+	}
+	return moves
+}
+
+// ProposeMove injects a vote to move a validator to another shard, which the
+// reference validator casts in its blocks until the move takes effect.
+func (api *API) ProposeMove(address common.Address, shard uint64) error {
+	if shard >= api.istanbul.numShard {
+		return errInvalidShard
+	}
+	api.istanbul.candidatesLock.Lock()
+	defer api.istanbul.candidatesLock.Unlock()
+
+	api.istanbul.moves[address] = shard
+	return nil
+}
+
+// DiscardMove drops a currently running shard move, stopping the validator from
+// casting further votes on it.
+func (api *API) DiscardMove(address common.Address) {
+	api.istanbul.candidatesLock.Lock()
+	defer api.istanbul.candidatesLock.Unlock()
+
+	delete(api.istanbul.moves, address)
+}
+
+// GetShardTopology retrieves the validators assigned to every shard after the
+// given reference block, or the latest one if none is specified.
+func (api *API) GetShardTopology(number *rpc.BlockNumber) (*types.ShardTopology, error) {
+	var refNum uint64
+	if number == nil || *number == rpc.LatestBlockNumber {
+		db := api.istanbul.refChainDB()
+		head := rawdb.ReadHeaderNumber(db, rawdb.ReadHeadBlockHash(db))
+		if head == nil {
+			return nil, errUnknownBlock
+		}
+		refNum = *head
+	} else {
+		refNum = uint64(number.Int64())
+	}
+	topology, err := api.istanbul.shardTopology(refNum)
+	if err != nil {
+		return nil, err
+	}
+	if topology == nil {
+		topology = types.NewShardTopology(api.istanbul.numShard, api.istanbul.shards)
+	}
+	return topology, nil
+}
+
+// GetShardCheckpoint retrieves the checkpoint the reference chain holds of the
+// given block of a shard, or of its latest checkpointed block if none is
+// specified.
+func (api *API) GetShardCheckpoint(shard uint64, number *rpc.BlockNumber) (*types.ShardCheckpoint, error) {
+	db := api.istanbul.refChainDB()
+	var blockNum uint64
+	if number == nil || *number == rpc.LatestBlockNumber {
+		head, ok := rawdb.ReadShardCheckpointHead(db, shard)
+		if !ok {
+			return nil, errUnknownCheckpoint
+		}
+		blockNum = head
+	} else {
+		blockNum = uint64(number.Int64())
+	}
+	checkpoint := rawdb.ReadShardCheckpoint(db, shard, blockNum)
+	if checkpoint == nil {
+		return nil, errUnknownCheckpoint
+	}
+	return checkpoint, nil
+}
+
+// GetShardBlockProof returns the proof that the block of a shard with the
+// given hash is final, i.e. checkpointed with the committed seals of enough
+// validators of the shard: the state commitment carrying the sealed block
+// header and its transaction trie proof against the reference block that
+// included it. It returns nil if the block is not checkpointed.
+func (api *API) GetShardBlockProof(shard uint64, hash common.Hash) (*types.ShardBlockProof, error) {
+	db := api.istanbul.refChainDB()
+	checkpoint := rawdb.ReadShardCheckpointByHash(db, hash)
+	if checkpoint == nil || checkpoint.Shard != shard {
+		return nil, nil
+	}
+	if err := api.istanbul.verifyShardSeals(shard, checkpoint.Number, checkpoint.RefNumber, checkpoint.Hash, checkpoint.Extra()); err != nil {
+		return nil, err
+	}
+	block := rawdb.ReadBlock(db, rawdb.ReadCanonicalHash(db, checkpoint.Checkpointed), checkpoint.Checkpointed)
+	if block == nil {
+		return nil, errUnknownBlock
+	}
+	return types.ProveStateCommit(block.Header(), block.Transactions(), checkpoint.CommitTx)
+}
+
+// VerifyShardBlock checks a proof that a shard block is final against the
+// reference chain of the node: the reference block including the state
+// commitment must be canonical, and the shard header it carries sealed by
+// enough validators of the shard. It returns false if the reference block is
+// not canonical.
+func (api *API) VerifyShardBlock(proof *types.ShardBlockProof) (bool, error) {
+	header, err := proof.Verify()
+	if err != nil {
+		return false, err
+	}
+	number := proof.RefHeader.Number.Uint64()
+	if rawdb.ReadCanonicalHash(api.istanbul.refChainDB(), number) != proof.RefHeader.Hash() {
+		return false, nil
+	}
+	extra, err := types.ExtractIstanbulExtra(header)
+	if err != nil {
+		return false, err
+	}
+	var refNum uint64
+	if header.RefNumber != nil {
+		refNum = header.RefNumber.Uint64()
+	}
+	if err := api.istanbul.verifyShardSeals(header.Shard, header.Number.Uint64(), refNum, header.Hash(), extra); err != nil {
+		return false, err
+	}
+	return true, nil
+}
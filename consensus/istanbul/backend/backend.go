@@ -30,6 +30,7 @@ import (
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/bls"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
@@ -39,10 +40,13 @@ import (
 const (
 	// fetcherID is the ID indicates the block is from Istanbul engine
 	fetcherID = "istanbul"
+	// dbKeyRoundState is the database key of the persisted round state of core
+	dbKeyRoundState = "istanbul-round-state"
 )
 
 // New creates an Ethereum backend for Istanbul core engine.
-func New(config *istanbul.Config, privateKey *ecdsa.PrivateKey, myShard, numShard, refNodes uint64, db, refdb ethdb.Database) consensus.Istanbul {
+// The shards map holds the validators of every shard, indexed by shard ID.
+func New(config *istanbul.Config, privateKey *ecdsa.PrivateKey, myShard, numShard uint64, shards map[uint64][]common.Address, db, refdb ethdb.Database) consensus.Istanbul {
 	// Allocate the snapshot caches and create the engine
 	recents, _ := lru.NewARC(inmemorySnapshots)
 	recentMessages, _ := lru.NewARC(inmemoryPeers)
@@ -51,20 +55,24 @@ func New(config *istanbul.Config, privateKey *ecdsa.PrivateKey, myShard, numShar
 		config:           config,
 		myShard:          myShard,
 		numShard:         numShard,
-		refNodes:         refNodes,
+		shards:           shards,
 		istanbulEventMux: new(event.TypeMux),
 		privateKey:       privateKey,
 		address:          crypto.PubkeyToAddress(privateKey.PublicKey),
+		blsKey:           deriveBLSKey(privateKey),
+		blsKeys:          registerBLSKeys(config.BLSKeys),
 		logger:           log.New(),
 		db:               db,
+		refdb:            refdb,
 		commitCh:         make(chan *types.Block, 1),
 		recents:          recents,
 		candidates:       make(map[common.Address]bool),
+		moves:            make(map[common.Address]uint64),
 		coreStarted:      false,
 		recentMessages:   recentMessages,
 		knownMessages:    knownMessages,
 	}
-	backend.core = istanbulCore.New(backend, backend.config, myShard, numShard, refNodes)
+	backend.core = istanbulCore.New(backend, backend.config, myShard, numShard, shards)
 	return backend
 }
 
@@ -74,13 +82,16 @@ type backend struct {
 	config           *istanbul.Config
 	myShard          uint64
 	numShard         uint64
-	refNodes         uint64
+	shards           map[uint64][]common.Address // Validators of every shard
 	istanbulEventMux *event.TypeMux
 	privateKey       *ecdsa.PrivateKey
 	address          common.Address
+	blsKey           *bls.SecretKey                    // Key signing committed seals after the BLS fork
+	blsKeys          map[common.Address]*bls.PublicKey // Registered BLS keys of the validators
 	core             istanbulCore.Engine
 	logger           log.Logger
 	db               ethdb.Database
+	refdb            ethdb.Database // Database of the reference chain on shard nodes
 	chain            consensus.ChainReader
 	currentBlock     func() *types.Block
 	hasBadBlock      func(hash common.Hash) bool
@@ -94,6 +105,8 @@ type backend struct {
 
 	// Current list of candidates we are pushing
 	candidates map[common.Address]bool
+	// Current list of shard moves we are pushing, mapped to the target shard
+	moves map[common.Address]uint64
 	// Protects the signer fields
 	candidatesLock sync.RWMutex
 	// Snapshots for recent block to speed up reorgs
@@ -121,16 +134,17 @@ func (sb *backend) NumShard() uint64 {
 	return sb.numShard
 }
 
-// RefNodes returns the total number of shard
-func (sb *backend) RefNodes() uint64 {
-	return sb.refNodes
-}
-
 // MyShard returns local shard id
 func (sb *backend) MyShard() uint64 {
 	return sb.myShard
 }
 
+// SetShards updates the validators of every shard after the reference chain
+// reassigned them.
+func (sb *backend) SetShards(shards map[uint64][]common.Address) {
+	sb.core.SetShards(shards)
+}
+
 // Validators implements istanbul.Backend.Validators
 func (sb *backend) Validators(proposal istanbul.Proposal) istanbul.ValidatorSet {
 	return sb.getValidators(proposal.Number().Uint64(), proposal.Hash())
@@ -218,7 +232,7 @@ func (sb *backend) Gossip(valSet istanbul.ValidatorSet, payload []byte) error {
 }
 
 // Commit implements istanbul.Backend.Commit
-func (sb *backend) Commit(proposal istanbul.Proposal, seals [][]byte) error {
+func (sb *backend) Commit(proposal istanbul.Proposal, seals [][]byte, committers []common.Address) error {
 	// Check if the proposal is a valid block
 	block := &types.Block{}
 	block, ok := proposal.(*types.Block)
@@ -228,8 +242,13 @@ func (sb *backend) Commit(proposal istanbul.Proposal, seals [][]byte) error {
 	}
 
 	h := block.Header()
-	// Append seals into extra-data
-	err := writeCommittedSeals(h, seals)
+	// Append seals into extra-data, aggregated after the BLS fork
+	var err error
+	if sb.config.IsBLS(h.Number) {
+		err = sb.writeAggregatedSeal(h, sb.getValidators(h.Number.Uint64()-1, h.ParentHash), seals, committers)
+	} else {
+		err = writeCommittedSeals(h, seals)
+	}
 	if err != nil {
 		return err
 	}
@@ -370,6 +389,24 @@ func (sb *backend) HasBadProposal(hash common.Hash) bool {
 	return sb.hasBadBlock(hash)
 }
 
+// SaveRoundState implements istanbul.Backend.SaveRoundState. The round state
+// is flushed to disk before returning, as messages sent after saving it must
+// survive a crash of the machine too.
+func (sb *backend) SaveRoundState(data []byte) error {
+	if db, ok := sb.db.(ethdb.SyncPutter); ok {
+		return db.SyncPut([]byte(dbKeyRoundState), data)
+	}
+	return sb.db.Put([]byte(dbKeyRoundState), data)
+}
+
+// LoadRoundState implements istanbul.Backend.LoadRoundState
+func (sb *backend) LoadRoundState() ([]byte, error) {
+	if has, err := sb.db.Has([]byte(dbKeyRoundState)); err != nil || !has {
+		return nil, err
+	}
+	return sb.db.Get([]byte(dbKeyRoundState))
+}
+
 func (sb *backend) Close() error {
 	return nil
 }
@@ -0,0 +1,165 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package backend
+
+import (
+	"crypto/ecdsa"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/istanbul"
+	istanbulCore "github.com/ethereum/go-ethereum/consensus/istanbul/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/bls"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// blsKeySeed separates the BLS key derived from a node key from other uses of it
+var blsKeySeed = []byte("istanbul committed seal")
+
+// deriveBLSKey derives the BLS key a validator signs committed seals with from
+// its node key, so that no separate key has to be managed.
+func deriveBLSKey(privateKey *ecdsa.PrivateKey) *bls.SecretKey {
+	return bls.DeriveKey(append(common.CopyBytes(blsKeySeed), crypto.FromECDSA(privateKey)...))
+}
+
+// registerBLSKeys returns the public keys of the validators that proved the
+// possession of their secret keys. Keys failing the proof are left out, since
+// aggregating them would allow rogue key attacks.
+func registerBLSKeys(keys map[common.Address]*params.BLSKey) map[common.Address]*bls.PublicKey {
+	registry := make(map[common.Address]*bls.PublicKey, len(keys))
+	for addr, key := range keys {
+		pub, err := bls.UnmarshalPublicKey(key.PublicKey)
+		if err != nil || !bls.VerifyProof(pub, key.Proof) {
+			log.Error("Ignoring invalid BLS key", "address", addr)
+			continue
+		}
+		registry[addr] = pub
+	}
+	return registry
+}
+
+// BLSKey returns the BLS key registration of the local validator.
+func (sb *backend) BLSKey() *params.BLSKey {
+	return &params.BLSKey{
+		PublicKey: sb.blsKey.PublicKey().Bytes(),
+		Proof:     sb.blsKey.Prove(),
+	}
+}
+
+// SignCommittedSeal implements istanbul.Backend.SignCommittedSeal
+func (sb *backend) SignCommittedSeal(proposal istanbul.Proposal) ([]byte, error) {
+	seal := istanbulCore.PrepareCommittedSeal(proposal.Hash())
+	if sb.config.IsBLS(proposal.Number()) {
+		return sb.blsKey.Sign(seal), nil
+	}
+	return sb.Sign(seal)
+}
+
+// writeAggregatedSeal aggregates the BLS committed seals of the committers in
+// valSet into the extra-data of the header. Seals that do not verify are
+// dropped, as a single one would invalidate the aggregate.
+func (sb *backend) writeAggregatedSeal(h *types.Header, valSet istanbul.ValidatorSet, seals [][]byte, committers []common.Address) error {
+	if len(seals) != len(committers) {
+		return errInvalidCommittedSeals
+	}
+	hash := h.Hash()
+	proposalSeal := istanbulCore.PrepareCommittedSeal(hash)
+
+	signers := make([]byte, (valSet.Size()+7)/8)
+	var valid [][]byte
+	for i, seal := range seals {
+		index, val := valSet.GetByAddress(committers[i])
+		if val == nil || signers[index/8]&(1<<uint(index%8)) != 0 {
+			continue
+		}
+		if key := sb.blsKeys[committers[i]]; key == nil || !bls.Verify(key, proposalSeal, seal) {
+			sb.logger.Warn("Dropping invalid BLS committed seal", "address", committers[i], "hash", hash)
+			continue
+		}
+		signers[index/8] |= 1 << uint(index%8)
+		valid = append(valid, seal)
+	}
+	if len(valid) < sb.minCommittedSeals(h.Shard, h.Number, valSet) {
+		return errInvalidCommittedSeals
+	}
+	aggregate, err := bls.AggregateSignatures(valid)
+	if err != nil {
+		return err
+	}
+
+	istanbulExtra, err := types.ExtractIstanbulExtra(h)
+	if err != nil {
+		return err
+	}
+	istanbulExtra.CommittedSeal = [][]byte{}
+	istanbulExtra.Signers, istanbulExtra.AggregatedSeal = signers, aggregate
+
+	payload, err := rlp.EncodeToBytes(&istanbulExtra)
+	if err != nil {
+		return err
+	}
+	h.Extra = append(h.Extra[:types.IstanbulExtraVanity], payload...)
+	return nil
+}
+
+// verifyAggregatedSeal checks the aggregate seal on the block with the given
+// hash against the registered keys of the validators of valSet marked in the
+// signer bitmap, and returns the number of signers.
+func (sb *backend) verifyAggregatedSeal(hash common.Hash, valSet istanbul.ValidatorSet, extra *types.IstanbulExtra) (int, error) {
+	if len(extra.AggregatedSeal) == 0 {
+		return 0, errEmptyCommittedSeals
+	}
+	if len(extra.CommittedSeal) > 0 {
+		return 0, errInvalidCommittedSeals
+	}
+	signers, err := aggregatedSigners(valSet, extra.Signers)
+	if err != nil {
+		return 0, err
+	}
+	keys := make([]*bls.PublicKey, len(signers))
+	for i, addr := range signers {
+		if keys[i] = sb.blsKeys[addr]; keys[i] == nil {
+			return 0, errUnregisteredBLSKey
+		}
+	}
+	if !bls.VerifyAggregate(keys, istanbulCore.PrepareCommittedSeal(hash), extra.AggregatedSeal) {
+		return 0, errInvalidCommittedSeals
+	}
+	return len(signers), nil
+}
+
+// aggregatedSigners returns the validators marked in the signer bitmap, whose
+// bit i stands for the validator at index i of valSet.
+func aggregatedSigners(valSet istanbul.ValidatorSet, bitmap []byte) ([]common.Address, error) {
+	if len(bitmap) != (valSet.Size()+7)/8 {
+		return nil, errInvalidSignerBitmap
+	}
+	var signers []common.Address
+	for i := 0; i < len(bitmap)*8; i++ {
+		if bitmap[i/8]&(1<<uint(i%8)) == 0 {
+			continue
+		}
+		if i >= valSet.Size() {
+			return nil, errInvalidSignerBitmap
+		}
+		signers = append(signers, valSet.GetByIndex(uint64(i)).Address())
+	}
+	return signers, nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package backend
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/istanbul"
+	istanbulCore "github.com/ethereum/go-ethereum/consensus/istanbul/core"
+	"github.com/ethereum/go-ethereum/consensus/istanbul/validator"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// newBLSValidators creates n validators with BLS keys registered in a backend
+// that aggregates committed seals from block 1 on, along with their node keys.
+func newBLSValidators(n int) (*backend, istanbul.ValidatorSet, map[common.Address]*ecdsa.PrivateKey) {
+	keys := make(map[common.Address]*ecdsa.PrivateKey, n)
+	registered := make(map[common.Address]*params.BLSKey, n)
+	var addrs []common.Address
+	for i := 0; i < n; i++ {
+		key, _ := crypto.GenerateKey()
+		addr := crypto.PubkeyToAddress(key.PublicKey)
+		keys[addr] = key
+		registered[addr] = (&backend{blsKey: deriveBLSKey(key)}).BLSKey()
+		addrs = append(addrs, addr)
+	}
+	config := *istanbul.DefaultConfig
+	config.BLSBlock = big.NewInt(1)
+	sb := &backend{config: &config, logger: log.New(), blsKeys: registerBLSKeys(registered)}
+	return sb, validator.NewSet(addrs, config.ProposerPolicy), keys
+}
+
+func TestAggregatedSeal(t *testing.T) {
+	sb, valSet, keys := newBLSValidators(4)
+	header := &types.Header{Number: big.NewInt(1), MixDigest: types.IstanbulDigest}
+	header.Extra, _ = prepareExtra(header, nil)
+	proposal := types.NewBlockWithHeader(header)
+
+	// Every validator but the last one commits, the first one twice
+	var (
+		seals      [][]byte
+		committers []common.Address
+	)
+	for i := 0; i < 3; i++ {
+		addr := valSet.GetByIndex(uint64(i)).Address()
+		seal, err := (&backend{config: sb.config, blsKey: deriveBLSKey(keys[addr])}).SignCommittedSeal(proposal)
+		if err != nil || len(seal) != 96 {
+			t.Fatalf("failed to sign BLS seal: %v", err)
+		}
+		seals, committers = append(seals, seal), append(committers, addr)
+	}
+	seals, committers = append(seals, seals[0]), append(committers, committers[0])
+	// A seal of the wrong validator is dropped rather than spoiling the aggregate
+	last := valSet.GetByIndex(3).Address()
+	seals, committers = append(seals, seals[1]), append(committers, last)
+
+	if err := sb.writeAggregatedSeal(header, valSet, seals, committers); err != nil {
+		t.Fatalf("failed to aggregate seals: %v", err)
+	}
+	extra, _ := types.ExtractIstanbulExtra(header)
+	if !bytes.Equal(extra.Signers, []byte{0x07}) || len(extra.CommittedSeal) != 0 {
+		t.Fatalf("signers mismatch: have %x, want 07", extra.Signers)
+	}
+	if count, err := sb.countCommittedSeals(header.Number, header.Hash(), valSet, extra); err != nil || count != 3 {
+		t.Fatalf("aggregate seal rejected: count %d, err %v", count, err)
+	}
+	// Claiming a validator that did not sign invalidates the aggregate
+	extra.Signers = []byte{0x0f}
+	if _, err := sb.countCommittedSeals(header.Number, header.Hash(), valSet, extra); err != errInvalidCommittedSeals {
+		t.Errorf("forged signer: have %v, want %v", err, errInvalidCommittedSeals)
+	}
+	extra.Signers = []byte{0x17}
+	if _, err := sb.countCommittedSeals(header.Number, header.Hash(), valSet, extra); err != errInvalidSignerBitmap {
+		t.Errorf("signer beyond the validator set: have %v, want %v", err, errInvalidSignerBitmap)
+	}
+	extra.Signers = []byte{0x07}
+	delete(sb.blsKeys, valSet.GetByIndex(0).Address())
+	if _, err := sb.countCommittedSeals(header.Number, header.Hash(), valSet, extra); err != errUnregisteredBLSKey {
+		t.Errorf("unregistered signer: have %v, want %v", err, errUnregisteredBLSKey)
+	}
+	// Aggregate seals are only valid after the fork, and required from then on
+	if _, err := sb.countCommittedSeals(common.Big0, header.Hash(), valSet, extra); err != errInvalidCommittedSeals {
+		t.Errorf("aggregate before the fork: have %v, want %v", err, errInvalidCommittedSeals)
+	}
+	extra.Signers, extra.AggregatedSeal = nil, nil
+	if _, err := sb.countCommittedSeals(header.Number, header.Hash(), valSet, extra); err != errEmptyCommittedSeals {
+		t.Errorf("missing aggregate: have %v, want %v", err, errEmptyCommittedSeals)
+	}
+}
+
+func TestAggregatedSealQuorum(t *testing.T) {
+	sb, valSet, keys := newBLSValidators(4)
+	header := &types.Header{Number: big.NewInt(1), MixDigest: types.IstanbulDigest}
+	header.Extra, _ = prepareExtra(header, nil)
+
+	addr := valSet.GetByIndex(0).Address()
+	seal := deriveBLSKey(keys[addr]).Sign(istanbulCore.PrepareCommittedSeal(header.Hash()))
+	if err := sb.writeAggregatedSeal(header, valSet, [][]byte{seal}, []common.Address{addr}); err != errInvalidCommittedSeals {
+		t.Errorf("aggregate below F+1: have %v, want %v", err, errInvalidCommittedSeals)
+	}
+}
+
+func TestRegisterBLSKeys(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	other, _ := crypto.GenerateKey()
+	valid := (&backend{blsKey: deriveBLSKey(key)}).BLSKey()
+	// A key registered with the proof of another key is a potential rogue key
+	rogue := &params.BLSKey{PublicKey: valid.PublicKey, Proof: deriveBLSKey(other).Prove()}
+
+	registry := registerBLSKeys(map[common.Address]*params.BLSKey{
+		common.Address{1}: valid,
+		common.Address{2}: rogue,
+		common.Address{3}: {PublicKey: []byte{0x01}, Proof: valid.Proof},
+	})
+	if len(registry) != 1 || registry[common.Address{1}] == nil {
+		t.Errorf("registry mismatch: have %d keys, want the valid one", len(registry))
+	}
+}
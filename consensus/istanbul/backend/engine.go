@@ -29,9 +29,11 @@ import (
 	"github.com/ethereum/go-ethereum/consensus/istanbul"
 	istanbulCore "github.com/ethereum/go-ethereum/consensus/istanbul/core"
 	"github.com/ethereum/go-ethereum/consensus/istanbul/validator"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto/sha3"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
@@ -82,6 +84,20 @@ var (
 	errEmptyCommittedSeals = errors.New("zero committed seals")
 	// errMismatchTxhashes is returned if the TxHash in header is mismatch.
 	errMismatchTxhashes = errors.New("mismatch transcations hashes")
+	// errInvalidShard is returned if a state commitment reports an unknown shard.
+	errInvalidShard = errors.New("invalid shard")
+	// errUnknownTopology is returned if the validators of a header depend on a
+	// reference block that has not been processed yet.
+	errUnknownTopology = errors.New("unknown shard topology")
+	// errUnknownCheckpoint is returned if the reference chain holds no
+	// checkpoint of a shard block.
+	errUnknownCheckpoint = errors.New("unknown shard checkpoint")
+	// errUnregisteredBLSKey is returned if an aggregate seal includes a
+	// validator without a registered BLS key.
+	errUnregisteredBLSKey = errors.New("validator without registered BLS key")
+	// errInvalidSignerBitmap is returned if the signer bitmap of an aggregate
+	// seal does not match the validator set.
+	errInvalidSignerBitmap = errors.New("invalid signer bitmap")
 )
 var (
 	defaultDifficulty = big.NewInt(1)
@@ -111,12 +127,24 @@ func (sb *backend) Signers(header *types.Header) ([]common.Address, error) {
 	if err != nil {
 		return []common.Address{}, err
 	}
+	if len(extra.AggregatedSeal) > 0 {
+		number := header.Number.Uint64()
+		if number == 0 {
+			return []common.Address{}, nil
+		}
+		return aggregatedSigners(sb.getValidators(number-1, header.ParentHash), extra.Signers)
+	}
+	return sb.committers(header.Hash(), extra.CommittedSeal)
+}
 
+// committers retrieves the addresses that put the committed seals on the
+// block with the given hash.
+func (sb *backend) committers(hash common.Hash, seals [][]byte) ([]common.Address, error) {
 	var addrs []common.Address
-	proposalSeal := istanbulCore.PrepareCommittedSeal(header.Hash())
+	proposalSeal := istanbulCore.PrepareCommittedSeal(hash)
 
 	// 1. Get committed seals from current header
-	for _, seal := range extra.CommittedSeal {
+	for _, seal := range seals {
 		// 2. Get the original address by seal and parent block hash
 		addr, err := istanbul.GetSignatureAddress(proposalSeal, seal)
 		if err != nil {
@@ -155,7 +183,7 @@ func (sb *backend) verifyHeader(chain consensus.ChainReader, header *types.Heade
 	}
 
 	// Ensure that the coinbase is valid
-	if header.Nonce != (emptyNonce) && !bytes.Equal(header.Nonce[:], nonceAuthVote) && !bytes.Equal(header.Nonce[:], nonceDropVote) {
+	if header.Nonce != (emptyNonce) && !bytes.Equal(header.Nonce[:], nonceAuthVote) && !bytes.Equal(header.Nonce[:], nonceDropVote) && !isShardMoveVote(header) {
 		return errInvalidNonce
 	}
 	// Ensure that the mix digest is zero as we don't have fork protection currently
@@ -207,14 +235,14 @@ func (sb *backend) verifyCascadingFields(chain consensus.ChainReader, header *ty
 		copy(validators[i*common.AddressLength:], validator[:])
 	}
 
-	ref := header.Shard == uint64(0) && sb.myShard > uint64(0)
-	if !ref {
-		if err := sb.verifySigner(chain, header, parents); err != nil {
-			return err
-		}
-		return sb.verifyCommittedSeals(chain, header, parents)
+	// Shard nodes only track the validators of their own shard in snapshots
+	if header.Shard == uint64(0) && sb.myShard > uint64(0) {
+		return sb.verifyRefSeals(header)
 	}
-	return nil
+	if err := sb.verifySigner(chain, header, parents); err != nil {
+		return err
+	}
+	return sb.verifyCommittedSeals(chain, header, parents)
 }
 
 // VerifyHeaders is similar to VerifyHeader, but verifies a batch of headers
@@ -292,34 +320,194 @@ func (sb *backend) verifyCommittedSeals(chain consensus.ChainReader, header *typ
 	if err != nil {
 		return err
 	}
+	validSeal, err := sb.countCommittedSeals(header.Number, header.Hash(), snap.ValSet, extra)
+	if err != nil {
+		return err
+	}
+
+	// The length of validSeal should be larger than number of faulty node + 1
+	if validSeal < sb.minCommittedSeals(header.Shard, header.Number, snap.ValSet) {
+		return errInvalidCommittedSeals
+	}
+
+	return nil
+}
+
+// countCommittedSeals returns the number of distinct validators of valSet that
+// committed the block with the given number and hash, through individual seals
+// or, after the BLS fork, through an aggregate seal.
+func (sb *backend) countCommittedSeals(number *big.Int, hash common.Hash, valSet istanbul.ValidatorSet, extra *types.IstanbulExtra) (int, error) {
+	if sb.config.IsBLS(number) {
+		return sb.verifyAggregatedSeal(hash, valSet, extra)
+	}
+	if len(extra.Signers) > 0 || len(extra.AggregatedSeal) > 0 {
+		return 0, errInvalidCommittedSeals
+	}
 	// The length of Committed seals should be larger than 0
 	if len(extra.CommittedSeal) == 0 {
-		return errEmptyCommittedSeals
+		return 0, errEmptyCommittedSeals
 	}
 
-	validators := snap.ValSet.Copy()
-	// Check whether the committed seals are generated by parent's validators
+	validators := valSet.Copy()
+	// Check whether the committed seals are generated by the validators
 	validSeal := 0
-	committers, err := sb.Signers(header)
+	committers, err := sb.committers(hash, extra.CommittedSeal)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	for _, addr := range committers {
 		if validators.RemoveValidator(addr) {
 			validSeal++
 			continue
 		}
-		return errInvalidCommittedSeals
+		return 0, errInvalidCommittedSeals
 	}
+	return validSeal, nil
+}
 
-	// The length of validSeal should be larger than number of faulty node + 1
-	if validSeal <= snap.ValSet.F() {
-		return errInvalidCommittedSeals
+// shardValidators returns the genesis validators assigned to shard
+func (sb *backend) shardValidators(shard uint64) []common.Address {
+	return sb.shards[shard]
+}
+
+// isShardMoveVote returns whether a reference header votes on moving the
+// validator in its coinbase to another shard.
+func isShardMoveVote(header *types.Header) bool {
+	_, ok := types.DecodeShardMoveNonce(header.Nonce)
+	return ok && header.Shard == uint64(0)
+}
+
+// refChainDB returns the database of the reference chain, which shard nodes
+// keep apart from their own chain.
+func (sb *backend) refChainDB() ethdb.Database {
+	if sb.myShard > uint64(0) {
+		return sb.refdb
+	}
+	return sb.db
+}
+
+// shardTopology returns the validator assignment recorded after the reference
+// block number, or nil if the reference chain predates tracking reassignments.
+func (sb *backend) shardTopology(number uint64) (*types.ShardTopology, error) {
+	db := sb.refChainDB()
+	if db == nil {
+		return nil, nil
+	}
+	hash := rawdb.ReadCanonicalHash(db, number)
+	if topology := rawdb.ReadShardTopology(db, hash, number); topology != nil {
+		return topology, nil
+	}
+	if head := rawdb.ReadHeaderNumber(db, rawdb.ReadHeadBlockHash(db)); head == nil || *head < number {
+		return nil, errUnknownTopology
+	}
+	return nil, nil
+}
+
+// assignment returns the validator assignment deciding who seals header. It is
+// taken at the last epoch boundary of the reference block the header builds on,
+// so reassignments only take effect once that boundary has been processed.
+func (sb *backend) assignment(header *types.Header) (*types.ShardTopology, error) {
+	var refNum uint64
+	switch {
+	case header.Shard == uint64(0):
+		refNum = header.Number.Uint64() - 1
+	case header.RefNumber != nil:
+		refNum = header.RefNumber.Uint64()
+	}
+	return sb.assignmentAt(refNum)
+}
+
+// assignmentAt returns the validator assignment in effect for the blocks
+// building on reference block refNum.
+func (sb *backend) assignmentAt(refNum uint64) (*types.ShardTopology, error) {
+	if sb.config.Epoch > 0 {
+		refNum -= refNum % sb.config.Epoch
+	}
+	return sb.shardTopology(refNum)
+}
+
+// VerifyStateCommit checks whether a shard header reported to the reference
+// chain is committed by enough of the validators of that shard.
+func (sb *backend) VerifyStateCommit(chain consensus.ChainReader, header *types.Header) error {
+	if header.Shard == uint64(0) || header.Shard >= sb.numShard {
+		return errInvalidShard
+	}
+	extra, err := types.ExtractIstanbulExtra(header)
+	if err != nil {
+		return err
 	}
+	var refNum uint64
+	if header.RefNumber != nil {
+		refNum = header.RefNumber.Uint64()
+	}
+	return sb.verifyShardSeals(header.Shard, header.Number.Uint64(), refNum, header.Hash(), extra)
+}
 
+// verifyShardSeals checks whether the committed seals in extra on the block of
+// shard with the given number and hash, processing reference block refNum,
+// come from enough distinct validators of the shard.
+func (sb *backend) verifyShardSeals(shard, number, refNum uint64, hash common.Hash, extra *types.IstanbulExtra) error {
+	valSet, err := sb.assignedValidators(shard, refNum)
+	if err != nil {
+		return err
+	}
+	num := new(big.Int).SetUint64(number)
+	validSeal, err := sb.countCommittedSeals(num, hash, valSet, extra)
+	if err != nil {
+		return err
+	}
+	if validSeal < sb.minCommittedSeals(shard, num, valSet) {
+		return errInvalidCommittedSeals
+	}
 	return nil
 }
 
+// verifyRefSeals checks whether a reference header followed by a shard node is
+// proposed and committed by the reference validators assigned after its parent.
+func (sb *backend) verifyRefSeals(header *types.Header) error {
+	number := header.Number.Uint64()
+	valSet, err := sb.assignedValidators(0, number-1)
+	if err != nil {
+		return err
+	}
+	signer, err := ecrecover(header)
+	if err != nil {
+		return err
+	}
+	if _, v := valSet.GetByAddress(signer); v == nil {
+		return errUnauthorized
+	}
+	extra, err := types.ExtractIstanbulExtra(header)
+	if err != nil {
+		return err
+	}
+	return sb.verifyShardSeals(0, number, number-1, header.Hash(), extra)
+}
+
+// assignedValidators returns the validators of shard assigned for the blocks
+// building on reference block refNum.
+func (sb *backend) assignedValidators(shard, refNum uint64) (istanbul.ValidatorSet, error) {
+	shardValidators := sb.shardValidators(shard)
+	topology, err := sb.assignmentAt(refNum)
+	if err != nil {
+		return nil, err
+	}
+	if topology != nil {
+		shardValidators = topology.Validators(shard)
+	}
+	return validator.NewSet(shardValidators, sb.config.ProposerPolicy), nil
+}
+
+// minCommittedSeals returns the number of committed seals the header of shard
+// with the given number needs: more than F, or a 2F+1 quorum on shards running
+// full PBFT.
+func (sb *backend) minCommittedSeals(shard uint64, number *big.Int, valSet istanbul.ValidatorSet) int {
+	if shard > uint64(0) && sb.config.ThreePhase(shard, number) {
+		return 2*valSet.F() + 1
+	}
+	return valSet.F() + 1
+}
+
 // VerifySeal checks whether the crypto seal on a header is valid according to
 // the consensus rules of the given engine.
 func (sb *backend) VerifySeal(chain consensus.ChainReader, header *types.Header) error {
@@ -333,11 +521,10 @@ func (sb *backend) VerifySeal(chain consensus.ChainReader, header *types.Header)
 	if header.Difficulty.Cmp(defaultDifficulty) != 0 {
 		return errInvalidDifficulty
 	}
-	ref := header.Shard == uint64(0) && sb.myShard > uint64(0)
-	if !ref {
-		return sb.verifySigner(chain, header, nil)
+	if header.Shard == uint64(0) && sb.myShard > uint64(0) {
+		return sb.verifyRefSeals(header)
 	}
-	return nil
+	return sb.verifySigner(chain, header, nil)
 }
 
 // Prepare initializes the consensus fields of a block header according to the
@@ -373,16 +560,38 @@ func (sb *backend) Prepare(chain consensus.ChainReader, header *types.Header) er
 			authorizes = append(authorizes, authorize)
 		}
 	}
+	// reference validators also vote on moving validators between shards
+	var (
+		moves  []common.Address
+		shards []uint64
+	)
+	if header.Shard == uint64(0) && len(sb.moves) > 0 {
+		topology, err := sb.shardTopology(number - 1)
+		if topology == nil || err != nil {
+			topology = types.NewShardTopology(sb.numShard, sb.shards)
+		}
+		for address, shard := range sb.moves {
+			if current, ok := topology.ShardOf(address); ok && current != shard {
+				moves = append(moves, address)
+				shards = append(shards, shard)
+			}
+		}
+	}
 	sb.candidatesLock.RUnlock()
 
 	// pick one of the candidates randomly
-	if len(addresses) > 0 {
-		index := rand.Intn(len(addresses))
+	if total := len(addresses) + len(moves); total > 0 {
+		index := rand.Intn(total)
 		// add validator voting in coinbase
-		header.Coinbase = addresses[index]
-		if authorizes[index] {
+		switch {
+		case index >= len(addresses):
+			header.Coinbase = moves[index-len(addresses)]
+			header.Nonce = types.EncodeShardMoveNonce(shards[index-len(addresses)])
+		case authorizes[index]:
+			header.Coinbase = addresses[index]
 			copy(header.Nonce[:], nonceAuthVote)
-		} else {
+		default:
+			header.Coinbase = addresses[index]
 			copy(header.Nonce[:], nonceDropVote)
 		}
 	}
@@ -568,7 +777,7 @@ func (sb *backend) snapshot(chain consensus.ChainReader, number uint64, hash com
 		}
 		// If an on-disk checkpoint snapshot can be found, use that
 		if number%checkpointInterval == 0 {
-			if s, err := loadSnapshot(sb.config.Epoch, sb.db, hash); err == nil {
+			if s, err := loadSnapshot(sb.config, sb.db, hash); err == nil {
 				log.Trace("Loaded voting snapshot form disk", "number", number, "hash", hash)
 				snap = s
 				break
@@ -580,25 +789,7 @@ func (sb *backend) snapshot(chain consensus.ChainReader, number uint64, hash com
 			if err := sb.VerifyHeader(chain, genesis, false); err != nil {
 				return nil, err
 			}
-			istanbulExtra, err := types.ExtractIstanbulExtra(genesis)
-			sb.core.SetAllValidators(istanbulExtra.Validators)
-
-			totalValidators := uint64(len(istanbulExtra.Validators))
-			refValidators := sb.refNodes
-			validatorsPerShard := (totalValidators - refValidators) / (sb.numShard - 1)
-
-			lowIndex := uint64(0)
-			highIndex := refValidators
-			if sb.myShard > uint64(0) {
-				lowIndex = refValidators + (sb.myShard-1)*validatorsPerShard
-				highIndex = lowIndex + validatorsPerShard
-			}
-			istanbulExtra.Validators = istanbulExtra.Validators[lowIndex:highIndex]
-
-			if err != nil {
-				return nil, err
-			}
-			snap = newSnapshot(sb.config.Epoch, 0, genesis.Hash(), validator.NewSet(istanbulExtra.Validators, sb.config.ProposerPolicy))
+			snap = newSnapshot(sb.config, 0, genesis.Hash(), validator.NewSet(sb.shardValidators(sb.myShard), sb.config.ProposerPolicy))
 			if err := snap.store(sb.db); err != nil {
 				return nil, err
 			}
@@ -634,7 +825,7 @@ func (sb *backend) snapshot(chain consensus.ChainReader, number uint64, hash com
 		ref = headers[0].Shard == uint64(0) && sb.myShard > uint64(0)
 	}
 
-	snap, err := snap.apply(ref, headers)
+	snap, err := snap.apply(ref, headers, sb.assignment)
 	if err != nil {
 		return nil, err
 	}
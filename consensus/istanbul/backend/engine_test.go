@@ -21,6 +21,7 @@ import (
 	"crypto/ecdsa"
 	"math/big"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -28,7 +29,10 @@ import (
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/consensus/istanbul"
+	istanbulCore "github.com/ethereum/go-ethereum/consensus/istanbul/core"
+	"github.com/ethereum/go-ethereum/consensus/istanbul/validator"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -45,9 +49,13 @@ func newBlockChain(n int) (*core.BlockChain, *backend) {
 	memDB := ethdb.NewMemDatabase()
 	config := istanbul.DefaultConfig
 	// Use the first key as private key
-	b, _ := New(config, nodeKeys[0], memDB).(*backend)
+	addrs := make([]common.Address, n)
+	for i, key := range nodeKeys {
+		addrs[i] = crypto.PubkeyToAddress(key.PublicKey)
+	}
+	b, _ := New(config, nodeKeys[0], 0, 1, map[uint64][]common.Address{0: addrs}, memDB, memDB).(*backend)
 	genesis.MustCommit(memDB)
-	blockchain, err := core.NewBlockChain(memDB, nil, genesis.Config, b, vm.Config{}, nil)
+	blockchain, err := newTestBlockChain(memDB, genesis.Config, b)
 	if err != nil {
 		panic(err)
 	}
@@ -73,6 +81,13 @@ func newBlockChain(n int) (*core.BlockChain, *backend) {
 	return blockchain, b
 }
 
+// newTestBlockChain creates the reference chain of a single shard network on db.
+func newTestBlockChain(db ethdb.Database, config *params.ChainConfig, engine consensus.Engine) (*core.BlockChain, error) {
+	return core.NewBlockChain(db, nil, config, engine, vm.Config{}, nil, false, 0, 1,
+		make(map[uint64]*types.Commitments), make(map[uint64]types.CrossShardTxs), &types.Commitment{},
+		make(map[uint64]*types.DataCache), sync.RWMutex{}, types.NewRWLock(), make(map[uint64]*types.Commitment), make(map[uint64]uint64))
+}
+
 func getGenesisAndKeys(n int) (*core.Genesis, []*ecdsa.PrivateKey) {
 	// Setup validators
 	var nodeKeys = make([]*ecdsa.PrivateKey, n)
@@ -207,7 +222,7 @@ func TestSealCommittedOtherHash(t *testing.T) {
 			if _, ok := ev.Data.(istanbul.RequestEvent); !ok {
 				t.Errorf("unexpected event comes: %v", reflect.TypeOf(ev.Data))
 			}
-			if err := engine.Commit(otherBlock, [][]byte{expectedCommittedSeal}); err != nil {
+			if err := engine.Commit(otherBlock, [][]byte{expectedCommittedSeal}, []common.Address{engine.Address()}); err != nil {
 				t.Error(err.Error())
 			}
 		}
@@ -363,6 +378,96 @@ func TestVerifySeal(t *testing.T) {
 	}
 }
 
+func TestVerifyRefSeals(t *testing.T) {
+	// A shard node follows a reference chain of four validators by headers
+	refKeys := make([]*ecdsa.PrivateKey, 4)
+	refAddrs := make([]common.Address, 4)
+	for i := range refKeys {
+		refKeys[i], _ = crypto.GenerateKey()
+		refAddrs[i] = crypto.PubkeyToAddress(refKeys[i].PublicKey)
+	}
+	shardKey, _ := crypto.GenerateKey()
+	shards := map[uint64][]common.Address{0: refAddrs, 1: {crypto.PubkeyToAddress(shardKey.PublicKey)}}
+
+	refdb := ethdb.NewMemDatabase()
+	genesis := &types.Header{Number: common.Big0, Difficulty: defaultDifficulty, MixDigest: types.IstanbulDigest}
+	rawdb.WriteHeader(refdb, genesis)
+	rawdb.WriteCanonicalHash(refdb, genesis.Hash(), 0)
+	rawdb.WriteHeadBlockHash(refdb, genesis.Hash())
+	engine := New(istanbul.DefaultConfig, shardKey, 1, 2, shards, ethdb.NewMemDatabase(), refdb).(*backend)
+
+	// sealRef creates a reference header proposed by proposer and committed by committers
+	sealRef := func(time int64, proposer *ecdsa.PrivateKey, committers ...*ecdsa.PrivateKey) *types.Header {
+		header := &types.Header{
+			ParentHash: genesis.Hash(),
+			Number:     common.Big1,
+			Time:       big.NewInt(time),
+			Difficulty: defaultDifficulty,
+			MixDigest:  types.IstanbulDigest,
+		}
+		header.Extra, _ = prepareExtra(header, nil)
+		seal, _ := crypto.Sign(crypto.Keccak256(sigHash(header).Bytes()), proposer)
+		writeSeal(header, seal)
+		var seals [][]byte
+		for _, key := range committers {
+			seal, _ := crypto.Sign(crypto.Keccak256(istanbulCore.PrepareCommittedSeal(header.Hash())), key)
+			seals = append(seals, seal)
+		}
+		if len(seals) > 0 {
+			writeCommittedSeals(header, seals)
+		}
+		return header
+	}
+	tests := []struct {
+		header *types.Header
+		err    error
+	}{
+		{sealRef(1, refKeys[0]), errEmptyCommittedSeals},                              // unsealed
+		{sealRef(2, refKeys[0], refKeys[0]), errInvalidCommittedSeals},                // below F+1
+		{sealRef(3, refKeys[0], refKeys[1], shardKey), errInvalidCommittedSeals},      // seal of a shard validator
+		{sealRef(4, shardKey, refKeys[0], refKeys[1]), errUnauthorized},               // proposed by a shard validator
+		{sealRef(5, refKeys[0], refKeys[0], refKeys[1]), nil},                         // committed by F+1
+		{sealRef(6, refKeys[1], refKeys[0], refKeys[1], refKeys[2], refKeys[3]), nil}, // committed by all
+	}
+	for i, tt := range tests {
+		if err := engine.VerifySeal(nil, tt.header); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+func TestMinCommittedSeals(t *testing.T) {
+	config := *istanbul.DefaultConfig
+	config.ShardConsensus = map[uint64]istanbul.ShardConsensus{1: istanbul.FullPBFT, 2: istanbul.FastPath, 4: istanbul.FullPBFT}
+	config.ShardConsensusBlock = map[uint64]*big.Int{4: big.NewInt(10)}
+	sb := &backend{config: &config}
+
+	addrs := make([]common.Address, 4)
+	for i := range addrs {
+		addrs[i] = common.BytesToAddress([]byte{byte(i + 1)})
+	}
+	valSet := validator.NewSet(addrs, config.ProposerPolicy)
+
+	// Shards agree on their blocks in their own mode, next to each other
+	tests := []struct {
+		shard  uint64
+		number int64
+		seals  int
+	}{
+		{0, 1, 2},
+		{1, 1, 3},
+		{2, 1, 2},
+		{3, 1, 2},
+		{4, 9, 2}, // before the shard switches to full PBFT
+		{4, 10, 3},
+	}
+	for i, tt := range tests {
+		if seals := sb.minCommittedSeals(tt.shard, big.NewInt(tt.number), valSet); seals != tt.seals {
+			t.Errorf("test %d: committed seals of shard %d: have %d, want %d", i, tt.shard, seals, tt.seals)
+		}
+	}
+}
+
 func TestVerifyHeaders(t *testing.T) {
 	chain, engine := newBlockChain(1)
 	genesis := chain.Genesis()
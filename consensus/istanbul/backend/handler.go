@@ -47,8 +47,8 @@ var (
 func (sb *backend) Protocol() consensus.Protocol {
 	return consensus.Protocol{
 		Name:     "istanbul",
-		Versions: []uint{64},
-		Lengths:  []uint64{18},
+		Versions: []uint{65, 64},
+		Lengths:  []uint64{20, 18},
 	}
 }
 
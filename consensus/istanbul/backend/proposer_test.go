@@ -0,0 +1,71 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package backend
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/istanbul"
+	"github.com/ethereum/go-ethereum/consensus/istanbul/validator"
+)
+
+func TestReputationOffenses(t *testing.T) {
+	addrs := []common.Address{{1}, {2}, {3}, {4}}
+	config := &istanbul.Config{Epoch: 30000, ProposerPolicy: istanbul.Reputation, ReputationWindow: 2}
+	snap := newSnapshot(config, 0, common.Hash{}, validator.NewSet(addrs, config.ProposerPolicy))
+	snap.Proposer = addrs[0]
+
+	// Block 1 was proposed in round 1, so the proposer of round 0 timed out
+	snap.recordOffenses(1, addrs[2])
+	if len(snap.Offenses) != 1 || snap.Offenses[addrs[1]] != 1 {
+		t.Fatalf("offenses mismatch: have %v, want %x at 1", snap.Offenses, addrs[1])
+	}
+	snap.Proposer, snap.Number = addrs[2], 1
+	snap.resetProposers()
+
+	// The offender is skipped until the window passes
+	for number, penalized := range map[uint64]bool{2: true, 3: true, 4: false} {
+		if have := snap.proposerState(number).Penalized[addrs[1]]; have != penalized {
+			t.Errorf("block %d: penalized mismatch: have %v, want %v", number, have, penalized)
+		}
+	}
+	snap.ValSet.CalcProposer(addrs[0], 0)
+	if proposer := snap.ValSet.GetProposer().Address(); proposer != addrs[2] {
+		t.Errorf("proposer mismatch: have %x, want %x", proposer, addrs[2])
+	}
+
+	// Offenses survive a database round trip
+	blob, err := json.Marshal(snap)
+	if err != nil {
+		t.Fatalf("failed to encode snapshot: %v", err)
+	}
+	loaded := new(Snapshot)
+	if err := json.Unmarshal(blob, loaded); err != nil {
+		t.Fatalf("failed to decode snapshot: %v", err)
+	}
+	if loaded.Offenses[addrs[1]] != 1 || loaded.Proposer != addrs[2] {
+		t.Errorf("proposer data mismatch: have %v %x", loaded.Offenses, loaded.Proposer)
+	}
+
+	// Blocks proposed in round 0 prune offenses out of the window
+	snap.recordOffenses(4, addrs[3])
+	if len(snap.Offenses) != 0 {
+		t.Errorf("stale offenses kept: %v", snap.Offenses)
+	}
+}
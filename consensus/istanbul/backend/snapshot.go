@@ -49,31 +49,42 @@ type Tally struct {
 
 // Snapshot is the state of the authorization voting at a given point in time.
 type Snapshot struct {
-	Epoch uint64 // The number of blocks after which to checkpoint and reset the pending votes
+	Epoch  uint64 // The number of blocks after which to checkpoint and reset the pending votes
+	Window uint64 // The number of blocks a proposer causing a round change is skipped for
 
 	Number uint64                   // Block number where the snapshot was created
 	Hash   common.Hash              // Block hash where the snapshot was created
 	Votes  []*Vote                  // List of votes cast in chronological order
 	Tally  map[common.Address]Tally // Current vote tally to avoid recalculating
 	ValSet istanbul.ValidatorSet    // Set of authorized validators at this moment
+
+	Topology uint64 // Reference block at which the shard assignment of ValSet took effect
+
+	Weights  map[common.Address]uint64 // Proposer weights of the validators
+	Offenses map[common.Address]uint64 // Last block in which each validator's round ended in a round change
+	Proposer common.Address            // Author of the block the snapshot was created at
 }
 
 // newSnapshot create a new snapshot with the specified startup parameters. This
 // method does not initialize the set of recent validators, so only ever use if for
 // the genesis block.
-func newSnapshot(epoch uint64, number uint64, hash common.Hash, valSet istanbul.ValidatorSet) *Snapshot {
+func newSnapshot(config *istanbul.Config, number uint64, hash common.Hash, valSet istanbul.ValidatorSet) *Snapshot {
 	snap := &Snapshot{
-		Epoch:  epoch,
-		Number: number,
-		Hash:   hash,
-		ValSet: valSet,
-		Tally:  make(map[common.Address]Tally),
+		Epoch:    config.Epoch,
+		Window:   config.ReputationWindow,
+		Number:   number,
+		Hash:     hash,
+		ValSet:   valSet,
+		Tally:    make(map[common.Address]Tally),
+		Weights:  config.Weights,
+		Offenses: make(map[common.Address]uint64),
 	}
+	snap.resetProposers()
 	return snap
 }
 
 // loadSnapshot loads an existing snapshot from the database.
-func loadSnapshot(epoch uint64, db ethdb.Database, hash common.Hash) (*Snapshot, error) {
+func loadSnapshot(config *istanbul.Config, db ethdb.Database, hash common.Hash) (*Snapshot, error) {
 	blob, err := db.Get(append([]byte(dbKeySnapshotPrefix), hash[:]...))
 	if err != nil {
 		return nil, err
@@ -82,7 +93,9 @@ func loadSnapshot(epoch uint64, db ethdb.Database, hash common.Hash) (*Snapshot,
 	if err := json.Unmarshal(blob, snap); err != nil {
 		return nil, err
 	}
-	snap.Epoch = epoch
+	snap.Epoch = config.Epoch
+	snap.Window = config.ReputationWindow
+	snap.resetProposers()
 
 	return snap, nil
 }
@@ -99,17 +112,25 @@ func (s *Snapshot) store(db ethdb.Database) error {
 // copy creates a deep copy of the snapshot, though not the individual votes.
 func (s *Snapshot) copy() *Snapshot {
 	cpy := &Snapshot{
-		Epoch:  s.Epoch,
-		Number: s.Number,
-		Hash:   s.Hash,
-		ValSet: s.ValSet.Copy(),
-		Votes:  make([]*Vote, len(s.Votes)),
-		Tally:  make(map[common.Address]Tally),
+		Epoch:    s.Epoch,
+		Window:   s.Window,
+		Number:   s.Number,
+		Hash:     s.Hash,
+		ValSet:   s.ValSet.Copy(),
+		Votes:    make([]*Vote, len(s.Votes)),
+		Tally:    make(map[common.Address]Tally),
+		Topology: s.Topology,
+		Weights:  s.Weights,
+		Offenses: make(map[common.Address]uint64, len(s.Offenses)),
+		Proposer: s.Proposer,
 	}
 
 	for address, tally := range s.Tally {
 		cpy.Tally[address] = tally
 	}
+	for address, number := range s.Offenses {
+		cpy.Offenses[address] = number
+	}
 	copy(cpy.Votes, s.Votes)
 
 	return cpy
@@ -159,8 +180,9 @@ func (s *Snapshot) uncast(address common.Address, authorize bool) bool {
 }
 
 // apply creates a new authorization snapshot by applying the given headers to
-// the original one.
-func (s *Snapshot) apply(ref bool, headers []*types.Header) (*Snapshot, error) {
+// the original one. The assignment callback returns the shard topology in force
+// for a header, replacing the validators whenever a reassignment took effect.
+func (s *Snapshot) apply(ref bool, headers []*types.Header, assignment func(*types.Header) (*types.ShardTopology, error)) (*Snapshot, error) {
 	// Allow passing in no headers for cleaner code
 	if len(headers) == 0 {
 		return s, nil
@@ -184,6 +206,19 @@ func (s *Snapshot) apply(ref bool, headers []*types.Header) (*Snapshot, error) {
 			snap.Votes = nil
 			snap.Tally = make(map[common.Address]Tally)
 		}
+		// Switch to the validators of a new shard assignment, dropping their votes
+		if !ref {
+			topology, err := assignment(header)
+			if err != nil {
+				return nil, err
+			}
+			if topology != nil && topology.Since != snap.Topology {
+				snap.ValSet = validator.NewSet(topology.Validators(header.Shard), snap.ValSet.Policy())
+				snap.Topology = topology.Since
+				snap.Votes = nil
+				snap.Tally = make(map[common.Address]Tally)
+			}
+		}
 		// Resolve the authorization key and check against validators
 		validator, err := ecrecover(header)
 		if err != nil {
@@ -193,6 +228,15 @@ func (s *Snapshot) apply(ref bool, headers []*types.Header) (*Snapshot, error) {
 			if _, v := snap.ValSet.GetByAddress(validator); v == nil {
 				return nil, errUnauthorized
 			}
+			if snap.ValSet.Policy() == istanbul.Reputation {
+				snap.recordOffenses(number, validator)
+			}
+		}
+		snap.Proposer = validator
+
+		// Shard moves are tallied by the reference chain itself
+		if isShardMoveVote(header) {
+			continue
 		}
 
 		// Header authorized, discard any previous votes from the validator
@@ -256,10 +300,56 @@ func (s *Snapshot) apply(ref bool, headers []*types.Header) (*Snapshot, error) {
 	}
 	snap.Number += uint64(len(headers))
 	snap.Hash = headers[len(headers)-1].Hash()
+	snap.resetProposers()
 
 	return snap, nil
 }
 
+// proposerState returns the chain data selecting the proposer of block number,
+// penalizing the validators that caused a round change within the window.
+func (s *Snapshot) proposerState(number uint64) *istanbul.ProposerState {
+	penalized := make(map[common.Address]bool)
+	for address, offense := range s.Offenses {
+		if offense+s.Window >= number {
+			penalized[address] = true
+		}
+	}
+	return &istanbul.ProposerState{Sequence: number, Weights: s.Weights, Penalized: penalized}
+}
+
+// resetProposers rebuilds the validator set to select the proposer of the
+// block following the snapshot.
+func (s *Snapshot) resetProposers() {
+	s.ValSet = validator.NewSetWithState(s.validators(), s.ValSet.Policy(), s.proposerState(s.Number+1))
+}
+
+// recordOffenses records the validators whose turn to propose block number
+// ended in a round change before its author got to propose it, and forgets
+// the offenses that fell out of the window.
+func (s *Snapshot) recordOffenses(number uint64, author common.Address) {
+	for address, offense := range s.Offenses {
+		if offense+s.Window < number {
+			delete(s.Offenses, address)
+		}
+	}
+	valSet := validator.NewSetWithState(s.validators(), s.ValSet.Policy(), s.proposerState(number))
+	var failed []common.Address
+	for round := uint64(0); round < uint64(valSet.Size()); round++ {
+		valSet.CalcProposer(s.Proposer, round)
+		proposer := valSet.GetProposer()
+		if proposer == nil {
+			return
+		}
+		if proposer.Address() == author {
+			for _, address := range failed {
+				s.Offenses[address] = number
+			}
+			return
+		}
+		failed = append(failed, proposer.Address())
+	}
+}
+
 // validators retrieves the list of authorized validators in ascending order.
 func (s *Snapshot) validators() []common.Address {
 	validators := make([]common.Address, 0, s.ValSet.Size())
@@ -284,8 +374,14 @@ type snapshotJSON struct {
 	Tally  map[common.Address]Tally `json:"tally"`
 
 	// for validator set
+	Topology   uint64                  `json:"topology"`
 	Validators []common.Address        `json:"validators"`
 	Policy     istanbul.ProposerPolicy `json:"policy"`
+
+	// for proposer selection
+	Weights  map[common.Address]uint64 `json:"weights,omitempty"`
+	Offenses map[common.Address]uint64 `json:"offenses,omitempty"`
+	Proposer common.Address            `json:"proposer"`
 }
 
 func (s *Snapshot) toJSONStruct() *snapshotJSON {
@@ -295,8 +391,12 @@ func (s *Snapshot) toJSONStruct() *snapshotJSON {
 		Hash:       s.Hash,
 		Votes:      s.Votes,
 		Tally:      s.Tally,
+		Topology:   s.Topology,
 		Validators: s.validators(),
 		Policy:     s.ValSet.Policy(),
+		Weights:    s.Weights,
+		Offenses:   s.Offenses,
+		Proposer:   s.Proposer,
 	}
 }
 
@@ -312,7 +412,14 @@ func (s *Snapshot) UnmarshalJSON(b []byte) error {
 	s.Hash = j.Hash
 	s.Votes = j.Votes
 	s.Tally = j.Tally
+	s.Topology = j.Topology
 	s.ValSet = validator.NewSet(j.Validators, j.Policy)
+	s.Weights = j.Weights
+	s.Offenses = j.Offenses
+	if s.Offenses == nil {
+		s.Offenses = make(map[common.Address]uint64)
+	}
+	s.Proposer = j.Proposer
 	return nil
 }
 
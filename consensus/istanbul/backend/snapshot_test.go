@@ -27,8 +27,8 @@ import (
 	"github.com/ethereum/go-ethereum/consensus/istanbul"
 	"github.com/ethereum/go-ethereum/consensus/istanbul/validator"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 )
@@ -342,12 +342,12 @@ func TestVoting(t *testing.T) {
 		db := ethdb.NewMemDatabase()
 		genesis.Commit(db)
 
-		config := istanbul.DefaultConfig
+		config := *istanbul.DefaultConfig
 		if tt.epoch != 0 {
 			config.Epoch = tt.epoch
 		}
-		engine := New(config, accounts.accounts[tt.validators[0]], db).(*backend)
-		chain, err := core.NewBlockChain(db, nil, genesis.Config, engine, vm.Config{}, nil)
+		engine := New(&config, accounts.accounts[tt.validators[0]], 0, 1, map[uint64][]common.Address{0: validators}, db, db).(*backend)
+		chain, err := newTestBlockChain(db, genesis.Config, engine)
 
 		// Assemble a chain of headers from the cast votes
 		headers := make([]*types.Header, len(tt.votes))
@@ -370,6 +370,14 @@ func TestVoting(t *testing.T) {
 			copy(headers[j].Extra, genesis.ExtraData)
 			accounts.sign(headers[j], vote.validator)
 		}
+		// Shard assignments at epoch checkpoints are looked up on the reference
+		// chain, so store the headers as its canonical chain
+		for _, header := range headers {
+			rawdb.WriteHeader(db, header)
+			rawdb.WriteCanonicalHash(db, header.Hash(), header.Number.Uint64())
+		}
+		rawdb.WriteHeadBlockHash(db, headers[len(headers)-1].Hash())
+
 		// Pass all the headers through clique and ensure tallying succeeds
 		head := headers[len(headers)-1]
 
@@ -433,7 +441,7 @@ func TestSaveAndLoad(t *testing.T) {
 		t.Errorf("store snapshot failed: %v", err)
 	}
 
-	snap1, err := loadSnapshot(snap.Epoch, db, snap.Hash)
+	snap1, err := loadSnapshot(&istanbul.Config{Epoch: snap.Epoch}, db, snap.Hash)
 	if err != nil {
 		t.Errorf("load snapshot failed: %v", err)
 	}
@@ -16,13 +16,37 @@
 
 package istanbul
 
-import "math/big"
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+)
 
 type ProposerPolicy uint64
 
 const (
 	RoundRobin ProposerPolicy = iota
 	Sticky
+	// Weighted draws the proposer of every block in proportion to the
+	// validator weights, moving on round robin after a round change.
+	Weighted
+	// Reputation rotates round robin, skipping validators whose round ended
+	// in a round change within the last ReputationWindow blocks.
+	Reputation
+)
+
+// ShardConsensus selects how shard committees agree on their blocks. The
+// reference chain always runs the full protocol.
+type ShardConsensus uint64
+
+const (
+	// FastPath accepts a proposal without the PREPARE phase and commits it on
+	// F+1 votes, which only tolerates crash faults.
+	FastPath ShardConsensus = iota
+	// FullPBFT runs the PREPARE phase with locking and 2F+1 quorums on shards
+	// as well, which tolerates an equivocating proposer.
+	FullPBFT
 )
 
 type Config struct {
@@ -31,6 +55,33 @@ type Config struct {
 	ProposerPolicy ProposerPolicy `toml:",omitempty"` // The policy for proposer selection
 	Epoch          uint64         `toml:",omitempty"` // The number of blocks after which to checkpoint and reset the pending votes
 	Ceil2Nby3Block *big.Int       `toml:",omitempty"` // Number of confirmations required to move from one state to next [2F + 1 to Ceil(2N/3)]
+	BLSBlock       *big.Int       `toml:",omitempty"` // Block from which committed seals are aggregated BLS signatures
+
+	ReputationWindow uint64 `toml:",omitempty"` // Number of blocks a proposer causing a round change is skipped for
+
+	ShardConsensus      map[uint64]ShardConsensus         `toml:"-"` // How the committee of every shard agrees on its blocks (missing = FastPath)
+	ShardConsensusBlock map[uint64]*big.Int               `toml:"-"` // Block from which a shard committee runs full PBFT (missing = genesis)
+	BLSKeys             map[common.Address]*params.BLSKey `toml:"-"` // BLS keys registered by the validators
+	Weights             map[common.Address]uint64         `toml:"-"` // Proposer weights of the validators
+}
+
+// IsBLS returns whether the committed seals of block number are BLS
+// signatures, aggregated into a single seal.
+func (c *Config) IsBLS(number *big.Int) bool {
+	return c.BLSBlock != nil && number != nil && c.BLSBlock.Cmp(number) <= 0
+}
+
+// ThreePhase returns whether the committee of shard runs all three IBFT phases
+// with locking and Byzantine quorums on block number.
+func (c *Config) ThreePhase(shard uint64, number *big.Int) bool {
+	if shard == uint64(0) {
+		return true
+	}
+	if c.ShardConsensus[shard] != FullPBFT {
+		return false
+	}
+	block := c.ShardConsensusBlock[shard]
+	return block == nil || (number != nil && block.Cmp(number) <= 0)
 }
 
 var DefaultConfig = &Config{
@@ -39,4 +90,6 @@ var DefaultConfig = &Config{
 	ProposerPolicy: RoundRobin,
 	Epoch:          30000,
 	Ceil2Nby3Block: big.NewInt(0),
+
+	ReputationWindow: 10,
 }
@@ -24,6 +24,10 @@ import (
 )
 
 func (c *core) sendCommit() {
+	if err := c.storeRoundState(); err != nil {
+		c.logger.Error("Failed to persist round state", "state", c.state, "err", err)
+		return
+	}
 	sub := c.current.Subject()
 	c.broadcastCommit(sub)
 }
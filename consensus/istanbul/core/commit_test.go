@@ -219,6 +219,12 @@ OUTER:
 		if signedCount <= r0.valSet.F() {
 			t.Errorf("the expected signed count should be larger than %v, but got %v", r0.valSet.F(), signedCount)
 		}
+		// every seal is delivered along with the validator that put it
+		for i, addr := range v0.committedMsgs[0].committers {
+			if !bytes.Equal(addr.Bytes(), committedSeals[i][:common.AddressLength]) {
+				t.Errorf("committer mismatch: have %x, want %x", addr, committedSeals[i][:common.AddressLength])
+			}
+		}
 		if !r0.current.IsHashLocked() {
 			t.Errorf("block should be locked")
 		}
@@ -25,7 +25,6 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus/istanbul"
-	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	metrics "github.com/ethereum/go-ethereum/metrics"
@@ -33,14 +32,13 @@ import (
 )
 
 // New creates an Istanbul consensus core
-func New(backend istanbul.Backend, config *istanbul.Config, myShard, numShard, refNodes uint64) Engine {
+func New(backend istanbul.Backend, config *istanbul.Config, myShard, numShard uint64, shards map[uint64][]common.Address) Engine {
 	r := metrics.NewRegistry()
 	c := &core{
 		config:             config,
 		myShard:            myShard,
 		numShard:           numShard,
-		refNodes:           refNodes,
-		valSetAll:          make(map[uint64][]common.Address),
+		valSetAll:          shards,
 		address:            backend.Address(),
 		state:              StateAcceptRequest,
 		handlerWg:          new(sync.WaitGroup),
@@ -70,7 +68,6 @@ type core struct {
 	config   *istanbul.Config
 	myShard  uint64
 	numShard uint64
-	refNodes uint64
 	address  common.Address
 	state    State
 	logger   log.Logger
@@ -82,7 +79,8 @@ type core struct {
 	futurePreprepareTimer *time.Timer
 
 	valSet                istanbul.ValidatorSet
-	valSetAll             map[uint64][]common.Address
+	valSetAll             map[uint64][]common.Address // Validators of every shard
+	valSetAllMu           sync.RWMutex
 	waitingForRoundChange bool
 	validateFn            func([]byte, []byte) (common.Address, error)
 
@@ -107,25 +105,6 @@ type core struct {
 	consensusTimer metrics.Timer
 }
 
-func (c *core) SetAllValidators(validators []common.Address) {
-	totalValidators := uint64(len(validators))
-	// numShard := int(c.numShard)
-	// myShard := int(c.myShard)
-	refValidators := c.refNodes
-	validatorsPerShard := (totalValidators - refValidators) / (c.numShard - 1)
-
-	for i := uint64(0); i < c.numShard; i++ {
-		c.valSetAll[i] = []common.Address{}
-		start := uint64(0)
-		end := refValidators
-		if i > uint64(0) {
-			start = refValidators + (i-1)*validatorsPerShard
-			end = start + validatorsPerShard
-		}
-		c.valSetAll[i] = append(c.valSetAll[i], validators[start:end]...)
-	}
-}
-
 func (c *core) finalizeMessage(msg *message) ([]byte, error) {
 	var err error
 	// Add sender address
@@ -135,8 +114,7 @@ func (c *core) finalizeMessage(msg *message) ([]byte, error) {
 	msg.CommittedSeal = []byte{}
 	// Assign the CommittedSeal if it's a COMMIT message and proposal is not nil
 	if msg.Code == msgCommit && c.current.Proposal() != nil {
-		seal := PrepareCommittedSeal(c.current.Proposal().Hash())
-		msg.CommittedSeal, err = c.backend.Sign(seal)
+		msg.CommittedSeal, err = c.backend.SignCommittedSeal(c.current.Proposal())
 		if err != nil {
 			return nil, err
 		}
@@ -177,7 +155,10 @@ func (c *core) broadcast(shard uint64, msg *message) {
 			return
 		}
 	} else {
-		if err = c.backend.BroadcastOthers(c.valSetAll[shard], payload); err != nil {
+		c.valSetAllMu.RLock()
+		validators := c.valSetAll[shard]
+		c.valSetAllMu.RUnlock()
+		if err = c.backend.BroadcastOthers(validators, payload); err != nil {
 			logger.Error("Failed to broadcast message to", "shard", shard, "msg", msg, "err", err)
 			return
 		}
@@ -203,19 +184,27 @@ func (c *core) IsCurrentProposal(blockHash common.Hash) bool {
 	return c.current != nil && c.current.pendingRequest != nil && c.current.pendingRequest.Proposal.Hash() == blockHash
 }
 
+// SetShards implements core.Engine.SetShards
+func (c *core) SetShards(shards map[uint64][]common.Address) {
+	c.valSetAllMu.Lock()
+	defer c.valSetAllMu.Unlock()
+	c.valSetAll = shards
+}
+
 func (c *core) commit() {
 	c.setState(StateCommitted)
 
 	proposal := c.current.Proposal()
 	if proposal != nil {
 		committedSeals := make([][]byte, c.current.Commits.Size())
+		committers := make([]common.Address, c.current.Commits.Size())
 		for i, v := range c.current.Commits.Values() {
-			committedSeals[i] = make([]byte, types.IstanbulExtraSeal)
-			copy(committedSeals[i][:], v.CommittedSeal[:])
+			committedSeals[i] = common.CopyBytes(v.CommittedSeal)
+			committers[i] = v.Address
 		}
 
-		if err := c.backend.Commit(proposal, committedSeals); err != nil {
-			if c.myShard == uint64(0) {
+		if err := c.backend.Commit(proposal, committedSeals, committers); err != nil {
+			if c.threePhase() {
 				c.current.UnlockHash() //Unlock block when insertion fails
 			}
 			c.sendNextRoundChange()
@@ -285,10 +274,17 @@ func (c *core) startNewRound(round *big.Int, reorg bool) {
 	c.valSet.CalcProposer(lastProposer, newView.Round.Uint64())
 	c.waitingForRoundChange = false
 	c.setState(StateAcceptRequest)
+	// A locked validator restarting has to come back in the round it moved on
+	// to, not in the one it locked in
+	if c.current.IsHashLocked() {
+		if err := c.storeRoundState(); err != nil {
+			logger.Error("Failed to persist round state", "err", err)
+		}
+	}
 	if roundChange && c.IsProposer() && c.current != nil {
 		// If it is locked, propose the old proposal
 		// If we have pending request, propose pending request
-		if c.myShard == uint64(0) && c.current.IsHashLocked() {
+		if c.threePhase() && c.current.IsHashLocked() {
 			r := &istanbul.Request{
 				Proposal: c.current.Proposal(), //c.current.Proposal would be the locked proposal by previous proposer, see updateRoundState
 			}
@@ -302,6 +298,43 @@ func (c *core) startNewRound(round *big.Int, reorg bool) {
 	logger.Debug("New round", "new_round", newView.Round, "new_seq", newView.Sequence, "new_proposer", c.valSet.GetProposer(), "valSet", c.valSet.List(), "size", c.valSet.Size(), "IsProposer", c.IsProposer())
 }
 
+// storeRoundState persists the current round state. It has to succeed before
+// PREPARE, COMMIT and, while locked, ROUND CHANGE messages go out, as a
+// validator forgetting them on a crash could contradict them after restarting.
+func (c *core) storeRoundState() error {
+	data, err := c.current.save(c.state)
+	if err != nil {
+		return err
+	}
+	return c.backend.SaveRoundState(data)
+}
+
+// restoreRoundState resumes the round persisted before the node stopped, as
+// long as its sequence has not been committed meanwhile.
+func (c *core) restoreRoundState() {
+	data, err := c.backend.LoadRoundState()
+	if err != nil || len(data) == 0 {
+		return
+	}
+	saved, preprepare, err := loadRoundState(data)
+	if err != nil {
+		c.logger.Error("Failed to decode persisted round state", "err", err)
+		return
+	}
+	if saved.View.Sequence.Cmp(c.current.Sequence()) != 0 {
+		return
+	}
+	_, lastProposer := c.backend.LastProposal()
+
+	c.current = newRoundState(saved.View, c.valSet, saved.LockedHash, preprepare, nil, c.backend.HasBadProposal)
+	c.roundChangeSet = newRoundChangeSet(c.valSet)
+	c.valSet.CalcProposer(lastProposer, saved.View.Round.Uint64())
+	c.state = saved.State
+	c.newRoundChangeTimer()
+
+	c.logger.Info("Restored round state", "seq", saved.View.Sequence, "round", saved.View.Round, "state", saved.State, "locked", saved.LockedHash)
+}
+
 func (c *core) catchUpRound(view *istanbul.View) {
 	logger := c.logger.New("old_round", c.current.Round(), "old_seq", c.current.Sequence(), "old_proposer", c.valSet.GetProposer())
 
@@ -322,7 +355,7 @@ func (c *core) catchUpRound(view *istanbul.View) {
 func (c *core) updateRoundState(view *istanbul.View, validatorSet istanbul.ValidatorSet, roundChange bool) {
 	// Lock only if both roundChange is true and it is locked
 	if roundChange && c.current != nil {
-		if c.myShard == uint64(0) && c.current.IsHashLocked() {
+		if c.threePhase() && c.current.IsHashLocked() {
 			c.current = newRoundState(view, validatorSet, c.current.GetLockedHash(), c.current.Preprepare, c.current.pendingRequest, c.backend.HasBadProposal)
 		} else {
 			c.current = newRoundState(view, validatorSet, common.Hash{}, nil, c.current.pendingRequest, c.backend.HasBadProposal)
@@ -378,16 +411,26 @@ func (c *core) checkValidatorSignature(data []byte, sig []byte) (common.Address,
 	return istanbul.CheckValidatorSignature(c.valSet, data, sig)
 }
 
+// threePhase returns whether the committee runs all three phases on the
+// sequence in progress.
+func (c *core) threePhase() bool {
+	var sequence *big.Int
+	if c.current != nil {
+		sequence = c.current.Sequence()
+	}
+	return c.config.ThreePhase(c.myShard, sequence)
+}
+
 func (c *core) QuorumSize() int {
 	if c.config.Ceil2Nby3Block == nil || (c.current != nil && c.current.sequence.Cmp(c.config.Ceil2Nby3Block) < 0) {
 		c.logger.Trace("Confirmation Formula used 2F+ 1")
-		if c.myShard == uint64(0) {
+		if c.threePhase() {
 			return (2 * c.valSet.F()) + 1
 		}
 		return c.valSet.F() + 1
 	}
 	c.logger.Trace("Confirmation Formula used ceil(2N/3)")
-	if c.myShard == uint64(0) {
+	if c.threePhase() {
 		return int(math.Ceil(float64(2*c.valSet.Size()) / 3))
 	}
 	return int(math.Ceil(float64(c.valSet.Size()) / 2))
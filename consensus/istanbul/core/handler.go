@@ -25,6 +25,8 @@ import (
 func (c *core) Start() error {
 	// Start a new round from last sequence + 1
 	c.startNewRound(common.Big0, false)
+	// Resume the round the validator was in when it stopped
+	c.restoreRoundState()
 
 	// Tests will handle events itself, so we have to make subscribeEvents()
 	// be able to call in test.
@@ -25,6 +25,10 @@ import (
 func (c *core) sendPrepare() {
 	logger := c.logger.New("state", c.state)
 
+	if err := c.storeRoundState(); err != nil {
+		logger.Error("Failed to persist round state", "err", err)
+		return
+	}
 	sub := c.current.Subject()
 	encodedSubject, err := Encode(sub)
 	if err != nil {
@@ -101,7 +101,8 @@ func (c *core) handlePreprepare(msg *message, src istanbul.Validator) error {
 
 	// Here is about to accept the PRE-PREPARE
 	if c.state == StateAcceptRequest {
-		if c.myShard > uint64(0) {
+		// Shards on the fast path commit without a PREPARE phase
+		if !c.threePhase() {
 			c.acceptPreprepare(preprepare)
 			c.setState(StatePrepared)
 			c.sendCommit()
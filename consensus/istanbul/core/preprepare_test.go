@@ -22,6 +22,7 @@ import (
 	"testing"
 
 	"github.com/ethereum/go-ethereum/consensus/istanbul"
+	"github.com/ethereum/go-ethereum/core/types"
 )
 
 func newTestPreprepare(v *istanbul.View) *istanbul.Preprepare {
@@ -296,3 +297,102 @@ func TestHandlePreprepareWithLock(t *testing.T) {
 		}
 	}
 }
+
+func TestEquivocatingShardProposer(t *testing.T) {
+	N := uint64(4) // replica 0 is the proposer, it equivocates
+	F := uint64(1)
+
+	view := &istanbul.View{
+		Round:    big.NewInt(0),
+		Sequence: big.NewInt(1),
+	}
+	// Replicas 1 and 2 are sent one block, replica 3 a conflicting one
+	blockA := makeBlock(1)
+	blockB := (&types.Block{}).WithSeal(&types.Header{
+		Difficulty: big.NewInt(0),
+		Number:     big.NewInt(1),
+		Time:       big.NewInt(1),
+	})
+	proposals := []istanbul.Proposal{nil, blockA, blockA, blockB}
+
+	testCases := []struct {
+		mode      istanbul.ShardConsensus
+		committed []istanbul.Proposal // Block committed by every replica, nil if none
+	}{
+		// The fast path only tolerates crash faults, so both blocks get committed
+		{istanbul.FastPath, []istanbul.Proposal{nil, blockA, blockA, blockB}},
+		// Full PBFT only commits the block the proposer got a quorum of PREPAREs for
+		{istanbul.FullPBFT, []istanbul.Proposal{nil, blockA, blockA, nil}},
+	}
+	for i, test := range testCases {
+		sys := NewShardTestSystemWithBackend(N, F, test.mode)
+		closer := sys.Run(false)
+
+		proposer := sys.backends[0].engine.(*core).valSet.GetByIndex(0)
+		vote := func(c *core, code uint64, src istanbul.Validator, proposal istanbul.Proposal) {
+			m, _ := Encode(&istanbul.Subject{View: view, Digest: proposal.Hash()})
+			c.handleCheckedMsg(&message{
+				Code:          code,
+				Msg:           m,
+				Address:       src.Address(),
+				CommittedSeal: src.Address().Bytes(), // small hack
+			}, src)
+		}
+		for j := 1; j < len(sys.backends); j++ {
+			c := sys.backends[j].engine.(*core)
+			m, _ := Encode(&istanbul.Preprepare{View: view, Proposal: proposals[j]})
+			if err := c.handlePreprepare(&message{Code: msgPreprepare, Msg: m, Address: proposer.Address()}, proposer); err != nil {
+				t.Fatalf("test %d: replica %d: failed to handle preprepare: %v", i, j, err)
+			}
+		}
+		// Deliver the votes of the honest replicas, and the ones of the
+		// proposer matching the block each replica was sent
+		for _, code := range []uint64{msgPrepare, msgCommit} {
+			for j := 1; j < len(sys.backends); j++ {
+				c := sys.backends[j].engine.(*core)
+				vote(c, code, proposer, proposals[j])
+				for k := 1; k < len(sys.backends); k++ {
+					from := sys.backends[k].engine.(*core)
+					if code == msgPrepare && from.state.Cmp(StatePreprepared) >= 0 || from.state.Cmp(StatePrepared) >= 0 {
+						vote(c, code, c.valSet.GetByIndex(uint64(k)), proposals[k])
+					}
+				}
+			}
+		}
+		for j := 1; j < len(sys.backends); j++ {
+			committed := sys.backends[j].committedMsgs
+			switch want := test.committed[j]; {
+			case want == nil && len(committed) != 0:
+				t.Errorf("test %d: replica %d committed %x", i, j, committed[0].commitProposal.Hash())
+			case want != nil && (len(committed) != 1 || committed[0].commitProposal.Hash() != want.Hash()):
+				t.Errorf("test %d: replica %d did not commit %x", i, j, want.Hash())
+			}
+		}
+		closer()
+	}
+}
+
+func TestShardQuorumSize(t *testing.T) {
+	N := uint64(4)
+	F := uint64(1)
+
+	testCases := []struct {
+		shard  uint64
+		mode   istanbul.ShardConsensus // Consensus of shard 1
+		quorum int
+	}{
+		{0, istanbul.FastPath, 3},
+		{1, istanbul.FastPath, 2},
+		{1, istanbul.FullPBFT, 3},
+		// Shards missing from the configuration stay on the fast path
+		{2, istanbul.FullPBFT, 2},
+	}
+	for i, test := range testCases {
+		sys := NewShardTestSystemWithBackend(N, F, test.mode)
+		c := sys.backends[0].engine.(*core)
+		c.myShard = test.shard
+		if quorum := c.QuorumSize(); quorum != test.quorum {
+			t.Errorf("test %d: quorum mismatch: have %d, want %d", i, quorum, test.quorum)
+		}
+	}
+}
@@ -46,6 +46,13 @@ func (c *core) sendRoundChange(round *big.Int) {
 		Sequence: new(big.Int).Set(cv.Sequence),
 	})
 
+	if c.current.IsHashLocked() {
+		if err := c.storeRoundState(); err != nil {
+			logger.Error("Failed to persist round state", "err", err)
+			return
+		}
+	}
+
 	// Now we have the new round number and sequence number
 	cv = c.currentView()
 	rc := &istanbul.Subject{
@@ -168,6 +168,55 @@ func (s *roundState) GetLockedHash() common.Hash {
 	return s.lockedHash
 }
 
+// savedRoundState is what a validator persists of its round state before it
+// sends PREPARE and COMMIT messages, so that it comes back in the same view
+// and still locked on the same proposal after a crash.
+type savedRoundState struct {
+	View       *istanbul.View
+	State      State
+	LockedHash common.Hash
+	Preprepare []byte // Encoded PRE-PREPARE accepted in the view, empty if none
+}
+
+// save encodes the view, the accepted proposal and the lock of the round
+// state, along with the state of core.
+func (s *roundState) save(state State) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	saved := &savedRoundState{
+		View: &istanbul.View{
+			Round:    s.round,
+			Sequence: s.sequence,
+		},
+		State:      state,
+		LockedHash: s.lockedHash,
+	}
+	if s.Preprepare != nil {
+		var err error
+		if saved.Preprepare, err = rlp.EncodeToBytes(s.Preprepare); err != nil {
+			return nil, err
+		}
+	}
+	return rlp.EncodeToBytes(saved)
+}
+
+// loadRoundState decodes a round state saved by roundState.save.
+func loadRoundState(data []byte) (*savedRoundState, *istanbul.Preprepare, error) {
+	saved := new(savedRoundState)
+	if err := rlp.DecodeBytes(data, saved); err != nil {
+		return nil, nil, err
+	}
+	if len(saved.Preprepare) == 0 {
+		return saved, nil, nil
+	}
+	preprepare := new(istanbul.Preprepare)
+	if err := rlp.DecodeBytes(saved.Preprepare, preprepare); err != nil {
+		return nil, nil, err
+	}
+	return saved, preprepare, nil
+}
+
 // The DecodeRLP method should read one value from the given
 // Stream. It is not forbidden to read less or more, but it might
 // be confusing.
@@ -74,3 +74,156 @@ func TestLockHash(t *testing.T) {
 		t.Error("IsHashLocked should return false")
 	}
 }
+
+// restartValidator kills the core of the backend and starts a fresh one on the
+// same database, as a validator restarting after a crash would.
+func restartValidator(t *testing.T, backend *testSystemBackend) *core {
+	old := backend.engine.(*core)
+	c := New(backend, old.config, old.myShard, old.numShard, nil).(*core)
+	c.logger = testLogger
+	c.validateFn = backend.CheckValidatorSignature
+	if err := c.Start(); err != nil {
+		t.Fatalf("failed to restart validator: %v", err)
+	}
+	backend.engine = c
+	return c
+}
+
+func TestRestartLockedValidator(t *testing.T) {
+	sys := NewTestSystemWithBackend(4, 1)
+	sys.Run(false)
+
+	// Validator 1 locks on the proposal in round 2 and crashes after its COMMIT
+	v1 := sys.backends[1]
+	c := v1.engine.(*core)
+	c.current = newTestRoundState(&istanbul.View{Round: big.NewInt(2), Sequence: big.NewInt(1)}, c.valSet)
+	c.current.LockHash()
+	c.state = StatePrepared
+	c.sendCommit()
+	locked := c.current.GetLockedHash()
+
+	r1 := restartValidator(t, v1)
+	defer r1.Stop()
+	if view := r1.currentView(); view.Round.Cmp(big.NewInt(2)) != 0 || view.Sequence.Cmp(common.Big1) != 0 {
+		t.Fatalf("view mismatch: have %v, want round 2 of sequence 1", view)
+	}
+	if r1.state != StatePrepared {
+		t.Errorf("state mismatch: have %v, want %v", r1.state, StatePrepared)
+	}
+	if !r1.current.IsHashLocked() || r1.current.GetLockedHash() != locked {
+		t.Fatalf("lock lost: have %x, want %x", r1.current.GetLockedHash(), locked)
+	}
+	if r1.current.Proposal() == nil || r1.current.Proposal().Hash() != locked {
+		t.Fatalf("locked proposal not restored")
+	}
+
+	// The restarted validator finishes the round on the COMMITs of the others
+	m, _ := Encode(r1.current.Subject())
+	for _, i := range []uint64{0, 2, 3} {
+		validator := r1.valSet.GetByIndex(i)
+		if err := r1.handleCommit(&message{
+			Code:          msgCommit,
+			Msg:           m,
+			Address:       validator.Address(),
+			Signature:     []byte{},
+			CommittedSeal: validator.Address().Bytes(),
+		}, validator); err != nil {
+			t.Fatalf("failed to handle commit: %v", err)
+		}
+	}
+	if len(v1.committedMsgs) != 1 || v1.committedMsgs[0].commitProposal.Hash() != locked {
+		t.Errorf("locked proposal not committed after restart")
+	}
+}
+
+func TestRestartUnlockedValidator(t *testing.T) {
+	sys := NewTestSystemWithBackend(4, 1)
+	sys.Run(false)
+
+	// Validator 1 crashes after its PREPARE in round 1, before locking
+	v1 := sys.backends[1]
+	c := v1.engine.(*core)
+	c.current = newTestRoundState(&istanbul.View{Round: big.NewInt(1), Sequence: big.NewInt(1)}, c.valSet)
+	c.state = StatePreprepared
+	c.sendPrepare()
+
+	r1 := restartValidator(t, v1)
+	defer r1.Stop()
+	if view := r1.currentView(); view.Round.Cmp(common.Big1) != 0 || view.Sequence.Cmp(common.Big1) != 0 {
+		t.Fatalf("view mismatch: have %v, want round 1 of sequence 1", view)
+	}
+	if r1.state != StatePreprepared {
+		t.Errorf("state mismatch: have %v, want %v", r1.state, StatePreprepared)
+	}
+	if r1.current.IsHashLocked() {
+		t.Errorf("block should not be locked")
+	}
+	if r1.current.Proposal() == nil || r1.current.Proposal().Hash() != c.current.Proposal().Hash() {
+		t.Errorf("prepared proposal not restored")
+	}
+}
+
+func TestRestartAfterCommit(t *testing.T) {
+	sys := NewTestSystemWithBackend(4, 1)
+	sys.Run(false)
+
+	v1 := sys.backends[1]
+	c := v1.engine.(*core)
+	c.current = newTestRoundState(&istanbul.View{Round: big.NewInt(1), Sequence: big.NewInt(1)}, c.valSet)
+	c.current.LockHash()
+	c.state = StatePrepared
+	c.sendCommit()
+	// The sequence gets committed before the validator comes back
+	v1.committedMsgs = append(v1.committedMsgs, testCommittedMsgs{commitProposal: c.current.Proposal()})
+
+	r1 := restartValidator(t, v1)
+	defer r1.Stop()
+	if view := r1.currentView(); view.Round.Sign() != 0 || view.Sequence.Cmp(common.Big2) != 0 {
+		t.Errorf("view mismatch: have %v, want round 0 of sequence 2", view)
+	}
+	if r1.state != StateAcceptRequest || r1.current.IsHashLocked() {
+		t.Errorf("stale round state restored: state %v, locked %x", r1.state, r1.current.GetLockedHash())
+	}
+}
+
+func TestRestartAfterLockedRoundChange(t *testing.T) {
+	sys := NewTestSystemWithBackend(4, 1)
+	sys.Run(false)
+
+	// Validator 1 locks in round 1 and moves on to round 2 without committing
+	v1 := sys.backends[1]
+	c := v1.engine.(*core)
+	c.current = newTestRoundState(&istanbul.View{Round: big.NewInt(1), Sequence: big.NewInt(1)}, c.valSet)
+	c.current.LockHash()
+	c.state = StatePrepared
+	c.sendCommit()
+	locked := c.current.GetLockedHash()
+	c.roundChangeSet = newRoundChangeSet(c.valSet)
+	c.sendRoundChange(big.NewInt(2))
+
+	r1 := restartValidator(t, v1)
+	if view := r1.currentView(); view.Round.Cmp(common.Big2) != 0 || view.Sequence.Cmp(common.Big1) != 0 {
+		t.Fatalf("view mismatch after round change: have %v, want round 2 of sequence 1", view)
+	}
+	if !r1.current.IsHashLocked() || r1.current.GetLockedHash() != locked {
+		t.Fatalf("lock lost after round change: have %x, want %x", r1.current.GetLockedHash(), locked)
+	}
+	// Starting the next round is persisted as well
+	r1.startNewRound(big.NewInt(3), false)
+	r1.Stop()
+
+	r2 := restartValidator(t, v1)
+	defer r2.Stop()
+	if view := r2.currentView(); view.Round.Cmp(big.NewInt(3)) != 0 || view.Sequence.Cmp(common.Big1) != 0 {
+		t.Fatalf("view mismatch after new round: have %v, want round 3 of sequence 1", view)
+	}
+	if r2.state != StateAcceptRequest {
+		t.Errorf("state mismatch: have %v, want %v", r2.state, StateAcceptRequest)
+	}
+	if !r2.current.IsHashLocked() || r2.current.GetLockedHash() != locked {
+		t.Fatalf("lock lost after new round: have %x, want %x", r2.current.GetLockedHash(), locked)
+	}
+	if r2.current.Proposal() == nil || r2.current.Proposal().Hash() != locked {
+		t.Errorf("locked proposal not restored")
+	}
+}
@@ -50,6 +50,7 @@ type testSystemBackend struct {
 type testCommittedMsgs struct {
 	commitProposal istanbul.Proposal
 	committedSeals [][]byte
+	committers     []common.Address
 }
 
 // ==============================================
@@ -87,16 +88,22 @@ func (self *testSystemBackend) Broadcast(valSet istanbul.ValidatorSet, message [
 	return nil
 }
 
+func (self *testSystemBackend) BroadcastOthers(valAddress []common.Address, message []byte) error {
+	testLogger.Warn("not sending to other shards")
+	return nil
+}
+
 func (self *testSystemBackend) Gossip(valSet istanbul.ValidatorSet, message []byte) error {
 	testLogger.Warn("not sign any data")
 	return nil
 }
 
-func (self *testSystemBackend) Commit(proposal istanbul.Proposal, seals [][]byte) error {
+func (self *testSystemBackend) Commit(proposal istanbul.Proposal, seals [][]byte, committers []common.Address) error {
 	testLogger.Info("commit message", "address", self.Address())
 	self.committedMsgs = append(self.committedMsgs, testCommittedMsgs{
 		commitProposal: proposal,
 		committedSeals: seals,
+		committers:     committers,
 	})
 
 	// fake new head events
@@ -113,6 +120,10 @@ func (self *testSystemBackend) Sign(data []byte) ([]byte, error) {
 	return self.address.Bytes(), nil
 }
 
+func (self *testSystemBackend) SignCommittedSeal(proposal istanbul.Proposal) ([]byte, error) {
+	return self.Sign(PrepareCommittedSeal(proposal.Hash()))
+}
+
 func (self *testSystemBackend) CheckSignature([]byte, common.Address, []byte) error {
 	return nil
 }
@@ -156,6 +167,17 @@ func (self *testSystemBackend) ParentValidators(proposal istanbul.Proposal) ista
 	return self.peers
 }
 
+func (self *testSystemBackend) SaveRoundState(data []byte) error {
+	return self.db.Put([]byte("round-state"), data)
+}
+
+func (self *testSystemBackend) LoadRoundState() ([]byte, error) {
+	if has, _ := self.db.Has([]byte("round-state")); !has {
+		return nil, nil
+	}
+	return self.db.Get([]byte("round-state"))
+}
+
 func (sb *testSystemBackend) Close() error {
 	return nil
 }
@@ -208,7 +230,7 @@ func NewTestSystemWithBackend(n, f uint64) *testSystem {
 		backend.peers = vset
 		backend.address = vset.GetByIndex(i).Address()
 
-		core := New(backend, config).(*core)
+		core := New(backend, config, 0, 1, nil).(*core)
 		core.state = StateAcceptRequest
 		core.current = newRoundState(&istanbul.View{
 			Round:    big.NewInt(0),
@@ -226,6 +248,21 @@ func NewTestSystemWithBackend(n, f uint64) *testSystem {
 	return sys
 }
 
+// NewShardTestSystemWithBackend creates a test system whose replicas form the
+// committee of shard 1, agreeing on blocks in the given consensus mode.
+func NewShardTestSystemWithBackend(n, f uint64, mode istanbul.ShardConsensus) *testSystem {
+	sys := NewTestSystemWithBackend(n, f)
+
+	config := *istanbul.DefaultConfig
+	config.ShardConsensus = map[uint64]istanbul.ShardConsensus{1: mode}
+	for _, backend := range sys.backends {
+		core := backend.engine.(*core)
+		core.myShard = 1
+		core.config = &config
+	}
+	return sys
+}
+
 // listen will consume messages from queue and deliver a message to core
 func (t *testSystem) listen() {
 	for {
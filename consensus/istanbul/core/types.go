@@ -39,8 +39,8 @@ type Engine interface {
 	// to avoid any race condition of coming propagated blocks
 	IsCurrentProposal(blockHash common.Hash) bool
 
-	// SetAllValidators initializes with information of all validators
-	SetAllValidators(validators []common.Address)
+	// SetShards replaces the validators of every shard after a reassignment
+	SetShards(shards map[uint64][]common.Address)
 }
 
 type State uint64
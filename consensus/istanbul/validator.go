@@ -101,3 +101,23 @@ type ValidatorSetAll interface {
 // ----------------------------------------------------------------------------
 
 type ProposalSelector func(ValidatorSet, common.Address, uint64) Validator
+
+// ProposerState is the chain data beyond the validators themselves that the
+// Weighted and Reputation policies select proposers from. It is taken from the
+// snapshot of the parent block, so every validator agrees on it.
+type ProposerState struct {
+	Sequence  uint64                    // Number of the block the proposer is selected for
+	Weights   map[common.Address]uint64 // Proposer weights, validators without one weigh 1
+	Penalized map[common.Address]bool   // Validators that recently caused a round change
+}
+
+// Weight returns the proposer weight of the validator with the given address.
+func (s *ProposerState) Weight(addr common.Address) uint64 {
+	if s == nil || s.Weights == nil {
+		return 1
+	}
+	if weight, ok := s.Weights[addr]; ok {
+		return weight
+	}
+	return 1
+}
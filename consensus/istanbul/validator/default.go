@@ -17,13 +17,16 @@
 package validator
 
 import (
+	"encoding/binary"
 	"math"
+	"math/big"
 	"reflect"
 	"sort"
 	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus/istanbul"
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
 type defaultValidator struct {
@@ -43,6 +46,7 @@ func (val *defaultValidator) String() string {
 type defaultSet struct {
 	validators istanbul.Validators
 	policy     istanbul.ProposerPolicy
+	state      *istanbul.ProposerState
 
 	proposer    istanbul.Validator
 	validatorMu sync.RWMutex
@@ -50,9 +54,14 @@ type defaultSet struct {
 }
 
 func newDefaultSet(addrs []common.Address, policy istanbul.ProposerPolicy) *defaultSet {
+	return newStateSet(addrs, policy, nil)
+}
+
+func newStateSet(addrs []common.Address, policy istanbul.ProposerPolicy, state *istanbul.ProposerState) *defaultSet {
 	valSet := &defaultSet{}
 
 	valSet.policy = policy
+	valSet.state = state
 	// init validators
 	valSet.validators = make([]istanbul.Validator, len(addrs))
 	for i, addr := range addrs {
@@ -64,9 +73,15 @@ func newDefaultSet(addrs []common.Address, policy istanbul.ProposerPolicy) *defa
 	if valSet.Size() > 0 {
 		valSet.proposer = valSet.GetByIndex(0)
 	}
-	valSet.selector = roundRobinProposer
-	if policy == istanbul.Sticky {
+	switch policy {
+	case istanbul.Sticky:
 		valSet.selector = stickyProposer
+	case istanbul.Weighted:
+		valSet.selector = weightedProposer(state)
+	case istanbul.Reputation:
+		valSet.selector = reputationProposer(state)
+	default:
+		valSet.selector = roundRobinProposer
 	}
 
 	return valSet
@@ -157,6 +172,71 @@ func stickyProposer(valSet istanbul.ValidatorSet, proposer common.Address, round
 	return valSet.GetByIndex(pick)
 }
 
+// weightedProposer draws the first proposer of a sequence with a probability
+// proportional to its weight, seeded by the sequence alone so that no proposer
+// can grind the draw. Later rounds move on round robin from it.
+func weightedProposer(state *istanbul.ProposerState) istanbul.ProposalSelector {
+	return func(valSet istanbul.ValidatorSet, proposer common.Address, round uint64) istanbul.Validator {
+		if valSet.Size() == 0 {
+			return nil
+		}
+		validators := valSet.List()
+		total := new(big.Int)
+		for _, val := range validators {
+			total.Add(total, new(big.Int).SetUint64(state.Weight(val.Address())))
+		}
+		pick := 0
+		if total.Sign() > 0 {
+			var seed [8]byte
+			if state != nil {
+				binary.BigEndian.PutUint64(seed[:], state.Sequence)
+			}
+			target := new(big.Int).SetBytes(crypto.Keccak256(seed[:]))
+			target.Mod(target, total)
+			for i, val := range validators {
+				weight := new(big.Int).SetUint64(state.Weight(val.Address()))
+				if target.Cmp(weight) < 0 {
+					pick = i
+					break
+				}
+				target.Sub(target, weight)
+			}
+		}
+		return valSet.GetByIndex((uint64(pick) + round) % uint64(valSet.Size()))
+	}
+}
+
+// reputationProposer rotates round robin over the validators that did not
+// cause a round change recently, falling back to all of them if none is left.
+func reputationProposer(state *istanbul.ProposerState) istanbul.ProposalSelector {
+	return func(valSet istanbul.ValidatorSet, proposer common.Address, round uint64) istanbul.Validator {
+		if valSet.Size() == 0 {
+			return nil
+		}
+		next := 0
+		if !emptyAddress(proposer) {
+			next = int(calcSeed(valSet, proposer, 0)) + 1
+		}
+		var (
+			eligible []istanbul.Validator
+			offset   uint64
+		)
+		for i, val := range valSet.List() {
+			if state != nil && state.Penalized[val.Address()] {
+				continue
+			}
+			if i < next {
+				offset++
+			}
+			eligible = append(eligible, val)
+		}
+		if len(eligible) == 0 {
+			return roundRobinProposer(valSet, proposer, round)
+		}
+		return eligible[(offset+round)%uint64(len(eligible))]
+	}
+}
+
 func (valSet *defaultSet) AddValidator(address common.Address) bool {
 	valSet.validatorMu.Lock()
 	defer valSet.validatorMu.Unlock()
@@ -193,7 +273,7 @@ func (valSet *defaultSet) Copy() istanbul.ValidatorSet {
 	for _, v := range valSet.validators {
 		addresses = append(addresses, v.Address())
 	}
-	return NewSet(addresses, valSet.policy)
+	return NewSetWithState(addresses, valSet.policy, valSet.state)
 }
 
 func (valSet *defaultSet) F() int { return int(math.Ceil(float64(valSet.Size())/3)) - 1 }
@@ -36,6 +36,8 @@ func TestValidatorSet(t *testing.T) {
 	testNormalValSet(t)
 	testEmptyValSet(t)
 	testStickyProposer(t)
+	testWeightedProposer(t)
+	testReputationProposer(t)
 	testAddAndRemoveValidator(t)
 }
 
@@ -206,3 +208,70 @@ func testStickyProposer(t *testing.T) {
 		t.Errorf("proposer mismatch: have %v, want %v", val, val2)
 	}
 }
+
+func testWeightedProposer(t *testing.T) {
+	addrs := []common.Address{common.HexToAddress("0x01"), common.HexToAddress("0x02"), common.HexToAddress("0x03")}
+	weights := map[common.Address]uint64{addrs[0]: 0, addrs[2]: 3}
+
+	// Round 0 proposers follow the weights over many sequences
+	picks := make(map[common.Address]int)
+	for seq := uint64(1); seq <= 4000; seq++ {
+		valSet := NewSetWithState(addrs, istanbul.Weighted, &istanbul.ProposerState{Sequence: seq, Weights: weights})
+		valSet.CalcProposer(addrs[1], 0)
+		picks[valSet.GetProposer().Address()]++
+	}
+	if picks[addrs[0]] != 0 {
+		t.Errorf("validator without weight proposed %d times", picks[addrs[0]])
+	}
+	if ratio := float64(picks[addrs[2]]) / float64(picks[addrs[1]]); ratio < 2.5 || ratio > 3.5 {
+		t.Errorf("proposals not proportional to weights: have ratio %.2f, want 3", ratio)
+	}
+	// The draw only depends on the sequence, round changes move on round robin
+	state := &istanbul.ProposerState{Sequence: 7, Weights: weights}
+	valSet := NewSetWithState(addrs, istanbul.Weighted, state)
+	valSet.CalcProposer(addrs[0], 0)
+	first := valSet.GetProposer()
+	other := valSet.Copy()
+	if other.CalcProposer(addrs[2], 0); !reflect.DeepEqual(other.GetProposer(), first) {
+		t.Errorf("proposer depends on the last proposer: have %v, want %v", other.GetProposer(), first)
+	}
+	index, _ := valSet.GetByAddress(first.Address())
+	valSet.CalcProposer(addrs[0], 1)
+	if val := valSet.GetProposer(); !reflect.DeepEqual(val, valSet.GetByIndex(uint64(index+1)%3)) {
+		t.Errorf("round change proposer mismatch: have %v, want %v", val, valSet.GetByIndex(uint64(index+1)%3))
+	}
+}
+
+func testReputationProposer(t *testing.T) {
+	addrs := []common.Address{common.HexToAddress("0x01"), common.HexToAddress("0x02"), common.HexToAddress("0x03"), common.HexToAddress("0x04")}
+	state := &istanbul.ProposerState{Penalized: map[common.Address]bool{addrs[1]: true}}
+	valSet := NewSetWithState(addrs, istanbul.Reputation, state)
+
+	tests := []struct {
+		last     common.Address
+		round    uint64
+		proposer common.Address
+	}{
+		{addrs[0], 0, addrs[2]}, // the penalized successor is skipped
+		{addrs[0], 1, addrs[3]},
+		{addrs[0], 2, addrs[0]},
+		{addrs[0], 3, addrs[2]},
+		{addrs[3], 0, addrs[0]},
+		{addrs[1], 0, addrs[2]},
+		{common.Address{}, 1, addrs[2]},
+	}
+	for i, tt := range tests {
+		valSet.CalcProposer(tt.last, tt.round)
+		if val := valSet.GetProposer(); val.Address() != tt.proposer {
+			t.Errorf("test %d: proposer mismatch: have %x, want %x", i, val.Address(), tt.proposer)
+		}
+	}
+	// Without eligible validators the policy falls back to round robin
+	for _, addr := range addrs {
+		state.Penalized[addr] = true
+	}
+	valSet.CalcProposer(addrs[0], 0)
+	if val := valSet.GetProposer(); val.Address() != addrs[1] {
+		t.Errorf("fallback proposer mismatch: have %x, want %x", val.Address(), addrs[1])
+	}
+}
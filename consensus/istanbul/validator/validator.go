@@ -31,6 +31,12 @@ func NewSet(addrs []common.Address, policy istanbul.ProposerPolicy) istanbul.Val
 	return newDefaultSet(addrs, policy)
 }
 
+// NewSetWithState creates a validator set selecting proposers from the chain
+// data in state, as the Weighted and Reputation policies require.
+func NewSetWithState(addrs []common.Address, policy istanbul.ProposerPolicy, state *istanbul.ProposerState) istanbul.ValidatorSet {
+	return newStateSet(addrs, policy, state)
+}
+
 func ExtractValidators(extraData []byte) []common.Address {
 	// get the validator addresses
 	addrs := make([]common.Address, (len(extraData) / common.AddressLength))
@@ -26,13 +26,14 @@ import (
 const (
 	Eth62 = 62
 	Eth63 = 63
+	Eth64 = 64
 )
 
 var (
 	EthProtocol = Protocol{
 		Name:     "eth",
-		Versions: []uint{Eth62, Eth63},
-		Lengths:  []uint64{17, 8},
+		Versions: []uint{Eth64, Eth63, Eth62},
+		Lengths:  []uint64{20, 17, 8},
 	}
 )
 
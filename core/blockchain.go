@@ -24,7 +24,7 @@ import (
 	"io"
 	"math/big"
 	mrand "math/rand"
-	"os"
+	"reflect"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -34,6 +34,7 @@ import (
 	"github.com/ethereum/go-ethereum/common/mclock"
 	"github.com/ethereum/go-ethereum/common/prque"
 	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/lock"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -43,6 +44,7 @@ import (
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/metrics/eventlog"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/trie"
@@ -52,6 +54,13 @@ import (
 var (
 	blockInsertTimer = metrics.NewRegisteredTimer("chain/inserts", nil)
 
+	crossTxAcceptedCounter  = metrics.NewRegisteredCounter("chain/crossshard/accepted", nil)
+	crossTxAbortedCounter   = metrics.NewRegisteredCounter("chain/crossshard/aborted", nil)
+	crossTxExecutedCounter  = metrics.NewRegisteredCounter("chain/crossshard/executed", nil)
+	crossTxLatencyTimer     = metrics.NewRegisteredTimer("chain/crossshard/latency", nil)          // From reference chain acceptance to local execution
+	commitLagTimer          = metrics.NewRegisteredTimer("chain/crossshard/commitlag", nil)        // From reported reference block to reference chain inclusion
+	crossShardEvDropCounter = metrics.NewRegisteredCounter("chain/crossshard/events/dropped", nil) // Progress events dropped on a full queue
+
 	ErrNoGenesis = errors.New("Genesis not found in chain")
 )
 
@@ -74,6 +83,8 @@ type CacheConfig struct {
 	Disabled      bool          // Whether to disable trie write caching (archive node)
 	TrieNodeLimit int           // Memory limit (MB) at which to flush the current in-memory trie to disk
 	TrieTimeLimit time.Duration // Time limit after which to flush the current in-memory trie to disk
+
+	HeadersOnly bool // Whether a reference chain keeps only headers and proven cross-shard receipts
 }
 
 // BlockChain represents the canonical chain given a database with a genesis
@@ -105,13 +116,21 @@ type BlockChain struct {
 	foreignDataMu   sync.RWMutex                   // Lock for foreign data
 	foreignDataCh   chan struct{}
 
-	logdir        string
-	gLocked       *types.RWLock                      // Currently readLocked
-	lockedAddrMap map[uint64]map[common.Address]bool // shard to addr map
+	gLocked *types.RWLock // Guards the cross-shard bookkeeping shared with the miner
+	locks   *lock.Manager // Keys locked by cross-shard transactions, kept by reference nodes
+
+	validating map[common.Hash]*readSetValidation // Optimistic cross-shard transactions waiting for read versions
+	voting     map[common.Hash]*crossTxVoting     // Atomic cross-shard transactions waiting for votes or their decision to apply
 
 	lastCommit map[uint64]*types.Commitment // To store the last rs block that includes a commit
 	lastCtx    map[uint64]uint64            // to store whether a shard is touched by a ctx or not
+	lastUnlock map[uint64]uint64            // reference block at which the locks of a shard were last released
 	procCtxs   map[common.Hash]bool         // processed cross shard transaction
+	replaying  bool                         // Whether reference blocks are being replayed rather than received
+	prunedTail uint64                       // First reference block whose cross-shard checkpoint was not pruned
+
+	genesisTopology *types.ShardTopology // Validators assigned to shards at genesis, nil if reassignments are not tracked
+	topology        *types.ShardTopology // Validator assignment last announced to subscribers
 
 	db     ethdb.Database // Low level persistent database to store final content in
 	triegc *prque.Prque   // Priority queue mapping block numbers to tries to gc
@@ -124,6 +143,9 @@ type BlockChain struct {
 	chainHeadFeed   event.Feed
 	commitHeadFeed  event.Feed
 	foreignDataFeed event.Feed
+	topologyFeed    event.Feed
+	crossShardFeed  event.Feed
+	crossShardCh    chan CrossShardEvent // Queue of cross-shard progress events for crossShardFeed
 	logsFeed        event.Feed
 	scope           event.SubscriptionScope
 	genesisBlock    *types.Block
@@ -165,7 +187,7 @@ type BlockChain struct {
 // NewBlockChain returns a fully initialised block chain using information
 // available in the database. It initialises the default Ethereum Validator and
 // Processor.
-func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *params.ChainConfig, engine consensus.Engine, vmConfig vm.Config, shouldPreserve func(block *types.Block) bool, ref bool, shard, numShard uint64, commitments map[uint64]*types.Commitments, pendingCrossTxs map[uint64]types.CrossShardTxs, myLatestCommit *types.Commitment, foreignData map[uint64]*types.DataCache, foreignDataMu sync.RWMutex, gLocked *types.RWLock, lastCommit map[uint64]*types.Commitment, lastCtx map[uint64]uint64, lockedAddrMap map[uint64]map[common.Address]bool, logdir string) (*BlockChain, error) {
+func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *params.ChainConfig, engine consensus.Engine, vmConfig vm.Config, shouldPreserve func(block *types.Block) bool, ref bool, shard, numShard uint64, commitments map[uint64]*types.Commitments, pendingCrossTxs map[uint64]types.CrossShardTxs, myLatestCommit *types.Commitment, foreignData map[uint64]*types.DataCache, foreignDataMu sync.RWMutex, gLocked *types.RWLock, lastCommit map[uint64]*types.Commitment, lastCtx map[uint64]uint64) (*BlockChain, error) {
 	if cacheConfig == nil {
 		cacheConfig = &CacheConfig{
 			TrieNodeLimit: 256,
@@ -189,6 +211,7 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 		triegc:            prque.New(nil),
 		stateCache:        state.NewDatabase(db),
 		quit:              make(chan struct{}),
+		crossShardCh:      make(chan CrossShardEvent, crossShardEvChanSize),
 		shouldPreserve:    shouldPreserve,
 		bodyCache:         bodyCache,
 		bodyRLPCache:      bodyRLPCache,
@@ -208,9 +231,11 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 		gLocked:           gLocked,
 		lastCommit:        lastCommit,
 		lastCtx:           lastCtx,
+		lastUnlock:        make(map[uint64]uint64),
 		procCtxs:          make(map[common.Hash]bool),
-		lockedAddrMap:     lockedAddrMap,
-		logdir:            logdir,
+		locks:             lock.NewManager(),
+		validating:        make(map[common.Hash]*readSetValidation),
+		voting:            make(map[common.Hash]*crossTxVoting),
 	}
 	bc.SetValidator(NewBlockValidator(chainConfig, bc, engine))
 	bc.SetProcessor(NewStateProcessor(chainConfig, bc, engine))
@@ -225,50 +250,15 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 		return nil, ErrNoGenesis
 	}
 
-	refNum := uint64(0)
-	genRoot := bc.genesisBlock.Root()
-	genHash := bc.genesisBlock.Hash()
-	bc.gLocked.Mu.Lock()
-	if bc.myshard == 0 && !bc.ref {
-		// Initialize commit for every shard!
-		for i := uint64(1); i < numShard; i++ {
-			bc.lastCtx[i] = refNum
-		}
-		for i := uint64(1); i < numShard; i++ {
-			bc.lastCommit[i] = &types.Commitment{
-				Shard:     shard,
-				BlockNum:  uint64(0),
-				RefNum:    uint64(0),
-				StateRoot: genRoot,
-				BHash:     genHash,
-			}
-		}
-	} else {
-		if bc.ref {
-			// Initialize foreign data and commitments for each shard
-			// I am adding this only in ref chain of each worker shard
-			// as the variables are shard among both nodes!
-			bc.foreignData[refNum] = types.NewDataCache(refNum, true)
-			bc.commitments[refNum] = types.NewCommitments()
-			for shard := uint64(0); shard < numShard; shard++ {
-				commit := &types.Commitment{
-					Shard:     shard,
-					BlockNum:  uint64(0),
-					RefNum:    uint64(0),
-					StateRoot: genRoot,
-					BHash:     genHash,
-				}
-				bc.commitments[refNum].AddCommit(shard, commit)
-			}
-			// Set my latest commit root to be root of genesis block!
-			bc.myLatestCommit.StateRoot = bc.genesisBlock.Root()
-		}
-	}
-	bc.gLocked.Mu.Unlock()
-
 	if err := bc.loadLastState(); err != nil {
 		return nil, err
 	}
+	// Rebuild the cross-shard bookkeeping left behind by the last run
+	if bc.tracksCrossShard() {
+		bc.gLocked.Mu.Lock()
+		bc.loadCrossShardState(bc.CurrentBlock())
+		bc.gLocked.Mu.Unlock()
+	}
 	// Check the current state of the block hashes and make sure that we do not have any of the bad blocks in our chain
 	for hash := range BadHashes {
 		if header := bc.GetHeaderByHash(hash); header != nil {
@@ -284,6 +274,7 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 	}
 	// Take ownership of this particular state
 	go bc.update()
+	go bc.crossShardLoop()
 	return bc, nil
 }
 
@@ -372,6 +363,9 @@ func (bc *BlockChain) AddProcessed(thash common.Hash) {
 // loadLastState loads the last known chain state from the database. This method
 // assumes that the chain manager mutex is held.
 func (bc *BlockChain) loadLastState() error {
+	if bc.HeadersOnly() {
+		return bc.loadLastHeader()
+	}
 	// Restore the last known head block
 	head := rawdb.ReadHeadBlockHash(bc.db)
 	if head == (common.Hash{}) {
@@ -446,9 +440,12 @@ func (bc *BlockChain) SetHead(head uint64) error {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
-	// Rewind the header chain, deleting all block bodies until then
+	// Rewind the header chain, deleting all block bodies and cross-shard
+	// bookkeeping until then
 	delFn := func(db rawdb.DatabaseDeleter, hash common.Hash, num uint64) {
 		rawdb.DeleteBody(db, hash, num)
+		rawdb.DeleteCrossShardCheckpoint(db, hash, num)
+		rawdb.DeleteCrossShardAborts(db, hash, num)
 	}
 	bc.hc.SetHead(head, delFn)
 	currentHeader := bc.hc.CurrentHeader()
@@ -599,9 +596,24 @@ func (bc *BlockChain) StateData(root common.Hash, keys []*types.CKeys) []*types.
 	for _, keyList := range keys {
 		addr := keyList.Addr
 		keyVal := &types.KeyVal{Addr: addr, Nonce: pstate.GetNonce(addr), Balance: pstate.GetBalance(addr).Uint64(), Data: []common.Hash{}}
+		// Attach the proofs needed to verify the values against root
+		proof, err := pstate.GetProof(addr)
+		if err != nil {
+			log.Error("Error in proving account", "addr", addr, "error", err)
+			return nil
+		}
+		keyVal.Proof = proof
 		for _, key := range keyList.Keys {
 			val := pstate.GetState(addr, key)
 			keyVal.Data = append(keyVal.Data, val)
+			if pstate.Exist(addr) {
+				sproof, err := pstate.GetStorageProof(addr, key)
+				if err != nil {
+					log.Error("Error in proving storage", "addr", addr, "key", key, "error", err)
+					return nil
+				}
+				keyVal.StorageProof = append(keyVal.StorageProof, sproof)
+			}
 		}
 		keyVals = append(keyVals, keyVal)
 	}
@@ -772,6 +784,9 @@ func (bc *BlockChain) GetBodyRLP(hash common.Hash) rlp.RawValue {
 
 // HasBlock checks if a block is fully present in the database or not.
 func (bc *BlockChain) HasBlock(hash common.Hash, number uint64) bool {
+	if bc.HeadersOnly() {
+		return bc.HasHeader(hash, number)
+	}
 	if bc.blockCache.Contains(hash) {
 		return true
 	}
@@ -918,6 +933,14 @@ func (bc *BlockChain) Stop() {
 				}
 			}
 		}
+		// Keep the states read sets of pending cross-shard transactions come from
+		for number := range bc.pinnedCommits() {
+			if pinned := bc.GetHeaderByNumber(number); pinned != nil {
+				if err := triedb.Commit(pinned.Root, true); err != nil {
+					log.Error("Failed to commit pinned state trie", "number", number, "err", err)
+				}
+			}
+		}
 		for !bc.triegc.Empty() {
 			triedb.Dereference(bc.triegc.PopItem().(common.Hash))
 		}
@@ -1202,13 +1225,20 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 				lastWrite = chosen
 				bc.gcproc = 0
 			}
-			// Garbage collect anything below our required write retention
+			// Garbage collect anything below our required write retention, flushing
+			// the states read sets of pending cross-shard transactions come from
+			pinned := bc.pinnedCommits()
 			for !bc.triegc.Empty() {
 				root, number := bc.triegc.Pop()
 				if uint64(-number) > chosen {
 					bc.triegc.Push(root, number)
 					break
 				}
+				if pinned[uint64(-number)] {
+					if err := triedb.Commit(root.(common.Hash), false); err != nil {
+						return NonStatTy, err
+					}
+				}
 				triedb.Dereference(root.(common.Hash))
 			}
 		}
@@ -1270,6 +1300,9 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 //
 // After insertion is done, all accumulated events will be fired.
 func (bc *BlockChain) InsertChain(chain types.Blocks) (int, error) {
+	if bc.HeadersOnly() {
+		return 0, ErrHeadersOnly
+	}
 	n, events, logs, err := bc.insertChain(chain)
 	bc.PostChainEvents(events, logs)
 	return n, err
@@ -1564,97 +1597,70 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 	return 0, events, coalescedLogs, nil
 }
 
-func (bc *BlockChain) addNewLocks(allKeys map[uint64][]*types.CKeys) {
-	// This function assumes that the bc.gLocked.Mu is already held
-	var addr common.Address
-	for shard, sKeys := range allKeys {
-		if _, sok := bc.lockedAddrMap[shard]; !sok {
-			bc.lockedAddrMap[shard] = make(map[common.Address]bool)
-		}
-		// for every contract of a shard
-		for _, cKeys := range sKeys {
-			addr = cKeys.Addr
-			if _, aok := bc.gLocked.Locks[addr]; !aok {
-				bc.gLocked.Locks[addr] = types.NewCLock(addr)
-			}
-			if _, aok := bc.lockedAddrMap[shard][addr]; !aok {
-				bc.lockedAddrMap[shard][addr] = false
+// LogData records the metrics and events of a local block.
+func (bc *BlockChain) LogData(self bool, block *types.Block, receipts types.Receipts) {
+	var (
+		bNum = block.NumberU64()
+		rNum = block.RefNumberU64()
+		ctxs = make(map[common.Hash]*types.CrossTx)
+	)
+	// Collect the cross-shard transactions the block may execute
+	if parent := bc.GetHeader(block.ParentHash(), bNum-1); parent != nil {
+		for curr := parent.RefNumber.Uint64() + 1; curr <= rNum; curr++ {
+			for _, ctx := range bc.CrossTxs(curr).Txs {
+				ctxs[ctx.Tx.Hash()] = ctx
 			}
-			// Add lock to all keys
-			for _, key := range cKeys.Keys {
-				if _, kok := bc.gLocked.Locks[addr].Keys[key]; !kok {
-					bc.gLocked.Locks[addr].Keys[key] = 0
+		}
+	}
+	for i, tx := range block.Transactions() {
+		if tx.TxType() == types.CrossShardLocal {
+			crossTxExecutedCounter.Inc(1)
+			var (
+				local  = tx.Hash()
+				status = receipts[i].Status
+				ev     = CrossShardEvent{Kind: CrossTxExecuted, LocalHash: &local, Shard: bc.myshard, Number: bNum, Status: &status}
+			)
+			if ctx, ok := ctxs[local]; ok {
+				if !ctx.Seen.IsZero() {
+					crossTxLatencyTimer.UpdateSince(ctx.Seen)
+				}
+				ev.RefHash, ev.Shards = ctx.RefHash, ctx.Shards
+				if ctx.BlockNum != nil {
+					ev.RefNum = ctx.BlockNum.Uint64()
 				}
-				bc.gLocked.Locks[addr].Keys[key] = bc.gLocked.Locks[addr].Keys[key] + 1
-			}
-			// Mark write locks
-			for _, key := range cKeys.WKeys {
-				bc.gLocked.Locks[addr].Keys[key] = -1
 			}
+			bc.postCrossShardEvent(ev)
+		}
+		if eventlog.Enabled() {
+			eventlog.Emit("localtx", "number", bNum, "ref", rNum, "hash", tx.Hash(), "type", tx.TxType(), "status", receipts[i].Status, "gas", receipts[i].GasUsed)
 		}
 	}
+	eventlog.Emit("localblock", "number", bNum, "ref", rNum, "hash", block.Hash(), "root", block.Root(), "gasused", block.GasUsed(), "txs", len(block.Transactions()), "self", self)
 }
 
-// LogData logs data of local blocks!
-func (bc *BlockChain) LogData(self bool, block *types.Block, receipts types.Receipts) {
-	// Logging local transaction!
-	ltdata := bc.logdir + "ltdata"
-	ltdataf, err := os.OpenFile(ltdata, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Error("Can't open ltdata file", "error", err)
-	}
-	defer ltdataf.Close()
-	// Cross-shard Local data
-	csltime := bc.logdir + "csltime"
-	csltimef, err := os.OpenFile(csltime, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// VerifyStateCommit checks that a state commitment reports a shard block
+// committed by the validators of that shard.
+func (bc *BlockChain) VerifyStateCommit(tx *types.Transaction) error {
+	header, err := types.DecodeStateCommitHeader(tx)
 	if err != nil {
-		log.Error("Can't open csltime  file", "error", err)
-	}
-	defer csltimef.Close()
-	// Parsing transactions!
-	bNum := block.NumberU64()
-	rNum := block.RefNumberU64()
-	txs := block.Transactions()
-	bHash := block.Hash().Hex()
-	var txLen = 0
-	for i, tx := range txs {
-		receipt := receipts[i]
-		txLen++
-		fmt.Fprintln(ltdataf, bNum, bHash, rNum, tx.Hash().Hex(), tx.TxType(), receipt.Status, receipt.GasUsed, time.Now().Unix())
-		if tx.TxType() == types.CrossShardLocal {
-			fmt.Fprintln(csltimef, bNum, tx.Hash().Hex(), time.Now().Unix())
-		}
+		return err
 	}
-	// Logging information about the block!
-	lbtime := bc.logdir + "lbtime"
-	lbtimef, err := os.OpenFile(lbtime, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Error("Can't open lbitme file!", "error", err)
+	if istanbul, ok := bc.engine.(consensus.Istanbul); ok {
+		return istanbul.VerifyStateCommit(bc, header)
 	}
-	fmt.Fprintln(lbtimef, bNum, rNum, block.Hash().Hex(), block.Root().Hex(), block.GasUsed(), txLen, self, time.Now().Unix())
-	lbtimef.Close()
-}
-
-// CheckGLock checks whether the global lock is held or not!
-func (bc *BlockChain) CheckGLock(addr common.Address, addrKeys map[common.Hash]bool) bool {
-	// This function assumes that bc.gLocked.Mu is already held!
-	gLockedKeys := bc.gLocked.Locks[addr].Keys
-	for key, kval := range addrKeys {
-		gval, gok := gLockedKeys[key]
-		// Globally locked and current write locked or globally write locked!
-		if gok && (kval || gval < 0) {
-			return true
-		}
-	}
-	return false
+	return nil
 }
 
 // UpdateRefStatus updates current reference statsus
 func (bc *BlockChain) UpdateRefStatus(block *types.Block, receipts types.Receipts) {
 	bc.gLocked.Mu.Lock()
 	defer bc.gLocked.Mu.Unlock()
+	bc.updateRefStatus(block, receipts)
+}
+
+func (bc *BlockChain) updateRefStatus(block *types.Block, receipts types.Receipts) {
+	// This function assumes that bc.gLocked.Mu is already held
 	var (
-		elemSize  = 32
 		u64Offset = 24
 		bNum      = block.NumberU64()
 		receipt   *types.Receipt
@@ -1663,38 +1669,21 @@ func (bc *BlockChain) UpdateRefStatus(block *types.Block, receipts types.Receipt
 		txType    uint64
 		eventOut  uint64
 	)
-	tdata := bc.logdir + "tdata"
-	tdataf, err := os.OpenFile(tdata, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Error("Can't open tdata file", "error", err)
-	}
-	defer tdataf.Close()
-	ctxtime := bc.logdir + "ctxtime"
-	ctxtimef, err := os.OpenFile(ctxtime, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Error("Can't open tdata file", "error", err)
-	}
-	defer ctxtimef.Close()
-	// state commitment time!
-	sctime := bc.logdir + "sctime"
-	sctimef, err := os.OpenFile(sctime, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Error("Can't open tdata file", "error", err)
-	}
-	defer sctimef.Close()
 	// Parsing trasnaction
 	txs := block.Transactions()
 	for i, tx := range txs {
 		receipt = receipts[i]
 		rStatus = receipt.Status == uint64(1)
 		txType = tx.TxType()
-		// Tranaction data file
-		fmt.Fprintln(tdataf, bNum, tx.Hash().Hex(), txType, rStatus, receipt.GasUsed, time.Now().Unix())
+		bc.emitRefTx(bNum, tx, receipt)
 
 		tStatus = false
-		if rStatus && receipt.Logs != nil {
+		eventOut = 0
+		if rStatus && len(receipt.Logs) > 0 {
 			if txType == types.CrossShard || txType == types.StateCommit {
-				eventOut = binary.BigEndian.Uint64(receipt.Logs[0].Data[u64Offset:])
+				if len(receipt.Logs[0].Data) >= u64Offset+8 {
+					eventOut = binary.BigEndian.Uint64(receipt.Logs[0].Data[u64Offset:])
+				}
 				tStatus = eventOut == uint64(1)
 			} else {
 				log.Debug("Not a relavent transaction", "status", rStatus, "txType", txType)
@@ -1707,57 +1696,105 @@ func (bc *BlockChain) UpdateRefStatus(block *types.Block, receipts types.Receipt
 			if txType == types.CrossShard {
 				// Marking the trasnaction as processed
 				bc.AddProcessed(tx.Hash())
+				payload, shards, _, err := types.DecodeCrossTx(uint64(0), tx.Data())
+				if err != nil {
+					log.Warn("Skipping malformed cross-shard transaction", "hash", tx.Hash(), "err", err)
+					continue
+				}
+				allKeys, _, _, err := types.GetAllRWSet(payload)
+				if err != nil {
+					log.Warn("Skipping malformed cross-shard transaction", "hash", tx.Hash(), "err", err)
+					continue
+				}
 				// Updating latest cross-shard transaction for a shard
-				data := tx.Data()[4:]
-				_, shards, _ := types.DecodeCrossTx(uint64(0), data)
 				for _, shard := range shards {
 					bc.lastCtx[shard] = bNum
 				}
-				// Updating global locks based on the new cross-shard transaction
-				numShards := len(shards)
-				index := (2+1+numShards)*elemSize + elemSize + 2
-				allKeys, _, _ := types.GetAllRWSet(uint16(numShards), data[index:])
-				bc.addNewLocks(allKeys)
-				// Logging data!
-				// Cross-shard transaction file
-				fmt.Fprintln(ctxtimef, bNum, tx.Hash().Hex(), numShards, time.Now().Unix())
-			} else if txType == types.StateCommit {
-				// Extracting data
-				shard, commit, report, root, bHash := types.DecodeStateCommit(tx)
-				// Unlocking keys due to state commit
-				lockedAddrs, sok := bc.lockedAddrMap[shard]
-				log.Debug("Unlocking locked keys!", "len", len(lockedAddrs))
-				if sok && len(lockedAddrs) > 0 {
-					for addr := range lockedAddrs {
-						delete(bc.gLocked.Locks, addr)
+				switch {
+				case bc.OptimisticCrossShard(bNum):
+					if ctx, err := types.ParseCrossTxData(payload); err == nil {
+						ctx.BlockNum, ctx.RefHash, ctx.Origin = block.Number(), tx.Hash(), bNum
+						bc.trackReadSets(ctx, 0)
+					}
+				case bc.AtomicCrossShard(bNum):
+					// Keys stay locked until the decision is applied by every shard
+					bc.locks.Acquire(tx.Hash(), undecidedLock, allKeys)
+					if ctx, err := types.ParseCrossTxData(payload); err == nil {
+						ctx.BlockNum, ctx.RefHash = block.Number(), tx.Hash()
+						bc.trackVotes(ctx)
 					}
-					delete(bc.lockedAddrMap, shard)
+				default:
+					bc.locks.Acquire(tx.Hash(), bNum, allKeys)
 				}
+				if !bc.replaying {
+					crossTxAcceptedCounter.Inc(1)
+					eventlog.Emit("crosstx", "ref", bNum, "hash", tx.Hash(), "shards", shards)
+
+					ev := CrossShardEvent{Kind: CrossTxAccepted, RefNum: bNum, RefHash: tx.Hash(), Shards: shards}
+					if ctx, err := types.ParseCrossTxData(payload); err == nil {
+						local := ctx.Tx.Hash()
+						ev.LocalHash = &local
+					}
+					bc.postCrossShardEvent(ev)
+				}
+			} else if txType == types.StateCommit {
+				if err := bc.VerifyStateCommit(tx); err != nil {
+					log.Warn("Ignoring unattested state commitment", "hash", tx.Hash(), "err", err)
+					continue
+				}
+				bc.checkpointShardBlock(block, tx)
+				// Extracting data
+				shard, commit, report, root, bHash, _ := types.DecodeStateCommit(tx)
+				// Release the keys of the shard locked by the transactions the commit covers
+				released := bc.locks.ReleaseCovered(shard, report)
+				log.Debug("Released locked keys", "shard", shard, "report", report, "unlocked", len(released))
+				bc.lastUnlock[shard] = bNum
+				bc.recordReadVersions(tx, shard, report)
+				bc.recordVotes(tx, shard, report)
 				// Updating the latest commit of a shard
 				lcommit := bc.lastCommit[shard]
 				if report >= lcommit.RefNum {
 					bc.lastCommit[shard] = &types.Commitment{Shard: shard, BlockNum: commit, RefNum: report, StateRoot: root, BHash: bHash} // Update last commit of a shard!
-					fmt.Fprintln(sctimef, shard, commit, report, root.Hex(), bHash.Hex(), tx.Hash().Hex(), time.Now().Unix())
+					bc.recordCommit(block, tx, shard, commit, report, root, bHash)
 				}
 			}
 		}
 	}
-	// Logging summary of the block
-	txLen := len(txs)
-	rtime := bc.logdir + "rtime"
-	rtimef, err := os.OpenFile(rtime, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Error("Can't open rtime file", "error", err)
+	// Transactions accepted in other modes are not tracked by either
+	_, retried := bc.decideReadSets(bNum)
+	for _, ctx := range retried {
+		for _, shard := range ctx.Shards {
+			bc.lastCtx[shard] = bNum
+		}
 	}
-	fmt.Fprintln(rtimef, bNum, txLen, block.Hash().Hex(), block.Root().Hex(), block.GasLimit(), block.GasUsed(), time.Now().Unix())
-	rtimef.Close()
+	bc.snapshotReadSets(bNum)
+	bc.resolveCrossTxs(block)
+	bc.emitRefBlock(block)
+	bc.abortExpiredCrossTxs(block)
+	bc.finishVotes()
+	bc.updateShardTopology(block)
+	bc.writeCrossShardCheckpoint(block)
 }
 
 // ParseBlock function extracts necessary information from a reference block
 func (bc *BlockChain) ParseBlock(block *types.Block, receipts types.Receipts) {
 	bc.gLocked.Mu.Lock()
 	defer bc.gLocked.Mu.Unlock()
-	elemSize := 32
+	bc.parseBlock(block, receipts)
+}
+
+func (bc *BlockChain) parseBlock(block *types.Block, receipts types.Receipts) {
+	// This function assumes that bc.gLocked.Mu is already held
+	for i, tx := range block.Transactions() {
+		bc.emitRefTx(block.NumberU64(), tx, receipts[i])
+	}
+	bc.parseRefTxs(block, types.RefTxs(block.Transactions(), receipts))
+}
+
+// parseRefTxs extracts the commitments and cross-shard transactions of a
+// reference block from the transactions picked by types.RefTxs.
+func (bc *BlockChain) parseRefTxs(block *types.Block, refTxs []*types.RefTx) {
+	// This function assumes that bc.gLocked.Mu is already held
 	u64Offset := 24
 	myshard := bc.MyShard()
 	refNum := block.NumberU64()
@@ -1767,42 +1804,20 @@ func (bc *BlockChain) ParseBlock(block *types.Block, receipts types.Receipts) {
 		bc.commitments[refNum] = types.NewCommitments()
 		bc.commitments[refNum].CopyCommits(bc.numShard, bc.commitments[refNum-1])
 	}
-	// Transactional information!
-	tdata := bc.logdir + "tdata"
-	tdataf, err := os.OpenFile(tdata, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Error("Can't open tdata file", "error", err)
-	}
-	defer tdataf.Close()
-	// Cross-shard transaction file
-	ctxtime := bc.logdir + "ctxtime"
-	ctxtimef, err := os.OpenFile(ctxtime, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Error("Can't open tdata file", "error", err)
-	}
-	defer ctxtimef.Close()
-	// state commitment time!
-	sctime := bc.logdir + "sctime"
-	sctimef, err := os.OpenFile(sctime, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Error("Can't open tdata file", "error", err)
-	}
-	defer sctimef.Close()
 	// Parsing transaction!
-	txs := block.Transactions()
-	for i, tx := range txs {
+	for _, refTx := range refTxs {
 		// Checking execution status of the transaction
-		receipt := receipts[i]
+		tx, receipt := refTx.Tx, refTx.Receipt
 		rStatus := receipt.Status == uint64(1)
 		txType := tx.TxType()
-		// Tranaction data file
-		fmt.Fprintln(tdataf, refNum, tx.Hash().Hex(), txType, rStatus, receipt.GasUsed, time.Now().Unix())
 
 		txStatus := false
 		var eventOutput uint64
-		if rStatus && receipt.Logs != nil {
+		if rStatus && len(receipt.Logs) > 0 {
 			if txType == types.CrossShard || txType == types.StateCommit {
-				eventOutput = binary.BigEndian.Uint64(receipt.Logs[0].Data[u64Offset:])
+				if len(receipt.Logs[0].Data) >= u64Offset+8 {
+					eventOutput = binary.BigEndian.Uint64(receipt.Logs[0].Data[u64Offset:])
+				}
 				txStatus = eventOutput == uint64(1)
 			} else {
 				log.Debug("rStatus passed", "txType", txType)
@@ -1814,25 +1829,50 @@ func (bc *BlockChain) ParseBlock(block *types.Block, receipts types.Receipts) {
 
 		if txStatus {
 			if tx.TxType() == types.CrossShard {
-				data := tx.Data()[4:]
-				_, shardsInvolved, involved := types.DecodeCrossTx(myshard, data)
+				payload, shardsInvolved, involved, err := types.DecodeCrossTx(myshard, tx.Data())
+				if err != nil {
+					log.Warn("Skipping malformed cross-shard transaction", "hash", tx.Hash(), "err", err)
+					continue
+				}
 				if involved {
+					crossTx, err := types.ParseCrossTxData(payload)
+					if err != nil {
+						log.Warn("Skipping malformed cross-shard transaction", "hash", tx.Hash(), "err", err)
+						continue
+					}
 					status = false
-					numShards := len(shardsInvolved)
-					startIndex := (2+1+numShards)*elemSize + elemSize // Last 32 bytes to avoid string length
-					crossTx := types.ParseCrossTxData(uint16(numShards), data[2+startIndex:])
 					crossTx.BlockNum = block.Number()
+					crossTx.RefHash = tx.Hash()
+					crossTx.Seen = time.Now()
 					log.Debug("New cross shard transaction added!", "bn", refNum, "shards", shardsInvolved)
+					if bc.OptimisticCrossShard(refNum) {
+						crossTx.Origin = refNum
+						bc.trackReadSets(crossTx, 0)
+					} else if bc.AtomicCrossShard(refNum) {
+						bc.trackVotes(crossTx)
+					}
 
 					if _, ok := bc.pendingCrossTxs[refNum]; !ok {
 						bc.pendingCrossTxs[refNum] = types.NewCrossShardTxs()
 					}
-					bc.pendingCrossTxs[refNum].AddTransaction(uint64(i), crossTx)
-					// Logging data!
-					fmt.Fprintln(ctxtimef, refNum, tx.Hash().Hex(), crossTx.Tx.Hash().Hex(), numShards, time.Now().Unix())
+					bc.pendingCrossTxs[refNum].AddTransaction(refTx.Index, crossTx)
+					if !bc.replaying {
+						crossTxAcceptedCounter.Inc(1)
+						eventlog.Emit("crosstx", "ref", refNum, "hash", tx.Hash(), "local", crossTx.Tx.Hash(), "shards", shardsInvolved)
+
+						local := crossTx.Tx.Hash()
+						bc.postCrossShardEvent(CrossShardEvent{Kind: CrossTxAccepted, RefNum: refNum, RefHash: tx.Hash(), LocalHash: &local, Shard: myshard, Shards: shardsInvolved})
+					}
 				}
 			} else if tx.TxType() == types.StateCommit {
-				shard, commit, report, root, bHash := types.DecodeStateCommit(tx)
+				if err := bc.VerifyStateCommit(tx); err != nil {
+					log.Warn("Ignoring unattested state commitment", "hash", tx.Hash(), "err", err)
+					continue
+				}
+				bc.checkpointShardBlock(block, tx)
+				shard, commit, report, root, bHash, _ := types.DecodeStateCommit(tx)
+				bc.recordReadVersions(tx, shard, report)
+				bc.recordVotes(tx, shard, report)
 				if shard == bc.myshard {
 					bc.myLatestCommit.Update(commit, report, root, bHash)
 					log.Info("Updated Latest commit", "commit", commit, "report", report, "reporting", refNum, "root", root, "bHash", bHash)
@@ -1842,12 +1882,22 @@ func (bc *BlockChain) ParseBlock(block *types.Block, receipts types.Receipts) {
 					bc.commitments[refNum].AddCommit(shard, tcommit)
 					log.Debug("New commit added for ", "shard", shard, "committed", commit, "reporting", refNum, "root", root)
 				}
-				fmt.Fprintln(sctimef, shard, commit, report, root.Hex(), bHash.Hex(), tx.Hash().Hex(), time.Now().Unix())
+				bc.recordCommit(block, tx, shard, commit, report, root, bHash)
 			}
 		} else {
 			log.Info("Unsuccesful transaction execution!", "status", receipt.Status, "event", eventOutput, "txType", tx.TxType(), "hash", tx.Hash())
 		}
 	}
+	// Transactions with stale read sets need fresh foreign data, while validated
+	// ones are executed with the data fetched when they were accepted
+	validated, retried := bc.decideReadSets(refNum)
+	for k, ctx := range retried {
+		if _, ok := bc.pendingCrossTxs[refNum]; !ok {
+			bc.pendingCrossTxs[refNum] = types.NewCrossShardTxs()
+		}
+		bc.pendingCrossTxs[refNum].AddTransaction(newAttemptIndex(refTxs, k), ctx)
+		status = false
+	}
 	bc.foreignDataMu.Lock()
 	if _, ok := bc.foreignData[refNum]; !ok {
 		bc.foreignData[refNum] = types.NewDataCache(refNum, status)
@@ -1856,17 +1906,505 @@ func (bc *BlockChain) ParseBlock(block *types.Block, receipts types.Receipts) {
 	if _, ok := bc.pendingCrossTxs[refNum]; ok {
 		status := bc.foreignData[refNum].InitKeys(bc.myshard, bc.pendingCrossTxs[refNum], bc.commitments[refNum])
 		if status {
+			if !bc.replaying {
+				for _, ev := range bc.dataReadyEvents(refNum) {
+					bc.postCrossShardEvent(ev)
+				}
+			}
 			go bc.PostForeignDataEvent(refNum)
 		}
 	}
-	rtime := bc.logdir + "rtime"
-	rtimef, err := os.OpenFile(rtime, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Error("Can't open rtime file", "error", err)
+	if len(validated) > 0 {
+		if _, ok := bc.pendingCrossTxs[refNum]; !ok {
+			bc.pendingCrossTxs[refNum] = types.NewCrossShardTxs()
+		}
+		offset := bc.pendingCrossTxs[refNum].TxCount()
+		for k, ctx := range validated {
+			bc.pendingCrossTxs[refNum].AddTransaction(newAttemptIndex(refTxs, offset+k), ctx)
+		}
+		go bc.PostForeignDataEvent(refNum)
 	}
-	txLen := len(txs)
-	fmt.Fprintln(rtimef, refNum, txLen, block.Hash().Hex(), block.Root().Hex(), block.GasLimit(), block.GasUsed(), time.Now().Unix())
-	rtimef.Close()
+	bc.snapshotReadSets(refNum)
+	bc.resolveCrossTxs(block)
+	bc.emitRefBlock(block)
+	// Wake up shard workers waiting for data that will no longer be needed
+	if aborted := bc.abortExpiredCrossTxs(block); len(aborted) > 0 {
+		go bc.PostForeignDataEvent(refNum)
+	}
+	bc.finishVotes()
+	bc.updateShardTopology(block)
+	bc.writeCrossShardCheckpoint(block)
+}
+
+// tracksCrossShard returns whether the chain maintains the cross-shard
+// bookkeeping, i.e. whether it is the reference chain of either a reference
+// node or a shard node.
+func (bc *BlockChain) tracksCrossShard() bool {
+	if bc.myshard == uint64(0) {
+		return !bc.ref
+	}
+	return bc.ref
+}
+
+// processRefBlock applies a canonical reference block to the cross-shard bookkeeping
+func (bc *BlockChain) processRefBlock(block *types.Block, receipts types.Receipts) {
+	// This function assumes that bc.gLocked.Mu is already held
+	bc.replaying = true
+	defer func() { bc.replaying = false }()
+
+	if bc.myshard == uint64(0) {
+		bc.updateRefStatus(block, receipts)
+	} else {
+		bc.parseBlock(block, receipts)
+	}
+}
+
+// emitRefTx records a transaction of a processed reference block.
+func (bc *BlockChain) emitRefTx(number uint64, tx *types.Transaction, receipt *types.Receipt) {
+	if eventlog.Enabled() && !bc.replaying {
+		eventlog.Emit("reftx", "ref", number, "hash", tx.Hash(), "type", tx.TxType(), "status", receipt.Status, "gas", receipt.GasUsed)
+	}
+}
+
+// emitRefBlock records the summary of a processed reference block.
+func (bc *BlockChain) emitRefBlock(block *types.Block) {
+	if !bc.replaying {
+		eventlog.Emit("refblock", "number", block.NumberU64(), "hash", block.Hash(), "root", block.Root(), "txs", len(block.Transactions()), "gaslimit", block.GasLimit(), "gasused", block.GasUsed())
+	}
+}
+
+// recordCommit records the metrics and event of a state commitment accepted
+// in a reference block.
+func (bc *BlockChain) recordCommit(block *types.Block, tx *types.Transaction, shard, commit, report uint64, root, bHash common.Hash) {
+	if bc.replaying {
+		return
+	}
+	if reported := bc.hc.GetHeaderByNumber(report); reported != nil && block.Time().Cmp(reported.Time) >= 0 {
+		commitLagTimer.Update(time.Duration(new(big.Int).Sub(block.Time(), reported.Time).Uint64()) * time.Second)
+	}
+	eventlog.Emit("commit", "ref", block.NumberU64(), "shard", shard, "block", commit, "report", report, "root", root, "bhash", bHash, "hash", tx.Hash())
+	bc.postCrossShardEvent(CrossShardEvent{Kind: StateCommitted, RefNum: block.NumberU64(), RefHash: tx.Hash(), Shard: shard, Number: commit, Reported: report, Root: &root})
+}
+
+// crossTxAccepted returns whether the receipt of a reference chain transaction
+// reports it as accepted by the reference contract.
+func crossTxAccepted(receipt *types.Receipt) bool {
+	if receipt.Status != types.ReceiptStatusSuccessful || len(receipt.Logs) == 0 || len(receipt.Logs[0].Data) < 32 {
+		return false
+	}
+	return binary.BigEndian.Uint64(receipt.Logs[0].Data[24:32]) == uint64(1)
+}
+
+// reportedRefNum returns the latest reference block a shard has reported to
+// have processed, as known after reference block refNum.
+func (bc *BlockChain) reportedRefNum(shard, refNum uint64) uint64 {
+	// This function assumes that bc.gLocked.Mu is already held
+	if bc.myshard == uint64(0) {
+		if commit, ok := bc.lastCommit[shard]; ok {
+			return commit.RefNum
+		}
+		return 0
+	}
+	if shard == bc.myshard {
+		return bc.myLatestCommit.RefNum
+	}
+	if commits, ok := bc.commitments[refNum]; ok {
+		if commit := commits.GetCommit(shard); commit != nil {
+			return commit.RefNum
+		}
+	}
+	return 0
+}
+
+// lateShards splits the shards involved in a cross-shard transaction accepted
+// in reference block expiry into the ones that reported to have processed it as
+// known after reference block number, and the ones that did not.
+func (bc *BlockChain) lateShards(shards []uint64, expiry, number uint64) ([]uint64, []uint64) {
+	// This function assumes that bc.gLocked.Mu is already held
+	var reported, late []uint64
+	for _, shard := range shards {
+		if shard == uint64(0) {
+			continue
+		}
+		if bc.reportedRefNum(shard, number) < expiry {
+			late = append(late, shard)
+		} else {
+			reported = append(reported, shard)
+		}
+	}
+	return reported, late
+}
+
+// abortsCrossTxs returns whether the cross-shard transactions accepted in
+// reference block number are aborted once their deadline passes. Only the
+// optimistic and atomic ones are, as no shard applies them before the
+// reference chain decided them; shards apply the ones run with locks as soon
+// as they have the foreign data, so these wait for it however long it takes.
+func (bc *BlockChain) abortsCrossTxs(number uint64) bool {
+	if !bc.chainConfig.IsCrossShardAbort(new(big.Int).SetUint64(number)) {
+		return false
+	}
+	return bc.OptimisticCrossShard(number) || bc.AtomicCrossShard(number)
+}
+
+// abortExpiredCrossTxs aborts the cross-shard transactions accepted one
+// deadline before block which some involved shard has not reported to have
+// processed yet, if they are aborted at all. The decision only depends on the
+// reference chain, as shards report through the state commitments it
+// includes, so every node derives the same one. It is stored against block so
+// that shards waiting for foreign data can skip the aborted transactions, and
+// along with the atomic commit decisions; reference nodes release their locks.
+// No shard has applied an aborted transaction, as atomic ones are undecided
+// until every shard voted and optimistic ones until every shard reported its
+// read versions, so the abort holds for all of them.
+func (bc *BlockChain) abortExpiredCrossTxs(block *types.Block) []common.Hash {
+	// This function assumes that bc.gLocked.Mu is already held
+	number, deadline := block.NumberU64(), bc.chainConfig.CrossShardDeadline()
+	if number <= deadline || !bc.abortsCrossTxs(number-deadline) {
+		return nil
+	}
+	maxNonCanonical := uint64(math.MaxUint64)
+	hash, expiry := bc.hc.GetAncestor(block.Hash(), number, deadline, &maxNonCanonical)
+	refTxs, ok := bc.refTxsAt(hash, expiry)
+	if !ok {
+		log.Error("Missing reference block, cross-shard deadline not enforced", "number", expiry, "hash", hash)
+		return nil
+	}
+	// Transactions accepted again after their read sets went stale expire
+	// along with the ones first accepted in the same block
+	var (
+		hashes  []common.Hash
+		involve = make(map[common.Hash][]uint64)
+		aborted = []common.Hash{}
+	)
+	for _, refTx := range refTxs {
+		tx := refTx.Tx
+		if tx.TxType() != types.CrossShard || !crossTxAccepted(refTx.Receipt) {
+			continue
+		}
+		_, shards, _, err := types.DecodeCrossTx(uint64(0), tx.Data())
+		if err != nil {
+			continue
+		}
+		hashes, involve[tx.Hash()] = append(hashes, tx.Hash()), shards
+	}
+	for _, ctx := range bc.expiredRetries(expiry) {
+		hashes, involve[ctx.RefHash] = append(hashes, ctx.RefHash), ctx.Shards
+	}
+	for _, hash := range hashes {
+		shards := involve[hash]
+		reported, late := bc.lateShards(shards, expiry, number)
+		if len(late) == 0 {
+			continue
+		}
+		if bc.myshard == uint64(0) {
+			bc.locks.Release(hash)
+		}
+		aborted = append(aborted, hash)
+		log.Info("Aborted expired cross-shard transaction", "hash", hash, "accepted", expiry, "aborted", number, "shards", shards, "reported", reported)
+		if !bc.replaying {
+			crossTxAbortedCounter.Inc(1)
+			eventlog.Emit("abort", "ref", number, "hash", hash, "accepted", expiry, "shards", shards)
+			bc.postCrossShardEvent(CrossShardEvent{Kind: CrossTxAborted, RefNum: expiry, RefHash: hash, Shard: bc.myshard, Shards: shards})
+		}
+	}
+	bc.dropReadSets(aborted, expiry, number)
+	bc.abortVotes(block, aborted)
+	rawdb.WriteCrossShardAborts(bc.db, block.Hash(), number, aborted)
+	return aborted
+}
+
+// AbortedCrossTxs returns the cross-shard transactions of reference block
+// refNum that were aborted, keyed by their reference chain hash, and whether
+// their deadline has been reached on the canonical chain. The deadline is
+// never reached for transactions that are not aborted once it passes.
+func (bc *BlockChain) AbortedCrossTxs(refNum uint64) (map[common.Hash]bool, bool) {
+	number := refNum + bc.chainConfig.CrossShardDeadline()
+	hash := rawdb.ReadCanonicalHash(bc.db, number)
+	if hash == (common.Hash{}) {
+		return nil, false
+	}
+	hashes, ok := rawdb.ReadCrossShardAborts(bc.db, hash, number)
+	if !ok {
+		return nil, false
+	}
+	aborted := make(map[common.Hash]bool, len(hashes))
+	for _, hash := range hashes {
+		aborted[hash] = true
+	}
+	return aborted, true
+}
+
+// IncompleteDataCaches returns the reference numbers whose foreign data has
+// not been fully received yet.
+func (bc *BlockChain) IncompleteDataCaches() []uint64 {
+	bc.foreignDataMu.RLock()
+	defer bc.foreignDataMu.RUnlock()
+
+	var nums []uint64
+	for num, dc := range bc.foreignData {
+		dc.DataCacheMu.RLock()
+		if !dc.Status {
+			nums = append(nums, num)
+		}
+		dc.DataCacheMu.RUnlock()
+	}
+	return nums
+}
+
+// SetShardTopology starts tracking the reassignment of validators voted on the
+// reference chain, beginning with the validators assigned at genesis.
+func (bc *BlockChain) SetShardTopology(shards map[uint64][]common.Address) {
+	bc.gLocked.Mu.Lock()
+	defer bc.gLocked.Mu.Unlock()
+
+	bc.genesisTopology = types.NewShardTopology(bc.numShard, shards)
+	head := bc.CurrentBlock()
+	bc.topology = bc.shardTopologyAt(head.Hash(), head.NumberU64())
+}
+
+// ShardTopology returns the validator assignment after the canonical reference
+// block number, or nil if reassignments are not tracked.
+func (bc *BlockChain) ShardTopology(number uint64) *types.ShardTopology {
+	if bc.genesisTopology == nil {
+		return nil
+	}
+	return bc.shardTopologyAt(rawdb.ReadCanonicalHash(bc.db, number), number)
+}
+
+// shardTopologyAt returns the validator assignment after a reference block. Blocks
+// processed before reassignments were tracked keep the genesis assignment.
+func (bc *BlockChain) shardTopologyAt(hash common.Hash, number uint64) *types.ShardTopology {
+	if topology := rawdb.ReadShardTopology(bc.db, hash, number); topology != nil {
+		return topology
+	}
+	return bc.genesisTopology
+}
+
+// updateShardTopology tallies the reassignment vote cast by a reference block
+// and moves the validators of passed votes at epoch boundaries.
+func (bc *BlockChain) updateShardTopology(block *types.Block) {
+	// This function assumes that bc.gLocked.Mu is already held
+	if bc.genesisTopology == nil {
+		return
+	}
+	var (
+		header   = block.Header()
+		number   = header.Number.Uint64()
+		topology = bc.shardTopologyAt(header.ParentHash, number-1).Copy()
+	)
+	if shard, ok := types.DecodeShardMoveNonce(header.Nonce); ok {
+		voter, err := bc.engine.Author(header)
+		if err == nil && topology.Cast(voter, header.Coinbase, shard) {
+			log.Info("Counted shard reassignment vote", "number", number, "voter", voter, "validator", header.Coinbase, "shard", shard)
+		}
+	}
+	if number%bc.chainConfig.Istanbul.EpochLength() == 0 && topology.Apply(number) {
+		log.Info("Reassigned validators between shards", "number", number, "shards", topology.Shards)
+	}
+	rawdb.WriteShardTopology(bc.db, block.Hash(), number, topology)
+
+	// Announce the assignment of the new head if it differs from the last one
+	if bc.replaying || (topology.Since == bc.topology.Since && reflect.DeepEqual(topology.Shards, bc.topology.Shards)) {
+		return
+	}
+	bc.topology = topology
+	eventlog.Emit("topology", "ref", number, "since", topology.Since, "shards", topology.Shards)
+	go bc.topologyFeed.Send(ShardTopologyEvent{Number: number, Shards: topology.Map()})
+}
+
+// genesisCheckpoint returns the cross-shard bookkeeping before any reference
+// block is processed.
+func (bc *BlockChain) genesisCheckpoint() *rawdb.CrossShardCheckpoint {
+	checkpoint := &rawdb.CrossShardCheckpoint{
+		LastCtx:      make([]uint64, bc.numShard),
+		LastUnlock:   make([]uint64, bc.numShard),
+		LatestCommit: &types.Commitment{Shard: bc.myshard, StateRoot: bc.genesisBlock.Root()},
+	}
+	for shard := uint64(0); shard < bc.numShard; shard++ {
+		checkpoint.Commits = append(checkpoint.Commits, &types.Commitment{
+			Shard:     shard,
+			StateRoot: bc.genesisBlock.Root(),
+			BHash:     bc.genesisBlock.Hash(),
+		})
+	}
+	return checkpoint
+}
+
+// crossShardCheckpoint returns the cross-shard bookkeeping after processing
+// reference block refNum.
+func (bc *BlockChain) crossShardCheckpoint(refNum uint64) *rawdb.CrossShardCheckpoint {
+	// This function assumes that bc.gLocked.Mu is already held
+	checkpoint := &rawdb.CrossShardCheckpoint{
+		ReplayFrom: refNum,
+		LastCtx:    make([]uint64, bc.numShard),
+		LastUnlock: make([]uint64, bc.numShard),
+	}
+	if bc.myshard == uint64(0) {
+		for shard := uint64(1); shard < bc.numShard; shard++ {
+			if commit, ok := bc.lastCommit[shard]; ok {
+				checkpoint.Commits = append(checkpoint.Commits, commit)
+			}
+			checkpoint.LastCtx[shard] = bc.lastCtx[shard]
+			checkpoint.LastUnlock[shard] = bc.lastUnlock[shard]
+			// Locks are held by transactions accepted after the latest report of a shard
+			replayFrom := uint64(1)
+			if commit, ok := bc.lastCommit[shard]; ok {
+				replayFrom = commit.RefNum + 1
+			}
+			if replayFrom < checkpoint.ReplayFrom {
+				checkpoint.ReplayFrom = replayFrom
+			}
+		}
+		// Transactions awaiting validation are tracked since their first acceptance
+		if from := bc.optimisticReplayFrom(); from < checkpoint.ReplayFrom {
+			checkpoint.ReplayFrom = from
+		}
+		if from := bc.atomicReplayFrom(); from < checkpoint.ReplayFrom {
+			checkpoint.ReplayFrom = from
+		}
+		return checkpoint
+	}
+	if commits, ok := bc.commitments[refNum]; ok {
+		for shard := uint64(0); shard < bc.numShard; shard++ {
+			if commit := commits.GetCommit(shard); commit != nil {
+				checkpoint.Commits = append(checkpoint.Commits, commit)
+			}
+		}
+	}
+	latest := *bc.myLatestCommit
+	checkpoint.LatestCommit = &latest
+	// Cross-shard transactions are pending since the last own commit
+	checkpoint.ReplayFrom = latest.RefNum
+	if from := bc.optimisticReplayFrom(); from < checkpoint.ReplayFrom {
+		checkpoint.ReplayFrom = from
+	}
+	if from := bc.atomicReplayFrom(); from < checkpoint.ReplayFrom {
+		checkpoint.ReplayFrom = from
+	}
+	return checkpoint
+}
+
+// writeCrossShardCheckpoint stores the cross-shard checkpoint of reference
+// block block and prunes the canonical checkpoints no longer needed. Heads are
+// only rewound within triesInMemory blocks, whose state is kept, and each of
+// them replays from its own checkpoint, so older checkpoints are finalized
+// once the oldest such head replays past them.
+func (bc *BlockChain) writeCrossShardCheckpoint(block *types.Block) {
+	// This function assumes that bc.gLocked.Mu is already held
+	number := block.NumberU64()
+	rawdb.WriteCrossShardCheckpoint(bc.db, block.Hash(), number, bc.crossShardCheckpoint(number))
+	if number <= triesInMemory {
+		return
+	}
+	oldest := number - triesInMemory
+	checkpoint := rawdb.ReadCrossShardCheckpoint(bc.db, rawdb.ReadCanonicalHash(bc.db, oldest), oldest)
+	if checkpoint == nil {
+		return
+	}
+	// Heads replay from the checkpoint preceding their ReplayFrom
+	limit := oldest
+	if checkpoint.ReplayFrom > 0 && checkpoint.ReplayFrom-1 < limit {
+		limit = checkpoint.ReplayFrom - 1
+	}
+	if bc.prunedTail == 0 {
+		// Checkpoints pruned before a restart or rewind are not looked up again
+		bc.prunedTail = limit
+	}
+	for ; bc.prunedTail < limit; bc.prunedTail++ {
+		rawdb.DeleteCrossShardCheckpoint(bc.db, rawdb.ReadCanonicalHash(bc.db, bc.prunedTail), bc.prunedTail)
+	}
+}
+
+// resetCrossShardState replaces the cross-shard bookkeeping with the one recorded
+// after processing reference block refNum.
+func (bc *BlockChain) resetCrossShardState(refNum uint64, checkpoint *rawdb.CrossShardCheckpoint) {
+	// This function assumes that bc.gLocked.Mu is already held
+	for hash := range bc.validating {
+		delete(bc.validating, hash)
+	}
+	for hash := range bc.voting {
+		delete(bc.voting, hash)
+	}
+	if bc.myshard == uint64(0) {
+		bc.locks.Reset()
+		for _, commit := range checkpoint.Commits {
+			lcommit := *commit
+			bc.lastCommit[commit.Shard] = &lcommit
+		}
+		for shard := uint64(1); shard < bc.numShard && shard < uint64(len(checkpoint.LastCtx)); shard++ {
+			bc.lastCtx[shard] = checkpoint.LastCtx[shard]
+			bc.lastUnlock[shard] = checkpoint.LastUnlock[shard]
+		}
+		return
+	}
+	for num := range bc.commitments {
+		delete(bc.commitments, num)
+	}
+	for num := range bc.pendingCrossTxs {
+		delete(bc.pendingCrossTxs, num)
+	}
+	bc.commitments[refNum] = types.NewCommitments()
+	for _, commit := range checkpoint.Commits {
+		tcommit := *commit
+		bc.commitments[refNum].AddCommit(commit.Shard, &tcommit)
+	}
+	*bc.myLatestCommit = *checkpoint.LatestCommit
+
+	bc.foreignDataMu.Lock()
+	for num := range bc.foreignData {
+		if num > refNum {
+			delete(bc.foreignData, num)
+		}
+	}
+	if _, ok := bc.foreignData[refNum]; !ok {
+		bc.foreignData[refNum] = types.NewDataCache(refNum, true)
+	}
+	bc.foreignDataMu.Unlock()
+}
+
+// loadCrossShardState rebuilds the cross-shard bookkeeping as of head. Starting
+// from the checkpoint preceding the oldest reference block still affecting it,
+// all later canonical blocks are replayed.
+func (bc *BlockChain) loadCrossShardState(head *types.Block) {
+	// This function assumes that bc.gLocked.Mu is already held
+	bc.prunedTail = 0
+
+	start := uint64(1)
+	if checkpoint := rawdb.ReadCrossShardCheckpoint(bc.db, head.Hash(), head.NumberU64()); checkpoint != nil && checkpoint.ReplayFrom > start {
+		start = checkpoint.ReplayFrom
+	}
+	base := bc.genesisCheckpoint()
+	if start > 1 {
+		hash := rawdb.ReadCanonicalHash(bc.db, start-1)
+		if checkpoint := rawdb.ReadCrossShardCheckpoint(bc.db, hash, start-1); checkpoint != nil {
+			base = checkpoint
+		} else {
+			start = 1
+		}
+	}
+	bc.resetCrossShardState(start-1, base)
+
+	for num := start; num <= head.NumberU64(); num++ {
+		if bc.HeadersOnly() {
+			if !bc.replayRefHeader(num) {
+				return
+			}
+			continue
+		}
+		block := bc.GetBlockByNumber(num)
+		if block == nil {
+			log.Error("Missing reference block, cross-shard state incomplete", "number", num)
+			return
+		}
+		receipts := bc.GetReceiptsByHash(block.Hash())
+		if len(receipts) != len(block.Transactions()) {
+			log.Error("Missing reference receipts, cross-shard state incomplete", "number", num, "hash", block.Hash())
+			return
+		}
+		bc.processRefBlock(block, receipts)
+	}
+	log.Info("Loaded cross-shard state", "number", head.Number(), "hash", head.Hash(), "replayed", head.NumberU64()+1-start)
 }
 
 // CleanPendingTx removes commited cross-shard transactions
@@ -1881,7 +2419,7 @@ func (bc *BlockChain) CleanPendingTx(blockNum uint64) {
 	}
 
 	for num := range bc.pendingCrossTxs {
-		if num < blockNum {
+		if num < blockNum && !bc.awaitingDecision(num, blockNum) {
 			if _, ok := bc.pendingCrossTxs[num]; ok {
 				delete(bc.pendingCrossTxs, num)
 				log.Debug("Cleaning cross shard transactions for", "rbn", num)
@@ -2046,6 +2584,16 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 	}
 	batch.Write()
 
+	// Roll the cross-shard bookkeeping back to the common ancestor and apply the
+	// new fork on top. The new head itself is processed once the caller wrote it.
+	if bc.tracksCrossShard() && len(oldChain) > 0 {
+		bc.gLocked.Mu.Lock()
+		bc.loadCrossShardState(commonBlock)
+		for i := len(newChain) - 1; i > 0; i-- {
+			bc.processRefBlock(newChain[i], bc.GetReceiptsByHash(newChain[i].Hash()))
+		}
+		bc.gLocked.Mu.Unlock()
+	}
 	if len(deletedLogs) > 0 {
 		go bc.rmLogsFeed.Send(RemovedLogsEvent{deletedLogs})
 	}
@@ -2285,6 +2833,11 @@ func (bc *BlockChain) SubscribeChainHeadEvent(ch chan<- ChainHeadEvent) event.Su
 	return bc.scope.Track(bc.chainHeadFeed.Subscribe(ch))
 }
 
+// SubscribeShardTopologyEvent registers a subscription of ShardTopologyEvent.
+func (bc *BlockChain) SubscribeShardTopologyEvent(ch chan<- ShardTopologyEvent) event.Subscription {
+	return bc.scope.Track(bc.topologyFeed.Subscribe(ch))
+}
+
 // SubscribeForeignDataEvent registers a foriegn data signal
 func (bc *BlockChain) SubscribeForeignDataEvent(ch chan<- ForeignDataEvent) event.Subscription {
 	return bc.scope.Track(bc.foreignDataFeed.Subscribe(ch))
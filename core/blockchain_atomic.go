@@ -0,0 +1,565 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/metrics/eventlog"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// In atomic mode cross-shard transactions are committed in two phases. Every
+// involved shard prepares a transaction in the block that would otherwise
+// execute it: the call runs on a copy of the state and, instead of being
+// applied, its writes to the local state are buffered in the registry account
+// along with the vote of the shard, to commit if the call succeeded and to
+// abort otherwise. Votes are proven in the next state commitment. Once every
+// involved shard has voted, shards and reference nodes alike decide the
+// transaction, and the shards apply or drop the buffered writes in the first
+// block processing the deciding reference block. Until then local
+// transactions may not change the state a prepared transaction buffered
+// writes for, and reference nodes keep the keys of a committed transaction
+// locked until the state commitments of the shards cover the decision.
+
+// CrossTxVoteRegistry is the account whose storage holds the votes and the
+// buffered writes of the atomic cross-shard transactions prepared by a shard.
+var CrossTxVoteRegistry = common.HexToAddress("0x00000000000000000000000000000000000000f2")
+
+// undecidedLock is the reference block recorded for the locks of an atomic
+// cross-shard transaction until it is decided, which no commitment covers.
+const undecidedLock = math.MaxUint64
+
+// ErrUndeclaredCrossTxWrite is returned when a prepared cross-shard transaction
+// changes local state its read-write set does not declare, which the shard
+// votes to abort as its buffered writes would not carry the change.
+var ErrUndeclaredCrossTxWrite = errors.New("cross-shard transaction changes undeclared state")
+
+var crossTxCommittedCounter = metrics.NewRegisteredCounter("chain/crossshard/committed", nil)
+
+// crossTxVoting tracks an atomic cross-shard transaction from its acceptance
+// until every involved shard has applied the decision.
+type crossTxVoting struct {
+	ctx   *types.CrossTx
+	votes map[uint64]bool // Vote of every involved shard that reported, true to commit
+}
+
+// bufferedAccount is the local state of an account written by a prepared
+// cross-shard transaction.
+type bufferedAccount struct {
+	Addr    common.Address
+	Nonce   uint64
+	Balance *big.Int
+	Keys    []common.Hash
+	Values  []common.Hash
+}
+
+// AtomicCrossShard returns whether the cross-shard transactions accepted in
+// reference block number are committed in two phases decided by the reference
+// chain.
+func (bc *BlockChain) AtomicCrossShard(number uint64) bool {
+	return bc.chainConfig.IsAtomicCrossShard(new(big.Int).SetUint64(number))
+}
+
+// votingShards returns the number of shards voting on ctx.
+func votingShards(ctx *types.CrossTx) int {
+	n := 0
+	for _, shard := range ctx.Shards {
+		if shard != uint64(0) {
+			n++
+		}
+	}
+	return n
+}
+
+// involves returns whether shard executes part of ctx.
+func involves(ctx *types.CrossTx, shard uint64) bool {
+	for _, s := range ctx.Shards {
+		if s == shard {
+			return true
+		}
+	}
+	return false
+}
+
+// trackVotes starts waiting for the votes on an atomic cross-shard transaction
+// accepted in reference block ctx.BlockNum.
+func (bc *BlockChain) trackVotes(ctx *types.CrossTx) {
+	// This function assumes that bc.gLocked.Mu is already held
+	bc.voting[ctx.RefHash] = &crossTxVoting{ctx: ctx, votes: make(map[uint64]bool)}
+}
+
+// recordVotes applies the votes proven by a state commitment of shard
+// reporting reference block report. The undecided transactions the commitment
+// covers but proves no vote for count as aborted by the shard.
+func (bc *BlockChain) recordVotes(tx *types.Transaction, shard, report uint64) {
+	// This function assumes that bc.gLocked.Mu is already held
+	var votes map[common.Hash]bool
+	if header, err := types.DecodeStateCommitHeader(tx); err == nil {
+		if cv, err := types.DecodeStateCommitVotes(tx); err != nil {
+			log.Warn("Ignoring malformed votes", "shard", shard, "hash", tx.Hash(), "err", err)
+		} else if cv != nil {
+			if votes, err = cv.Verify(header.Root, CrossTxVoteRegistry); err != nil {
+				log.Warn("Ignoring unproven votes", "shard", shard, "hash", tx.Hash(), "err", err)
+			}
+		}
+	}
+	for _, v := range bc.voting {
+		ctx := v.ctx
+		if ctx.Resolved != 0 || ctx.BlockNum.Uint64() > report || !involves(ctx, shard) {
+			continue
+		}
+		if _, ok := v.votes[shard]; !ok {
+			v.votes[shard] = votes[ctx.Tx.Hash()]
+		}
+	}
+}
+
+// resolveCrossTxs decides the atomic cross-shard transactions every involved
+// shard has voted on as of block: they are committed if all votes are to
+// commit and aborted otherwise. Reference nodes keep the keys of committed
+// transactions locked until the shards report block, and release the keys of
+// aborted ones right away.
+func (bc *BlockChain) resolveCrossTxs(block *types.Block) {
+	// This function assumes that bc.gLocked.Mu is already held
+	number := block.NumberU64()
+
+	var decided []*crossTxVoting
+	for _, v := range bc.voting {
+		if v.ctx.Resolved == 0 && len(v.votes) == votingShards(v.ctx) {
+			decided = append(decided, v)
+		}
+	}
+	sort.Slice(decided, func(i, j int) bool {
+		if bi, bj := decided[i].ctx.BlockNum.Uint64(), decided[j].ctx.BlockNum.Uint64(); bi != bj {
+			return bi < bj
+		}
+		return bytes.Compare(decided[i].ctx.RefHash[:], decided[j].ctx.RefHash[:]) < 0
+	})
+	decisions := make([]*rawdb.CrossTxDecision, 0, len(decided))
+	for _, v := range decided {
+		ctx, commit := v.ctx, true
+		for _, vote := range v.votes {
+			commit = commit && vote
+		}
+		ctx.Resolved, ctx.Aborted = number, !commit
+		decisions = append(decisions, &rawdb.CrossTxDecision{Hash: ctx.RefHash, Commit: commit})
+
+		if bc.myshard == uint64(0) {
+			if commit {
+				bc.locks.Acquire(ctx.RefHash, number, ctx.AllContracts)
+			} else {
+				bc.locks.Release(ctx.RefHash)
+				delete(bc.voting, ctx.RefHash)
+			}
+		}
+		log.Debug("Decided cross-shard transaction", "hash", ctx.RefHash, "accepted", ctx.BlockNum, "ref", number, "commit", commit)
+		if bc.replaying {
+			continue
+		}
+		local, kind := ctx.Tx.Hash(), CrossTxVoted
+		if commit {
+			crossTxCommittedCounter.Inc(1)
+		} else {
+			crossTxAbortedCounter.Inc(1)
+			kind = CrossTxAborted
+		}
+		eventlog.Emit("decide", "ref", number, "hash", ctx.RefHash, "accepted", ctx.BlockNum, "commit", commit, "shards", ctx.Shards)
+		bc.postCrossShardEvent(CrossShardEvent{Kind: kind, RefNum: ctx.BlockNum.Uint64(), RefHash: ctx.RefHash, LocalHash: &local, Shard: bc.myshard, Shards: ctx.Shards})
+	}
+	if len(decisions) > 0 {
+		rawdb.WriteCrossTxDecisions(bc.db, block.Hash(), number, decisions)
+	}
+}
+
+// abortVotes aborts the atomic cross-shard transactions whose deadline passed
+// in reference block before every involved shard voted, recording the aborts
+// along with the decisions taken in block.
+func (bc *BlockChain) abortVotes(block *types.Block, hashes []common.Hash) {
+	// This function assumes that bc.gLocked.Mu is already held
+	number := block.NumberU64()
+
+	var decisions []*rawdb.CrossTxDecision
+	for _, hash := range hashes {
+		if v, ok := bc.voting[hash]; ok && v.ctx.Resolved == 0 {
+			v.ctx.Resolved, v.ctx.Aborted = number, true
+			decisions = append(decisions, &rawdb.CrossTxDecision{Hash: hash, Commit: false})
+			if bc.myshard == uint64(0) {
+				delete(bc.voting, hash)
+			}
+		}
+	}
+	if len(decisions) > 0 {
+		decisions = append(rawdb.ReadCrossTxDecisions(bc.db, block.Hash(), number), decisions...)
+		rawdb.WriteCrossTxDecisions(bc.db, block.Hash(), number, decisions)
+	}
+}
+
+// finishVotes stops tracking the decided atomic cross-shard transactions
+// whose decision has been applied, as far as the bookkeeping tells: shards
+// have committed a block processing the deciding reference block, and
+// reference nodes no longer hold the locks of the transaction.
+func (bc *BlockChain) finishVotes() {
+	// This function assumes that bc.gLocked.Mu is already held
+	for hash, v := range bc.voting {
+		if v.ctx.Resolved == 0 {
+			continue
+		}
+		if bc.myshard == uint64(0) {
+			if !bc.locks.Holding(hash) {
+				delete(bc.voting, hash)
+			}
+		} else if bc.myLatestCommit.RefNum >= v.ctx.Resolved {
+			delete(bc.voting, hash)
+		}
+	}
+}
+
+// atomicReplayFrom returns the oldest reference block that accepted an atomic
+// cross-shard transaction still tracked, or math.MaxUint64 if there is none.
+func (bc *BlockChain) atomicReplayFrom() uint64 {
+	// This function assumes that bc.gLocked.Mu is already held
+	from := uint64(math.MaxUint64)
+	for _, v := range bc.voting {
+		if number := v.ctx.BlockNum.Uint64(); number < from {
+			from = number
+		}
+	}
+	return from
+}
+
+// crossTxDecision looks up the atomic commit decision on a cross-shard
+// transaction accepted in the canonical reference block number. It returns
+// the deciding block, whether the transaction was committed and whether it
+// was decided at all.
+func (bc *BlockChain) crossTxDecision(hash common.Hash, number uint64) (uint64, bool, bool) {
+	last := number + bc.chainConfig.CrossShardDeadline()
+	if head := bc.CurrentBlock().NumberU64(); head < last {
+		last = head
+	}
+	for n := number; n <= last; n++ {
+		for _, decision := range rawdb.ReadCrossTxDecisions(bc.db, rawdb.ReadCanonicalHash(bc.db, n), n) {
+			if decision.Hash == hash {
+				return n, decision.Commit, true
+			}
+		}
+	}
+	return 0, false, false
+}
+
+// voteSlot returns the registry value storing a vote.
+func voteSlot(vote uint64) common.Hash {
+	return common.BigToHash(new(big.Int).SetUint64(vote))
+}
+
+// bufferSlot returns the i-th registry slot of the writes buffered by the
+// transaction with local hash. The first slot holds the length of their
+// encoding, the following ones the encoding itself.
+func bufferSlot(hash common.Hash, i uint64) common.Hash {
+	base := new(big.Int).SetBytes(crypto.Keccak256(hash.Bytes()))
+	return common.BigToHash(base.Add(base, new(big.Int).SetUint64(i)))
+}
+
+// storeWrites buffers the writes of the transaction with local hash in the
+// registry.
+func storeWrites(statedb *state.StateDB, hash common.Hash, writes []*bufferedAccount) error {
+	data, err := rlp.EncodeToBytes(writes)
+	if err != nil {
+		return err
+	}
+	statedb.SetState(CrossTxVoteRegistry, bufferSlot(hash, 0), common.BigToHash(new(big.Int).SetUint64(uint64(len(data)))))
+	for i := 0; i < len(data); i += common.HashLength {
+		end := i + common.HashLength
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := common.RightPadBytes(data[i:end], common.HashLength)
+		statedb.SetState(CrossTxVoteRegistry, bufferSlot(hash, uint64(1+i/common.HashLength)), common.BytesToHash(chunk))
+	}
+	return nil
+}
+
+// bufferedLength returns the length of the encoded writes buffered by the
+// transaction with local hash.
+func bufferedLength(statedb *state.StateDB, hash common.Hash) uint64 {
+	size := statedb.GetState(CrossTxVoteRegistry, bufferSlot(hash, 0)).Big()
+	if !size.IsUint64() {
+		return 0
+	}
+	return size.Uint64()
+}
+
+// loadWrites returns the writes buffered by the transaction with local hash.
+func loadWrites(statedb *state.StateDB, hash common.Hash) ([]*bufferedAccount, error) {
+	size := bufferedLength(statedb, hash)
+	if size == 0 {
+		return nil, nil
+	}
+	data := make([]byte, 0, size+common.HashLength)
+	for i := uint64(1); uint64(len(data)) < size; i++ {
+		data = append(data, statedb.GetState(CrossTxVoteRegistry, bufferSlot(hash, i)).Bytes()...)
+	}
+	var writes []*bufferedAccount
+	if err := rlp.DecodeBytes(data[:size], &writes); err != nil {
+		return nil, err
+	}
+	return writes, nil
+}
+
+// clearPrepared removes the vote and the buffered writes of the transaction
+// with local hash from the registry.
+func clearPrepared(statedb *state.StateDB, hash common.Hash) {
+	size := bufferedLength(statedb, hash)
+	for i := uint64(0); i <= (size+common.HashLength-1)/common.HashLength; i++ {
+		statedb.SetState(CrossTxVoteRegistry, bufferSlot(hash, i), common.Hash{})
+	}
+	statedb.SetState(CrossTxVoteRegistry, hash, common.Hash{})
+}
+
+// crossTxWrites returns the local state a prepared call changed in work. The
+// call may only change the write keys of its read-write set, along with the
+// nonce and balance of its accounts, sender and receiver, as the buffered
+// writes are made of these. It returns ErrUndeclaredCrossTxWrite if the call
+// changed any other state, e.g. by transferring value to another account or
+// by creating a contract.
+func crossTxWrites(statedb, work *state.StateDB, tx *types.Transaction, contracts []*types.CKeys) ([]*bufferedAccount, error) {
+	var (
+		accounts []common.Address
+		declared = make(map[common.Address][]common.Hash)
+		seen     = make(map[storageKey]bool)
+	)
+	declare := func(addr common.Address, keys []common.Hash) {
+		if _, ok := declared[addr]; !ok {
+			accounts, declared[addr] = append(accounts, addr), []common.Hash{}
+		}
+		for _, key := range keys {
+			if !seen[storageKey{addr, key}] {
+				seen[storageKey{addr, key}] = true
+				declared[addr] = append(declared[addr], key)
+			}
+		}
+	}
+	for _, contract := range contracts {
+		declare(contract.Addr, contract.WKeys)
+	}
+	declare(tx.From(), nil)
+	if to := tx.To(); to != nil {
+		declare(*to, nil)
+	}
+	var writes []*bufferedAccount
+	for _, addr := range accounts {
+		acc := &bufferedAccount{Addr: addr, Nonce: work.GetNonce(addr), Balance: new(big.Int).Set(work.GetBalance(addr))}
+		changed := acc.Nonce != statedb.GetNonce(addr) || acc.Balance.Cmp(statedb.GetBalance(addr)) != 0
+		for _, key := range declared[addr] {
+			if val := work.GetState(addr, key); val != statedb.GetState(addr, key) {
+				acc.Keys, acc.Values = append(acc.Keys, key), append(acc.Values, val)
+			}
+		}
+		if changed || len(acc.Keys) > 0 {
+			writes = append(writes, acc)
+		}
+	}
+	// Replay the buffered writes to tell whether the call changed anything else
+	expect := statedb.Copy()
+	applyWrites(expect, writes)
+	expect.Finalise(false)
+	for _, addr := range work.DirtyAccounts() {
+		if !sameAccount(expect, work, addr) {
+			return nil, ErrUndeclaredCrossTxWrite
+		}
+	}
+	return writes, nil
+}
+
+// applyWrites applies the writes buffered by a prepared cross-shard
+// transaction to statedb.
+func applyWrites(statedb *state.StateDB, writes []*bufferedAccount) {
+	for _, acc := range writes {
+		statedb.SetNonce(acc.Addr, acc.Nonce)
+		statedb.SetBalance(acc.Addr, acc.Balance)
+		for i, key := range acc.Keys {
+			statedb.SetState(acc.Addr, key, acc.Values[i])
+		}
+	}
+}
+
+// sameAccount returns whether addr holds the same account in both states.
+func sameAccount(a, b *state.StateDB, addr common.Address) bool {
+	if a.Exist(addr) != b.Exist(addr) {
+		return false
+	}
+	if !a.Exist(addr) {
+		return true
+	}
+	if a.GetNonce(addr) != b.GetNonce(addr) || a.GetBalance(addr).Cmp(b.GetBalance(addr)) != 0 || a.GetCodeHash(addr) != b.GetCodeHash(addr) {
+		return false
+	}
+	rootA, _ := a.GetStorageRoot(addr)
+	rootB, _ := b.GetStorageRoot(addr)
+	return rootA == rootB
+}
+
+// PrepareCrossTransaction prepares the atomic commit of the CrossShardLocal
+// transaction of ctx. The call is applied to a copy of statedb, and its writes
+// to the local state are buffered in the registry instead, along with the vote
+// of the shard. The shard votes to abort if the call fails or changes state
+// its read-write set does not declare. The returned receipt reports the vote
+// and carries no logs, as the call has no effect until the reference chain
+// commits it.
+//
+// The gas the call used is paid right away whatever the vote, as for a failed
+// local transaction. The fee is not buffered since that would keep the block
+// beneficiary from being paid by later transactions until the decision.
+func PrepareCrossTransaction(config *params.ChainConfig, bc *BlockChain, author *common.Address, gp *GasPool, dc *types.DataCache, statedb *state.StateDB, header *types.Header, tx *types.Transaction, ctx *types.CrossTx, usedGas *uint64, cfg vm.Config) *types.Receipt {
+	work := statedb.Copy()
+	receipt, _, _, err := ApplyTransaction(config, bc, author, gp, dc, work, work, header, tx, usedGas, cfg)
+	if err == nil {
+		var beneficiary common.Address
+		if author == nil {
+			beneficiary, _ = bc.Engine().Author(header) // Ignore error, we're past header validation
+		} else {
+			beneficiary = *author
+		}
+		fee := new(big.Int).Mul(new(big.Int).SetUint64(receipt.GasUsed), tx.GasPrice())
+		statedb.SubBalance(tx.From(), fee)
+		statedb.AddBalance(beneficiary, fee)
+	}
+
+	vote := types.VoteAbort
+	if err == nil && receipt.Status == types.ReceiptStatusSuccessful {
+		var writes []*bufferedAccount
+		if writes, err = crossTxWrites(statedb, work, tx, ctx.AllContracts[bc.myshard]); err == nil {
+			err = storeWrites(statedb, tx.Hash(), writes)
+		}
+		if err == nil {
+			vote = types.VoteCommit
+		}
+	}
+	// Keep the registry from being deleted as an empty account
+	if statedb.GetNonce(CrossTxVoteRegistry) == 0 {
+		statedb.SetNonce(CrossTxVoteRegistry, 1)
+	}
+	statedb.SetState(CrossTxVoteRegistry, tx.Hash(), voteSlot(vote))
+
+	if err != nil {
+		log.Debug("Failed to prepare cross-shard transaction", "hash", tx.Hash(), "err", err)
+		return FailedCrossShardReceipt(config, header, statedb, tx, *usedGas, err)
+	}
+	if config.IsByzantium(header.Number) {
+		statedb.Finalise(true)
+	} else {
+		receipt.PostState = statedb.IntermediateRoot(config.IsEIP158(header.Number)).Bytes()
+	}
+	receipt.Logs = []*types.Log{}
+	receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+	return receipt
+}
+
+// ApplyCrossTxDecisions applies the writes buffered by the atomic cross-shard
+// transactions committed in the reference blocks from to header.RefNumber,
+// and drops the ones of the transactions aborted in them. It must be applied
+// at the start of the shard block, before its transactions.
+func (bc *BlockChain) ApplyCrossTxDecisions(statedb *state.StateDB, header *types.Header, from uint64) {
+	to := header.RefNumber.Uint64()
+	if !bc.AtomicCrossShard(to) || bc.ref || bc.myshard == uint64(0) {
+		return
+	}
+
+	bc.gLocked.Mu.RLock()
+	prepared, earlier := bc.preparedCrossTxs(from, to)
+	bc.gLocked.Mu.RUnlock()
+
+	for _, ctx := range append(earlier, prepared...) {
+		if ctx.Resolved < from || ctx.Resolved > to {
+			continue
+		}
+		hash := ctx.Tx.Hash()
+		vote := statedb.GetState(CrossTxVoteRegistry, hash)
+		if vote == (common.Hash{}) {
+			continue
+		}
+		if !ctx.Aborted && vote == voteSlot(types.VoteCommit) {
+			writes, err := loadWrites(statedb, hash)
+			if err != nil {
+				log.Error("Dropping undecodable buffered writes", "hash", ctx.RefHash, "local", hash, "err", err)
+			}
+			applyWrites(statedb, writes)
+		}
+		clearPrepared(statedb, hash)
+	}
+}
+
+// pinPrepared adds to ps the local state of the atomic cross-shard
+// transactions statedb holds commit votes for and which are undecided in the
+// reference blocks up to to: their read-write sets and the accounts they
+// buffered writes for.
+func (bc *BlockChain) pinPrepared(ps *PinnedState, statedb *state.StateDB, ctxs []*types.CrossTx, to uint64) {
+	for _, ctx := range ctxs {
+		if ctx.Resolved != 0 && ctx.Resolved <= to {
+			continue
+		}
+		hash := ctx.Tx.Hash()
+		if statedb.GetState(CrossTxVoteRegistry, hash) != voteSlot(types.VoteCommit) {
+			continue
+		}
+		for _, contract := range ctx.AllContracts[bc.myshard] {
+			ps.pin(statedb, contract.Addr, contract.Keys)
+		}
+		writes, _ := loadWrites(statedb, hash)
+		for _, acc := range writes {
+			ps.pin(statedb, acc.Addr, acc.Keys)
+		}
+	}
+}
+
+// CrossTxVotes returns the votes of the shard on the undecided atomic
+// cross-shard transactions as stored by the committed block header, for its
+// state commitment. It returns nil unless the shard commits cross-shard
+// transactions atomically.
+func (bc *BlockChain) CrossTxVotes(header *types.Header) *types.CrossTxVotes {
+	if !bc.AtomicCrossShard(header.RefNumber.Uint64()) || bc.myshard == uint64(0) {
+		return nil
+	}
+	bc.gLocked.Mu.RLock()
+	prepared, _ := bc.preparedCrossTxs(0, header.RefNumber.Uint64())
+	bc.gLocked.Mu.RUnlock()
+
+	txs := []common.Hash{}
+	for _, ctx := range prepared {
+		if bc.AtomicCrossShard(ctx.BlockNum.Uint64()) && ctx.Resolved == 0 {
+			txs = append(txs, ctx.Tx.Hash())
+		}
+	}
+	kvs := bc.StateData(header.Root, []*types.CKeys{{Addr: CrossTxVoteRegistry, Keys: txs}})
+	if len(kvs) != 1 {
+		return nil
+	}
+	return &types.CrossTxVotes{Txs: txs, Proof: kvs[0]}
+}
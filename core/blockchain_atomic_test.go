@@ -0,0 +1,295 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestResolveCrossTxs(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	bc := &BlockChain{db: db, myshard: 1, replaying: true, voting: make(map[common.Hash]*crossTxVoting), myLatestCommit: &types.Commitment{}}
+
+	committed := optimisticCrossTx(1, 5, map[common.Hash]bool{crossKeyA: true})
+	aborted := optimisticCrossTx(2, 5, map[common.Hash]bool{crossKeyB: true})
+	waiting := optimisticCrossTx(3, 6, map[common.Hash]bool{crossKeyB: false})
+	for _, ctx := range []*types.CrossTx{committed, aborted, waiting} {
+		bc.trackVotes(ctx)
+	}
+	bc.voting[committed.RefHash].votes = map[uint64]bool{1: true, 2: true}
+	bc.voting[aborted.RefHash].votes = map[uint64]bool{1: true, 2: false}
+	bc.voting[waiting.RefHash].votes = map[uint64]bool{1: true}
+
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(8)})
+	bc.resolveCrossTxs(block)
+	if committed.Resolved != 8 || committed.Aborted {
+		t.Errorf("unanimous transaction: resolved %d, aborted %v", committed.Resolved, committed.Aborted)
+	}
+	if aborted.Resolved != 8 || !aborted.Aborted {
+		t.Errorf("vetoed transaction: resolved %d, aborted %v", aborted.Resolved, aborted.Aborted)
+	}
+	if waiting.Resolved != 0 {
+		t.Errorf("partially voted transaction decided in %d", waiting.Resolved)
+	}
+	decisions := rawdb.ReadCrossTxDecisions(db, block.Hash(), 8)
+	if len(decisions) != 2 || decisions[0].Hash != committed.RefHash || !decisions[0].Commit || decisions[1].Hash != aborted.RefHash || decisions[1].Commit {
+		t.Fatalf("stored decisions mismatch: %v", decisions)
+	}
+	// Deadline aborts only affect undecided transactions
+	expired := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(9)})
+	bc.abortVotes(expired, []common.Hash{committed.RefHash, waiting.RefHash})
+	if committed.Aborted || waiting.Resolved != 9 || !waiting.Aborted {
+		t.Errorf("deadline abort mismatch: committed aborted %v, waiting resolved %d", committed.Aborted, waiting.Resolved)
+	}
+	decisions = rawdb.ReadCrossTxDecisions(db, expired.Hash(), 9)
+	if len(decisions) != 1 || decisions[0].Hash != waiting.RefHash || decisions[0].Commit {
+		t.Fatalf("stored abort mismatch: %v", decisions)
+	}
+	// Decisions are tracked until the shard commits a block applying them
+	bc.myLatestCommit.RefNum = 8
+	bc.finishVotes()
+	if _, ok := bc.voting[committed.RefHash]; ok {
+		t.Errorf("applied decision still tracked")
+	}
+	if _, ok := bc.voting[waiting.RefHash]; !ok {
+		t.Errorf("unapplied decision dropped")
+	}
+	if from := bc.atomicReplayFrom(); from != 6 {
+		t.Errorf("replay start mismatch: have %d, want 6", from)
+	}
+}
+
+func TestCrossShardEvents(t *testing.T) {
+	metrics.Enabled = true
+	defer func(counter metrics.Counter) {
+		metrics.Enabled = false
+		crossShardEvDropCounter = counter
+	}(crossShardEvDropCounter)
+	crossShardEvDropCounter = metrics.NewCounter()
+
+	bc := &BlockChain{
+		db:             ethdb.NewMemDatabase(),
+		myshard:        1,
+		voting:         make(map[common.Hash]*crossTxVoting),
+		myLatestCommit: &types.Commitment{},
+		crossShardCh:   make(chan CrossShardEvent, crossShardEvChanSize),
+		quit:           make(chan struct{}),
+	}
+	events := make(chan CrossShardEvent, 2*crossShardEvChanSize)
+	sub := bc.SubscribeCrossShardEvent(events)
+	defer sub.Unsubscribe()
+
+	// Prepared transactions are committed or aborted once every shard voted
+	committed := optimisticCrossTx(2, 5, map[common.Hash]bool{crossKeyA: true})
+	aborted := optimisticCrossTx(1, 5, map[common.Hash]bool{crossKeyB: true})
+	for _, ctx := range []*types.CrossTx{committed, aborted} {
+		bc.trackVotes(ctx)
+	}
+	bc.voting[committed.RefHash].votes = map[uint64]bool{1: true, 2: true}
+	bc.voting[aborted.RefHash].votes = map[uint64]bool{1: true, 2: false}
+	bc.resolveCrossTxs(types.NewBlockWithHeader(&types.Header{Number: big.NewInt(8)}))
+
+	// Events beyond the queue capacity are dropped rather than blocking
+	for i := 0; i < crossShardEvChanSize-1; i++ {
+		bc.postCrossShardEvent(CrossShardEvent{Kind: StateCommitted, RefNum: uint64(i)})
+	}
+	if dropped := crossShardEvDropCounter.Count(); dropped != 1 {
+		t.Errorf("dropped event count mismatch: have %d, want 1", dropped)
+	}
+	go bc.crossShardLoop()
+	defer close(bc.quit)
+
+	// Decisions are delivered in the order of the accepting block and hash
+	for i, want := range []*CrossShardEvent{
+		{Kind: CrossTxAborted, RefHash: aborted.RefHash},
+		{Kind: CrossTxVoted, RefHash: committed.RefHash},
+	} {
+		ev := <-events
+		if ev.Kind != want.Kind || ev.RefHash != want.RefHash || ev.RefNum != 5 || ev.Shard != 1 || len(ev.Shards) != 2 {
+			t.Fatalf("event %d mismatch: have %+v, want %+v", i, ev, want)
+		}
+	}
+	for i := 0; i < crossShardEvChanSize-2; i++ {
+		if ev := <-events; ev.Kind != StateCommitted || ev.RefNum != uint64(i) {
+			t.Fatalf("queued event %d mismatch: %+v", i, ev)
+		}
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("dropped event delivered: %+v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestPreparedWrites(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(ethdb.NewMemDatabase()))
+	hash := common.HexToHash("0x01")
+
+	keys := make([]common.Hash, 4)
+	for i := range keys {
+		keys[i] = common.BigToHash(big.NewInt(int64(i)))
+	}
+	writes := []*bufferedAccount{
+		{Addr: crossAddr, Nonce: 3, Balance: big.NewInt(7), Keys: keys, Values: keys},
+		{Addr: common.Address{2}, Nonce: 1, Balance: new(big.Int)},
+	}
+	if err := storeWrites(statedb, hash, writes); err != nil {
+		t.Fatalf("failed to store writes: %v", err)
+	}
+	stored, err := loadWrites(statedb, hash)
+	if err != nil {
+		t.Fatalf("failed to load writes: %v", err)
+	}
+	if len(stored) != len(writes) {
+		t.Fatalf("write count mismatch: have %d, want %d", len(stored), len(writes))
+	}
+	for i, acc := range stored {
+		want := writes[i]
+		if acc.Addr != want.Addr || acc.Nonce != want.Nonce || acc.Balance.Cmp(want.Balance) != 0 || len(acc.Keys) != len(want.Keys) || len(acc.Values) != len(want.Values) {
+			t.Errorf("write %d mismatch: have %+v, want %+v", i, acc, want)
+		}
+	}
+	statedb.SetState(CrossTxVoteRegistry, hash, voteSlot(types.VoteCommit))
+	clearPrepared(statedb, hash)
+	if stored, _ := loadWrites(statedb, hash); stored != nil {
+		t.Errorf("cleared writes still stored: %v", stored)
+	}
+	for i := uint64(0); i < 16; i++ {
+		if val := statedb.GetState(CrossTxVoteRegistry, bufferSlot(hash, i)); val != (common.Hash{}) {
+			t.Errorf("slot %d not cleared: %x", i, val)
+		}
+	}
+	if vote := statedb.GetState(CrossTxVoteRegistry, hash); vote != (common.Hash{}) {
+		t.Errorf("vote not cleared: %x", vote)
+	}
+}
+
+func TestCrossTxWrites(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(ethdb.NewMemDatabase()))
+	statedb.SetNonce(crossAddr, 1)
+	statedb.SetState(crossAddr, crossKeyB, common.Hash{1})
+	statedb.Finalise(true)
+
+	ctx := optimisticCrossTx(1, 5, map[common.Hash]bool{crossKeyA: true, crossKeyB: false})
+	contracts := ctx.AllContracts[1]
+
+	// Declared writes are buffered along with the nonces and balances
+	work := statedb.Copy()
+	work.SetState(crossAddr, crossKeyA, common.Hash{2})
+	work.AddBalance(crossAddr, big.NewInt(3))
+	work.SetNonce(ctx.Tx.From(), 1)
+	work.Finalise(true)
+
+	writes, err := crossTxWrites(statedb, work, ctx.Tx, contracts)
+	if err != nil {
+		t.Fatalf("failed to buffer declared writes: %v", err)
+	}
+	if len(writes) != 2 || writes[0].Addr != crossAddr || len(writes[0].Keys) != 1 || writes[0].Keys[0] != crossKeyA || writes[1].Addr != ctx.Tx.From() {
+		t.Fatalf("buffered writes mismatch: %+v", writes)
+	}
+	// Any other change is undeclared
+	for i, write := range []func(*state.StateDB){
+		func(s *state.StateDB) { s.SetState(crossAddr, crossKeyB, common.Hash{2}) },
+		func(s *state.StateDB) { s.SetState(crossAddr, common.HexToHash("0x0c"), common.Hash{2}) },
+		func(s *state.StateDB) { s.AddBalance(common.Address{9}, big.NewInt(1)) },
+		func(s *state.StateDB) { s.SetCode(common.Address{9}, []byte{1}) },
+	} {
+		work := statedb.Copy()
+		write(work)
+		work.Finalise(true)
+		if _, err := crossTxWrites(statedb, work, ctx.Tx, contracts); err != ErrUndeclaredCrossTxWrite {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, ErrUndeclaredCrossTxWrite)
+		}
+	}
+}
+
+func TestApplyCrossTxDecisions(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(ethdb.NewMemDatabase()))
+	bc := &BlockChain{
+		chainConfig:     &params.ChainConfig{AtomicCrossShardBlock: big.NewInt(0)},
+		myshard:         1,
+		gLocked:         types.NewRWLock(),
+		pendingCrossTxs: map[uint64]types.CrossShardTxs{5: types.NewCrossShardTxs()},
+	}
+	committed := optimisticCrossTx(1, 5, map[common.Hash]bool{crossKeyA: true})
+	aborted := optimisticCrossTx(2, 5, map[common.Hash]bool{crossKeyB: true})
+	undecided := optimisticCrossTx(3, 5, map[common.Hash]bool{crossKeyB: true})
+	committed.Resolved = 7
+	aborted.Resolved, aborted.Aborted = 7, true
+	for i, ctx := range []*types.CrossTx{committed, aborted, undecided} {
+		bc.pendingCrossTxs[5].AddTransaction(uint64(i), ctx)
+		hash := ctx.Tx.Hash()
+		key := crossKeyA
+		if ctx != committed {
+			key = crossKeyB
+		}
+		storeWrites(statedb, hash, []*bufferedAccount{{Addr: crossAddr, Nonce: 1, Balance: big.NewInt(int64(i + 1)), Keys: []common.Hash{key}, Values: []common.Hash{hash}}})
+		statedb.SetState(CrossTxVoteRegistry, hash, voteSlot(types.VoteCommit))
+	}
+	// Undecided transactions pin the state they buffered writes for
+	header := &types.Header{RefNumber: big.NewInt(6)}
+	if ps := bc.PinnedState(statedb, header, 6); ps == nil || len(ps.values) != 2 {
+		t.Fatalf("prepared state not pinned: %+v", ps)
+	}
+	header.RefNumber = big.NewInt(7)
+	bc.ApplyCrossTxDecisions(statedb, header, 7)
+
+	if val := statedb.GetState(crossAddr, crossKeyA); val != committed.Tx.Hash() {
+		t.Errorf("committed write not applied: have %x", val)
+	}
+	if val := statedb.GetState(crossAddr, crossKeyB); val != (common.Hash{}) {
+		t.Errorf("aborted or undecided write applied: have %x", val)
+	}
+	if balance := statedb.GetBalance(crossAddr); balance.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("balance mismatch: have %v, want 1", balance)
+	}
+	for _, ctx := range []*types.CrossTx{committed, aborted} {
+		if vote := statedb.GetState(CrossTxVoteRegistry, ctx.Tx.Hash()); vote != (common.Hash{}) {
+			t.Errorf("decided vote not cleared: %x", vote)
+		}
+	}
+	if stored, _ := loadWrites(statedb, undecided.Tx.Hash()); len(stored) != 1 {
+		t.Errorf("undecided writes dropped")
+	}
+}
+
+func TestDeadlineAborts(t *testing.T) {
+	config := &params.ChainConfig{AtomicCrossShardBlock: big.NewInt(5), CrossShardAbortBlock: big.NewInt(10)}
+	bc := &BlockChain{chainConfig: config}
+
+	// Transactions are only aborted past the fork, and once shards apply them
+	// after the reference chain decided them
+	for number, want := range map[uint64]bool{0: false, 5: false, 9: false, 10: true, 20: true} {
+		if have := bc.abortsCrossTxs(number); have != want {
+			t.Errorf("block %d: aborts mismatch: have %v, want %v", number, have, want)
+		}
+	}
+	config.AtomicCrossShardBlock = nil
+	if bc.abortsCrossTxs(20) {
+		t.Errorf("transactions run with locks aborted")
+	}
+}
@@ -0,0 +1,324 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/lock"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Progress of a cross-shard transaction, as reported by CrossTxStatus.
+const (
+	CrossTxRejected  = "rejected"  // Not accepted by the reference contract
+	CrossTxAccepted  = "accepted"  // Accepted by the reference contract
+	CrossTxPending   = "pending"   // Waiting for the data of foreign shards
+	CrossTxReady     = "ready"     // Foreign data complete, waiting for execution
+	CrossTxExecuted  = "executed"  // Executed by the local shard
+	CrossTxAborted   = "aborted"   // Aborted after missing its deadline
+	CrossTxCommitted = "committed" // Every involved shard committed past the accepting block
+
+	CrossTxRescheduled = "rescheduled" // Read sets went stale, accepted again with fresh data
+	CrossTxVoted       = "voted"       // Every involved shard voted to commit, decision not yet applied
+)
+
+// StateCommitted is the kind of the CrossShardEvent posted when the state
+// commitment of a shard lands on the reference chain.
+const StateCommitted = "stateCommitted"
+
+// crossShardEvChanSize is the size of the queue of cross-shard progress events
+// waiting to be sent to subscribers.
+const crossShardEvChanSize = 256
+
+// CrossTxStatus describes how far a cross-shard transaction has progressed.
+type CrossTxStatus struct {
+	RefHash   common.Hash  `json:"refHash"`             // Hash of the transaction on the reference chain
+	LocalHash *common.Hash `json:"localHash,omitempty"` // Hash of the call executed by the involved shards
+	RefNum    uint64       `json:"refNum"`              // Reference block that included the transaction
+	Shards    []uint64     `json:"shards"`              // Shards involved in the transaction
+	Status    string       `json:"status"`
+}
+
+// CrossShardState returns the live cross-shard bookkeeping in the form stored
+// by the checkpoints of reference blocks.
+func (bc *BlockChain) CrossShardState() *rawdb.CrossShardCheckpoint {
+	bc.gLocked.Mu.RLock()
+	defer bc.gLocked.Mu.RUnlock()
+	return bc.crossShardCheckpoint(bc.CurrentBlock().NumberU64())
+}
+
+// Commitment returns the latest commitment of shard known after the canonical
+// reference block refNum, or nil if there is none.
+func (bc *BlockChain) Commitment(shard, refNum uint64) *types.Commitment {
+	checkpoint := rawdb.ReadCrossShardCheckpoint(bc.db, rawdb.ReadCanonicalHash(bc.db, refNum), refNum)
+	if checkpoint == nil {
+		return nil
+	}
+	if shard == bc.myshard && checkpoint.LatestCommit != nil {
+		return checkpoint.LatestCommit
+	}
+	for _, commit := range checkpoint.Commits {
+		if commit.Shard == shard {
+			return commit
+		}
+	}
+	return nil
+}
+
+// PendingCrossTxs returns a copy of the cross-shard transactions of reference
+// block refNum still waiting to be executed by the local shard, keyed by their
+// index in the block.
+func (bc *BlockChain) PendingCrossTxs(refNum uint64) map[uint64]*types.CrossTx {
+	bc.gLocked.Mu.RLock()
+	defer bc.gLocked.Mu.RUnlock()
+
+	ctxs := make(map[uint64]*types.CrossTx)
+	if pending, ok := bc.pendingCrossTxs[refNum]; ok {
+		pending.Lock.RLock()
+		for index, ctx := range pending.Txs {
+			ctxs[index] = ctx
+		}
+		pending.Lock.RUnlock()
+	}
+	return ctxs
+}
+
+// LockedKeys returns the keys of contract addr of shard currently locked by
+// cross-shard transactions, mapped to the number of readers holding them or -1
+// if the key is locked for writing.
+func (bc *BlockChain) LockedKeys(shard uint64, addr common.Address) map[common.Hash]int {
+	return bc.locks.LockedKeys(shard, addr)
+}
+
+// LockManager returns the keys locked by cross-shard transactions, which only
+// reference nodes keep.
+func (bc *BlockChain) LockManager() *lock.Manager {
+	return bc.locks
+}
+
+// FinalisingCommitment returns the first commitment of shard on the canonical
+// reference chain whose block processed reference block refNum, i.e. the one
+// finalising the shard's execution of the cross-shard transactions of refNum.
+// It returns nil if the shard has not committed that far yet.
+func (bc *BlockChain) FinalisingCommitment(shard, refNum uint64) *types.Commitment {
+	head := bc.CurrentBlock().NumberU64()
+	if refNum > head {
+		return nil
+	}
+	// Commitments only move forward, so search for the first covering one
+	n := sort.Search(int(head-refNum+1), func(i int) bool {
+		commit := bc.Commitment(shard, refNum+uint64(i))
+		return commit != nil && commit.RefNum >= refNum
+	})
+	if uint64(n) > head-refNum {
+		return nil
+	}
+	return bc.Commitment(shard, refNum+uint64(n))
+}
+
+// checkpointShardBlock stores the checkpoint of the shard block attested by
+// the verified state commitment tx of a reference block.
+func (bc *BlockChain) checkpointShardBlock(block *types.Block, tx *types.Transaction) {
+	header, err := types.DecodeStateCommitHeader(tx)
+	if err != nil {
+		return
+	}
+	checkpoint, err := types.NewShardCheckpoint(header, tx, block.NumberU64())
+	if err != nil {
+		log.Debug("Skipping shard checkpoint", "hash", tx.Hash(), "err", err)
+		return
+	}
+	rawdb.WriteShardCheckpoint(bc.db, checkpoint)
+	if head, ok := rawdb.ReadShardCheckpointHead(bc.db, checkpoint.Shard); !ok || checkpoint.Number > head {
+		rawdb.WriteShardCheckpointHead(bc.db, checkpoint.Shard, checkpoint.Number)
+	}
+}
+
+// pendingCrossTx looks up a pending cross-shard transaction by its reference
+// or local hash. Of a transaction accepted several times, the latest attempt
+// is returned.
+func (bc *BlockChain) pendingCrossTx(hash common.Hash) (uint64, *types.CrossTx) {
+	bc.gLocked.Mu.RLock()
+	defer bc.gLocked.Mu.RUnlock()
+
+	var (
+		found  *types.CrossTx
+		number uint64
+	)
+	for _, pending := range bc.pendingCrossTxs {
+		pending.Lock.RLock()
+		for _, ctx := range pending.Txs {
+			if ctx.RefHash != hash && ctx.Tx.Hash() != hash {
+				continue
+			}
+			if found == nil || ctx.BlockNum.Uint64() > number {
+				found, number = ctx, ctx.BlockNum.Uint64()
+			}
+		}
+		pending.Lock.RUnlock()
+	}
+	return number, found
+}
+
+// CrossTxStatus returns the progress of a cross-shard transaction as seen by
+// the reference chain, looked up by its reference hash or, while it is still
+// pending, by its local hash. Whether the local shard executed it is up to the
+// caller, which holds the shard chain. It returns nil if the transaction is
+// unknown.
+func (bc *BlockChain) CrossTxStatus(hash common.Hash) *CrossTxStatus {
+	if refNum, ctx := bc.pendingCrossTx(hash); ctx != nil {
+		local := ctx.Tx.Hash()
+		status := &CrossTxStatus{RefHash: ctx.RefHash, LocalHash: &local, RefNum: refNum, Shards: ctx.Shards, Status: CrossTxPending}
+		if aborted, _ := bc.AbortedCrossTxs(refNum); aborted[ctx.RefHash] || ctx.Stale || ctx.Aborted {
+			status.Status = CrossTxAborted
+		} else if ctx.Resolved != 0 {
+			status.Status = CrossTxVoted
+		} else if bc.OptimisticCrossShard(refNum) && !ctx.Validated() {
+			status.Status = CrossTxAccepted
+		} else if _, ready := bc.Dc(refNum); ready {
+			status.Status = CrossTxReady
+		}
+		return status
+	}
+	tx, blockHash, number, index := rawdb.ReadTransaction(bc.db, hash)
+	if tx == nil || tx.TxType() != types.CrossShard {
+		return nil
+	}
+	payload, shards, _, err := types.DecodeCrossTx(uint64(0), tx.Data())
+	if err != nil {
+		return nil
+	}
+	status := &CrossTxStatus{RefHash: hash, RefNum: number, Shards: shards, Status: CrossTxAccepted}
+	if ctx, err := types.ParseCrossTxData(payload); err == nil {
+		local := ctx.Tx.Hash()
+		status.LocalHash = &local
+	}
+	receipts := bc.GetReceiptsByHash(blockHash)
+	if index >= uint64(len(receipts)) || !crossTxAccepted(receipts[index]) {
+		status.Status = CrossTxRejected
+		return status
+	}
+	if aborted, _ := bc.AbortedCrossTxs(number); aborted[hash] {
+		status.Status = CrossTxAborted
+		return status
+	}
+	bc.gLocked.Mu.RLock()
+	defer bc.gLocked.Mu.RUnlock()
+
+	// Optimistic transactions are only executed once validated
+	if v, ok := bc.validating[hash]; ok {
+		status.RefNum = v.ctx.BlockNum.Uint64()
+		return status
+	}
+	// Atomic transactions take effect in the blocks processing their decision
+	if bc.AtomicCrossShard(number) {
+		decided, commit, ok := bc.crossTxDecision(hash, number)
+		if !ok {
+			return status
+		}
+		if !commit {
+			status.Status = CrossTxAborted
+			return status
+		}
+		status.Status, number = CrossTxVoted, decided
+	}
+	head := bc.CurrentBlock().NumberU64()
+	for _, shard := range shards {
+		if shard != uint64(0) && bc.reportedRefNum(shard, head) < number {
+			return status
+		}
+	}
+	status.Status = CrossTxCommitted
+	return status
+}
+
+// postCrossShardEvent queues ev for the subscribers of cross-shard progress,
+// which receive the events in the order the chain made the progress. It is
+// called with chain locks held, so if slow subscribers let the queue fill up
+// the event is dropped rather than stalling block processing; subscribers
+// can catch up with CrossTxStatus.
+func (bc *BlockChain) postCrossShardEvent(ev CrossShardEvent) {
+	select {
+	case bc.crossShardCh <- ev:
+	default:
+		crossShardEvDropCounter.Inc(1)
+		log.Debug("Dropping cross-shard event, queue full", "kind", ev.Kind, "refnum", ev.RefNum, "refhash", ev.RefHash)
+	}
+}
+
+// crossShardLoop sends the queued cross-shard progress events, so that slow
+// subscribers do not hold up block processing.
+func (bc *BlockChain) crossShardLoop() {
+	for {
+		select {
+		case ev := <-bc.crossShardCh:
+			bc.crossShardFeed.Send(ev)
+		case <-bc.quit:
+			return
+		}
+	}
+}
+
+// ForeignDataReady reports that the foreign data needed by the cross-shard
+// transactions of reference block refNum is complete and wakes up the workers
+// waiting for it.
+func (bc *BlockChain) ForeignDataReady(refNum uint64) {
+	bc.gLocked.Mu.RLock()
+	events := bc.dataReadyEvents(refNum)
+	bc.gLocked.Mu.RUnlock()
+
+	for _, ev := range events {
+		bc.postCrossShardEvent(ev)
+	}
+	bc.PostForeignDataEvent(refNum)
+}
+
+// dataReadyEvents returns the progress events of the cross-shard transactions
+// of reference block refNum whose foreign data is complete.
+func (bc *BlockChain) dataReadyEvents(refNum uint64) []CrossShardEvent {
+	// This function assumes that bc.gLocked.Mu is already held
+	pending, ok := bc.pendingCrossTxs[refNum]
+	if !ok {
+		return nil
+	}
+	pending.Lock.RLock()
+	defer pending.Lock.RUnlock()
+
+	indexes := make([]uint64, 0, len(pending.Txs))
+	for index := range pending.Txs {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	events := make([]CrossShardEvent, 0, len(indexes))
+	for _, index := range indexes {
+		ctx := pending.Txs[index]
+		local := ctx.Tx.Hash()
+		events = append(events, CrossShardEvent{Kind: CrossTxReady, RefNum: refNum, RefHash: ctx.RefHash, LocalHash: &local, Shard: bc.myshard, Shards: ctx.Shards})
+	}
+	return events
+}
+
+// SubscribeCrossShardEvent registers a subscription of CrossShardEvent.
+func (bc *BlockChain) SubscribeCrossShardEvent(ch chan<- CrossShardEvent) event.Subscription {
+	return bc.scope.Track(bc.crossShardFeed.Subscribe(ch))
+}
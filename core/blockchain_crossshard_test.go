@@ -0,0 +1,66 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+func TestCrossShardCheckpointPruning(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	bc := &BlockChain{db: db, myshard: 1, numShard: 2, myLatestCommit: &types.Commitment{}}
+
+	blocks := make(map[uint64]*types.Block)
+	insert := func(from, to uint64, commit func(uint64) uint64) {
+		for number := from; number <= to; number++ {
+			block := types.NewBlockWithHeader(&types.Header{Number: new(big.Int).SetUint64(number)})
+			rawdb.WriteCanonicalHash(db, block.Hash(), number)
+			blocks[number] = block
+			bc.myLatestCommit.RefNum = commit(number)
+			bc.writeCrossShardCheckpoint(block)
+		}
+	}
+	// checkpoints reports whether the checkpoints of blocks from..to are stored
+	checkpoints := func(from, to uint64, want bool) {
+		t.Helper()
+		for number := from; number <= to; number++ {
+			block := blocks[number]
+			if have := rawdb.ReadCrossShardCheckpoint(db, block.Hash(), number) != nil; have != want {
+				t.Fatalf("checkpoint %d: stored %v, want %v", number, have, want)
+			}
+		}
+	}
+	// A shard not committing past block 50 keeps its checkpoints around
+	insert(1, 200, func(number uint64) uint64 {
+		if number > 50 {
+			return 50
+		}
+		return number
+	})
+	checkpoints(1, 48, false)
+	checkpoints(49, 200, true)
+
+	// Once the oldest retained head moves on, older checkpoints are pruned
+	insert(201, 329, func(number uint64) uint64 { return number })
+	checkpoints(1, 199, false)
+	checkpoints(200, 329, true)
+}
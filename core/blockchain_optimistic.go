@@ -0,0 +1,603 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/lock"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/metrics/eventlog"
+)
+
+// In optimistic mode the reference contract accepts cross-shard transactions
+// without locking their keys. Every involved shard then prepares an accepted
+// transaction at the end of the first block processing its reference block:
+// the version of its local read set is the committed block the other shards
+// fetched it from if it is unchanged since, or the preparing block otherwise.
+// Versions are stored in the registry account and proven in the next state
+// commitment. Once every involved shard has reported, shards and reference
+// nodes alike decide the transaction: if no read set went stale, the shards
+// execute it against the foreign data fetched when it was accepted, otherwise
+// it is accepted again with fresh data, up to maxReadSetRetries times. Local
+// transactions may not change the read set of a transaction prepared fresh
+// until it is decided.
+
+// ReadVersionRegistry is the account whose storage holds the read versions of
+// the optimistic cross-shard transactions prepared by a shard.
+var ReadVersionRegistry = common.HexToAddress("0x00000000000000000000000000000000000000f1")
+
+// maxReadSetRetries is the number of times a cross-shard transaction whose
+// read sets went stale is accepted again before it is given up.
+const maxReadSetRetries = 3
+
+// staleVersion is the version of the read set of a shard whose commitment
+// does not prove one for a transaction it covers.
+const staleVersion = math.MaxUint64
+
+// ErrPinnedState is returned when a local transaction changes the state read by
+// an optimistic cross-shard transaction awaiting validation.
+var ErrPinnedState = errors.New("transaction changes state read by a pending cross-shard transaction")
+
+// ErrMissingCommittedState is returned when a shard cannot prepare an optimistic
+// cross-shard transaction because the committed state its read set was fetched
+// from is not available.
+var ErrMissingCommittedState = errors.New("missing committed state of a cross-shard read set")
+
+var crossTxRescheduledCounter = metrics.NewRegisteredCounter("chain/crossshard/rescheduled", nil)
+
+// readSetValidation tracks an optimistic cross-shard transaction until the
+// read versions of every involved shard are known.
+type readSetValidation struct {
+	ctx      *types.CrossTx
+	attempt  int               // Number of earlier attempts whose read sets went stale
+	snapshot map[uint64]uint64 // Committed block of every involved shard the read sets were fetched from
+	versions map[uint64]uint64 // Reported version of the read set of every involved shard
+}
+
+// OptimisticCrossShard returns whether the cross-shard transactions accepted
+// in reference block number are validated by read versions instead of locking
+// their keys.
+func (bc *BlockChain) OptimisticCrossShard(number uint64) bool {
+	return bc.chainConfig.IsOptimisticCrossShard(new(big.Int).SetUint64(number))
+}
+
+// trackReadSets starts waiting for the read versions of a cross-shard
+// transaction accepted in reference block ctx.BlockNum.
+func (bc *BlockChain) trackReadSets(ctx *types.CrossTx, attempt int) {
+	// This function assumes that bc.gLocked.Mu is already held
+	bc.validating[ctx.RefHash] = &readSetValidation{
+		ctx:      ctx,
+		attempt:  attempt,
+		snapshot: make(map[uint64]uint64),
+		versions: make(map[uint64]uint64),
+	}
+}
+
+// snapshotReadSets records the commitments the read sets of the transactions
+// accepted in reference block number are fetched from.
+func (bc *BlockChain) snapshotReadSets(number uint64) {
+	// This function assumes that bc.gLocked.Mu is already held
+	for _, v := range bc.validating {
+		if v.ctx.BlockNum.Uint64() != number {
+			continue
+		}
+		for _, shard := range v.ctx.Shards {
+			switch {
+			case shard == uint64(0):
+			case bc.myshard == uint64(0):
+				if commit, ok := bc.lastCommit[shard]; ok {
+					v.snapshot[shard] = commit.BlockNum
+				}
+			case shard == bc.myshard:
+				v.snapshot[shard] = bc.myLatestCommit.BlockNum
+				v.ctx.LocalCommit = bc.myLatestCommit.BlockNum
+			default:
+				v.snapshot[shard] = bc.commitments[number].CommitNum(shard)
+			}
+		}
+	}
+}
+
+// recordReadVersions applies the read versions proven by a state commitment of
+// shard reporting reference block report. The transactions the commitment
+// covers but proves no version for are considered stale on the shard.
+func (bc *BlockChain) recordReadVersions(tx *types.Transaction, shard, report uint64) {
+	// This function assumes that bc.gLocked.Mu is already held
+	var versions map[common.Hash]uint64
+	if header, err := types.DecodeStateCommitHeader(tx); err == nil {
+		if rv, err := types.DecodeStateCommitVersions(tx); err != nil {
+			log.Warn("Ignoring malformed read versions", "shard", shard, "hash", tx.Hash(), "err", err)
+		} else if rv != nil {
+			if versions, err = rv.Verify(header.Root, ReadVersionRegistry); err != nil {
+				log.Warn("Ignoring unproven read versions", "shard", shard, "hash", tx.Hash(), "err", err)
+			}
+		}
+	}
+	for _, v := range bc.validating {
+		if v.ctx.BlockNum.Uint64() > report {
+			continue
+		}
+		if _, ok := v.snapshot[shard]; !ok {
+			continue
+		}
+		if _, ok := v.versions[shard]; ok {
+			continue
+		}
+		version, ok := versions[v.ctx.Tx.Hash()]
+		if !ok {
+			version = staleVersion
+		}
+		v.versions[shard] = version
+	}
+}
+
+// decideReadSets validates the transactions whose read versions have been
+// reported by every involved shard as of reference block number. Transactions
+// with a stale read set are accepted again in number with fresh foreign data,
+// or given up after too many attempts. It returns the validated transactions
+// and the new attempts, in the order they were accepted.
+func (bc *BlockChain) decideReadSets(number uint64) ([]*types.CrossTx, []*types.CrossTx) {
+	// This function assumes that bc.gLocked.Mu is already held
+	var decided []*readSetValidation
+	for _, v := range bc.validating {
+		if v.ctx.BlockNum.Uint64() < number && len(v.versions) == len(v.snapshot) {
+			decided = append(decided, v)
+		}
+	}
+	sort.Slice(decided, func(i, j int) bool {
+		if bi, bj := decided[i].ctx.BlockNum.Uint64(), decided[j].ctx.BlockNum.Uint64(); bi != bj {
+			return bi < bj
+		}
+		return bytes.Compare(decided[i].ctx.RefHash[:], decided[j].ctx.RefHash[:]) < 0
+	})
+	var validated, retried []*types.CrossTx
+	for _, v := range decided {
+		ctx := v.ctx
+		delete(bc.validating, ctx.RefHash)
+		ctx.Decided = number
+
+		for shard, version := range v.versions {
+			if version > v.snapshot[shard] {
+				ctx.Stale = true
+			}
+		}
+		if !ctx.Stale {
+			validated = append(validated, ctx)
+			continue
+		}
+		local := ctx.Tx.Hash()
+		if v.attempt >= maxReadSetRetries {
+			log.Info("Gave up cross-shard transaction with stale read sets", "hash", ctx.RefHash, "accepted", ctx.Origin, "attempts", v.attempt+1)
+			if !bc.replaying {
+				crossTxAbortedCounter.Inc(1)
+				eventlog.Emit("abort", "ref", number, "hash", ctx.RefHash, "accepted", ctx.BlockNum, "shards", ctx.Shards)
+				bc.postCrossShardEvent(CrossShardEvent{Kind: CrossTxAborted, RefNum: ctx.BlockNum.Uint64(), RefHash: ctx.RefHash, LocalHash: &local, Shard: bc.myshard, Shards: ctx.Shards})
+			}
+			continue
+		}
+		retry := &types.CrossTx{
+			Shards:       ctx.Shards,
+			BlockNum:     new(big.Int).SetUint64(number),
+			Tx:           ctx.Tx,
+			AllContracts: ctx.AllContracts,
+			RefHash:      ctx.RefHash,
+			Seen:         ctx.Seen,
+			Origin:       ctx.Origin,
+		}
+		bc.trackReadSets(retry, v.attempt+1)
+		retried = append(retried, retry)
+
+		log.Debug("Rescheduled cross-shard transaction with stale read sets", "hash", ctx.RefHash, "accepted", ctx.BlockNum, "ref", number, "attempt", v.attempt+1)
+		if !bc.replaying {
+			crossTxRescheduledCounter.Inc(1)
+			eventlog.Emit("reschedule", "ref", number, "hash", ctx.RefHash, "accepted", ctx.BlockNum, "attempt", v.attempt+1)
+			bc.postCrossShardEvent(CrossShardEvent{Kind: CrossTxRescheduled, RefNum: number, RefHash: ctx.RefHash, LocalHash: &local, Shard: bc.myshard, Shards: ctx.Shards})
+		}
+	}
+	return validated, retried
+}
+
+// expiredRetries returns the new attempts of cross-shard transactions made in
+// reference block expiry which are still waiting for read versions.
+func (bc *BlockChain) expiredRetries(expiry uint64) []*types.CrossTx {
+	// This function assumes that bc.gLocked.Mu is already held
+	var ctxs []*types.CrossTx
+	for _, v := range bc.validating {
+		if v.attempt > 0 && v.ctx.BlockNum.Uint64() == expiry {
+			ctxs = append(ctxs, v.ctx)
+		}
+	}
+	sort.Slice(ctxs, func(i, j int) bool { return bytes.Compare(ctxs[i].RefHash[:], ctxs[j].RefHash[:]) < 0 })
+	return ctxs
+}
+
+// dropReadSets stops validating the attempts of cross-shard transactions made
+// in reference block expiry, which were aborted in block number.
+func (bc *BlockChain) dropReadSets(hashes []common.Hash, expiry, number uint64) {
+	// This function assumes that bc.gLocked.Mu is already held
+	for _, hash := range hashes {
+		if v, ok := bc.validating[hash]; ok && v.ctx.BlockNum.Uint64() == expiry {
+			v.ctx.Decided, v.ctx.Stale = number, true
+			delete(bc.validating, hash)
+		}
+	}
+}
+
+// optimisticReplayFrom returns the oldest reference block that accepted a
+// cross-shard transaction not yet executed by every shard as far as the
+// bookkeeping tells, or math.MaxUint64 if there is none.
+func (bc *BlockChain) optimisticReplayFrom() uint64 {
+	// This function assumes that bc.gLocked.Mu is already held
+	from := uint64(math.MaxUint64)
+	for _, v := range bc.validating {
+		if v.ctx.Origin < from {
+			from = v.ctx.Origin
+		}
+	}
+	for _, pending := range bc.pendingCrossTxs {
+		pending.Lock.RLock()
+		for _, ctx := range pending.Txs {
+			if ctx.Origin != 0 && ctx.Origin < from {
+				from = ctx.Origin
+			}
+		}
+		pending.Lock.RUnlock()
+	}
+	return from
+}
+
+// awaitingDecision returns whether the cross-shard transactions accepted in
+// reference block refNum are still needed by shard blocks processing reference
+// blocks from onwards, i.e. some of them is undecided or decided later.
+func (bc *BlockChain) awaitingDecision(refNum, from uint64) bool {
+	// This function assumes that bc.gLocked.Mu is already held
+	optimistic, atomic := bc.OptimisticCrossShard(refNum), bc.AtomicCrossShard(refNum)
+	if !optimistic && !atomic {
+		return false
+	}
+	pending := bc.pendingCrossTxs[refNum]
+	pending.Lock.RLock()
+	defer pending.Lock.RUnlock()
+
+	for _, ctx := range pending.Txs {
+		decided := ctx.Decided
+		if atomic {
+			decided = ctx.Resolved
+		}
+		if ctx.BlockNum.Uint64() == refNum && (decided == 0 || decided >= from) {
+			return true
+		}
+	}
+	return false
+}
+
+// preparedCrossTxs returns the cross-shard transactions a shard block
+// processing the reference blocks from to to prepares, along with the ones
+// accepted before from. Both are in acceptance order.
+func (bc *BlockChain) preparedCrossTxs(from, to uint64) ([]*types.CrossTx, []*types.CrossTx) {
+	// This function assumes that bc.gLocked.Mu is already held
+	type entry struct {
+		refNum, index uint64
+		ctx           *types.CrossTx
+	}
+	var entries []entry
+	for refNum, pending := range bc.pendingCrossTxs {
+		pending.Lock.RLock()
+		for index, ctx := range pending.Txs {
+			// Validated transactions are also listed under the deciding block
+			if ctx.BlockNum.Uint64() == refNum && refNum <= to {
+				entries = append(entries, entry{refNum, index, ctx})
+			}
+		}
+		pending.Lock.RUnlock()
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].refNum != entries[j].refNum {
+			return entries[i].refNum < entries[j].refNum
+		}
+		return entries[i].index < entries[j].index
+	})
+	var prepared, earlier []*types.CrossTx
+	for _, e := range entries {
+		if e.refNum >= from {
+			prepared = append(prepared, e.ctx)
+		} else {
+			earlier = append(earlier, e.ctx)
+		}
+	}
+	return prepared, earlier
+}
+
+// undecidedAt returns whether ctx is still awaiting validation in a shard
+// block processing reference blocks up to to.
+func undecidedAt(ctx *types.CrossTx, to uint64) bool {
+	return ctx.Decided == 0 || ctx.Decided > to
+}
+
+// preparedFresh returns whether the registry in statedb holds a fresh read
+// version for ctx.
+func preparedFresh(statedb *state.StateDB, ctx *types.CrossTx) bool {
+	return statedb.GetState(ReadVersionRegistry, ctx.Tx.Hash()) == versionSlot(ctx.LocalCommit)
+}
+
+// versionSlot returns the registry value storing a read version.
+func versionSlot(version uint64) common.Hash {
+	return common.BigToHash(new(big.Int).Add(new(big.Int).SetUint64(version), common.Big1))
+}
+
+// crossTxsConflict returns whether two cross-shard transactions conflict on
+// the state of shard: they share a key one of them writes, or a contract one
+// of them may transfer value to.
+func crossTxsConflict(shard uint64, a, b *types.CrossTx) bool {
+	keysA, keysB := lock.Set(a.AllContracts)[shard], lock.Set(b.AllContracts)[shard]
+	for k, mode := range keysA {
+		if held, ok := keysB[k]; ok && !held.Compatible(mode) {
+			return true
+		}
+	}
+	if a.Tx.Value().Sign() == 0 && b.Tx.Value().Sign() == 0 {
+		return false
+	}
+	for _, ca := range a.AllContracts[shard] {
+		for _, cb := range b.AllContracts[shard] {
+			if ca.Addr == cb.Addr {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readSetUnchanged returns whether the local read set of ctx holds the same
+// state in statedb as in the committed state the other shards fetched it from.
+func (bc *BlockChain) readSetUnchanged(committed, statedb *state.StateDB, ctx *types.CrossTx) bool {
+	for _, contract := range ctx.AllContracts[bc.myshard] {
+		addr := contract.Addr
+		if committed.GetNonce(addr) != statedb.GetNonce(addr) || committed.GetBalance(addr).Cmp(statedb.GetBalance(addr)) != 0 {
+			return false
+		}
+		for _, key := range contract.Keys {
+			if committed.GetState(addr, key) != statedb.GetState(addr, key) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// PrepareCrossTxs records in statedb the read versions of the optimistic
+// cross-shard transactions accepted in the reference blocks from to
+// header.RefNumber, and clears the versions of the transactions decided in
+// them. It must be applied at the end of the shard block, after its
+// transactions. The committed states read sets are fetched from are kept
+// until the transactions are decided, as the version must not depend on the
+// state a node happens to hold.
+func (bc *BlockChain) PrepareCrossTxs(statedb *state.StateDB, header *types.Header, from uint64) error {
+	to := header.RefNumber.Uint64()
+	if !bc.OptimisticCrossShard(to) || bc.ref || bc.myshard == uint64(0) {
+		return nil
+	}
+
+	bc.gLocked.Mu.RLock()
+	defer bc.gLocked.Mu.RUnlock()
+
+	prepared, earlier := bc.preparedCrossTxs(from, to)
+
+	// Only transactions prepared fresh restrict later ones
+	var fresh []*types.CrossTx
+	for _, ctx := range earlier {
+		if !undecidedAt(ctx, to) {
+			if ctx.Decided >= from {
+				statedb.SetState(ReadVersionRegistry, ctx.Tx.Hash(), common.Hash{})
+			}
+			continue
+		}
+		if preparedFresh(statedb, ctx) {
+			fresh = append(fresh, ctx)
+		}
+	}
+	committed := make(map[uint64]*state.StateDB)
+	for _, ctx := range prepared {
+		// Aborted before the shard got to prepare it
+		if !undecidedAt(ctx, to) {
+			continue
+		}
+		version := ctx.LocalCommit
+		cstate, ok := committed[ctx.LocalCommit]
+		if !ok {
+			commit := bc.GetHeaderByNumber(ctx.LocalCommit)
+			if commit == nil {
+				log.Error("Missing committed block of a read set", "number", ctx.LocalCommit, "tx", ctx.Tx.Hash())
+				return ErrMissingCommittedState
+			}
+			var err error
+			if cstate, err = state.New(commit.Root, bc.stateCache); err != nil {
+				log.Error("Missing committed state of a read set", "number", ctx.LocalCommit, "tx", ctx.Tx.Hash(), "err", err)
+				return ErrMissingCommittedState
+			}
+			committed[ctx.LocalCommit] = cstate
+		}
+		if !bc.readSetUnchanged(cstate, statedb, ctx) {
+			version = header.Number.Uint64()
+		}
+		for _, other := range fresh {
+			if version == ctx.LocalCommit && crossTxsConflict(bc.myshard, ctx, other) {
+				version = header.Number.Uint64()
+			}
+		}
+		if version == ctx.LocalCommit {
+			fresh = append(fresh, ctx)
+		}
+		// Keep the registry from being deleted as an empty account
+		if statedb.GetNonce(ReadVersionRegistry) == 0 {
+			statedb.SetNonce(ReadVersionRegistry, 1)
+		}
+		statedb.SetState(ReadVersionRegistry, ctx.Tx.Hash(), versionSlot(version))
+	}
+	return nil
+}
+
+// pinnedCommits returns the committed blocks whose state must be kept as the
+// read sets of undecided optimistic cross-shard transactions were fetched from
+// them.
+func (bc *BlockChain) pinnedCommits() map[uint64]bool {
+	if bc.chainConfig.OptimisticCrossShardBlock == nil || bc.ref || bc.myshard == uint64(0) {
+		return nil
+	}
+	bc.gLocked.Mu.RLock()
+	defer bc.gLocked.Mu.RUnlock()
+
+	pinned := map[uint64]bool{bc.myLatestCommit.BlockNum: true}
+	for refNum, pending := range bc.pendingCrossTxs {
+		pending.Lock.RLock()
+		for _, ctx := range pending.Txs {
+			if ctx.BlockNum.Uint64() == refNum && bc.OptimisticCrossShard(refNum) && ctx.Decided == 0 {
+				pinned[ctx.LocalCommit] = true
+			}
+		}
+		pending.Lock.RUnlock()
+	}
+	return pinned
+}
+
+// ReadVersions returns the read versions of the cross-shard transactions
+// awaiting validation as stored by the committed block header, for its state
+// commitment. It returns nil unless the shard runs cross-shard transactions
+// optimistically.
+func (bc *BlockChain) ReadVersions(header *types.Header) *types.ReadVersions {
+	if !bc.OptimisticCrossShard(header.RefNumber.Uint64()) || bc.myshard == uint64(0) {
+		return nil
+	}
+	bc.gLocked.Mu.RLock()
+	prepared, _ := bc.preparedCrossTxs(0, header.RefNumber.Uint64())
+	bc.gLocked.Mu.RUnlock()
+
+	txs := []common.Hash{}
+	for _, ctx := range prepared {
+		if bc.OptimisticCrossShard(ctx.BlockNum.Uint64()) && ctx.Decided == 0 {
+			txs = append(txs, ctx.Tx.Hash())
+		}
+	}
+	kvs := bc.StateData(header.Root, []*types.CKeys{{Addr: ReadVersionRegistry, Keys: txs}})
+	if len(kvs) != 1 {
+		return nil
+	}
+	return &types.ReadVersions{Txs: txs, Proof: kvs[0]}
+}
+
+// storageKey identifies a storage key of a contract.
+type storageKey struct {
+	addr common.Address
+	key  common.Hash
+}
+
+// PinnedState is the local state read by the optimistic cross-shard
+// transactions awaiting validation, or written by the prepared atomic ones,
+// which local transactions may not change.
+type PinnedState struct {
+	values   map[storageKey]common.Hash
+	nonces   map[common.Address]uint64
+	balances map[common.Address]*big.Int
+}
+
+// PinnedState captures the local state read by the cross-shard transactions
+// prepared fresh before a shard block processing the reference blocks from to
+// header.RefNumber and still undecided in them. It returns nil if there is no
+// such state. In atomic mode, it captures the state of the transactions
+// prepared to commit so far instead, including the ones of the block.
+func (bc *BlockChain) PinnedState(statedb *state.StateDB, header *types.Header, from uint64) *PinnedState {
+	to := header.RefNumber.Uint64()
+	optimistic, atomic := bc.OptimisticCrossShard(to), bc.AtomicCrossShard(to)
+	if !optimistic && !atomic || bc.ref || bc.myshard == uint64(0) {
+		return nil
+	}
+
+	bc.gLocked.Mu.RLock()
+	prepared, earlier := bc.preparedCrossTxs(from, to)
+	bc.gLocked.Mu.RUnlock()
+
+	ps := &PinnedState{
+		values:   make(map[storageKey]common.Hash),
+		nonces:   make(map[common.Address]uint64),
+		balances: make(map[common.Address]*big.Int),
+	}
+	if atomic {
+		bc.pinPrepared(ps, statedb, append(earlier, prepared...), to)
+	} else {
+		for _, ctx := range earlier {
+			if !undecidedAt(ctx, to) || !preparedFresh(statedb, ctx) {
+				continue
+			}
+			for _, contract := range ctx.AllContracts[bc.myshard] {
+				ps.pin(statedb, contract.Addr, contract.Keys)
+			}
+		}
+	}
+	if len(ps.nonces) == 0 {
+		return nil
+	}
+	return ps
+}
+
+// pin records the current nonce, balance and values of keys of addr.
+func (ps *PinnedState) pin(statedb *state.StateDB, addr common.Address, keys []common.Hash) {
+	ps.nonces[addr] = statedb.GetNonce(addr)
+	ps.balances[addr] = statedb.GetBalance(addr)
+	for _, key := range keys {
+		ps.values[storageKey{addr, key}] = statedb.GetState(addr, key)
+	}
+}
+
+// Verify returns ErrPinnedState if statedb no longer holds the pinned state.
+func (ps *PinnedState) Verify(statedb *state.StateDB) error {
+	if ps == nil {
+		return nil
+	}
+	for addr, nonce := range ps.nonces {
+		if statedb.GetNonce(addr) != nonce || statedb.GetBalance(addr).Cmp(ps.balances[addr]) != 0 {
+			return ErrPinnedState
+		}
+	}
+	for k, val := range ps.values {
+		if statedb.GetState(k.addr, k.key) != val {
+			return ErrPinnedState
+		}
+	}
+	return nil
+}
+
+// newAttemptIndex returns the index under which the cross-shard transactions
+// added to a reference block by its decisions are kept, past the indexes of
+// its own transactions.
+func newAttemptIndex(refTxs []*types.RefTx, k int) uint64 {
+	next := uint64(0)
+	for _, refTx := range refTxs {
+		if refTx.Index >= next {
+			next = refTx.Index + 1
+		}
+	}
+	return next + uint64(k)
+}
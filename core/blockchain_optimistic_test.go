@@ -0,0 +1,218 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	crossAddr = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	crossKeyA = common.HexToHash("0x0a")
+	crossKeyB = common.HexToHash("0x0b")
+)
+
+// crossContracts builds the read-write set of a transaction touching keys of
+// crossAddr on shard 1, writing the keys marked true.
+func crossContracts(keys map[common.Hash]bool) map[uint64][]*types.CKeys {
+	ck := &types.CKeys{Addr: crossAddr}
+	for key, write := range keys {
+		ck.Keys = append(ck.Keys, key)
+		if write {
+			ck.WKeys = append(ck.WKeys, key)
+		}
+	}
+	return map[uint64][]*types.CKeys{1: {ck}}
+}
+
+// optimisticCrossTx creates a cross-shard transaction accepted in reference
+// block number, reading and writing keys of crossAddr on shard 1.
+func optimisticCrossTx(n byte, number uint64, keys map[common.Hash]bool) *types.CrossTx {
+	tx := types.NewCrossTransaction(types.CrossShardLocal, uint64(n), 0, crossAddr, common.Address{n}, big.NewInt(0), 21000, big.NewInt(0), nil)
+	return &types.CrossTx{
+		Shards:       []uint64{1, 2},
+		BlockNum:     new(big.Int).SetUint64(number),
+		Tx:           tx,
+		AllContracts: crossContracts(keys),
+		RefHash:      common.Hash{n},
+		Origin:       number,
+	}
+}
+
+// reportReadSets tracks ctx as fetched from the given commitments and
+// reports the given read versions.
+func reportReadSets(bc *BlockChain, ctx *types.CrossTx, attempt int, snapshot, versions map[uint64]uint64) {
+	bc.trackReadSets(ctx, attempt)
+	v := bc.validating[ctx.RefHash]
+	for shard, number := range snapshot {
+		v.snapshot[shard] = number
+	}
+	for shard, version := range versions {
+		v.versions[shard] = version
+	}
+}
+
+func TestDecideReadSets(t *testing.T) {
+	bc := &BlockChain{myshard: 1, replaying: true, validating: make(map[common.Hash]*readSetValidation)}
+	snapshot := map[uint64]uint64{1: 10, 2: 20}
+
+	fresh := optimisticCrossTx(1, 5, map[common.Hash]bool{crossKeyA: true})
+	reportReadSets(bc, fresh, 0, snapshot, map[uint64]uint64{1: 10, 2: 20})
+	stale := optimisticCrossTx(2, 5, map[common.Hash]bool{crossKeyB: true})
+	reportReadSets(bc, stale, 0, snapshot, map[uint64]uint64{1: 10, 2: 21})
+	waiting := optimisticCrossTx(3, 5, map[common.Hash]bool{crossKeyB: false})
+	reportReadSets(bc, waiting, 0, snapshot, map[uint64]uint64{1: 10})
+	exhausted := optimisticCrossTx(4, 5, map[common.Hash]bool{crossKeyB: false})
+	reportReadSets(bc, exhausted, maxReadSetRetries, snapshot, map[uint64]uint64{1: staleVersion, 2: 20})
+
+	// Nothing is decided in the block accepting the transactions
+	if validated, retried := bc.decideReadSets(5); len(validated) != 0 || len(retried) != 0 {
+		t.Fatalf("decided in the accepting block: %d validated, %d retried", len(validated), len(retried))
+	}
+	validated, retried := bc.decideReadSets(8)
+	if len(validated) != 1 || validated[0] != fresh || !fresh.Validated() || fresh.Decided != 8 {
+		t.Fatalf("fresh transaction not validated: %v", validated)
+	}
+	if len(retried) != 1 || retried[0].RefHash != stale.RefHash {
+		t.Fatalf("stale transaction not retried: %v", retried)
+	}
+	if !stale.Stale || stale.Decided != 8 || stale.Validated() {
+		t.Errorf("stale attempt not marked: decided %d, stale %v", stale.Decided, stale.Stale)
+	}
+	retry := retried[0]
+	if retry.BlockNum.Uint64() != 8 || retry.Origin != 5 || retry.Decided != 0 || retry.Stale {
+		t.Errorf("retry mismatch: block %d, origin %d, decided %d, stale %v", retry.BlockNum, retry.Origin, retry.Decided, retry.Stale)
+	}
+	if v, ok := bc.validating[stale.RefHash]; !ok || v.ctx != retry || v.attempt != 1 {
+		t.Errorf("retry not awaiting validation")
+	}
+	// Transactions still missing versions wait, exhausted ones are given up
+	if _, ok := bc.validating[waiting.RefHash]; !ok || waiting.Decided != 0 {
+		t.Errorf("partially reported transaction decided")
+	}
+	if _, ok := bc.validating[exhausted.RefHash]; ok || !exhausted.Stale {
+		t.Errorf("exhausted transaction retried")
+	}
+	if from := bc.optimisticReplayFrom(); from != 5 {
+		t.Errorf("replay start mismatch: have %d, want 5", from)
+	}
+}
+
+func TestCrossTxsConflict(t *testing.T) {
+	reader := optimisticCrossTx(1, 5, map[common.Hash]bool{crossKeyA: false})
+	tests := []struct {
+		other    *types.CrossTx
+		conflict bool
+	}{
+		{optimisticCrossTx(2, 5, map[common.Hash]bool{crossKeyA: false}), false},
+		{optimisticCrossTx(2, 5, map[common.Hash]bool{crossKeyA: true}), true},
+		{optimisticCrossTx(2, 5, map[common.Hash]bool{crossKeyB: true}), false},
+	}
+	for i, tt := range tests {
+		if have := crossTxsConflict(1, reader, tt.other); have != tt.conflict {
+			t.Errorf("test %d: conflict mismatch: have %v, want %v", i, have, tt.conflict)
+		}
+		// Keys of other shards never conflict on the local one
+		if crossTxsConflict(2, reader, tt.other) {
+			t.Errorf("test %d: conflict on a shard without keys", i)
+		}
+	}
+	// Value transfers conflict on shared contracts regardless of the keys
+	payer := optimisticCrossTx(3, 5, map[common.Hash]bool{crossKeyB: false})
+	payer.SetTransaction(types.NewCrossTransaction(types.CrossShardLocal, 3, 0, crossAddr, common.Address{3}, big.NewInt(1), 21000, big.NewInt(0), nil))
+	if !crossTxsConflict(1, reader, payer) {
+		t.Errorf("value transfer to a read contract does not conflict")
+	}
+}
+
+func TestPinnedStateVerify(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(ethdb.NewMemDatabase()))
+	statedb.SetState(crossAddr, crossKeyA, common.HexToHash("0x01"))
+
+	ps := &PinnedState{
+		values:   map[storageKey]common.Hash{{crossAddr, crossKeyA}: common.HexToHash("0x01")},
+		nonces:   map[common.Address]uint64{crossAddr: 0},
+		balances: map[common.Address]*big.Int{crossAddr: new(big.Int)},
+	}
+	if err := ps.Verify(statedb); err != nil {
+		t.Fatalf("unchanged state rejected: %v", err)
+	}
+	statedb.SetState(crossAddr, crossKeyB, common.HexToHash("0x02"))
+	if err := ps.Verify(statedb); err != nil {
+		t.Fatalf("change of an unpinned key rejected: %v", err)
+	}
+	statedb.AddBalance(crossAddr, big.NewInt(1))
+	if err := ps.Verify(statedb); err != ErrPinnedState {
+		t.Errorf("balance change: have %v, want %v", err, ErrPinnedState)
+	}
+	statedb.SubBalance(crossAddr, big.NewInt(1))
+	statedb.SetState(crossAddr, crossKeyA, common.HexToHash("0x03"))
+	if err := ps.Verify(statedb); err != ErrPinnedState {
+		t.Errorf("value change: have %v, want %v", err, ErrPinnedState)
+	}
+	if err := (*PinnedState)(nil).Verify(statedb); err != nil {
+		t.Errorf("missing pins reject state: %v", err)
+	}
+}
+
+func TestPrepareMissingCommittedState(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	config := *params.TestChainConfig
+	config.OptimisticCrossShardBlock = big.NewInt(0)
+	genesis := (&Genesis{Config: &config}).MustCommit(db)
+
+	pending := map[uint64]types.CrossShardTxs{5: types.NewCrossShardTxs()}
+	bc, err := NewBlockChain(db, nil, &config, ethash.NewFaker(), vm.Config{}, nil, false, 1, 3,
+		make(map[uint64]*types.Commitments), pending, &types.Commitment{},
+		make(map[uint64]*types.DataCache), sync.RWMutex{}, types.NewRWLock(), make(map[uint64]*types.Commitment), make(map[uint64]uint64))
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer bc.Stop()
+
+	ctx := optimisticCrossTx(1, 5, map[common.Hash]bool{crossKeyA: true})
+	pending[5].Txs[0] = ctx
+	header := &types.Header{Number: big.NewInt(1), RefNumber: big.NewInt(5)}
+
+	// The read set was fetched from the genesis state, which is unchanged
+	statedb, _ := state.New(genesis.Root(), bc.stateCache)
+	if err := bc.PrepareCrossTxs(statedb, header, 5); err != nil {
+		t.Fatalf("failed to prepare against available state: %v", err)
+	}
+	if version := statedb.GetState(ReadVersionRegistry, ctx.Tx.Hash()); version != versionSlot(0) {
+		t.Fatalf("read version mismatch: have %x, want %x", version, versionSlot(0))
+	}
+	if pinned := bc.pinnedCommits(); !pinned[0] {
+		t.Fatalf("committed state of an undecided transaction not pinned: %v", pinned)
+	}
+	// A node missing the committed state must not fall back to a stale version
+	ctx.LocalCommit = 3
+	statedb, _ = state.New(genesis.Root(), bc.stateCache)
+	if err := bc.PrepareCrossTxs(statedb, header, 5); err != ErrMissingCommittedState {
+		t.Fatalf("missing committed state: have %v, want %v", err, ErrMissingCommittedState)
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// HeadersOnly returns whether the chain is a reference chain followed by
+// headers and the proven receipts of its cross-shard transactions, instead
+// of executing every reference block.
+func (bc *BlockChain) HeadersOnly() bool {
+	return bc.ref && bc.myshard != uint64(0) && bc.cacheConfig.HeadersOnly
+}
+
+// loadLastHeader restores the head of a header-only reference chain. This
+// method assumes that the chain manager mutex is held.
+func (bc *BlockChain) loadLastHeader() error {
+	head := rawdb.ReadHeadHeaderHash(bc.db)
+	if head == (common.Hash{}) {
+		log.Warn("Empty database, resetting chain")
+		return bc.Reset()
+	}
+	header := bc.GetHeaderByHash(head)
+	if header == nil {
+		log.Warn("Head header missing, resetting chain", "hash", head)
+		return bc.Reset()
+	}
+	block := bc.refBlock(header)
+	if block == nil {
+		log.Warn("Head cross-shard transactions missing, resetting chain", "number", header.Number, "hash", head)
+		return bc.Reset()
+	}
+	bc.currentBlock.Store(block)
+	bc.currentFastBlock.Store(block)
+	bc.hc.SetCurrentHeader(header)
+
+	log.Debug("Loaded most recent reference header", "number", header.Number, "hash", head, "td", bc.GetTd(head, header.Number.Uint64()))
+	return nil
+}
+
+// refTxsAt returns the cross-shard relevant transactions of a reference block,
+// taken from the full block if it is known and from the proven receipts kept
+// by header-only chains otherwise.
+func (bc *BlockChain) refTxsAt(hash common.Hash, number uint64) ([]*types.RefTx, bool) {
+	if block := bc.GetBlock(hash, number); block != nil {
+		receipts := bc.GetReceiptsByHash(hash)
+		if len(receipts) != len(block.Transactions()) {
+			return nil, false
+		}
+		return types.RefTxs(block.Transactions(), receipts), true
+	}
+	return rawdb.ReadRefTxs(bc.db, hash, number)
+}
+
+// refBlock assembles the block of a header-only reference chain, carrying
+// only the cross-shard relevant transactions in its body.
+func (bc *BlockChain) refBlock(header *types.Header) *types.Block {
+	refTxs, ok := bc.refTxsAt(header.Hash(), header.Number.Uint64())
+	if !ok {
+		return nil
+	}
+	txs := make([]*types.Transaction, len(refTxs))
+	for i, refTx := range refTxs {
+		txs[i] = refTx.Tx
+	}
+	return types.NewBlockWithHeader(header).WithBody(txs, nil)
+}
+
+// replayRefHeader applies the canonical reference block number of a
+// header-only chain to the cross-shard bookkeeping.
+func (bc *BlockChain) replayRefHeader(number uint64) bool {
+	// This function assumes that bc.gLocked.Mu is already held
+	hash := rawdb.ReadCanonicalHash(bc.db, number)
+	header := bc.GetHeader(hash, number)
+	if header == nil {
+		log.Error("Missing reference header, cross-shard state incomplete", "number", number)
+		return false
+	}
+	refTxs, ok := bc.refTxsAt(hash, number)
+	if !ok {
+		log.Error("Missing reference receipts, cross-shard state incomplete", "number", number, "hash", hash)
+		return false
+	}
+	bc.replaying = true
+	defer func() { bc.replaying = false }()
+
+	bc.parseRefTxs(bc.refBlock(header), refTxs)
+	return true
+}
+
+// InsertRefHeaders extends a header-only reference chain. Every header must
+// carry valid Istanbul committed seals of the reference validators, and refTxs
+// holds the cross-shard relevant transactions of each block, whose receipts
+// the caller has checked against the header with types.VerifyRefReceipts.
+func (bc *BlockChain) InsertRefHeaders(headers []*types.Header, refTxs [][]*types.RefTx) (int, error) {
+	n, events, err := bc.insertRefHeaders(headers, refTxs)
+	bc.PostChainEvents(events, nil)
+	return n, err
+}
+
+func (bc *BlockChain) insertRefHeaders(headers []*types.Header, refTxs [][]*types.RefTx) (int, []interface{}, error) {
+	if !bc.HeadersOnly() {
+		return 0, nil, ErrHeadersOnly
+	}
+	bc.wg.Add(1)
+	defer bc.wg.Done()
+
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+
+	var (
+		events    = make([]interface{}, 0, len(headers))
+		lastBlock *types.Block
+	)
+	for i, header := range headers {
+		var (
+			hash   = header.Hash()
+			number = header.Number.Uint64()
+			head   = bc.CurrentBlock()
+		)
+		if number <= head.NumberU64() && rawdb.ReadCanonicalHash(bc.db, number) == hash {
+			continue
+		}
+		// Reference blocks are final, so anything not extending the head is bogus
+		if header.ParentHash != head.Hash() {
+			return i, events, ErrRefChainFork
+		}
+		// The engine checks the proposer and committed seals of reference
+		// headers against the reference validators, not the local shard's
+		if err := bc.engine.VerifyHeader(bc, header, true); err != nil {
+			return i, events, err
+		}
+		if _, err := bc.hc.WriteHeader(header); err != nil {
+			return i, events, err
+		}
+		rawdb.WriteRefTxs(bc.db, hash, number, refTxs[i])
+
+		block := bc.refBlock(header)
+		rawdb.WriteHeadBlockHash(bc.db, hash)
+		rawdb.WriteHeadFastBlockHash(bc.db, hash)
+		bc.currentBlock.Store(block)
+		bc.currentFastBlock.Store(block)
+
+		bc.gLocked.Mu.Lock()
+		for _, refTx := range refTxs[i] {
+			bc.emitRefTx(number, refTx.Tx, refTx.Receipt)
+		}
+		bc.parseRefTxs(block, refTxs[i])
+		bc.gLocked.Mu.Unlock()
+
+		log.Debug("Inserted reference header", "number", number, "hash", hash, "crosstxs", len(refTxs[i]))
+		events = append(events, ChainEvent{block, hash, nil})
+		lastBlock = block
+	}
+	if lastBlock != nil {
+		events = append(events, ChainHeadEvent{lastBlock})
+	}
+	return len(headers), events, nil
+}
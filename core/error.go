@@ -35,4 +35,12 @@ var (
 
 	// ErrAbortBlocksProcessing is returned if bc.insertChain is interrupted under raft mode
 	ErrAbortBlocksProcessing = errors.New("abort during blocks processing")
+
+	// ErrHeadersOnly is returned when full blocks are imported into a reference
+	// chain that is followed by headers only.
+	ErrHeadersOnly = errors.New("reference chain is followed by headers only")
+
+	// ErrRefChainFork is returned if a header-only reference chain is offered
+	// headers that do not extend its head.
+	ErrRefChainFork = errors.New("reference headers do not extend the chain head")
 )
@@ -24,6 +24,13 @@ import (
 // NewTxsEvent is posted when a batch of transactions enter the transaction pool.
 type NewTxsEvent struct{ Txs []*types.Transaction }
 
+// ForwardTxsEvent is posted when the transaction pool hands transactions over
+// to the shard whose chain includes them.
+type ForwardTxsEvent struct {
+	Shard uint64
+	Txs   []*types.Transaction
+}
+
 // PendingLogsEvent is posted pre mining and notifies of pending logs.
 type PendingLogsEvent struct {
 	Logs []*types.Log
@@ -41,6 +48,28 @@ type NewRefBlockEvent struct{ Start, End uint64 }
 // ForeignDataEvent is posted when data download is complete
 type ForeignDataEvent struct{}
 
+// CrossShardEvent is posted when a cross-shard transaction or the state
+// commitment of a shard makes progress.
+type CrossShardEvent struct {
+	Kind      string       `json:"kind"`                // One of the CrossTx* progress values or StateCommitted
+	RefNum    uint64       `json:"refNum"`              // Reference block the transaction or commitment was included in
+	RefHash   common.Hash  `json:"refHash"`             // Hash of the transaction on the reference chain
+	LocalHash *common.Hash `json:"localHash,omitempty"` // Hash of the call executed by the involved shards
+	Shard     uint64       `json:"shard"`               // Shard that made the progress
+	Shards    []uint64     `json:"shards,omitempty"`    // Shards involved in a cross-shard transaction
+	Number    uint64       `json:"number,omitempty"`    // Executing or committed shard block
+	Status    *uint64      `json:"status,omitempty"`    // Receipt status of an execution
+	Reported  uint64       `json:"reported,omitempty"`  // Latest reference block processed by a committed block
+	Root      *common.Hash `json:"root,omitempty"`      // State root of a committed block
+}
+
+// ShardTopologyEvent is posted when the reference chain reassigns validators
+// between shards.
+type ShardTopologyEvent struct {
+	Number uint64                      // Reference block the assignment was read from
+	Shards map[uint64][]common.Address // Validators of every shard, indexed by shard
+}
+
 // RemovedLogsEvent is posted when a reorg happens
 type RemovedLogsEvent struct{ Logs []*types.Log }
 
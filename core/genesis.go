@@ -201,6 +201,12 @@ func SetupGenesisBlock(db ethdb.Database, genesis *Genesis) (*params.ChainConfig
 
 	// Get the existing chain configuration.
 	newcfg := genesis.configOrDefault(stored)
+	if err := newcfg.CheckShardConsensus(); err != nil {
+		return newcfg, stored, err
+	}
+	if err := newcfg.CheckCrossShard(); err != nil {
+		return newcfg, stored, err
+	}
 	storedcfg := rawdb.ReadChainConfig(db, stored)
 	if storedcfg == nil {
 		log.Warn("Found genesis block without chain config")
@@ -0,0 +1,342 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package lock implements the locks cross-shard transactions hold on the
+// storage keys of their read-write sets while the reference chain orders them.
+package lock
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Mode is the access a cross-shard transaction needs to a storage key.
+type Mode uint8
+
+const (
+	Shared    Mode = iota // The key is only read
+	Exclusive             // The key is written
+)
+
+// Compatible returns whether a key may be locked in both modes at once, which
+// is only the case if neither writes it.
+func (m Mode) Compatible(other Mode) bool {
+	return m == Shared && other == Shared
+}
+
+// Key identifies a storage key of a contract of a shard. Every shard has its
+// own state, so the same contract address denotes different contracts on
+// different shards.
+type Key struct {
+	Shard uint64
+	Addr  common.Address
+	Slot  common.Hash
+}
+
+// holder is an accepted cross-shard transaction holding locks.
+type holder struct {
+	refNum uint64                  // Reference block that accepted the transaction
+	keys   map[uint64]map[Key]Mode // Locked keys, by the shard storing them
+}
+
+// Request is a cross-shard transaction waiting to lock its keys.
+type Request struct {
+	Hash   common.Hash
+	Sender common.Address            // Creator of the transaction, whose requests are granted in the order listed
+	Keys   map[uint64][]*types.CKeys // Read-write set of every involved shard
+}
+
+// Manager keeps the storage keys locked by cross-shard transactions between
+// their acceptance on the reference chain and the state commitments of the
+// involved shards covering them.
+//
+// Transactions lock all of their keys at once when accepted, so no transaction
+// ever holds some keys while waiting for others and deadlocks cannot occur.
+// Transactions waiting to be accepted are scheduled oldest first, and keys
+// wanted by an older waiting transaction are not handed to younger ones, so
+// that a stream of transactions on a hot contract cannot starve a conflicting
+// one.
+type Manager struct {
+	mu      sync.RWMutex
+	keys    map[Key]map[common.Hash]Mode // Holders of every locked key
+	holders map[common.Hash]*holder      // Locks held by every transaction
+	ages    map[common.Hash]uint64       // Arrival order of waiting transactions
+	nextAge uint64
+}
+
+// NewManager creates a lock manager without any locks.
+func NewManager() *Manager {
+	return &Manager{
+		keys:    make(map[Key]map[common.Hash]Mode),
+		holders: make(map[common.Hash]*holder),
+		ages:    make(map[common.Hash]uint64),
+	}
+}
+
+// Set returns the lock mode needed for every key of a read-write set, by the
+// shard storing the key.
+func Set(allKeys map[uint64][]*types.CKeys) map[uint64]map[Key]Mode {
+	set := make(map[uint64]map[Key]Mode)
+	for shard, sKeys := range allKeys {
+		keys := make(map[Key]Mode)
+		for _, cKeys := range sKeys {
+			for _, key := range cKeys.Keys {
+				if _, ok := keys[Key{shard, cKeys.Addr, key}]; !ok {
+					keys[Key{shard, cKeys.Addr, key}] = Shared
+				}
+			}
+			for _, key := range cKeys.WKeys {
+				keys[Key{shard, cKeys.Addr, key}] = Exclusive
+			}
+		}
+		set[shard] = keys
+	}
+	return set
+}
+
+// Acquire records the locks of a cross-shard transaction accepted in reference
+// block refNum. The reference contract has already ordered the transaction, so
+// its locks are taken even if they conflict with held ones.
+func (lm *Manager) Acquire(hash common.Hash, refNum uint64, allKeys map[uint64][]*types.CKeys) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	lm.release(hash)
+	delete(lm.ages, hash)
+
+	h := &holder{refNum: refNum, keys: Set(allKeys)}
+	for _, keys := range h.keys {
+		for k, mode := range keys {
+			if _, ok := lm.keys[k]; !ok {
+				lm.keys[k] = make(map[common.Hash]Mode)
+			}
+			lm.keys[k][hash] = mode
+		}
+	}
+	lm.holders[hash] = h
+}
+
+// Release drops all locks of a cross-shard transaction, e.g. once it has been
+// aborted.
+func (lm *Manager) Release(hash common.Hash) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	lm.release(hash)
+}
+
+func (lm *Manager) release(hash common.Hash) {
+	h, ok := lm.holders[hash]
+	if !ok {
+		return
+	}
+	for shard := range h.keys {
+		lm.releaseShard(hash, h, shard)
+	}
+	delete(lm.holders, hash)
+}
+
+// releaseShard drops the locks a transaction holds on the keys of shard.
+func (lm *Manager) releaseShard(hash common.Hash, h *holder, shard uint64) {
+	for k := range h.keys[shard] {
+		delete(lm.keys[k], hash)
+		if len(lm.keys[k]) == 0 {
+			delete(lm.keys, k)
+		}
+	}
+	delete(h.keys, shard)
+}
+
+// ReleaseCovered drops the locks on the keys of shard held by the transactions
+// accepted up to reference block report, which a state commitment of the shard
+// reporting that block covers. It returns the transactions left without locks.
+func (lm *Manager) ReleaseCovered(shard, report uint64) []common.Hash {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	var released []common.Hash
+	for hash, h := range lm.holders {
+		if h.refNum > report {
+			continue
+		}
+		if _, ok := h.keys[shard]; ok {
+			lm.releaseShard(hash, h, shard)
+		}
+		if len(h.keys) == 0 {
+			delete(lm.holders, hash)
+			released = append(released, hash)
+		}
+	}
+	return released
+}
+
+// Reset drops all locks and forgets the waiting transactions.
+func (lm *Manager) Reset() {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	lm.keys = make(map[Key]map[common.Hash]Mode)
+	lm.holders = make(map[common.Hash]*holder)
+	lm.ages = make(map[common.Hash]uint64)
+}
+
+// Holding returns whether a cross-shard transaction still holds locks.
+func (lm *Manager) Holding(hash common.Hash) bool {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	_, ok := lm.holders[hash]
+	return ok
+}
+
+// LockedKeys returns the locked keys of contract addr of shard, mapped to the
+// number of shared holders or -1 if the key is locked exclusively.
+func (lm *Manager) LockedKeys(shard uint64, addr common.Address) map[common.Hash]int {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	keys := make(map[common.Hash]int)
+	for k, holders := range lm.keys {
+		if k.Shard != shard || k.Addr != addr {
+			continue
+		}
+		for _, mode := range holders {
+			if mode == Exclusive {
+				keys[k.Slot] = -1
+				break
+			}
+			keys[k.Slot]++
+		}
+	}
+	return keys
+}
+
+// Schedule picks the waiting transactions whose locks can be granted in the
+// next reference block, in which state commitments reporting the reference
+// block covered[shard] are included for some shards. Requests are considered
+// in the order they first arrived, and a request that cannot be granted still
+// claims its keys, keeping younger conflicting requests waiting behind it.
+// Nothing is locked until the granted transactions are accepted.
+//
+// The requests of a sender are granted in the order they are listed, as its
+// transactions are included in nonce order: once one of them waits, the ones
+// listed after it wait as well and claim no keys.
+func (lm *Manager) Schedule(reqs []*Request, covered map[uint64]uint64) []*Request {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	// Age the waiting transactions, forgetting the ones no longer waiting
+	waiting := make(map[common.Hash]bool, len(reqs))
+	for _, req := range reqs {
+		waiting[req.Hash] = true
+		if _, ok := lm.ages[req.Hash]; !ok {
+			lm.ages[req.Hash] = lm.nextAge
+			lm.nextAge++
+		}
+	}
+	for hash := range lm.ages {
+		if !waiting[hash] {
+			delete(lm.ages, hash)
+		}
+	}
+	queue := make([]*Request, len(reqs))
+	copy(queue, reqs)
+	sort.SliceStable(queue, func(i, j int) bool { return lm.ages[queue[i].Hash] < lm.ages[queue[j].Hash] })
+
+	// Requests stuck behind a waiting one of their sender release their claims,
+	// which may let other requests through and hold up further ones in turn
+	stuck := make(map[common.Hash]bool)
+	for {
+		granted := lm.grant(queue, covered, stuck)
+
+		changed := false
+		stopped := make(map[common.Address]bool)
+		for _, req := range reqs {
+			if stopped[req.Sender] {
+				if !stuck[req.Hash] {
+					stuck[req.Hash], changed = true, true
+				}
+				continue
+			}
+			if !granted[req.Hash] {
+				stopped[req.Sender] = true
+			}
+		}
+		if !changed {
+			var result []*Request
+			for _, req := range queue {
+				if granted[req.Hash] {
+					result = append(result, req)
+				}
+			}
+			return result
+		}
+	}
+}
+
+// grant returns the requests of queue that can be granted in order, leaving
+// out the stuck ones without claiming their keys.
+func (lm *Manager) grant(queue []*Request, covered map[uint64]uint64, stuck map[common.Hash]bool) map[common.Hash]bool {
+	var (
+		claimed = make(map[Key]Mode)
+		granted = make(map[common.Hash]bool)
+	)
+	for _, req := range queue {
+		if stuck[req.Hash] {
+			continue
+		}
+		set, ok := Set(req.Keys), true
+		for _, keys := range set {
+			for k, mode := range keys {
+				if lm.conflicts(k, mode, req.Hash, covered) {
+					ok = false
+				}
+				if claim, cok := claimed[k]; cok && !claim.Compatible(mode) {
+					ok = false
+				}
+			}
+		}
+		for _, keys := range set {
+			for k, mode := range keys {
+				if claim, cok := claimed[k]; !cok || mode == Exclusive && claim == Shared {
+					claimed[k] = mode
+				}
+			}
+		}
+		if ok {
+			granted[req.Hash] = true
+		}
+	}
+	return granted
+}
+
+// conflicts returns whether locking k in mode conflicts with a lock held by
+// another transaction that the covered commitments do not release.
+func (lm *Manager) conflicts(k Key, mode Mode, hash common.Hash, covered map[uint64]uint64) bool {
+	for h, held := range lm.keys[k] {
+		if h == hash || held.Compatible(mode) {
+			continue
+		}
+		if report, ok := covered[k.Shard]; ok && lm.holders[h].refNum <= report {
+			continue
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,267 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package lock
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var (
+	testAddr = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	keyA     = common.HexToHash("0x0a")
+	keyB     = common.HexToHash("0x0b")
+)
+
+// testKeys builds the read-write set of a transaction touching keys of testAddr
+// on shard 1, writing the keys marked true.
+func testKeys(keys map[common.Hash]bool) map[uint64][]*types.CKeys {
+	ck := &types.CKeys{Addr: testAddr}
+	for key, write := range keys {
+		ck.Keys = append(ck.Keys, key)
+		if write {
+			ck.WKeys = append(ck.WKeys, key)
+		}
+	}
+	return map[uint64][]*types.CKeys{1: {ck}}
+}
+
+func request(n byte, keys map[common.Hash]bool) *Request {
+	return &Request{Hash: common.Hash{n}, Sender: common.Address{n}, Keys: testKeys(keys)}
+}
+
+func scheduled(granted []*Request) map[common.Hash]bool {
+	set := make(map[common.Hash]bool)
+	for _, req := range granted {
+		set[req.Hash] = true
+	}
+	return set
+}
+
+func TestLockConflictMatrix(t *testing.T) {
+	tests := []struct {
+		held, wanted Mode
+		compatible   bool
+	}{
+		{Shared, Shared, true},
+		{Shared, Exclusive, false},
+		{Exclusive, Shared, false},
+		{Exclusive, Exclusive, false},
+	}
+	for i, tt := range tests {
+		if have := tt.held.Compatible(tt.wanted); have != tt.compatible {
+			t.Errorf("test %d: compatible mismatch: have %v, want %v", i, have, tt.compatible)
+		}
+		// The same outcome when the held lock belongs to an accepted transaction
+		lm := NewManager()
+		lm.Acquire(common.Hash{1}, 1, testKeys(map[common.Hash]bool{keyA: tt.held == Exclusive}))
+
+		granted := lm.Schedule([]*Request{request(2, map[common.Hash]bool{keyA: tt.wanted == Exclusive})}, nil)
+		if have := len(granted) == 1; have != tt.compatible {
+			t.Errorf("test %d: granted mismatch: have %v, want %v", i, have, tt.compatible)
+		}
+		// And when it is only claimed by an older request of the same schedule
+		lm = NewManager()
+		granted = lm.Schedule([]*Request{
+			request(1, map[common.Hash]bool{keyA: tt.held == Exclusive}),
+			request(2, map[common.Hash]bool{keyA: tt.wanted == Exclusive}),
+		}, nil)
+		if have := len(granted) == 2; have != tt.compatible {
+			t.Errorf("test %d: claimed granted mismatch: have %v, want %v", i, have, tt.compatible)
+		}
+	}
+}
+
+func TestLockDisjointKeys(t *testing.T) {
+	lm := NewManager()
+	lm.Acquire(common.Hash{1}, 1, testKeys(map[common.Hash]bool{keyA: true}))
+
+	granted := lm.Schedule([]*Request{request(2, map[common.Hash]bool{keyB: true})}, nil)
+	if len(granted) != 1 {
+		t.Fatalf("write on a different key was not granted")
+	}
+}
+
+func TestLockedKeys(t *testing.T) {
+	lm := NewManager()
+	lm.Acquire(common.Hash{1}, 1, testKeys(map[common.Hash]bool{keyA: false, keyB: true}))
+	lm.Acquire(common.Hash{2}, 1, testKeys(map[common.Hash]bool{keyA: false}))
+
+	keys := lm.LockedKeys(1, testAddr)
+	if keys[keyA] != 2 || keys[keyB] != -1 || len(keys) != 2 {
+		t.Fatalf("locked keys mismatch: %v", keys)
+	}
+	if keys := lm.LockedKeys(1, common.Address{}); len(keys) != 0 {
+		t.Fatalf("unlocked contract reports keys: %v", keys)
+	}
+	lm.Release(common.Hash{1})
+	if keys := lm.LockedKeys(1, testAddr); keys[keyA] != 1 || len(keys) != 1 {
+		t.Fatalf("locked keys mismatch after release: %v", keys)
+	}
+}
+
+func TestLockReleaseCovered(t *testing.T) {
+	lm := NewManager()
+	both := map[uint64][]*types.CKeys{
+		1: {{Addr: testAddr, Keys: []common.Hash{keyA}, WKeys: []common.Hash{keyA}}},
+		2: {{Addr: common.Address{2}, Keys: []common.Hash{keyB}, WKeys: []common.Hash{keyB}}},
+	}
+	lm.Acquire(common.Hash{1}, 5, both)
+	lm.Acquire(common.Hash{2}, 8, testKeys(map[common.Hash]bool{keyB: true}))
+
+	// A commitment reporting an older block releases nothing
+	if released := lm.ReleaseCovered(1, 4); len(released) != 0 || len(lm.LockedKeys(1, testAddr)) != 2 {
+		t.Fatalf("uncovered locks released: %v", released)
+	}
+	// Covering the first transaction on one shard only releases the keys of that shard
+	if released := lm.ReleaseCovered(1, 6); len(released) != 0 {
+		t.Fatalf("transaction released before every shard committed: %v", released)
+	}
+	if keys := lm.LockedKeys(1, testAddr); len(keys) != 1 || keys[keyB] != -1 {
+		t.Fatalf("locked keys mismatch: %v", keys)
+	}
+	if !lm.Holding(common.Hash{1}) || len(lm.LockedKeys(2, common.Address{2})) != 1 {
+		t.Fatalf("locks of the uncommitted shard released")
+	}
+	if released := lm.ReleaseCovered(2, 5); len(released) != 1 || released[0] != (common.Hash{1}) || lm.Holding(common.Hash{1}) {
+		t.Fatalf("covered transaction not released: %v", released)
+	}
+	if released := lm.ReleaseCovered(1, 8); len(released) != 1 || len(lm.LockedKeys(1, testAddr)) != 0 {
+		t.Fatalf("remaining locks not released: %v", released)
+	}
+}
+
+func TestLockScheduleCovered(t *testing.T) {
+	lm := NewManager()
+	lm.Acquire(common.Hash{1}, 3, testKeys(map[common.Hash]bool{keyA: true}))
+
+	req := request(2, map[common.Hash]bool{keyA: true})
+	if granted := lm.Schedule([]*Request{req}, map[uint64]uint64{1: 2}); len(granted) != 0 {
+		t.Fatalf("granted behind a lock the included commitment does not cover")
+	}
+	if granted := lm.Schedule([]*Request{req}, map[uint64]uint64{2: 3}); len(granted) != 0 {
+		t.Fatalf("granted behind a lock covered on another shard only")
+	}
+	if granted := lm.Schedule([]*Request{req}, map[uint64]uint64{1: 3}); len(granted) != 1 {
+		t.Fatalf("not granted although the included commitment releases the lock")
+	}
+	// Scheduling does not lock anything
+	if keys := lm.LockedKeys(1, testAddr); keys[keyA] != -1 || len(keys) != 1 {
+		t.Fatalf("schedule changed the locks: %v", keys)
+	}
+}
+
+func TestLockScheduleFairness(t *testing.T) {
+	lm := NewManager()
+	lm.Acquire(common.Hash{1}, 1, testKeys(map[common.Hash]bool{keyA: false}))
+
+	// A writer waits for the reader holding the key
+	writer := request(2, map[common.Hash]bool{keyA: true})
+	if granted := lm.Schedule([]*Request{writer}, nil); len(granted) != 0 {
+		t.Fatalf("writer granted while the key is read")
+	}
+	// Younger readers cannot overtake it, even though they are compatible with
+	// the held lock and listed first
+	reader := request(3, map[common.Hash]bool{keyA: false})
+	if granted := lm.Schedule([]*Request{reader, writer}, nil); len(granted) != 0 {
+		t.Fatalf("younger reader overtook the waiting writer: %v", scheduled(granted))
+	}
+	// Once the reader is released, the writer goes first and the reader waits
+	lm.ReleaseCovered(1, 1)
+	granted := scheduled(lm.Schedule([]*Request{reader, writer}, nil))
+	if !granted[writer.Hash] || granted[reader.Hash] {
+		t.Fatalf("writer not granted first: %v", granted)
+	}
+	lm.Acquire(writer.Hash, 2, writer.Keys)
+	lm.ReleaseCovered(1, 2)
+	if granted := lm.Schedule([]*Request{reader}, nil); len(granted) != 1 {
+		t.Fatalf("reader not granted after the writer")
+	}
+}
+
+func TestLockScheduleForgetsDropped(t *testing.T) {
+	lm := NewManager()
+	lm.Acquire(common.Hash{1}, 1, testKeys(map[common.Hash]bool{keyA: true}))
+
+	old := request(2, map[common.Hash]bool{keyA: true})
+	lm.Schedule([]*Request{old}, nil)
+	lm.ReleaseCovered(1, 1)
+
+	// A request no longer waiting loses its place in the queue
+	young := request(3, map[common.Hash]bool{keyA: true})
+	if granted := lm.Schedule([]*Request{young}, nil); len(granted) != 1 {
+		t.Fatalf("request blocked by a dropped one")
+	}
+	granted := scheduled(lm.Schedule([]*Request{old, young}, nil))
+	if !granted[young.Hash] || granted[old.Hash] {
+		t.Fatalf("returning request kept its age: %v", granted)
+	}
+}
+
+func TestLockShards(t *testing.T) {
+	lm := NewManager()
+	both := map[uint64][]*types.CKeys{
+		1: {{Addr: testAddr, Keys: []common.Hash{keyA}, WKeys: []common.Hash{keyA}}},
+		2: {{Addr: testAddr, Keys: []common.Hash{keyA}, WKeys: []common.Hash{keyA}}},
+	}
+	lm.Acquire(common.Hash{1}, 5, both)
+
+	// The same contract address on different shards is a different contract
+	if keys := lm.LockedKeys(3, testAddr); len(keys) != 0 {
+		t.Fatalf("keys locked on an uninvolved shard: %v", keys)
+	}
+	// Releasing the keys of one shard keeps the locks of the other
+	lm.ReleaseCovered(1, 5)
+	if keys := lm.LockedKeys(1, testAddr); len(keys) != 0 {
+		t.Fatalf("covered keys still locked: %v", keys)
+	}
+	if keys := lm.LockedKeys(2, testAddr); keys[keyA] != -1 {
+		t.Fatalf("keys of the uncommitted shard released: %v", keys)
+	}
+	req := &Request{Hash: common.Hash{2}, Sender: common.Address{2}, Keys: map[uint64][]*types.CKeys{2: both[2]}}
+	if granted := lm.Schedule([]*Request{req}, nil); len(granted) != 0 {
+		t.Fatalf("granted behind a lock held on its shard")
+	}
+	if granted := lm.Schedule([]*Request{request(3, map[common.Hash]bool{keyA: true})}, nil); len(granted) != 1 {
+		t.Fatalf("not granted on the released shard")
+	}
+}
+
+func TestLockScheduleNonceOrder(t *testing.T) {
+	lm := NewManager()
+	lm.Acquire(common.Hash{1}, 1, testKeys(map[common.Hash]bool{keyA: true}))
+
+	// The first transaction of a sender waits for the held lock, so its next
+	// one waits as well, without keeping the key it writes from others
+	sender := common.Address{2}
+	first := &Request{Hash: common.Hash{2}, Sender: sender, Keys: testKeys(map[common.Hash]bool{keyA: true})}
+	next := &Request{Hash: common.Hash{3}, Sender: sender, Keys: testKeys(map[common.Hash]bool{keyB: true})}
+	other := request(4, map[common.Hash]bool{keyB: true})
+
+	granted := scheduled(lm.Schedule([]*Request{first, next, other}, nil))
+	if granted[first.Hash] || granted[next.Hash] || !granted[other.Hash] {
+		t.Fatalf("nonce order not kept: %v", granted)
+	}
+	// Once the lock is released, the transactions of the sender go in order
+	lm.ReleaseCovered(1, 1)
+	granted = scheduled(lm.Schedule([]*Request{first, next}, nil))
+	if !granted[first.Hash] || !granted[next.Hash] {
+		t.Fatalf("transactions of the sender not granted: %v", granted)
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// CrossShardCheckpoint is the cumulative cross-shard bookkeeping after a
+// reference block has been processed. Everything not stored here is rebuilt
+// by replaying the reference blocks starting at ReplayFrom.
+type CrossShardCheckpoint struct {
+	ReplayFrom   uint64              // First reference block whose effects are still pending
+	Commits      []*types.Commitment // Latest known commitment of every shard
+	LastCtx      []uint64            // Latest cross-shard transaction height, indexed by shard
+	LastUnlock   []uint64            // Height at which the locks of a shard were last released, indexed by shard
+	LatestCommit *types.Commitment   // Latest commitment of the local shard
+}
+
+// ReadCrossShardCheckpoint retrieves the cross-shard checkpoint of a block.
+func ReadCrossShardCheckpoint(db DatabaseReader, hash common.Hash, number uint64) *CrossShardCheckpoint {
+	data, _ := db.Get(crossShardKey(number, hash))
+	if len(data) == 0 {
+		return nil
+	}
+	checkpoint := new(CrossShardCheckpoint)
+	if err := rlp.DecodeBytes(data, checkpoint); err != nil {
+		log.Error("Invalid cross-shard checkpoint RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return checkpoint
+}
+
+// WriteCrossShardCheckpoint stores the cross-shard checkpoint of a block.
+func WriteCrossShardCheckpoint(db DatabaseWriter, hash common.Hash, number uint64, checkpoint *CrossShardCheckpoint) {
+	data, err := rlp.EncodeToBytes(checkpoint)
+	if err != nil {
+		log.Crit("Failed to RLP encode cross-shard checkpoint", "err", err)
+	}
+	if err := db.Put(crossShardKey(number, hash), data); err != nil {
+		log.Crit("Failed to store cross-shard checkpoint", "err", err)
+	}
+}
+
+// DeleteCrossShardCheckpoint removes the cross-shard checkpoint of a block.
+func DeleteCrossShardCheckpoint(db DatabaseDeleter, hash common.Hash, number uint64) {
+	if err := db.Delete(crossShardKey(number, hash)); err != nil {
+		log.Crit("Failed to delete cross-shard checkpoint", "err", err)
+	}
+}
+
+// ReadCrossShardAborts retrieves the hashes of the cross-shard transactions
+// aborted by a block, along with whether the block recorded any decision.
+func ReadCrossShardAborts(db DatabaseReader, hash common.Hash, number uint64) ([]common.Hash, bool) {
+	data, _ := db.Get(crossAbortKey(number, hash))
+	if len(data) == 0 {
+		return nil, false
+	}
+	var aborted []common.Hash
+	if err := rlp.DecodeBytes(data, &aborted); err != nil {
+		log.Error("Invalid cross-shard abort list RLP", "hash", hash, "err", err)
+		return nil, false
+	}
+	return aborted, true
+}
+
+// WriteCrossShardAborts stores the hashes of the cross-shard transactions
+// aborted by a block. An empty list records that nothing was aborted.
+func WriteCrossShardAborts(db DatabaseWriter, hash common.Hash, number uint64, aborted []common.Hash) {
+	if aborted == nil {
+		aborted = []common.Hash{}
+	}
+	data, err := rlp.EncodeToBytes(aborted)
+	if err != nil {
+		log.Crit("Failed to RLP encode cross-shard abort list", "err", err)
+	}
+	if err := db.Put(crossAbortKey(number, hash), data); err != nil {
+		log.Crit("Failed to store cross-shard abort list", "err", err)
+	}
+}
+
+// DeleteCrossShardAborts removes the cross-shard abort list of a block.
+func DeleteCrossShardAborts(db DatabaseDeleter, hash common.Hash, number uint64) {
+	if err := db.Delete(crossAbortKey(number, hash)); err != nil {
+		log.Crit("Failed to delete cross-shard abort list", "err", err)
+	}
+}
+
+// CrossTxDecision is the outcome of the atomic commit of a cross-shard
+// transaction.
+type CrossTxDecision struct {
+	Hash   common.Hash // Reference chain hash of the transaction
+	Commit bool        // Whether every involved shard voted to commit
+}
+
+// ReadCrossTxDecisions retrieves the atomic commit decisions made by a block.
+func ReadCrossTxDecisions(db DatabaseReader, hash common.Hash, number uint64) []*CrossTxDecision {
+	data, _ := db.Get(crossDecisionKey(number, hash))
+	if len(data) == 0 {
+		return nil
+	}
+	var decisions []*CrossTxDecision
+	if err := rlp.DecodeBytes(data, &decisions); err != nil {
+		log.Error("Invalid cross-shard decision list RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return decisions
+}
+
+// WriteCrossTxDecisions stores the atomic commit decisions made by a block.
+func WriteCrossTxDecisions(db DatabaseWriter, hash common.Hash, number uint64, decisions []*CrossTxDecision) {
+	data, err := rlp.EncodeToBytes(decisions)
+	if err != nil {
+		log.Crit("Failed to RLP encode cross-shard decision list", "err", err)
+	}
+	if err := db.Put(crossDecisionKey(number, hash), data); err != nil {
+		log.Crit("Failed to store cross-shard decision list", "err", err)
+	}
+}
+
+// DeleteCrossTxDecisions removes the atomic commit decisions of a block.
+func DeleteCrossTxDecisions(db DatabaseDeleter, hash common.Hash, number uint64) {
+	if err := db.Delete(crossDecisionKey(number, hash)); err != nil {
+		log.Crit("Failed to delete cross-shard decision list", "err", err)
+	}
+}
+
+// ReadShardTopology retrieves the shard topology after a reference block.
+func ReadShardTopology(db DatabaseReader, hash common.Hash, number uint64) *types.ShardTopology {
+	data, _ := db.Get(shardTopologyKey(number, hash))
+	if len(data) == 0 {
+		return nil
+	}
+	topology := new(types.ShardTopology)
+	if err := rlp.DecodeBytes(data, topology); err != nil {
+		log.Error("Invalid shard topology RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return topology
+}
+
+// WriteShardTopology stores the shard topology after a reference block.
+func WriteShardTopology(db DatabaseWriter, hash common.Hash, number uint64, topology *types.ShardTopology) {
+	data, err := rlp.EncodeToBytes(topology)
+	if err != nil {
+		log.Crit("Failed to RLP encode shard topology", "err", err)
+	}
+	if err := db.Put(shardTopologyKey(number, hash), data); err != nil {
+		log.Crit("Failed to store shard topology", "err", err)
+	}
+}
+
+// DeleteShardTopology removes the shard topology of a reference block.
+func DeleteShardTopology(db DatabaseDeleter, hash common.Hash, number uint64) {
+	if err := db.Delete(shardTopologyKey(number, hash)); err != nil {
+		log.Crit("Failed to delete shard topology", "err", err)
+	}
+}
+
+// ReadShardCheckpoint retrieves the checkpoint of a shard block.
+func ReadShardCheckpoint(db DatabaseReader, shard, number uint64) *types.ShardCheckpoint {
+	data, _ := db.Get(shardCheckpointKey(shard, number))
+	if len(data) == 0 {
+		return nil
+	}
+	checkpoint := new(types.ShardCheckpoint)
+	if err := rlp.DecodeBytes(data, checkpoint); err != nil {
+		log.Error("Invalid shard checkpoint RLP", "shard", shard, "number", number, "err", err)
+		return nil
+	}
+	return checkpoint
+}
+
+// ReadShardCheckpointByHash retrieves the checkpoint of a shard block by its hash.
+func ReadShardCheckpointByHash(db DatabaseReader, hash common.Hash) *types.ShardCheckpoint {
+	data, _ := db.Get(shardCheckpointHashKey(hash))
+	if len(data) != 16 {
+		return nil
+	}
+	return ReadShardCheckpoint(db, binary.BigEndian.Uint64(data[:8]), binary.BigEndian.Uint64(data[8:]))
+}
+
+// WriteShardCheckpoint stores the checkpoint of a shard block, indexed by its
+// number and hash.
+func WriteShardCheckpoint(db DatabaseWriter, checkpoint *types.ShardCheckpoint) {
+	data, err := rlp.EncodeToBytes(checkpoint)
+	if err != nil {
+		log.Crit("Failed to RLP encode shard checkpoint", "err", err)
+	}
+	if err := db.Put(shardCheckpointKey(checkpoint.Shard, checkpoint.Number), data); err != nil {
+		log.Crit("Failed to store shard checkpoint", "err", err)
+	}
+	index := append(encodeBlockNumber(checkpoint.Shard), encodeBlockNumber(checkpoint.Number)...)
+	if err := db.Put(shardCheckpointHashKey(checkpoint.Hash), index); err != nil {
+		log.Crit("Failed to store shard checkpoint index", "err", err)
+	}
+}
+
+// DeleteShardCheckpoint removes the checkpoint of a shard block.
+func DeleteShardCheckpoint(db DatabaseDeleter, shard, number uint64, hash common.Hash) {
+	if err := db.Delete(shardCheckpointKey(shard, number)); err != nil {
+		log.Crit("Failed to delete shard checkpoint", "err", err)
+	}
+	if err := db.Delete(shardCheckpointHashKey(hash)); err != nil {
+		log.Crit("Failed to delete shard checkpoint index", "err", err)
+	}
+}
+
+// ReadShardCheckpointHead retrieves the number of the latest checkpointed
+// block of a shard.
+func ReadShardCheckpointHead(db DatabaseReader, shard uint64) (uint64, bool) {
+	data, _ := db.Get(shardCheckpointHeadKey(shard))
+	if len(data) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(data), true
+}
+
+// WriteShardCheckpointHead stores the number of the latest checkpointed block
+// of a shard.
+func WriteShardCheckpointHead(db DatabaseWriter, shard, number uint64) {
+	if err := db.Put(shardCheckpointHeadKey(shard), encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store shard checkpoint head", "err", err)
+	}
+}
+
+// refTxStorage is the storage encoding of a proven reference transaction.
+type refTxStorage struct {
+	Index   uint64
+	Tx      *types.Transaction
+	Receipt *types.ReceiptForStorage
+}
+
+// ReadRefTxs retrieves the cross-shard transactions of a reference block kept
+// by a header-only reference chain, along with whether any were stored.
+func ReadRefTxs(db DatabaseReader, hash common.Hash, number uint64) ([]*types.RefTx, bool) {
+	data, _ := db.Get(refTxsKey(number, hash))
+	if len(data) == 0 {
+		return nil, false
+	}
+	var stored []*refTxStorage
+	if err := rlp.DecodeBytes(data, &stored); err != nil {
+		log.Error("Invalid reference transactions RLP", "hash", hash, "err", err)
+		return nil, false
+	}
+	refTxs := make([]*types.RefTx, len(stored))
+	for i, entry := range stored {
+		refTxs[i] = &types.RefTx{Index: entry.Index, Tx: entry.Tx, Receipt: (*types.Receipt)(entry.Receipt)}
+	}
+	return refTxs, true
+}
+
+// WriteRefTxs stores the proven cross-shard transactions of a reference block.
+func WriteRefTxs(db DatabaseWriter, hash common.Hash, number uint64, refTxs []*types.RefTx) {
+	stored := make([]*refTxStorage, len(refTxs))
+	for i, refTx := range refTxs {
+		stored[i] = &refTxStorage{Index: refTx.Index, Tx: refTx.Tx, Receipt: (*types.ReceiptForStorage)(refTx.Receipt)}
+	}
+	data, err := rlp.EncodeToBytes(stored)
+	if err != nil {
+		log.Crit("Failed to RLP encode reference transactions", "err", err)
+	}
+	if err := db.Put(refTxsKey(number, hash), data); err != nil {
+		log.Crit("Failed to store reference transactions", "err", err)
+	}
+}
+
+// DeleteRefTxs removes the proven cross-shard transactions of a reference block.
+func DeleteRefTxs(db DatabaseDeleter, hash common.Hash, number uint64) {
+	if err := db.Delete(refTxsKey(number, hash)); err != nil {
+		log.Crit("Failed to delete reference transactions", "err", err)
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// Tests cross-shard checkpoint storage and retrieval operations.
+func TestCrossShardCheckpointStorage(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+
+	hash, number := common.HexToHash("0x01"), uint64(42)
+	checkpoint := &CrossShardCheckpoint{
+		ReplayFrom: 40,
+		Commits: []*types.Commitment{
+			{Shard: 1, BlockNum: 10, RefNum: 39, StateRoot: common.HexToHash("0x02"), BHash: common.HexToHash("0x03")},
+			{Shard: 2, BlockNum: 12, RefNum: 40, StateRoot: common.HexToHash("0x04"), BHash: common.HexToHash("0x05")},
+		},
+		LastCtx:      []uint64{0, 41, 38},
+		LastUnlock:   []uint64{0, 39, 40},
+		LatestCommit: &types.Commitment{Shard: 1, BlockNum: 10, RefNum: 39},
+	}
+	if entry := ReadCrossShardCheckpoint(db, hash, number); entry != nil {
+		t.Fatalf("Non existent checkpoint returned: %v", entry)
+	}
+	// Write and verify the checkpoint in the database
+	WriteCrossShardCheckpoint(db, hash, number, checkpoint)
+	if entry := ReadCrossShardCheckpoint(db, hash, number); entry == nil {
+		t.Fatalf("Stored checkpoint not found")
+	} else if !reflect.DeepEqual(entry, checkpoint) {
+		t.Fatalf("Retrieved checkpoint mismatch: have %v, want %v", entry, checkpoint)
+	}
+	// Delete the checkpoint and verify the execution
+	DeleteCrossShardCheckpoint(db, hash, number)
+	if entry := ReadCrossShardCheckpoint(db, hash, number); entry != nil {
+		t.Fatalf("Deleted checkpoint returned: %v", entry)
+	}
+}
+
+// Tests cross-shard abort list storage and retrieval operations.
+func TestCrossShardAbortStorage(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+
+	hash, number := common.HexToHash("0x01"), uint64(42)
+	if aborted, ok := ReadCrossShardAborts(db, hash, number); ok {
+		t.Fatalf("Non existent abort list returned: %v", aborted)
+	}
+	// An empty list must still be distinguishable from a missing one
+	WriteCrossShardAborts(db, hash, number, nil)
+	if aborted, ok := ReadCrossShardAborts(db, hash, number); !ok {
+		t.Fatalf("Stored empty abort list not found")
+	} else if len(aborted) != 0 {
+		t.Fatalf("Retrieved abort list mismatch: have %v, want none", aborted)
+	}
+	want := []common.Hash{common.HexToHash("0x02"), common.HexToHash("0x03")}
+	WriteCrossShardAborts(db, hash, number, want)
+	if aborted, ok := ReadCrossShardAborts(db, hash, number); !ok {
+		t.Fatalf("Stored abort list not found")
+	} else if !reflect.DeepEqual(aborted, want) {
+		t.Fatalf("Retrieved abort list mismatch: have %v, want %v", aborted, want)
+	}
+	// Delete the abort list and verify the execution
+	DeleteCrossShardAborts(db, hash, number)
+	if aborted, ok := ReadCrossShardAborts(db, hash, number); ok {
+		t.Fatalf("Deleted abort list returned: %v", aborted)
+	}
+}
+
+// Tests atomic commit decision storage and retrieval operations.
+func TestCrossTxDecisionStorage(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+
+	hash, number := common.HexToHash("0x01"), uint64(42)
+	if decisions := ReadCrossTxDecisions(db, hash, number); decisions != nil {
+		t.Fatalf("Non existent decision list returned: %v", decisions)
+	}
+	want := []*CrossTxDecision{
+		{Hash: common.HexToHash("0x02"), Commit: true},
+		{Hash: common.HexToHash("0x03")},
+	}
+	WriteCrossTxDecisions(db, hash, number, want)
+	if decisions := ReadCrossTxDecisions(db, hash, number); !reflect.DeepEqual(decisions, want) {
+		t.Fatalf("Retrieved decision list mismatch: have %v, want %v", decisions, want)
+	}
+	// Delete the decision list and verify the execution
+	DeleteCrossTxDecisions(db, hash, number)
+	if decisions := ReadCrossTxDecisions(db, hash, number); decisions != nil {
+		t.Fatalf("Deleted decision list returned: %v", decisions)
+	}
+}
+
+// Tests shard topology storage and retrieval operations.
+func TestShardTopologyStorage(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+
+	hash, number := common.HexToHash("0x01"), uint64(60)
+	topology := &types.ShardTopology{
+		Since: 30,
+		Shards: [][]common.Address{
+			{common.HexToAddress("0x0a"), common.HexToAddress("0x0b")},
+			{common.HexToAddress("0x0c")},
+		},
+		Votes: []*types.ShardMoveVote{{Validator: common.HexToAddress("0x0a"), Address: common.HexToAddress("0x0b"), Shard: 1}},
+		Moves: []*types.ShardMove{{Address: common.HexToAddress("0x0c"), Shard: 0}},
+	}
+	if entry := ReadShardTopology(db, hash, number); entry != nil {
+		t.Fatalf("Non existent topology returned: %v", entry)
+	}
+	// Write and verify the topology in the database
+	WriteShardTopology(db, hash, number, topology)
+	if entry := ReadShardTopology(db, hash, number); entry == nil {
+		t.Fatalf("Stored topology not found")
+	} else if !reflect.DeepEqual(entry, topology) {
+		t.Fatalf("Retrieved topology mismatch: have %v, want %v", entry, topology)
+	}
+	// Delete the topology and verify the execution
+	DeleteShardTopology(db, hash, number)
+	if entry := ReadShardTopology(db, hash, number); entry != nil {
+		t.Fatalf("Deleted topology returned: %v", entry)
+	}
+}
+
+// Tests shard checkpoint storage and retrieval operations.
+func TestShardCheckpointStorage(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+
+	checkpoint := &types.ShardCheckpoint{
+		Shard:         2,
+		Number:        40,
+		Hash:          common.HexToHash("0x01"),
+		Root:          common.HexToHash("0x02"),
+		RefNumber:     18,
+		CommittedSeal: []hexutil.Bytes{{0x0a}, {0x0b}},
+		Checkpointed:  20,
+		CommitTx:      common.HexToHash("0x03"),
+
+		Signers:        hexutil.Bytes{0x03},
+		AggregatedSeal: hexutil.Bytes{0x0c},
+	}
+	if entry := ReadShardCheckpointByHash(db, checkpoint.Hash); entry != nil {
+		t.Fatalf("Non existent checkpoint returned: %v", entry)
+	}
+	// Write and verify the checkpoint in the database
+	WriteShardCheckpoint(db, checkpoint)
+	if entry := ReadShardCheckpoint(db, 2, 40); !reflect.DeepEqual(entry, checkpoint) {
+		t.Fatalf("Retrieved checkpoint mismatch: have %v, want %v", entry, checkpoint)
+	}
+	if entry := ReadShardCheckpointByHash(db, checkpoint.Hash); !reflect.DeepEqual(entry, checkpoint) {
+		t.Fatalf("Retrieved checkpoint by hash mismatch: have %v, want %v", entry, checkpoint)
+	}
+	if entry := ReadShardCheckpoint(db, 1, 40); entry != nil {
+		t.Fatalf("Checkpoint of another shard returned: %v", entry)
+	}
+	if _, ok := ReadShardCheckpointHead(db, 2); ok {
+		t.Fatalf("Non existent checkpoint head returned")
+	}
+	WriteShardCheckpointHead(db, 2, 40)
+	if number, ok := ReadShardCheckpointHead(db, 2); !ok || number != 40 {
+		t.Fatalf("Retrieved checkpoint head mismatch: have %d, want 40", number)
+	}
+	// Delete the checkpoint and verify the execution
+	DeleteShardCheckpoint(db, 2, 40, checkpoint.Hash)
+	if entry := ReadShardCheckpointByHash(db, checkpoint.Hash); entry != nil {
+		t.Fatalf("Deleted checkpoint returned: %v", entry)
+	}
+}
+
+// Tests proven reference transaction storage and retrieval operations.
+func TestRefTxsStorage(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+
+	hash, number := common.HexToHash("0x01"), uint64(42)
+	tx := types.NewTransaction(types.CrossShard, 1, 0, common.HexToAddress("0x0a"), big.NewInt(0), 90000, big.NewInt(1), []byte{0x01})
+	receipt := types.NewReceipt(nil, false, 42000)
+	receipt.TxHash, receipt.GasUsed = tx.Hash(), 21000
+	receipt.Logs = []*types.Log{{Address: common.HexToAddress("0x0a"), Data: []byte{0x01}}}
+
+	if refTxs, ok := ReadRefTxs(db, hash, number); ok {
+		t.Fatalf("Non existent reference transactions returned: %v", refTxs)
+	}
+	// Write and verify the transactions in the database
+	WriteRefTxs(db, hash, number, []*types.RefTx{{Index: 3, Tx: tx, Receipt: receipt}})
+	refTxs, ok := ReadRefTxs(db, hash, number)
+	if !ok || len(refTxs) != 1 {
+		t.Fatalf("Stored reference transactions not found: %v", refTxs)
+	}
+	if refTxs[0].Index != 3 || refTxs[0].Tx.Hash() != tx.Hash() {
+		t.Fatalf("Retrieved transaction mismatch: have %d/%x, want 3/%x", refTxs[0].Index, refTxs[0].Tx.Hash(), tx.Hash())
+	}
+	if have := refTxs[0].Receipt; have.Status != receipt.Status || have.TxHash != receipt.TxHash || have.GasUsed != receipt.GasUsed || !reflect.DeepEqual(have.Logs[0].Data, receipt.Logs[0].Data) {
+		t.Fatalf("Retrieved receipt mismatch: have %v, want %v", have, receipt)
+	}
+	// Delete the transactions and verify the execution
+	DeleteRefTxs(db, hash, number)
+	if refTxs, ok := ReadRefTxs(db, hash, number); ok {
+		t.Fatalf("Deleted reference transactions returned: %v", refTxs)
+	}
+}
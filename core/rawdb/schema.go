@@ -41,6 +41,9 @@ var (
 	// fastTrieProgressKey tracks the number of trie entries imported during fast sync.
 	fastTrieProgressKey = []byte("TrieSync")
 
+	// shardCheckpointHeadPrefix tracks the latest checkpointed block of every shard.
+	shardCheckpointHeadPrefix = []byte("LastShardCheckpoint")
+
 	// Data item prefixes (use single byte to avoid mixing data types, avoid `i`, used for indexes).
 	headerPrefix       = []byte("h") // headerPrefix + num (uint64 big endian) + hash -> header
 	headerTDSuffix     = []byte("t") // headerPrefix + num (uint64 big endian) + hash + headerTDSuffix -> td
@@ -49,6 +52,14 @@ var (
 
 	blockBodyPrefix     = []byte("b") // blockBodyPrefix + num (uint64 big endian) + hash -> block body
 	blockReceiptsPrefix = []byte("r") // blockReceiptsPrefix + num (uint64 big endian) + hash -> block receipts
+	crossShardPrefix    = []byte("x") // crossShardPrefix + num (uint64 big endian) + hash -> cross-shard checkpoint
+	crossAbortPrefix    = []byte("X") // crossAbortPrefix + num (uint64 big endian) + hash -> aborted cross-shard transactions
+	crossDecisionPrefix = []byte("D") // crossDecisionPrefix + num (uint64 big endian) + hash -> atomic commit decisions
+	shardTopologyPrefix = []byte("v") // shardTopologyPrefix + num (uint64 big endian) + hash -> shard topology
+	refTxsPrefix        = []byte("c") // refTxsPrefix + num (uint64 big endian) + hash -> proven cross-shard transactions
+
+	shardCheckpointPrefix     = []byte("k") // shardCheckpointPrefix + shard (uint64 big endian) + num (uint64 big endian) -> shard checkpoint
+	shardCheckpointHashPrefix = []byte("K") // shardCheckpointHashPrefix + hash -> shard + num (uint64 big endian)
 
 	txLookupPrefix  = []byte("l") // txLookupPrefix + hash -> transaction/receipt lookup metadata
 	bloomBitsPrefix = []byte("B") // bloomBitsPrefix + bit (uint16 big endian) + section (uint64 big endian) + hash -> bloom bits
@@ -108,6 +119,46 @@ func blockReceiptsKey(number uint64, hash common.Hash) []byte {
 	return append(append(blockReceiptsPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
 }
 
+// crossShardKey = crossShardPrefix + num (uint64 big endian) + hash
+func crossShardKey(number uint64, hash common.Hash) []byte {
+	return append(append(crossShardPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// crossAbortKey = crossAbortPrefix + num (uint64 big endian) + hash
+func crossAbortKey(number uint64, hash common.Hash) []byte {
+	return append(append(crossAbortPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// crossDecisionKey = crossDecisionPrefix + num (uint64 big endian) + hash
+func crossDecisionKey(number uint64, hash common.Hash) []byte {
+	return append(append(crossDecisionPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// shardTopologyKey = shardTopologyPrefix + num (uint64 big endian) + hash
+func shardTopologyKey(number uint64, hash common.Hash) []byte {
+	return append(append(shardTopologyPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// refTxsKey = refTxsPrefix + num (uint64 big endian) + hash
+func refTxsKey(number uint64, hash common.Hash) []byte {
+	return append(append(refTxsPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// shardCheckpointKey = shardCheckpointPrefix + shard (uint64 big endian) + num (uint64 big endian)
+func shardCheckpointKey(shard, number uint64) []byte {
+	return append(append(shardCheckpointPrefix, encodeBlockNumber(shard)...), encodeBlockNumber(number)...)
+}
+
+// shardCheckpointHashKey = shardCheckpointHashPrefix + hash
+func shardCheckpointHashKey(hash common.Hash) []byte {
+	return append(shardCheckpointHashPrefix, hash.Bytes()...)
+}
+
+// shardCheckpointHeadKey = shardCheckpointHeadPrefix + shard (uint64 big endian)
+func shardCheckpointHeadKey(shard uint64) []byte {
+	return append(shardCheckpointHeadPrefix, encodeBlockNumber(shard)...)
+}
+
 // txLookupKey = txLookupPrefix + hash
 func txLookupKey(hash common.Hash) []byte {
 	return append(txLookupPrefix, hash.Bytes()...)
@@ -321,6 +321,21 @@ func (self *StateDB) GetStorageRoot(addr common.Address) (common.Hash, error) {
 	return so.storageRoot(self.db), nil
 }
 
+// DirtyAccounts returns the accounts changed since the state was last
+// committed, in no particular order.
+func (self *StateDB) DirtyAccounts() []common.Address {
+	addrs := make([]common.Address, 0, len(self.stateObjectsDirty)+len(self.journal.dirties))
+	for addr := range self.stateObjectsDirty {
+		addrs = append(addrs, addr)
+	}
+	for addr := range self.journal.dirties {
+		if _, ok := self.stateObjectsDirty[addr]; !ok {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
 /*
  * SETTERS
  */
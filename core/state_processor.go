@@ -17,6 +17,9 @@
 package core
 
 import (
+	"bytes"
+	"math/big"
+
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/consensus/misc"
@@ -72,6 +75,8 @@ func (p *StateProcessor) Process(block *types.Block, start, end uint64, statedb,
 	if p.config.DAOForkSupport && p.config.DAOForkBlock != nil && p.config.DAOForkBlock.Cmp(block.Number()) == 0 {
 		misc.ApplyDAOHardFork(statedb)
 	}
+	p.bc.ApplyCrossTxDecisions(statedb, header, start)
+	pinned := p.bc.PinnedState(statedb, header, start)
 	// Iterate over and process the individual transactions
 	for i, tx := range block.Transactions() {
 		txType = tx.TxType()
@@ -82,15 +87,21 @@ func (p *StateProcessor) Process(block *types.Block, start, end uint64, statedb,
 		psnap := privateState.Snapshot()
 
 		dc = nil
+		var prepared *types.CrossTx
 		if txType == types.CrossShardLocal {
 			found := false
 			for curr <= end {
 				for _, ctx := range p.bc.CrossTxs(curr).Txs {
-					if tx.Hash() == ctx.Tx.Hash() {
-						dc, _ = p.bc.Dc(curr)
-						found = true
-						break
+					if tx.Hash() != ctx.Tx.Hash() {
+						continue
+					}
+					// Optimistic transactions run on the data fetched for the validated attempt
+					if p.bc.OptimisticCrossShard(ctx.BlockNum.Uint64()) && (!ctx.Validated() || ctx.Decided > end) {
+						continue
 					}
+					dc, _ = p.bc.Dc(ctx.BlockNum.Uint64())
+					prepared, found = ctx, true
+					break
 				}
 				if found {
 					break
@@ -99,24 +110,26 @@ func (p *StateProcessor) Process(block *types.Block, start, end uint64, statedb,
 			}
 		}
 
+		// Atomic transactions are only prepared until the reference chain decides them
+		if prepared != nil && p.bc.AtomicCrossShard(prepared.BlockNum.Uint64()) {
+			receipts = append(receipts, PrepareCrossTransaction(p.config, p.bc, nil, gp, dc, statedb, header, tx, prepared, usedGas, cfg))
+			pinned = p.bc.PinnedState(statedb, header, start)
+			continue
+		}
 		receipt, privateReceipt, _, err := ApplyTransaction(p.config, p.bc, nil, gp, dc, statedb, privateState, header, tx, usedGas, cfg)
 		if txType == types.CrossShardLocal && err != nil {
 			statedb.RevertToSnapshot(snap)
 			privateState.RevertToSnapshot(psnap)
 			log.Debug("Error cross shard local transaction", "thash", tx.Hash(), "from", tx.From(), "error", err)
 
-			// Creating a dummy receipt
-			root := statedb.IntermediateRoot(false)
-			receipt = types.NewReceipt(root.Bytes(), true, *usedGas)
-			receipt.TxHash = tx.Hash()
-			receipt.GasUsed = tx.Gas()
-			// Set the receipt logs and create a bloom for filtering
-			receipt.Logs = statedb.GetLogs(tx.Hash())
-			receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+			receipt = FailedCrossShardReceipt(p.config, header, statedb, tx, *usedGas, err)
 		} else {
 			if err != nil {
 				return nil, nil, nil, 0, err
 			}
+			if err := pinned.Verify(statedb); err != nil {
+				return nil, nil, nil, 0, err
+			}
 		}
 
 		receipts = append(receipts, receipt)
@@ -130,6 +143,10 @@ func (p *StateProcessor) Process(block *types.Block, start, end uint64, statedb,
 		}
 	}
 
+	if err := p.bc.PrepareCrossTxs(statedb, header, start); err != nil {
+		return nil, nil, nil, 0, err
+	}
+
 	// Finalize the block, applying any consensus engine specific extras (e.g. block rewards)
 	p.engine.Finalize(p.bc, header, statedb, block.Transactions(), block.Uncles(), receipts)
 	return receipts, privateReceipts, allLogs, *usedGas, nil
@@ -164,7 +181,8 @@ func ApplyTransaction(config *params.ChainConfig, bc *BlockChain, author *common
 	vmenv := vm.NewEVM(context, dc, statedb, privateState, config, cfg)
 
 	// Apply the transaction to the current state (included in the env)
-	_, gas, failed, err := ApplyMessage(vmenv, msg, gp)
+	st := NewStateTransition(vmenv, msg, gp)
+	ret, gas, failed, err := st.TransitionDb()
 	if err != nil {
 		return nil, nil, 0, err
 	}
@@ -195,6 +213,9 @@ func ApplyTransaction(config *params.ChainConfig, bc *BlockChain, author *common
 	receipt := types.NewReceipt(root, publicFailed, *usedGas)
 	receipt.TxHash = tx.Hash()
 	receipt.GasUsed = gas
+	if failed && tx.TxType() == types.CrossShardLocal {
+		receipt.RevertReason = revertReason(ret, st.vmerr)
+	}
 	// if the transaction created a contract, store the creation address in the receipt.
 	if msg.To() == nil {
 		receipt.ContractAddress = crypto.CreateAddress(vmenv.Context.Origin, tx.Nonce())
@@ -224,3 +245,53 @@ func ApplyTransaction(config *params.ChainConfig, bc *BlockChain, author *common
 
 	return receipt, privateReceipt, gas, err
 }
+
+// FailedCrossShardReceipt creates the receipt of a CrossShardLocal transaction
+// that could not be applied, e.g. because its foreign data was incomplete. The
+// transaction changes no state and uses no gas, and the receipt records why.
+// Before the cross-shard receipt fork the receipt carries the intermediate
+// state root, as blocks of that era were sealed with.
+func FailedCrossShardReceipt(config *params.ChainConfig, header *types.Header, statedb *state.StateDB, tx *types.Transaction, usedGas uint64, err error) *types.Receipt {
+	if !config.IsCrossShardReceipt(header.Number) {
+		receipt := types.NewReceipt(statedb.IntermediateRoot(false).Bytes(), true, usedGas)
+		receipt.TxHash = tx.Hash()
+		receipt.GasUsed = tx.Gas()
+		receipt.RevertReason = err.Error()
+		receipt.Logs = statedb.GetLogs(tx.Hash())
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		return receipt
+	}
+	var root []byte
+	if !config.IsByzantium(header.Number) {
+		root = statedb.IntermediateRoot(config.IsEIP158(header.Number)).Bytes()
+	}
+	receipt := types.NewReceipt(root, true, usedGas)
+	receipt.TxHash = tx.Hash()
+	receipt.RevertReason = err.Error()
+	receipt.Logs = []*types.Log{}
+	receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+	return receipt
+}
+
+// revertSelector is the selector of the Error(string) data Solidity reverts with.
+var revertSelector = crypto.Keccak256([]byte("Error(string)"))[:4]
+
+// revertReason describes a failed execution, unpacking the message of a
+// Solidity revert or require if the returned data carries one.
+func revertReason(ret []byte, vmerr error) string {
+	if len(ret) >= 4+2*32 && bytes.Equal(ret[:4], revertSelector) {
+		data := ret[4:]
+		offset := new(big.Int).SetBytes(data[:32])
+		if offset.IsUint64() && offset.Uint64() <= uint64(len(data)-32) {
+			start := offset.Uint64() + 32
+			size := new(big.Int).SetBytes(data[start-32 : start])
+			if size.IsUint64() && size.Uint64() <= uint64(len(data))-start {
+				return string(data[start : start+size.Uint64()])
+			}
+		}
+	}
+	if vmerr != nil {
+		return vmerr.Error()
+	}
+	return "execution failed"
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestFailedCrossShardReceipt(t *testing.T) {
+	byzantium := *params.TestChainConfig
+	byzantium.CrossShardReceiptBlock = big.NewInt(2)
+	frontier := byzantium
+	frontier.ByzantiumBlock = nil
+
+	var (
+		tx    = types.NewCrossTransaction(types.CrossShardLocal, 0, 1, common.Address{0x0c}, common.Address{0x0f}, big.NewInt(0), 100000, big.NewInt(1), nil)
+		cause = errors.New("incomplete foreign data")
+	)
+	tests := []struct {
+		config   *params.ChainConfig
+		number   int64
+		wantRoot bool
+		wantGas  uint64
+		wantLogs int
+	}{
+		// Before the fork the receipt charges the gas limit and keeps the logs
+		{config: &byzantium, number: 1, wantRoot: true, wantGas: tx.Gas(), wantLogs: 1},
+		{config: &frontier, number: 1, wantRoot: true, wantGas: tx.Gas(), wantLogs: 1},
+		// From the fork on nothing is charged or logged, and the root is only
+		// carried by pre-byzantium receipts
+		{config: &byzantium, number: 2, wantRoot: false, wantGas: 0, wantLogs: 0},
+		{config: &frontier, number: 2, wantRoot: true, wantGas: 0, wantLogs: 0},
+	}
+	for i, test := range tests {
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(ethdb.NewMemDatabase()))
+		statedb.SetBalance(common.Address{0x0f}, big.NewInt(1))
+		statedb.Prepare(tx.Hash(), common.Hash{}, 0)
+		statedb.AddLog(&types.Log{Address: common.Address{0x0f}})
+		root := statedb.IntermediateRoot(false)
+
+		header := &types.Header{Number: big.NewInt(test.number)}
+		receipt := FailedCrossShardReceipt(test.config, header, statedb, tx, 21000, cause)
+
+		if receipt.Status != types.ReceiptStatusFailed {
+			t.Errorf("test %d: status mismatch: have %d, want %d", i, receipt.Status, types.ReceiptStatusFailed)
+		}
+		if receipt.TxHash != tx.Hash() || receipt.RevertReason != cause.Error() {
+			t.Errorf("test %d: receipt mismatch: hash %x, reason %q", i, receipt.TxHash, receipt.RevertReason)
+		}
+		if receipt.CumulativeGasUsed != 21000 || receipt.GasUsed != test.wantGas {
+			t.Errorf("test %d: gas mismatch: have %d/%d, want 21000/%d", i, receipt.GasUsed, receipt.CumulativeGasUsed, test.wantGas)
+		}
+		if test.wantRoot && !bytes.Equal(receipt.PostState, root.Bytes()) {
+			t.Errorf("test %d: post state mismatch: have %x, want %x", i, receipt.PostState, root)
+		}
+		if !test.wantRoot && receipt.PostState != nil {
+			t.Errorf("test %d: unexpected post state %x", i, receipt.PostState)
+		}
+		if len(receipt.Logs) != test.wantLogs {
+			t.Errorf("test %d: log count mismatch: have %d, want %d", i, len(receipt.Logs), test.wantLogs)
+		}
+		if receipt.Bloom != types.CreateBloom(types.Receipts{receipt}) {
+			t.Errorf("test %d: bloom mismatch", i)
+		}
+		// The failed transaction leaves the state untouched
+		if have := statedb.IntermediateRoot(false); have != root {
+			t.Errorf("test %d: state root changed: have %x, want %x", i, have, root)
+		}
+	}
+}
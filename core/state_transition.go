@@ -65,6 +65,7 @@ type StateTransition struct {
 	dc         *types.DataCache
 	bshard     uint64
 	evm        *vm.EVM
+	vmerr      error // Error the EVM failed the execution with, if any
 }
 
 // Message represents a message sent to a contract.
@@ -318,6 +319,7 @@ func (st *StateTransition) TransitionDb() (ret []byte, usedGas uint64, failed bo
 		// 		s2.IntermediateRoot(false))
 		// }
 	}
+	st.vmerr = vmerr
 	if vmerr != nil {
 		// The only possible consensus-error would be if there wasn't
 		// sufficient balance to make the transfer happen. The first
@@ -33,11 +33,20 @@ import (
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/params"
+	lru "github.com/hashicorp/golang-lru"
 )
 
 const (
 	// chainHeadChanSize is the size of channel listening to ChainHeadEvent.
 	chainHeadChanSize = 10
+
+	// forwardQueueSize is the number of transactions of other shards that may
+	// wait to be handed over to the peers of their shard.
+	forwardQueueSize = 1024
+
+	// forwardedCacheSize is the number of recently forwarded transaction hashes
+	// kept to drop resubmissions of the same transaction.
+	forwardedCacheSize = 4096
 )
 
 var (
@@ -85,6 +94,18 @@ var (
 	// ErrEtherValueUnsupported is returned if a transaction specifies an Ether Value
 	// for a private Quorum transaction.
 	ErrEtherValueUnsupported = errors.New("ether value is not supported for private transactions")
+
+	// ErrMalformedPayload is returned if the reference chain can not decode the
+	// payload of a cross-shard transaction or state commitment.
+	ErrMalformedPayload = errors.New("malformed cross-shard payload")
+
+	// ErrForwarded is returned if a transaction belongs to another shard and was
+	// handed to the peers of that shard instead of being pooled locally.
+	ErrForwarded = errors.New("transaction forwarded to its shard")
+
+	// ErrForwardQueueFull is returned if a transaction of another shard can not
+	// be forwarded because too many forwarded transactions are still pending.
+	ErrForwardQueueFull = errors.New("forward queue full")
 )
 
 var (
@@ -204,6 +225,10 @@ type TxPool struct {
 	chain        blockChain
 	gasPrice     *big.Int
 	txFeed       event.Feed
+	forwardFeed  event.Feed
+	forwardCh    chan *types.Transaction // Transactions of other shards waiting to be forwarded
+	forwarded    *lru.Cache              // Hashes of recently forwarded transactions
+	forwardQuit  chan struct{}
 	scope        event.SubscriptionScope
 	chainHeadCh  chan ChainHeadEvent
 	chainHeadSub event.Subscription
@@ -254,7 +279,10 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, refAddress
 		addrShardMap: make(map[common.Address]uint64),
 		myshard:      myshard,
 		leftovers:    make(map[common.Hash]*types.Transaction),
+		forwardCh:    make(chan *types.Transaction, forwardQueueSize),
+		forwardQuit:  make(chan struct{}),
 	}
+	pool.forwarded, _ = lru.New(forwardedCacheSize)
 
 	var addr common.Address
 	for shard, baddr := range shardAddMap {
@@ -285,12 +313,28 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, refAddress
 	pool.chainHeadSub = pool.chain.SubscribeChainHeadEvent(pool.chainHeadCh)
 
 	// Start the event loop and return
-	pool.wg.Add(1)
+	pool.wg.Add(2)
 	go pool.loop()
+	go pool.forwardLoop()
 
 	return pool
 }
 
+// forwardLoop hands the queued transactions of other shards over to the
+// subscribers of the forward feed, outside of the pool lock.
+func (pool *TxPool) forwardLoop() {
+	defer pool.wg.Done()
+
+	for {
+		select {
+		case tx := <-pool.forwardCh:
+			pool.forwardFeed.Send(ForwardTxsEvent{Shard: tx.HomeShard(), Txs: types.Transactions{tx}})
+		case <-pool.forwardQuit:
+			return
+		}
+	}
+}
+
 // loop is the transaction pool's main event loop, waiting for and reacting to
 // outside blockchain events as well as for various reporting and transaction
 // eviction events.
@@ -487,6 +531,7 @@ func (pool *TxPool) Stop() {
 
 	// Unsubscribe subscriptions registered from blockchain
 	pool.chainHeadSub.Unsubscribe()
+	close(pool.forwardQuit)
 	pool.wg.Wait()
 
 	if pool.journal != nil {
@@ -501,6 +546,12 @@ func (pool *TxPool) SubscribeNewTxsEvent(ch chan<- NewTxsEvent) event.Subscripti
 	return pool.scope.Track(pool.txFeed.Subscribe(ch))
 }
 
+// SubscribeForwardTxsEvent registers a subscription of ForwardTxsEvent and
+// starts sending event to the given channel.
+func (pool *TxPool) SubscribeForwardTxsEvent(ch chan<- ForwardTxsEvent) event.Subscription {
+	return pool.scope.Track(pool.forwardFeed.Subscribe(ch))
+}
+
 // GasPrice returns the current gas price enforced by the transaction pool.
 func (pool *TxPool) GasPrice() *big.Int {
 	pool.mu.RLock()
@@ -625,6 +676,39 @@ func (pool *TxPool) local() map[common.Address]types.Transactions {
 // validateTx checks whether a transaction is valid according to the consensus
 // rules and adheres to some heuristic limits of the local node (price and size).
 func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
+	from, err := pool.validateTxStateless(tx)
+	if err != nil {
+		return err
+	}
+	isQuorum := pool.chainconfig.IsQuorum
+
+	// Drop non-local transactions under our own minimal accepted gas price
+	local = local || pool.locals.contains(from) // account may be local even if the transaction arrived from the network
+	if !isQuorum && !local && pool.gasPrice.Cmp(tx.GasPrice()) > 0 {
+		return ErrUnderpriced
+	}
+	// Ensure the transaction adheres to nonce ordering
+	if pool.currentState.GetNonce(from) > tx.Nonce() && (tx.TxType() != types.CrossShard || tx.TxType() != types.IntraShard) {
+		return ErrNonceTooLow
+	}
+	// Transactor should have enough funds to cover the costs
+	// cost == V + GP * GL
+	if pool.currentState.GetBalance(from).Cmp(tx.Cost()) < 0 {
+		return ErrInsufficientFunds
+	}
+	// Check if the sender account is authorized to perform the transaction
+	if isQuorum {
+		if err := checkAccount(from, tx.To()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateTxStateless checks the rules of validateTx that do not depend on the
+// local state, so they also hold for transactions forwarded to other shards.
+// It returns the sender of the transaction.
+func (pool *TxPool) validateTxStateless(tx *types.Transaction) (common.Address, error) {
 	isQuorum := pool.chainconfig.IsQuorum
 	sizeLimit := pool.chainconfig.TransactionSizeLimit
 	if sizeLimit == 0 {
@@ -632,59 +716,59 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	}
 
 	if isQuorum && tx.GasPrice().Cmp(common.Big0) != 0 {
-		return ErrInvalidGasPrice
+		return common.Address{}, ErrInvalidGasPrice
 	}
 	// Reject transactions over 32KB (or manually set limit) to prevent DOS attacks
 	if float64(tx.Size()) > float64(sizeLimit*1024) {
-		return ErrOversizedData
+		return common.Address{}, ErrOversizedData
 	}
 	// Transactions can't be negative. This may never happen using RLP decoded
 	// transactions but may occur if you create a transaction using the RPC.
 	if tx.Value().Sign() < 0 {
-		return ErrNegativeValue
+		return common.Address{}, ErrNegativeValue
 	}
 	// Ensure the transaction doesn't exceed the current block limit gas.
 	if pool.currentMaxGas < tx.Gas() {
-		return ErrGasLimit
+		return common.Address{}, ErrGasLimit
 	}
 	// Make sure the transaction is signed properly
 	from, err := types.Sender(pool.signer, tx)
 	if err != nil {
-		return ErrInvalidSender
-	}
-	// Drop non-local transactions under our own minimal accepted gas price
-	local = local || pool.locals.contains(from) // account may be local even if the transaction arrived from the network
-	if !isQuorum && !local && pool.gasPrice.Cmp(tx.GasPrice()) > 0 {
-		return ErrUnderpriced
-	}
-	// Ensure the transaction adheres to nonce ordering
-	if pool.currentState.GetNonce(from) > tx.Nonce() && (tx.TxType() != types.CrossShard || tx.TxType() != types.IntraShard) {
-		return ErrNonceTooLow
+		return common.Address{}, ErrInvalidSender
 	}
 	// Ether value is not currently supported on private transactions
 	if tx.IsPrivate() && (len(tx.Data()) == 0 || tx.Value().Sign() != 0) {
-		return ErrEtherValueUnsupported
-	}
-	// Transactor should have enough funds to cover the costs
-	// cost == V + GP * GL
-	if pool.currentState.GetBalance(from).Cmp(tx.Cost()) < 0 {
-		return ErrInsufficientFunds
+		return common.Address{}, ErrEtherValueUnsupported
 	}
 	intrGas, err := IntrinsicGas(tx.Data(), tx.To() == nil, pool.homestead)
 	if err != nil {
-		return err
+		return common.Address{}, err
 	}
 	if tx.Gas() < intrGas {
-		return ErrIntrinsicGas
+		return common.Address{}, ErrIntrinsicGas
 	}
+	if err := validatePayload(tx); err != nil {
+		log.Debug("Rejecting malformed transaction", "hash", tx.Hash(), "txType", tx.TxType(), "err", err)
+		return common.Address{}, ErrMalformedPayload
+	}
+	return from, nil
+}
 
-	// Check if the sender account is authorized to perform the transaction
-	if isQuorum {
-		if err := checkAccount(from, tx.To()); err != nil {
+// validatePayload checks that cross-shard transactions and state commitments
+// can be decoded when included in a reference block.
+func validatePayload(tx *types.Transaction) error {
+	switch tx.TxType() {
+	case types.CrossShard:
+		payload, _, _, err := types.DecodeCrossTx(uint64(0), tx.Data())
+		if err != nil {
 			return err
 		}
+		_, err = types.ParseCrossTxData(payload)
+		return err
+	case types.StateCommit:
+		_, err := types.DecodeStateCommitHeader(tx)
+		return err
 	}
-
 	return nil
 }
 
@@ -703,6 +787,28 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 		log.Trace("Discarding already known transaction", "hash", hash)
 		return false, fmt.Errorf("known transaction: %x", hash)
 	}
+	// Transactions of other shards can not be validated against the local
+	// state, hand them over to the peers of their shard
+	if shard := tx.HomeShard(); shard != pool.myshard {
+		if pool.forwarded.Contains(hash) {
+			log.Trace("Discarding already forwarded transaction", "hash", hash)
+			return false, fmt.Errorf("known transaction: %x", hash)
+		}
+		if _, err := pool.validateTxStateless(tx); err != nil {
+			log.Trace("Discarding invalid transaction of another shard", "hash", hash, "shard", shard, "err", err)
+			invalidTxCounter.Inc(1)
+			return false, err
+		}
+		select {
+		case pool.forwardCh <- tx:
+		default:
+			log.Debug("Discarding transaction of another shard, forward queue full", "hash", hash, "shard", shard)
+			return false, ErrForwardQueueFull
+		}
+		pool.forwarded.Add(hash, struct{}{})
+		log.Trace("Forwarding transaction of another shard", "hash", hash, "shard", shard)
+		return false, ErrForwarded
+	}
 
 	from, _ := types.Sender(pool.signer, tx)
 	if tx.TxType() != types.StateCommit {
@@ -0,0 +1,201 @@
+// Copyright 2014 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	crossSelector = []byte{0x01, 0x02, 0x03, 0x04}
+	crossSender   = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	crossReceiver = common.HexToAddress("0x2000000000000000000000000000000000000002")
+	crossOther    = common.HexToAddress("0x3000000000000000000000000000000000000003")
+)
+
+func newCrossContracts() map[uint64][]*CKeys {
+	return map[uint64][]*CKeys{
+		1: {{Addr: crossReceiver, Keys: []common.Hash{common.HexToHash("0x01"), common.HexToHash("0x02")}, WKeys: []common.Hash{common.HexToHash("0x02")}}},
+		3: {{Addr: crossOther, Keys: []common.Hash{common.HexToHash("0x03")}}},
+	}
+}
+
+func TestCrossTxEncoding(t *testing.T) {
+	call := NewCrossTransaction(CrossShardLocal, 5, 0, crossReceiver, crossSender, big.NewInt(100), 90000, big.NewInt(2), []byte{0xaa, 0xbb})
+	data, err := EncodeCrossTx(crossSelector, []uint64{1, 3}, newCrossContracts(), call)
+	if err != nil {
+		t.Fatalf("failed to encode cross-shard transaction: %v", err)
+	}
+	if !bytes.Equal(data[:4], crossSelector) || (len(data)-4)%32 != 0 {
+		t.Fatalf("malformed call data: %x", data)
+	}
+	// Parse the call data the same way the reference chain and shards do
+	payload, shards, involved, err := DecodeCrossTx(3, data)
+	if err != nil {
+		t.Fatalf("failed to decode cross-shard transaction: %v", err)
+	}
+	if !involved || len(shards) != 2 || shards[0] != 1 || shards[1] != 3 {
+		t.Fatalf("shards mismatch: have %v, involved %v", shards, involved)
+	}
+	ctx, err := ParseCrossTxData(payload)
+	if err != nil {
+		t.Fatalf("failed to parse cross-shard transaction: %v", err)
+	}
+	if keys := ctx.AllContracts[1]; len(keys) != 1 || keys[0].Addr != crossReceiver || len(keys[0].Keys) != 2 || len(keys[0].WKeys) != 1 || keys[0].WKeys[0] != common.HexToHash("0x02") {
+		t.Errorf("shard 1 read-write set mismatch: %v", keys)
+	}
+	if keys := ctx.AllContracts[3]; len(keys) != 1 || keys[0].Addr != crossOther || len(keys[0].Keys) != 1 || len(keys[0].WKeys) != 0 {
+		t.Errorf("shard 3 read-write set mismatch: %v", keys)
+	}
+	tx := ctx.Tx
+	if tx.From() != crossSender || *tx.To() != crossReceiver || tx.Nonce() != 5 || tx.Value().Int64() != 100 || tx.Gas() != 90000 || tx.GasPrice().Int64() != 2 {
+		t.Errorf("inner call mismatch: %v", tx)
+	}
+	if !bytes.Equal(tx.Data(), []byte{0xaa, 0xbb}) {
+		t.Errorf("inner call data mismatch: %x", tx.Data())
+	}
+}
+
+func TestCrossTxEncodingRejects(t *testing.T) {
+	call := NewCrossTransaction(CrossShardLocal, 0, 0, crossReceiver, crossSender, nil, 90000, big.NewInt(1), nil)
+	tests := []struct {
+		name   string
+		shards []uint64
+		modify func(map[uint64][]*CKeys)
+		err    error
+	}{
+		{"no shards", nil, nil, ErrNoShards},
+		{"duplicate shard", []uint64{1, 3, 1}, nil, ErrDuplicateShard},
+		{"unlisted shard", []uint64{1}, nil, ErrUnlistedShard},
+		{"empty shard", []uint64{1, 2, 3}, nil, ErrEmptyShard},
+		{"duplicate contract", []uint64{1, 3}, func(c map[uint64][]*CKeys) {
+			c[3] = append(c[3], &CKeys{Addr: crossReceiver})
+		}, ErrDuplicateContract},
+		{"duplicate key", []uint64{1, 3}, func(c map[uint64][]*CKeys) {
+			c[3][0].Keys = append(c[3][0].Keys, common.HexToHash("0x03"))
+		}, ErrDuplicateKey},
+		{"unread write key", []uint64{1, 3}, func(c map[uint64][]*CKeys) {
+			c[3][0].WKeys = []common.Hash{common.HexToHash("0x04")}
+		}, ErrUnreadWriteKey},
+		{"oversized rw-set", []uint64{1, 3}, func(c map[uint64][]*CKeys) {
+			for i := 0; i < 2000; i++ {
+				c[3][0].Keys = append(c[3][0].Keys, common.BigToHash(big.NewInt(int64(i+100))))
+			}
+		}, ErrRWSetTooLarge},
+	}
+	for _, tt := range tests {
+		contracts := newCrossContracts()
+		if tt.modify != nil {
+			tt.modify(contracts)
+		}
+		if _, err := EncodeCrossTx(crossSelector, tt.shards, contracts, call); err != tt.err {
+			t.Errorf("%s: have %v, want %v", tt.name, err, tt.err)
+		}
+	}
+	if _, err := EncodeCrossTx(crossSelector[:3], []uint64{1, 3}, newCrossContracts(), call); err != ErrInvalidSelector {
+		t.Errorf("short selector: have %v, want %v", err, ErrInvalidSelector)
+	}
+	huge := NewCrossTransaction(CrossShardLocal, 0, 0, crossReceiver, crossSender, nil, 90000, new(big.Int).Lsh(big.NewInt(1), 64), nil)
+	if _, err := EncodeCrossTx(crossSelector, []uint64{1, 3}, newCrossContracts(), huge); err != ErrValueOverflow {
+		t.Errorf("huge gas price: have %v, want %v", err, ErrValueOverflow)
+	}
+}
+
+func TestCrossTxDecodingRejects(t *testing.T) {
+	call := NewCrossTransaction(CrossShardLocal, 5, 0, crossReceiver, crossSender, big.NewInt(100), 90000, big.NewInt(2), nil)
+	data, err := EncodeCrossTx(crossSelector, []uint64{1, 3}, newCrossContracts(), call)
+	if err != nil {
+		t.Fatalf("failed to encode cross-shard transaction: %v", err)
+	}
+	payload, _, _, err := DecodeCrossTx(0, data)
+	if err != nil {
+		t.Fatalf("failed to decode cross-shard transaction: %v", err)
+	}
+	// Every truncation of the call data or payload must fail cleanly
+	for i := 0; i < len(data)-len(payload); i++ {
+		if _, _, _, err := DecodeCrossTx(0, data[:i]); err == nil {
+			t.Fatalf("call data truncated to %d bytes accepted", i)
+		}
+	}
+	for i := 0; i < len(payload); i++ {
+		if _, err := ParseCrossTxData(payload[:i]); err == nil {
+			t.Fatalf("payload truncated to %d bytes accepted", i)
+		}
+	}
+	// Unknown versions and forged lengths are rejected
+	bad := common.CopyBytes(payload)
+	bad[0] = crossTxVersion + 1
+	if _, err := ParseCrossTxData(bad); err != ErrCrossTxVersion {
+		t.Errorf("unknown version: have %v, want %v", err, ErrCrossTxVersion)
+	}
+	bad = common.CopyBytes(data)
+	bad[4+3*32-1] = 0xff
+	if _, _, _, err := DecodeCrossTx(0, bad); err != ErrShortCrossTx {
+		t.Errorf("forged shard count: have %v, want %v", err, ErrShortCrossTx)
+	}
+	bad = common.CopyBytes(data)
+	bad[4+31] = 0x60
+	if _, _, _, err := DecodeCrossTx(0, bad); err != ErrCrossTxEncoding {
+		t.Errorf("forged offset: have %v, want %v", err, ErrCrossTxEncoding)
+	}
+	// The shards locked on the reference chain must be the ones run
+	bad = common.CopyBytes(data)
+	bad[4+4*32-1] = 2
+	if _, _, _, err := DecodeCrossTx(0, bad); err != ErrCrossTxShards {
+		t.Errorf("forged shards: have %v, want %v", err, ErrCrossTxShards)
+	}
+}
+
+func FuzzParseCrossTx(f *testing.F) {
+	call := NewCrossTransaction(CrossShardLocal, 5, 0, crossReceiver, crossSender, big.NewInt(100), 90000, big.NewInt(2), []byte{0xaa})
+	data, err := EncodeCrossTx(crossSelector, []uint64{1, 3}, newCrossContracts(), call)
+	if err != nil {
+		f.Fatalf("failed to encode cross-shard transaction: %v", err)
+	}
+	f.Add(data)
+	f.Add(data[:4+3*32])
+	f.Fuzz(func(t *testing.T, data []byte) {
+		payload, _, _, err := DecodeCrossTx(0, data)
+		if err != nil {
+			return
+		}
+		ParseCrossTxData(payload)
+	})
+}
+
+func TestTransactionHomeShard(t *testing.T) {
+	tests := []struct {
+		txType uint64
+		shard  uint64
+		want   uint64
+	}{
+		{IntraShard, 2, 2},
+		{ContractInit, 3, 3},
+		{CrossShard, 2, 0},
+		{StateCommit, 1, 0},
+	}
+	for i, tt := range tests {
+		tx := NewTransaction(tt.txType, 0, tt.shard, crossReceiver, big.NewInt(0), 21000, big.NewInt(0), nil)
+		if have := tx.HomeShard(); have != tt.want {
+			t.Errorf("test %d: home shard mismatch: have %d, want %d", i, have, tt.want)
+		}
+	}
+}
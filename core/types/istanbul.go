@@ -40,15 +40,25 @@ type IstanbulExtra struct {
 	Validators    []common.Address
 	Seal          []byte
 	CommittedSeal [][]byte
+
+	// Once BLS seals are enabled the committed seals are replaced by a bitmap
+	// of the committing validators and the aggregate of their seals.
+	Signers        []byte
+	AggregatedSeal []byte
 }
 
-// EncodeRLP serializes ist into the Ethereum RLP format.
+// EncodeRLP serializes ist into the Ethereum RLP format. The aggregate seal is
+// only appended when present, so extra-data without one keeps its encoding.
 func (ist *IstanbulExtra) EncodeRLP(w io.Writer) error {
-	return rlp.Encode(w, []interface{}{
+	fields := []interface{}{
 		ist.Validators,
 		ist.Seal,
 		ist.CommittedSeal,
-	})
+	}
+	if len(ist.Signers) > 0 || len(ist.AggregatedSeal) > 0 {
+		fields = append(fields, ist.Signers, ist.AggregatedSeal)
+	}
+	return rlp.Encode(w, fields)
 }
 
 // DecodeRLP implements rlp.Decoder, and load the istanbul fields from a RLP stream.
@@ -57,11 +67,19 @@ func (ist *IstanbulExtra) DecodeRLP(s *rlp.Stream) error {
 		Validators    []common.Address
 		Seal          []byte
 		CommittedSeal [][]byte
+		Aggregate     [][]byte `rlp:"tail"`
 	}
 	if err := s.Decode(&istanbulExtra); err != nil {
 		return err
 	}
 	ist.Validators, ist.Seal, ist.CommittedSeal = istanbulExtra.Validators, istanbulExtra.Seal, istanbulExtra.CommittedSeal
+	switch len(istanbulExtra.Aggregate) {
+	case 0:
+	case 2:
+		ist.Signers, ist.AggregatedSeal = istanbulExtra.Aggregate[0], istanbulExtra.Aggregate[1]
+	default:
+		return ErrInvalidIstanbulHeaderExtra
+	}
 	return nil
 }
 
@@ -95,6 +113,7 @@ func IstanbulFilteredHeader(h *Header, keepSeal bool) *Header {
 		istanbulExtra.Seal = []byte{}
 	}
 	istanbulExtra.CommittedSeal = [][]byte{}
+	istanbulExtra.Signers, istanbulExtra.AggregatedSeal = nil, nil
 
 	payload, err := rlp.EncodeToBytes(&istanbulExtra)
 	if err != nil {
@@ -23,6 +23,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rlp"
 )
 
 func TestHeaderHash(t *testing.T) {
@@ -86,3 +87,35 @@ func TestExtractToIstanbul(t *testing.T) {
 		}
 	}
 }
+
+func TestIstanbulExtraAggregate(t *testing.T) {
+	extra := &IstanbulExtra{
+		Validators:    []common.Address{common.HexToAddress("0x44add0ec310f115a0e603b2d7db9f067778eaf8a")},
+		Seal:          []byte{},
+		CommittedSeal: [][]byte{},
+	}
+	header := &Header{MixDigest: IstanbulDigest, Extra: istanbulExtraData(t, extra)}
+	hash := header.Hash()
+
+	extra.Signers, extra.AggregatedSeal = []byte{0x0b}, bytes.Repeat([]byte{0x01}, 96)
+	header.Extra = istanbulExtraData(t, extra)
+	decoded, err := ExtractIstanbulExtra(header)
+	if err != nil {
+		t.Fatalf("failed to extract aggregate seal: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, extra) {
+		t.Errorf("extra mismatch: have %v, want %v", decoded, extra)
+	}
+	// The aggregate seal is not part of the hash it signs
+	if header.Hash() != hash {
+		t.Errorf("aggregate seal changed the header hash")
+	}
+}
+
+func istanbulExtraData(t *testing.T, extra *IstanbulExtra) []byte {
+	payload, err := rlp.EncodeToBytes(extra)
+	if err != nil {
+		t.Fatalf("failed to encode extra: %v", err)
+	}
+	return append(make([]byte, IstanbulExtraVanity), payload...)
+}
@@ -0,0 +1,136 @@
+// Copyright 2014 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+var (
+	ErrNoCommitment       = errors.New("no commitment known for shard")
+	ErrMissingForeignData = errors.New("missing foreign data for contract")
+	ErrUnexpectedData     = errors.New("unexpected foreign data for contract")
+	ErrKeyCountMismatch   = errors.New("number of values does not match number of keys")
+	ErrProofCountMismatch = errors.New("number of storage proofs does not match number of keys")
+	ErrAccountMismatch    = errors.New("account does not match its proof")
+	ErrStorageMismatch    = errors.New("storage value does not match its proof")
+)
+
+// proofAccount is the consensus representation of an account as stored in the
+// state trie. It mirrors state.Account, which can not be imported from here.
+type proofAccount struct {
+	Nonce    uint64
+	Balance  *big.Int
+	Root     common.Hash
+	CodeHash []byte
+}
+
+// proofDatabase loads a list of trie nodes into a database keyed by node hash,
+// as expected by trie.VerifyProof.
+func proofDatabase(proof [][]byte) *ethdb.MemDatabase {
+	db := ethdb.NewMemDatabase()
+	for _, node := range proof {
+		db.Put(crypto.Keccak256(node), node)
+	}
+	return db
+}
+
+// VerifyKeyVal checks the values carried by kv against the state root of a
+// shard. The account fields are checked against kv.Proof and every value in
+// kv.Data against the storage proof of the corresponding entry in keys.
+func VerifyKeyVal(root common.Hash, keys []common.Hash, kv *KeyVal) error {
+	_, err := verifyKeyVal(root, keys, kv)
+	return err
+}
+
+// VerifyStateData checks the answer to a state data request for keys against
+// the state root of a shard, and returns whether each account exists in it.
+func VerifyStateData(root common.Hash, keys []*CKeys, vals []*KeyVal) ([]bool, error) {
+	if len(vals) != len(keys) {
+		return nil, ErrMissingForeignData
+	}
+	exists := make([]bool, len(keys))
+	for i, ck := range keys {
+		if vals[i] == nil || vals[i].Addr != ck.Addr {
+			return nil, ErrUnexpectedData
+		}
+		var err error
+		if exists[i], err = verifyKeyVal(root, ck.Keys, vals[i]); err != nil {
+			return nil, err
+		}
+	}
+	return exists, nil
+}
+
+// verifyKeyVal implements VerifyKeyVal, also returning whether the account
+// exists in the state trie.
+func verifyKeyVal(root common.Hash, keys []common.Hash, kv *KeyVal) (bool, error) {
+	if len(kv.Data) != len(keys) {
+		return false, ErrKeyCountMismatch
+	}
+	enc, _, err := trie.VerifyProof(root, crypto.Keccak256(kv.Addr.Bytes()), proofDatabase(kv.Proof))
+	if err != nil {
+		return false, fmt.Errorf("invalid account proof for %x: %v", kv.Addr, err)
+	}
+	account := proofAccount{Balance: new(big.Int), Root: EmptyRootHash}
+	if enc != nil {
+		if err := rlp.DecodeBytes(enc, &account); err != nil {
+			return false, fmt.Errorf("invalid account encoding for %x: %v", kv.Addr, err)
+		}
+	}
+	if account.Nonce != kv.Nonce || account.Balance.Uint64() != kv.Balance {
+		return false, ErrAccountMismatch
+	}
+	// Accounts without storage can only hold empty values
+	if account.Root == EmptyRootHash {
+		for _, val := range kv.Data {
+			if val != (common.Hash{}) {
+				return false, ErrStorageMismatch
+			}
+		}
+		return enc != nil, nil
+	}
+	if len(kv.StorageProof) != len(keys) {
+		return false, ErrProofCountMismatch
+	}
+	for i, key := range keys {
+		enc, _, err := trie.VerifyProof(account.Root, crypto.Keccak256(key.Bytes()), proofDatabase(kv.StorageProof[i]))
+		if err != nil {
+			return false, fmt.Errorf("invalid storage proof for %x/%x: %v", kv.Addr, key, err)
+		}
+		var val common.Hash
+		if enc != nil {
+			_, content, _, err := rlp.Split(enc)
+			if err != nil {
+				return false, fmt.Errorf("invalid storage encoding for %x/%x: %v", kv.Addr, key, err)
+			}
+			val.SetBytes(content)
+		}
+		if val != kv.Data[i] {
+			return false, ErrStorageMismatch
+		}
+	}
+	return true, nil
+}
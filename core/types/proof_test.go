@@ -0,0 +1,217 @@
+// Copyright 2014 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+var (
+	proofAddr  = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	emptyAddr  = common.HexToAddress("0x2000000000000000000000000000000000000002")
+	proofKeys  = []common.Hash{common.HexToHash("0x01"), common.HexToHash("0x02"), common.HexToHash("0x03")}
+	proofValue = common.HexToHash("0xdeadbeef")
+)
+
+// newProofState creates a committed state holding a single contract with two
+// non-empty storage slots and returns it along with its root.
+func newProofState(t *testing.T) (*state.StateDB, common.Hash) {
+	db := state.NewDatabase(ethdb.NewMemDatabase())
+	statedb, _ := state.New(common.Hash{}, db)
+	statedb.SetNonce(proofAddr, 7)
+	statedb.SetBalance(proofAddr, big.NewInt(1000))
+	statedb.SetState(proofAddr, proofKeys[0], proofValue)
+	statedb.SetState(proofAddr, proofKeys[1], common.HexToHash("0x01"))
+	root, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if err := db.TrieDB().Commit(root, false); err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	statedb, _ = state.New(root, db)
+	return statedb, root
+}
+
+// proveKeyVal assembles a KeyVal the same way BlockChain.StateData does.
+func proveKeyVal(t *testing.T, statedb *state.StateDB, addr common.Address, keys []common.Hash) *types.KeyVal {
+	kv := &types.KeyVal{Addr: addr, Nonce: statedb.GetNonce(addr), Balance: statedb.GetBalance(addr).Uint64()}
+	proof, err := statedb.GetProof(addr)
+	if err != nil {
+		t.Fatalf("failed to prove account: %v", err)
+	}
+	kv.Proof = proof
+	for _, key := range keys {
+		kv.Data = append(kv.Data, statedb.GetState(addr, key))
+		if statedb.Exist(addr) {
+			sproof, err := statedb.GetStorageProof(addr, key)
+			if err != nil {
+				t.Fatalf("failed to prove storage: %v", err)
+			}
+			kv.StorageProof = append(kv.StorageProof, sproof)
+		}
+	}
+	return kv
+}
+
+func TestVerifyKeyVal(t *testing.T) {
+	statedb, root := newProofState(t)
+
+	if err := types.VerifyKeyVal(root, proofKeys, proveKeyVal(t, statedb, proofAddr, proofKeys)); err != nil {
+		t.Fatalf("valid proof rejected: %v", err)
+	}
+	if err := types.VerifyKeyVal(root, proofKeys, proveKeyVal(t, statedb, emptyAddr, proofKeys)); err != nil {
+		t.Fatalf("valid proof of missing account rejected: %v", err)
+	}
+
+	kv := proveKeyVal(t, statedb, proofAddr, proofKeys)
+	kv.Data[0] = common.HexToHash("0xbad")
+	if err := types.VerifyKeyVal(root, proofKeys, kv); err != types.ErrStorageMismatch {
+		t.Errorf("tampered value: have %v, want %v", err, types.ErrStorageMismatch)
+	}
+	kv = proveKeyVal(t, statedb, proofAddr, proofKeys)
+	kv.Data[2] = proofValue
+	if err := types.VerifyKeyVal(root, proofKeys, kv); err != types.ErrStorageMismatch {
+		t.Errorf("tampered empty value: have %v, want %v", err, types.ErrStorageMismatch)
+	}
+	kv = proveKeyVal(t, statedb, proofAddr, proofKeys)
+	kv.Balance++
+	if err := types.VerifyKeyVal(root, proofKeys, kv); err != types.ErrAccountMismatch {
+		t.Errorf("tampered balance: have %v, want %v", err, types.ErrAccountMismatch)
+	}
+	kv = proveKeyVal(t, statedb, emptyAddr, proofKeys)
+	kv.Data[1] = proofValue
+	if err := types.VerifyKeyVal(root, proofKeys, kv); err != types.ErrStorageMismatch {
+		t.Errorf("value for missing account: have %v, want %v", err, types.ErrStorageMismatch)
+	}
+	kv = proveKeyVal(t, statedb, proofAddr, proofKeys[:2])
+	if err := types.VerifyKeyVal(root, proofKeys, kv); err != types.ErrKeyCountMismatch {
+		t.Errorf("short response: have %v, want %v", err, types.ErrKeyCountMismatch)
+	}
+	if err := types.VerifyKeyVal(common.HexToHash("0xbad"), proofKeys, proveKeyVal(t, statedb, proofAddr, proofKeys)); err == nil {
+		t.Errorf("proof against wrong root accepted")
+	}
+}
+
+func TestVerifyStateData(t *testing.T) {
+	statedb, root := newProofState(t)
+	keys := []*types.CKeys{{Addr: proofAddr, Keys: proofKeys}, {Addr: emptyAddr}}
+	vals := []*types.KeyVal{proveKeyVal(t, statedb, proofAddr, proofKeys), proveKeyVal(t, statedb, emptyAddr, nil)}
+
+	exists, err := types.VerifyStateData(root, keys, vals)
+	if err != nil {
+		t.Fatalf("valid answer rejected: %v", err)
+	}
+	if !exists[0] || exists[1] {
+		t.Errorf("account existence mismatch: have %v, want [true false]", exists)
+	}
+	if _, err := types.VerifyStateData(root, keys, vals[:1]); err != types.ErrMissingForeignData {
+		t.Errorf("short answer: have %v, want %v", err, types.ErrMissingForeignData)
+	}
+	if _, err := types.VerifyStateData(root, keys, []*types.KeyVal{vals[1], vals[0]}); err != types.ErrUnexpectedData {
+		t.Errorf("reordered answer: have %v, want %v", err, types.ErrUnexpectedData)
+	}
+	vals[0].Data[0] = common.HexToHash("0xbad")
+	if _, err := types.VerifyStateData(root, keys, vals); err != types.ErrStorageMismatch {
+		t.Errorf("tampered value: have %v, want %v", err, types.ErrStorageMismatch)
+	}
+}
+
+func TestReadVersionsVerify(t *testing.T) {
+	statedb, root := newProofState(t)
+
+	rv := &types.ReadVersions{Txs: proofKeys, Proof: proveKeyVal(t, statedb, proofAddr, proofKeys)}
+	versions, err := rv.Verify(root, proofAddr)
+	if err != nil {
+		t.Fatalf("valid read versions rejected: %v", err)
+	}
+	// Registry slots hold the version plus one, empty slots are unprepared
+	if len(versions) != 2 || versions[proofKeys[0]] != 0xdeadbeef-1 || versions[proofKeys[1]] != 0 {
+		t.Fatalf("versions mismatch: %v", versions)
+	}
+	if _, err := rv.Verify(root, emptyAddr); err != types.ErrVersionRegistry {
+		t.Errorf("foreign registry: have %v, want %v", err, types.ErrVersionRegistry)
+	}
+	rv.Proof.Data[1] = proofValue
+	if _, err := rv.Verify(root, proofAddr); err != types.ErrStorageMismatch {
+		t.Errorf("tampered version: have %v, want %v", err, types.ErrStorageMismatch)
+	}
+}
+
+func TestCrossTxVotesVerify(t *testing.T) {
+	statedb, root := newProofState(t)
+
+	cv := &types.CrossTxVotes{Txs: proofKeys, Proof: proveKeyVal(t, statedb, proofAddr, proofKeys)}
+	votes, err := cv.Verify(root, proofAddr)
+	if err != nil {
+		t.Fatalf("valid votes rejected: %v", err)
+	}
+	// Slots holding anything but a vote are left out
+	if len(votes) != 1 || !votes[proofKeys[1]] {
+		t.Fatalf("votes mismatch: %v", votes)
+	}
+	if _, err := cv.Verify(root, emptyAddr); err != types.ErrVoteRegistry {
+		t.Errorf("foreign registry: have %v, want %v", err, types.ErrVoteRegistry)
+	}
+	cv.Proof.Data[1] = common.BigToHash(new(big.Int).SetUint64(types.VoteAbort))
+	if _, err := cv.Verify(root, proofAddr); err != types.ErrStorageMismatch {
+		t.Errorf("tampered vote: have %v, want %v", err, types.ErrStorageMismatch)
+	}
+}
+
+func TestDataCacheAddData(t *testing.T) {
+	statedb, root := newProofState(t)
+
+	newCache := func(root common.Hash) *types.DataCache {
+		dc := types.NewDataCache(1, false)
+		dc.Required = 1
+		dc.ShardStatus[2] = false
+		dc.Commits[2] = &types.Commitment{Shard: 2, RefNum: 1, StateRoot: root}
+		dc.AddrToShard[proofAddr] = 2
+		dc.Keyval[proofAddr] = &types.CKeys{Addr: proofAddr, Keys: proofKeys}
+		return dc
+	}
+	// Values proven against a different root must not be cached
+	dc := newCache(common.HexToHash("0xbad"))
+	if err := dc.AddData(2, []*types.KeyVal{proveKeyVal(t, statedb, proofAddr, proofKeys)}); err == nil {
+		t.Fatalf("data for wrong root accepted")
+	}
+	if dc.Status || dc.ShardStatus[2] || len(dc.Values) != 0 {
+		t.Fatalf("cache modified by rejected data")
+	}
+	// Responses for unrequested contracts must not be cached
+	dc = newCache(root)
+	if err := dc.AddData(2, []*types.KeyVal{proveKeyVal(t, statedb, emptyAddr, proofKeys)}); err != types.ErrUnexpectedData {
+		t.Fatalf("unrequested contract: have %v, want %v", err, types.ErrUnexpectedData)
+	}
+	// Valid data completes the cache
+	if err := dc.AddData(2, []*types.KeyVal{proveKeyVal(t, statedb, proofAddr, proofKeys)}); err != nil {
+		t.Fatalf("valid data rejected: %v", err)
+	}
+	if !dc.Status || !dc.ShardStatus[2] {
+		t.Fatalf("cache not completed by valid data")
+	}
+	if val := dc.Values[proofAddr].Data[proofKeys[0]]; val != proofValue {
+		t.Errorf("cached value mismatch: have %x, want %x", val, proofValue)
+	}
+}
@@ -55,6 +55,7 @@ type Receipt struct {
 	TxHash          common.Hash    `json:"transactionHash" gencodec:"required"`
 	ContractAddress common.Address `json:"contractAddress"`
 	GasUsed         uint64         `json:"gasUsed" gencodec:"required"`
+	RevertReason    string         `json:"revertReason,omitempty"` // Why a failed cross-shard execution failed
 }
 
 type receiptMarshaling struct {
@@ -80,6 +81,7 @@ type receiptStorageRLP struct {
 	ContractAddress   common.Address
 	Logs              []*LogForStorage
 	GasUsed           uint64
+	RevertReason      [][]byte `rlp:"tail"` // Empty unless a failure reason is recorded, keeping older receipts decodable
 }
 
 // NewReceipt creates a barebone transaction receipt, copying the init fields.
@@ -168,6 +170,9 @@ func (r *ReceiptForStorage) EncodeRLP(w io.Writer) error {
 	for i, log := range r.Logs {
 		enc.Logs[i] = (*LogForStorage)(log)
 	}
+	if r.RevertReason != "" {
+		enc.RevertReason = [][]byte{[]byte(r.RevertReason)}
+	}
 	return rlp.Encode(w, enc)
 }
 
@@ -189,6 +194,9 @@ func (r *ReceiptForStorage) DecodeRLP(s *rlp.Stream) error {
 	}
 	// Assign the implementation fields
 	r.TxHash, r.ContractAddress, r.GasUsed = dec.TxHash, dec.ContractAddress, dec.GasUsed
+	if len(dec.RevertReason) > 0 {
+		r.RevertReason = string(dec.RevertReason[0])
+	}
 	return nil
 }
 
@@ -0,0 +1,150 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+var (
+	ErrRefProofOrder       = errors.New("reference proofs not in transaction order")
+	ErrRefReceiptsMismatch = errors.New("number of receipts does not match number of transactions")
+)
+
+// RefTx is a cross-shard relevant transaction of a reference block along with
+// its receipt and position in the block.
+type RefTx struct {
+	Index   uint64
+	Tx      *Transaction
+	Receipt *Receipt
+}
+
+// IsRefTx returns whether tx carries data shards follow on the reference chain.
+func IsRefTx(tx *Transaction) bool {
+	txType := tx.TxType()
+	return txType == CrossShard || txType == StateCommit
+}
+
+// RefTxs picks the cross-shard relevant transactions of a reference block.
+func RefTxs(txs Transactions, receipts Receipts) []*RefTx {
+	refTxs := []*RefTx{}
+	for i, tx := range txs {
+		if IsRefTx(tx) && i < len(receipts) {
+			refTxs = append(refTxs, &RefTx{Index: uint64(i), Tx: tx, Receipt: receipts[i]})
+		}
+	}
+	return refTxs
+}
+
+// trieProof collects the trie nodes of a merkle proof in path order.
+type trieProof [][]byte
+
+func (p *trieProof) Put(key []byte, value []byte) error {
+	*p = append(*p, value)
+	return nil
+}
+
+// RefTxProof proves a cross-shard relevant transaction of a reference block
+// and its receipt against the transaction and receipt roots of the header.
+type RefTxProof struct {
+	Index        uint64
+	Tx           *Transaction
+	TxProof      [][]byte
+	ReceiptProof [][]byte
+}
+
+// ProveRefReceipts returns the proofs of the cross-shard relevant transactions
+// of a reference block and of their receipts, in the order of the transactions.
+func ProveRefReceipts(txs Transactions, receipts Receipts) ([]*RefTxProof, error) {
+	if len(txs) != len(receipts) {
+		return nil, ErrRefReceiptsMismatch
+	}
+	txTrie, receiptTrie := new(trie.Trie), new(trie.Trie)
+	for i := range txs {
+		key, _ := rlp.EncodeToBytes(uint(i))
+		tx, err := rlp.EncodeToBytes(txs[i])
+		if err != nil {
+			return nil, err
+		}
+		receipt, err := rlp.EncodeToBytes(receipts[i])
+		if err != nil {
+			return nil, err
+		}
+		txTrie.Update(key, tx)
+		receiptTrie.Update(key, receipt)
+	}
+	proofs := []*RefTxProof{}
+	for i, tx := range txs {
+		if !IsRefTx(tx) {
+			continue
+		}
+		key, _ := rlp.EncodeToBytes(uint(i))
+		var txProof, receiptProof trieProof
+		if err := txTrie.Prove(key, 0, &txProof); err != nil {
+			return nil, err
+		}
+		if err := receiptTrie.Prove(key, 0, &receiptProof); err != nil {
+			return nil, err
+		}
+		proofs = append(proofs, &RefTxProof{Index: uint64(i), Tx: tx, TxProof: txProof, ReceiptProof: receiptProof})
+	}
+	return proofs, nil
+}
+
+// VerifyRefReceipts checks the proofs of the cross-shard relevant transactions
+// of a reference block and of their receipts against header. The proofs bind
+// every transaction to its index, but cannot show that the peer serving them
+// left none out.
+func VerifyRefReceipts(header *Header, proofs []*RefTxProof) ([]*RefTx, error) {
+	refTxs := make([]*RefTx, 0, len(proofs))
+	for i, proof := range proofs {
+		if proof.Tx == nil || (i > 0 && proof.Index <= proofs[i-1].Index) {
+			return nil, ErrRefProofOrder
+		}
+		hash := proof.Tx.Hash()
+		if !IsRefTx(proof.Tx) {
+			return nil, fmt.Errorf("transaction %x is not cross-shard relevant", hash)
+		}
+		key, _ := rlp.EncodeToBytes(uint(proof.Index))
+		enc, _, err := trie.VerifyProof(header.TxHash, key, proofDatabase(proof.TxProof))
+		if err != nil {
+			return nil, fmt.Errorf("invalid transaction proof for %x: %v", hash, err)
+		}
+		if want, _ := rlp.EncodeToBytes(proof.Tx); !bytes.Equal(enc, want) {
+			return nil, fmt.Errorf("transaction %x not at index %d", hash, proof.Index)
+		}
+		enc, _, err = trie.VerifyProof(header.ReceiptHash, key, proofDatabase(proof.ReceiptProof))
+		if err != nil {
+			return nil, fmt.Errorf("invalid receipt proof for %x: %v", hash, err)
+		}
+		if enc == nil {
+			return nil, fmt.Errorf("missing receipt for %x", hash)
+		}
+		receipt := new(Receipt)
+		if err := rlp.DecodeBytes(enc, receipt); err != nil {
+			return nil, fmt.Errorf("invalid receipt encoding for %x: %v", hash, err)
+		}
+		receipt.TxHash = hash
+		refTxs = append(refTxs, &RefTx{Index: proof.Index, Tx: proof.Tx, Receipt: receipt})
+	}
+	return refTxs, nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestRefReceiptProofs(t *testing.T) {
+	txs := Transactions{
+		NewTransaction(IntraShard, 0, 0, crossReceiver, big.NewInt(1), 21000, big.NewInt(1), nil),
+		NewTransaction(CrossShard, 1, 0, crossReceiver, big.NewInt(0), 90000, big.NewInt(1), []byte{0x01}),
+		NewTransaction(IntraShard, 2, 0, crossReceiver, big.NewInt(1), 21000, big.NewInt(1), nil),
+		NewTransaction(StateCommit, 3, 0, crossReceiver, big.NewInt(0), 90000, big.NewInt(1), []byte{0x02}),
+	}
+	receipts := make(Receipts, len(txs))
+	for i := range receipts {
+		receipts[i] = NewReceipt(nil, i == 2, uint64(21000*(i+1)))
+		receipts[i].Logs = []*Log{{Address: crossReceiver, Data: []byte{byte(i)}}}
+	}
+	header := &Header{TxHash: DeriveSha(txs), ReceiptHash: DeriveSha(receipts)}
+
+	proofs, err := ProveRefReceipts(txs, receipts)
+	if err != nil {
+		t.Fatalf("failed to prove receipts: %v", err)
+	}
+	if len(proofs) != 2 {
+		t.Fatalf("proof count mismatch: have %d, want 2", len(proofs))
+	}
+	refTxs, err := VerifyRefReceipts(header, proofs)
+	if err != nil {
+		t.Fatalf("failed to verify receipts: %v", err)
+	}
+	if len(refTxs) != 2 || refTxs[0].Index != 1 || refTxs[1].Index != 3 {
+		t.Fatalf("picked transactions mismatch: %v", refTxs)
+	}
+	for _, refTx := range refTxs {
+		want := receipts[refTx.Index]
+		if refTx.Tx.Hash() != txs[refTx.Index].Hash() || refTx.Receipt.TxHash != refTx.Tx.Hash() {
+			t.Errorf("tx %d: transaction mismatch", refTx.Index)
+		}
+		if refTx.Receipt.Status != want.Status || refTx.Receipt.CumulativeGasUsed != want.CumulativeGasUsed || !bytes.Equal(refTx.Receipt.Logs[0].Data, want.Logs[0].Data) {
+			t.Errorf("tx %d: receipt mismatch: have %v, want %v", refTx.Index, refTx.Receipt, want)
+		}
+	}
+	// Proofs are bound to the transaction and receipt roots
+	forged := &Header{TxHash: header.TxHash, ReceiptHash: common.HexToHash("0x01")}
+	if _, err := VerifyRefReceipts(forged, proofs); err == nil {
+		t.Error("receipt proof verified against a foreign receipt root")
+	}
+	forged = &Header{TxHash: common.HexToHash("0x01"), ReceiptHash: header.ReceiptHash}
+	if _, err := VerifyRefReceipts(forged, proofs); err == nil {
+		t.Error("transaction proof verified against a foreign transaction root")
+	}
+	// Moving a transaction to another index is detected
+	moved := *proofs[0]
+	moved.Index = 3
+	if _, err := VerifyRefReceipts(header, []*RefTxProof{&moved}); err == nil {
+		t.Error("transaction verified at a foreign index")
+	}
+	// Swapping the proofs of two transactions is detected
+	if _, err := VerifyRefReceipts(header, []*RefTxProof{proofs[1], proofs[0]}); err != ErrRefProofOrder {
+		t.Errorf("swapped proofs: have %v, want %v", err, ErrRefProofOrder)
+	}
+	// Transactions shards do not follow are not accepted
+	plain, _ := ProveRefReceipts(Transactions{txs[0]}, Receipts{receipts[0]})
+	if len(plain) != 0 {
+		t.Errorf("intra-shard transaction proven")
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+var (
+	ErrCommitTxNotFound = errors.New("state commitment not found in reference block")
+	ErrCommitTxMismatch = errors.New("state commitment does not match its proof")
+)
+
+// ShardCheckpoint records on the reference chain that a shard block is final:
+// the committed seals its committee put on it, as attested by the state
+// commitment reporting the block.
+type ShardCheckpoint struct {
+	Shard         uint64          `json:"shard"`
+	Number        uint64          `json:"number"`        // Number of the shard block
+	Hash          common.Hash     `json:"hash"`          // Hash of the shard block, excluding the committed seals
+	Root          common.Hash     `json:"root"`          // State root of the shard block
+	RefNumber     uint64          `json:"refNumber"`     // Reference block processed by the shard block
+	CommittedSeal []hexutil.Bytes `json:"committedSeal"` // Seals of the shard validators that committed the block
+	Checkpointed  uint64          `json:"checkpointed"`  // Reference block that included the state commitment
+	CommitTx      common.Hash     `json:"commitTx"`      // Hash of the state commitment
+
+	Signers        hexutil.Bytes `json:"signers,omitempty"`        // Bitmap of the validators in the aggregate seal
+	AggregatedSeal hexutil.Bytes `json:"aggregatedSeal,omitempty"` // BLS aggregate replacing the committed seals
+}
+
+// NewShardCheckpoint creates the checkpoint of the shard block header,
+// attested by the state commitment tx of reference block number.
+func NewShardCheckpoint(header *Header, tx *Transaction, number uint64) (*ShardCheckpoint, error) {
+	extra, err := ExtractIstanbulExtra(header)
+	if err != nil {
+		return nil, err
+	}
+	checkpoint := &ShardCheckpoint{
+		Shard:         header.Shard,
+		Number:        header.Number.Uint64(),
+		Hash:          header.Hash(),
+		Root:          header.Root,
+		CommittedSeal: make([]hexutil.Bytes, len(extra.CommittedSeal)),
+		Checkpointed:  number,
+		CommitTx:      tx.Hash(),
+
+		Signers:        extra.Signers,
+		AggregatedSeal: extra.AggregatedSeal,
+	}
+	if header.RefNumber != nil {
+		checkpoint.RefNumber = header.RefNumber.Uint64()
+	}
+	for i, seal := range extra.CommittedSeal {
+		checkpoint.CommittedSeal[i] = seal
+	}
+	return checkpoint, nil
+}
+
+// Extra returns the committed seals of the checkpointed block, individual or
+// aggregated, as found in its Istanbul extra-data.
+func (c *ShardCheckpoint) Extra() *IstanbulExtra {
+	extra := &IstanbulExtra{
+		CommittedSeal:  make([][]byte, len(c.CommittedSeal)),
+		Signers:        c.Signers,
+		AggregatedSeal: c.AggregatedSeal,
+	}
+	for i, seal := range c.CommittedSeal {
+		extra.CommittedSeal[i] = seal
+	}
+	return extra
+}
+
+// ShardBlockProof proves that a shard block was checkpointed to anyone holding
+// the reference chain headers: the state commitment carrying the sealed shard
+// header, with its transaction trie proof against the reference block that
+// included it.
+type ShardBlockProof struct {
+	RefHeader *Header         `json:"refHeader"` // Reference block including the state commitment
+	Index     uint64          `json:"index"`     // Position of the state commitment in the block
+	CommitTx  *Transaction    `json:"commitTx"`  // State commitment carrying the shard header
+	Proof     []hexutil.Bytes `json:"proof"`     // Transaction trie nodes in path order
+}
+
+// ProveStateCommit builds the proof of the state commitment with the given
+// hash, included in the reference block of header with transactions txs.
+func ProveStateCommit(header *Header, txs Transactions, hash common.Hash) (*ShardBlockProof, error) {
+	index := -1
+	tr := new(trie.Trie)
+	for i, tx := range txs {
+		key, _ := rlp.EncodeToBytes(uint(i))
+		enc, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			return nil, err
+		}
+		tr.Update(key, enc)
+		if tx.Hash() == hash && tx.TxType() == StateCommit {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, ErrCommitTxNotFound
+	}
+	key, _ := rlp.EncodeToBytes(uint(index))
+	var nodes trieProof
+	if err := tr.Prove(key, 0, &nodes); err != nil {
+		return nil, err
+	}
+	proof := &ShardBlockProof{
+		RefHeader: CopyHeader(header),
+		Index:     uint64(index),
+		CommitTx:  txs[index],
+		Proof:     make([]hexutil.Bytes, len(nodes)),
+	}
+	for i, node := range nodes {
+		proof.Proof[i] = node
+	}
+	return proof, nil
+}
+
+// Verify checks the state commitment against the transaction root of the
+// reference header and returns the shard header it carries. The caller has
+// to check the reference header against its own view of the reference chain
+// and the committed seals of the shard header against the shard committee.
+func (p *ShardBlockProof) Verify() (*Header, error) {
+	if p.RefHeader == nil || p.CommitTx == nil {
+		return nil, ErrCommitTxMismatch
+	}
+	nodes := make([][]byte, len(p.Proof))
+	for i, node := range p.Proof {
+		nodes[i] = node
+	}
+	key, _ := rlp.EncodeToBytes(uint(p.Index))
+	enc, _, err := trie.VerifyProof(p.RefHeader.TxHash, key, proofDatabase(nodes))
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction proof for %x: %v", p.CommitTx.Hash(), err)
+	}
+	if enc == nil {
+		return nil, ErrCommitTxNotFound
+	}
+	tx := new(Transaction)
+	if err := rlp.DecodeBytes(enc, tx); err != nil {
+		return nil, fmt.Errorf("invalid transaction encoding for %x: %v", p.CommitTx.Hash(), err)
+	}
+	if tx.Hash() != p.CommitTx.Hash() || tx.TxType() != StateCommit {
+		return nil, ErrCommitTxMismatch
+	}
+	return DecodeStateCommitHeader(tx)
+}
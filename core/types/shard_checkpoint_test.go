@@ -0,0 +1,138 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func TestNewShardCheckpoint(t *testing.T) {
+	seals := [][]byte{bytes.Repeat([]byte{0x01}, IstanbulExtraSeal), bytes.Repeat([]byte{0x02}, IstanbulExtraSeal)}
+	extra, _ := rlp.EncodeToBytes(&IstanbulExtra{
+		Validators:    []common.Address{common.HexToAddress("0x0a")},
+		Seal:          []byte{},
+		CommittedSeal: seals,
+	})
+	header := &Header{
+		Shard:     2,
+		Number:    big.NewInt(40),
+		RefNumber: big.NewInt(18),
+		Root:      common.HexToHash("0x01"),
+		Extra:     append(make([]byte, IstanbulExtraVanity), extra...),
+	}
+	tx := NewTransaction(StateCommit, 0, 0, common.Address{}, big.NewInt(0), 0, big.NewInt(0), nil)
+
+	checkpoint, err := NewShardCheckpoint(header, tx, 20)
+	if err != nil {
+		t.Fatalf("failed to create checkpoint: %v", err)
+	}
+	if checkpoint.Shard != 2 || checkpoint.Number != 40 || checkpoint.RefNumber != 18 || checkpoint.Checkpointed != 20 {
+		t.Errorf("position mismatch: %+v", checkpoint)
+	}
+	if checkpoint.Hash != header.Hash() || checkpoint.Root != header.Root || checkpoint.CommitTx != tx.Hash() {
+		t.Errorf("block mismatch: %+v", checkpoint)
+	}
+	if extra := checkpoint.Extra(); !reflect.DeepEqual(extra.CommittedSeal, seals) || len(extra.AggregatedSeal) != 0 {
+		t.Errorf("seals mismatch: have %x, want %x", extra.CommittedSeal, seals)
+	}
+	// Aggregate seals are checkpointed in place of the individual ones
+	extra, _ = rlp.EncodeToBytes(&IstanbulExtra{
+		Validators:     []common.Address{common.HexToAddress("0x0a")},
+		Seal:           []byte{},
+		CommittedSeal:  [][]byte{},
+		Signers:        []byte{0x03},
+		AggregatedSeal: bytes.Repeat([]byte{0x03}, 96),
+	})
+	header.Extra = append(make([]byte, IstanbulExtraVanity), extra...)
+	if checkpoint, err = NewShardCheckpoint(header, tx, 20); err != nil {
+		t.Fatalf("failed to create aggregate checkpoint: %v", err)
+	}
+	if extra := checkpoint.Extra(); len(extra.CommittedSeal) != 0 || !bytes.Equal(extra.Signers, []byte{0x03}) || len(extra.AggregatedSeal) != 96 {
+		t.Errorf("aggregate seal mismatch: %+v", extra)
+	}
+	if checkpoint.Hash != header.Hash() {
+		t.Errorf("aggregate checkpoint hash mismatch")
+	}
+	// Headers without Istanbul extra data cannot be checkpointed
+	header.Extra = nil
+	if _, err := NewShardCheckpoint(header, tx, 20); err == nil {
+		t.Errorf("checkpoint created without committed seals")
+	}
+}
+
+func TestShardBlockProof(t *testing.T) {
+	header := newStateCommitHeader(t)
+	data, err := EncodeStateCommit(2, header, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to encode state commit: %v", err)
+	}
+	commit := NewTransaction(StateCommit, 0, 2, common.Address{}, big.NewInt(0), 0, big.NewInt(0), data)
+	txs := Transactions{
+		NewTransaction(IntraShard, 0, 0, common.Address{}, big.NewInt(1), 0, big.NewInt(0), nil),
+		commit,
+		NewTransaction(IntraShard, 1, 0, common.Address{}, big.NewInt(1), 0, big.NewInt(0), nil),
+	}
+	ref := newStateCommitHeader(t)
+	ref.Shard, ref.Number, ref.TxHash = 0, big.NewInt(40), DeriveSha(txs)
+
+	proof, err := ProveStateCommit(ref, txs, commit.Hash())
+	if err != nil {
+		t.Fatalf("failed to prove state commit: %v", err)
+	}
+	if proof.Index != 1 || proof.RefHeader.Hash() != ref.Hash() {
+		t.Fatalf("proof position mismatch: index %d", proof.Index)
+	}
+	attested, err := proof.Verify()
+	if err != nil {
+		t.Fatalf("failed to verify proof: %v", err)
+	}
+	if attested.Hash() != header.Hash() {
+		t.Errorf("attested header mismatch: have %x, want %x", attested.Hash(), header.Hash())
+	}
+	// The proof survives the RPC encoding
+	enc, err := json.Marshal(proof)
+	if err != nil {
+		t.Fatalf("failed to encode proof: %v", err)
+	}
+	decoded := new(ShardBlockProof)
+	if err := json.Unmarshal(enc, decoded); err != nil {
+		t.Fatalf("failed to decode proof: %v", err)
+	}
+	if _, err := decoded.Verify(); err != nil {
+		t.Errorf("failed to verify decoded proof: %v", err)
+	}
+	// Proofs against another transaction root or of another transaction fail
+	proof.RefHeader.TxHash = DeriveSha(txs[:2])
+	if _, err := proof.Verify(); err == nil {
+		t.Errorf("proof verified against wrong transaction root")
+	}
+	proof.RefHeader.TxHash = ref.TxHash
+	proof.CommitTx = txs[0]
+	if _, err := proof.Verify(); err != ErrCommitTxMismatch {
+		t.Errorf("substituted transaction error mismatch: have %v, want %v", err, ErrCommitTxMismatch)
+	}
+	if _, err := ProveStateCommit(ref, txs, txs[0].Hash()); err != ErrCommitTxNotFound {
+		t.Errorf("non commitment proof error mismatch: have %v, want %v", err, ErrCommitTxNotFound)
+	}
+}
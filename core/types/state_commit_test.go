@@ -0,0 +1,187 @@
+// Copyright 2014 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func newStateCommitHeader(t testing.TB) *Header {
+	extra, err := rlp.EncodeToBytes(&IstanbulExtra{
+		Validators:    []common.Address{},
+		Seal:          bytes.Repeat([]byte{0x01}, IstanbulExtraSeal),
+		CommittedSeal: [][]byte{bytes.Repeat([]byte{0x02}, IstanbulExtraSeal)},
+	})
+	if err != nil {
+		t.Fatalf("failed to encode istanbul extra: %v", err)
+	}
+	return &Header{
+		Number:     big.NewInt(12),
+		RefNumber:  big.NewInt(34),
+		Shard:      2,
+		Root:       common.HexToHash("0xabcdef"),
+		Difficulty: big.NewInt(1),
+		Time:       big.NewInt(1),
+		MixDigest:  IstanbulDigest,
+		Extra:      append(make([]byte, IstanbulExtraVanity), extra...),
+	}
+}
+
+func TestStateCommitEncoding(t *testing.T) {
+	header := newStateCommitHeader(t)
+	data, err := EncodeStateCommit(2, header, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to encode state commit: %v", err)
+	}
+	tx := NewTransaction(StateCommit, 0, 2, common.Address{}, big.NewInt(0), 0, big.NewInt(0), data)
+
+	shard, commit, report, root, bHash, err := DecodeStateCommit(tx)
+	if err != nil {
+		t.Fatalf("failed to decode state commit: %v", err)
+	}
+	if shard != 2 || commit != 12 || report != 34 || root != header.Root || bHash != header.Hash() {
+		t.Fatalf("commitment mismatch: have (%d, %d, %d, %x, %x)", shard, commit, report, root, bHash)
+	}
+	attested, err := DecodeStateCommitHeader(tx)
+	if err != nil {
+		t.Fatalf("failed to decode attested header: %v", err)
+	}
+	if attested.Hash() != header.Hash() {
+		t.Errorf("attested header mismatch: have %x, want %x", attested.Hash(), header.Hash())
+	}
+	// Commitments without an attested header are rejected
+	tx = NewTransaction(StateCommit, 0, 2, common.Address{}, big.NewInt(0), 0, big.NewInt(0), data[:stateCommitLen])
+	if _, err := DecodeStateCommitHeader(tx); err != ErrMissingAttestation {
+		t.Errorf("missing header: have %v, want %v", err, ErrMissingAttestation)
+	}
+	// Commitments reporting a different root than the attested header are rejected
+	forged := common.CopyBytes(data)
+	copy(forged[4+3*32:], common.HexToHash("0xbad").Bytes())
+	tx = NewTransaction(StateCommit, 0, 2, common.Address{}, big.NewInt(0), 0, big.NewInt(0), forged)
+	if _, err := DecodeStateCommitHeader(tx); err != ErrCommitMismatch {
+		t.Errorf("forged root: have %v, want %v", err, ErrCommitMismatch)
+	}
+	// Truncated commitments are rejected instead of panicking
+	tx = NewTransaction(StateCommit, 0, 2, common.Address{}, big.NewInt(0), 0, big.NewInt(0), data[:stateCommitLen-1])
+	if _, _, _, _, _, err := DecodeStateCommit(tx); err != ErrShortStateCommit {
+		t.Errorf("truncated commitment: have %v, want %v", err, ErrShortStateCommit)
+	}
+}
+
+func TestStateCommitVersions(t *testing.T) {
+	header := newStateCommitHeader(t)
+	versions := &ReadVersions{
+		Txs:   []common.Hash{common.HexToHash("0x01"), common.HexToHash("0x02")},
+		Proof: &KeyVal{Addr: common.HexToAddress("0x0f"), Nonce: 1, Data: []common.Hash{common.HexToHash("0x05"), common.HexToHash("0x09")}, Proof: [][]byte{{0xc0}}, StorageProof: [][][]byte{{{0xc1}}, {{0xc2}}}},
+	}
+	data, err := EncodeStateCommit(2, header, versions, nil)
+	if err != nil {
+		t.Fatalf("failed to encode state commit: %v", err)
+	}
+	tx := NewTransaction(StateCommit, 0, 2, common.Address{}, big.NewInt(0), 0, big.NewInt(0), data)
+
+	// The attested header is still found ahead of the versions
+	attested, err := DecodeStateCommitHeader(tx)
+	if err != nil {
+		t.Fatalf("failed to decode attested header: %v", err)
+	}
+	if attested.Hash() != header.Hash() {
+		t.Errorf("attested header mismatch: have %x, want %x", attested.Hash(), header.Hash())
+	}
+	decoded, err := DecodeStateCommitVersions(tx)
+	if err != nil {
+		t.Fatalf("failed to decode read versions: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, versions) {
+		t.Errorf("read versions mismatch: have %+v, want %+v", decoded, versions)
+	}
+	// Commitments of pessimistic shards carry no versions
+	if data, err = EncodeStateCommit(2, header, nil, nil); err != nil {
+		t.Fatalf("failed to encode state commit: %v", err)
+	}
+	tx = NewTransaction(StateCommit, 0, 2, common.Address{}, big.NewInt(0), 0, big.NewInt(0), data)
+	if decoded, err := DecodeStateCommitVersions(tx); decoded != nil || err != nil {
+		t.Errorf("versions without any encoded: have (%v, %v)", decoded, err)
+	}
+}
+
+func TestStateCommitVotes(t *testing.T) {
+	header := newStateCommitHeader(t)
+	votes := &CrossTxVotes{
+		Txs:   []common.Hash{common.HexToHash("0x01")},
+		Proof: &KeyVal{Addr: common.HexToAddress("0x0e"), Nonce: 1, Data: []common.Hash{common.HexToHash("0x01")}, Proof: [][]byte{{0xc0}}, StorageProof: [][][]byte{{{0xc1}}}},
+	}
+	versions := &ReadVersions{
+		Txs:   []common.Hash{common.HexToHash("0x02")},
+		Proof: &KeyVal{Addr: common.HexToAddress("0x0f"), Nonce: 1, Data: []common.Hash{common.HexToHash("0x05")}, Proof: [][]byte{{0xc0}}, StorageProof: [][][]byte{{{0xc2}}}},
+	}
+	tests := []struct {
+		versions *ReadVersions
+		votes    *CrossTxVotes
+	}{
+		{nil, votes},
+		{versions, votes},
+		{versions, nil},
+	}
+	for i, tt := range tests {
+		data, err := EncodeStateCommit(2, header, tt.versions, tt.votes)
+		if err != nil {
+			t.Fatalf("test %d: failed to encode state commit: %v", i, err)
+		}
+		tx := NewTransaction(StateCommit, 0, 2, common.Address{}, big.NewInt(0), 0, big.NewInt(0), data)
+		if _, err := DecodeStateCommitHeader(tx); err != nil {
+			t.Fatalf("test %d: failed to decode attested header: %v", i, err)
+		}
+		decodedVersions, err := DecodeStateCommitVersions(tx)
+		if err != nil {
+			t.Fatalf("test %d: failed to decode read versions: %v", i, err)
+		}
+		if !reflect.DeepEqual(decodedVersions, tt.versions) {
+			t.Errorf("test %d: read versions mismatch: have %+v, want %+v", i, decodedVersions, tt.versions)
+		}
+		decodedVotes, err := DecodeStateCommitVotes(tx)
+		if err != nil {
+			t.Fatalf("test %d: failed to decode votes: %v", i, err)
+		}
+		if !reflect.DeepEqual(decodedVotes, tt.votes) {
+			t.Errorf("test %d: votes mismatch: have %+v, want %+v", i, decodedVotes, tt.votes)
+		}
+	}
+}
+
+func FuzzDecodeStateCommit(f *testing.F) {
+	data, err := EncodeStateCommit(2, newStateCommitHeader(f), nil, nil)
+	if err != nil {
+		f.Fatalf("failed to encode state commit: %v", err)
+	}
+	f.Add(data)
+	f.Add(data[:stateCommitLen])
+	f.Add(data[:10])
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tx := NewTransaction(StateCommit, 0, 2, common.Address{}, big.NewInt(0), 0, big.NewInt(0), data)
+		DecodeStateCommit(tx)
+		DecodeStateCommitHeader(tx)
+		DecodeStateCommitVersions(tx)
+		DecodeStateCommitVotes(tx)
+	})
+}
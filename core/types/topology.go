@@ -0,0 +1,197 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// shardMoveNonce marks a reference block nonce as a vote to move the validator
+// in the coinbase to the shard held by the remaining nonce bytes. Regular
+// Istanbul votes use all-ones and all-zeros nonces, so the marker never clashes.
+const shardMoveNonce = byte(0x01)
+
+// EncodeShardMoveNonce returns the block nonce voting to move a validator to shard.
+func EncodeShardMoveNonce(shard uint64) BlockNonce {
+	var n BlockNonce
+	binary.BigEndian.PutUint64(n[:], shard)
+	n[0] = shardMoveNonce
+	return n
+}
+
+// DecodeShardMoveNonce returns the shard voted for by a block nonce, and whether
+// the nonce is a shard move vote at all.
+func DecodeShardMoveNonce(n BlockNonce) (uint64, bool) {
+	if n[0] != shardMoveNonce {
+		return 0, false
+	}
+	n[0] = 0
+	return binary.BigEndian.Uint64(n[:]), true
+}
+
+// ShardMoveVote is a reference validator's vote to move a validator to another shard.
+type ShardMoveVote struct {
+	Validator common.Address `json:"validator"` // Reference validator that cast this vote
+	Address   common.Address `json:"address"`   // Validator being voted on to move
+	Shard     uint64         `json:"shard"`     // Shard the validator should move to
+}
+
+// ShardMove is a reassignment passed by the reference validators, waiting for
+// the next epoch boundary to take effect.
+type ShardMove struct {
+	Address common.Address `json:"address"` // Validator to move
+	Shard   uint64         `json:"shard"`   // Shard the validator moves to
+}
+
+// ShardTopology is the assignment of validators to shards after a reference
+// block, along with the reassignment votes that are still pending.
+type ShardTopology struct {
+	Since  uint64             `json:"since"`  // Reference block at which the assignment took effect
+	Shards [][]common.Address `json:"shards"` // Validators of every shard, indexed by shard
+	Votes  []*ShardMoveVote   `json:"votes"`  // Votes cast since the last epoch boundary
+	Moves  []*ShardMove       `json:"moves"`  // Passed reassignments, applied at the next epoch boundary
+}
+
+// NewShardTopology creates the topology of numShard shards assigned at genesis.
+func NewShardTopology(numShard uint64, shards map[uint64][]common.Address) *ShardTopology {
+	topology := &ShardTopology{Shards: make([][]common.Address, numShard)}
+	for shard := uint64(0); shard < numShard; shard++ {
+		topology.Shards[shard] = append([]common.Address{}, shards[shard]...)
+	}
+	return topology
+}
+
+// Copy creates a deep copy of the topology.
+func (t *ShardTopology) Copy() *ShardTopology {
+	cpy := &ShardTopology{
+		Since:  t.Since,
+		Shards: make([][]common.Address, len(t.Shards)),
+		Votes:  make([]*ShardMoveVote, len(t.Votes)),
+		Moves:  make([]*ShardMove, len(t.Moves)),
+	}
+	for shard, validators := range t.Shards {
+		cpy.Shards[shard] = append([]common.Address{}, validators...)
+	}
+	copy(cpy.Votes, t.Votes)
+	copy(cpy.Moves, t.Moves)
+	return cpy
+}
+
+// Map returns the validators of every shard, indexed by shard.
+func (t *ShardTopology) Map() map[uint64][]common.Address {
+	shards := make(map[uint64][]common.Address, len(t.Shards))
+	for shard, validators := range t.Shards {
+		shards[uint64(shard)] = append([]common.Address{}, validators...)
+	}
+	return shards
+}
+
+// Validators returns the validators assigned to shard.
+func (t *ShardTopology) Validators(shard uint64) []common.Address {
+	if shard >= uint64(len(t.Shards)) {
+		return nil
+	}
+	return t.Shards[shard]
+}
+
+// ShardOf returns the shard a validator is assigned to.
+func (t *ShardTopology) ShardOf(addr common.Address) (uint64, bool) {
+	for shard, validators := range t.Shards {
+		for _, validator := range validators {
+			if validator == addr {
+				return uint64(shard), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Cast tallies the vote of a reference validator to move addr to shard and
+// returns whether the vote was counted. Once more than half of the reference
+// validators agree, the move is scheduled for the next epoch boundary.
+func (t *ShardTopology) Cast(voter, addr common.Address, shard uint64) bool {
+	if shard >= uint64(len(t.Shards)) {
+		return false
+	}
+	if current, ok := t.ShardOf(voter); !ok || current != 0 {
+		return false
+	}
+	if current, ok := t.ShardOf(addr); !ok || current == shard {
+		return false
+	}
+	// Replace any previous vote of the validator on the same account
+	for i, vote := range t.Votes {
+		if vote.Validator == voter && vote.Address == addr {
+			t.Votes = append(t.Votes[:i], t.Votes[i+1:]...)
+			break
+		}
+	}
+	t.Votes = append(t.Votes, &ShardMoveVote{Validator: voter, Address: addr, Shard: shard})
+
+	tally := 0
+	for _, vote := range t.Votes {
+		if vote.Address == addr && vote.Shard == shard {
+			tally++
+		}
+	}
+	if tally <= len(t.Shards[0])/2 {
+		return true
+	}
+	// The move passed, replace any earlier move of the account and drop its votes
+	for i := 0; i < len(t.Moves); i++ {
+		if t.Moves[i].Address == addr {
+			t.Moves = append(t.Moves[:i], t.Moves[i+1:]...)
+			i--
+		}
+	}
+	t.Moves = append(t.Moves, &ShardMove{Address: addr, Shard: shard})
+	for i := 0; i < len(t.Votes); i++ {
+		if t.Votes[i].Address == addr {
+			t.Votes = append(t.Votes[:i], t.Votes[i+1:]...)
+			i--
+		}
+	}
+	return true
+}
+
+// Apply reassigns the validators of all passed moves at the epoch boundary
+// number and resets the pending votes. Moves that would leave a shard without
+// validators are dropped. It returns whether the assignment changed.
+func (t *ShardTopology) Apply(number uint64) bool {
+	changed := false
+	for _, move := range t.Moves {
+		current, ok := t.ShardOf(move.Address)
+		if !ok || current == move.Shard || len(t.Shards[current]) == 1 {
+			continue
+		}
+		for i, validator := range t.Shards[current] {
+			if validator == move.Address {
+				t.Shards[current] = append(t.Shards[current][:i:i], t.Shards[current][i+1:]...)
+				break
+			}
+		}
+		t.Shards[move.Shard] = append(t.Shards[move.Shard], move.Address)
+		changed = true
+	}
+	t.Votes, t.Moves = nil, nil
+	if changed {
+		t.Since = number
+	}
+	return changed
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func TestShardMoveNonce(t *testing.T) {
+	for _, shard := range []uint64{0, 1, 7, 1<<56 - 1} {
+		nonce := EncodeShardMoveNonce(shard)
+		if got, ok := DecodeShardMoveNonce(nonce); !ok || got != shard {
+			t.Errorf("shard %d: decoded %d, %v", shard, got, ok)
+		}
+	}
+	for _, nonce := range []BlockNonce{{}, EncodeNonce(^uint64(0))} {
+		if _, ok := DecodeShardMoveNonce(nonce); ok {
+			t.Errorf("nonce %x decoded as shard move", nonce)
+		}
+	}
+}
+
+func TestShardTopologyVoting(t *testing.T) {
+	v := make([]common.Address, 7)
+	for i := range v {
+		v[i] = common.BigToAddress(big.NewInt(int64(i + 1)))
+	}
+	genesis := NewShardTopology(3, map[uint64][]common.Address{0: v[:3], 1: v[3:5], 2: v[5:7]})
+	topology := genesis.Copy()
+
+	// Only reference validators vote, and only on meaningful moves
+	if topology.Cast(v[3], v[4], 2) {
+		t.Fatal("vote of a shard validator counted")
+	}
+	if topology.Cast(v[0], v[4], 1) {
+		t.Fatal("vote to keep a validator in place counted")
+	}
+	if topology.Cast(v[0], v[4], 3) {
+		t.Fatal("vote for an unknown shard counted")
+	}
+	// A single vote out of three reference validators does not pass
+	if !topology.Cast(v[0], v[4], 2) || len(topology.Moves) != 0 {
+		t.Fatalf("first vote: counted moves %d", len(topology.Moves))
+	}
+	// Repeating the vote replaces it instead of counting twice
+	if !topology.Cast(v[0], v[4], 2) || len(topology.Votes) != 1 || len(topology.Moves) != 0 {
+		t.Fatalf("repeated vote: votes %d, moves %d", len(topology.Votes), len(topology.Moves))
+	}
+	if !topology.Cast(v[1], v[4], 2) || len(topology.Moves) != 1 || len(topology.Votes) != 0 {
+		t.Fatalf("majority vote: votes %d, moves %d", len(topology.Votes), len(topology.Moves))
+	}
+	// Nothing changes until the epoch boundary
+	if shard, _ := topology.ShardOf(v[4]); shard != 1 {
+		t.Fatalf("moved before epoch: shard %d", shard)
+	}
+	if !topology.Apply(30) {
+		t.Fatal("passed move not applied")
+	}
+	want := map[uint64][]common.Address{0: v[:3], 1: v[3:4], 2: {v[5], v[6], v[4]}}
+	if have := topology.Map(); !reflect.DeepEqual(have, want) {
+		t.Fatalf("topology mismatch: have %v, want %v", have, want)
+	}
+	if topology.Since != 30 || topology.Votes != nil || topology.Moves != nil {
+		t.Fatalf("epoch not reset: since %d, votes %d, moves %d", topology.Since, len(topology.Votes), len(topology.Moves))
+	}
+	// The genesis assignment is unaffected by changes to its copy
+	if shard, _ := genesis.ShardOf(v[4]); shard != 1 {
+		t.Fatalf("copy aliases genesis: shard %d", shard)
+	}
+	// Moving the last validator out of a shard is refused
+	topology.Cast(v[0], v[3], 0)
+	topology.Cast(v[1], v[3], 0)
+	if topology.Apply(60) {
+		t.Fatal("shard emptied by a move")
+	}
+	// The topology survives the database encoding
+	blob, err := rlp.EncodeToBytes(topology)
+	if err != nil {
+		t.Fatalf("failed to encode topology: %v", err)
+	}
+	decoded := new(ShardTopology)
+	if err := rlp.DecodeBytes(blob, decoded); err != nil {
+		t.Fatalf("failed to decode topology: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.Map(), topology.Map()) || decoded.Since != topology.Since {
+		t.Fatalf("topology mismatch after decoding: have %v, want %v", decoded.Map(), topology.Map())
+	}
+}
@@ -22,9 +22,11 @@ import (
 	"encoding/hex"
 	"errors"
 	"io"
+	"math"
 	"math/big"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	fmt "fmt"
 
@@ -49,8 +51,50 @@ const (
 
 var (
 	ErrInvalidSig = errors.New("invalid transaction v, r, s values")
+
+	ErrMissingAttestation = errors.New("state commitment carries no attested header")
+	ErrCommitMismatch     = errors.New("attested header does not match state commitment")
+	ErrVersionRegistry    = errors.New("read versions proven for a different account")
+	ErrVoteRegistry       = errors.New("votes proven for a different account")
+
+	ErrInvalidSelector   = errors.New("function selector must be 4 bytes")
+	ErrNoShards          = errors.New("cross-shard transaction involves no shards")
+	ErrDuplicateShard    = errors.New("shard listed more than once")
+	ErrUnlistedShard     = errors.New("read-write set refers to an unlisted shard")
+	ErrEmptyShard        = errors.New("shard has no contracts in read-write set")
+	ErrDuplicateContract = errors.New("contract listed more than once")
+	ErrDuplicateKey      = errors.New("storage key listed more than once")
+	ErrUnreadWriteKey    = errors.New("write key missing from the keys of its contract")
+	ErrRWSetTooLarge     = errors.New("read-write set too large")
+	ErrValueOverflow     = errors.New("value or gas price too large")
+	ErrMissingReceiver   = errors.New("cross-shard call has no receiver")
+
+	ErrShortCrossTx     = errors.New("cross-shard transaction data too short")
+	ErrCrossTxVersion   = errors.New("unsupported cross-shard transaction version")
+	ErrCrossTxEncoding  = errors.New("malformed cross-shard transaction encoding")
+	ErrCrossTxShards    = errors.New("cross-shard transaction lists different shards than its read-write sets")
+	ErrShortStateCommit = errors.New("state commitment data too short")
 )
 
+// stateCommitSelector is the function selector of the reference contract
+// method accepting state commitments.
+var stateCommitSelector = []byte{0x8a, 0x31, 0x29, 0x7a}
+
+// stateCommitLen is the length of the fixed arguments of a state commitment.
+const stateCommitLen = 4 + 5*32
+
+// crossTxVersion is the version of the payload format of cross-shard
+// transactions, carried in its first byte.
+const crossTxVersion = 1
+
+// maxRWSetSize is the maximum encoded size of the read-write sets of a
+// cross-shard transaction.
+const maxRWSetSize = math.MaxUint16
+
+// crossTxHeaderLen is the length of the inner call fields preceding its
+// data: sender, nonce, value, receiver, gas limit and gas price.
+const crossTxHeaderLen = 20 + 8 + 32 + 20 + 8 + 8
+
 // deriveSigner makes a *best* guess about which signer to use.
 func deriveSigner(V *big.Int) Signer {
 	// joel: this is one of the two places we used a wrong signer to print txes
@@ -278,6 +322,23 @@ func (tx *Transaction) TxType() uint64     { return tx.data.TxType }
 func (tx *Transaction) Shard() uint64      { return tx.data.Shard }
 func (tx *Transaction) CheckNonce() bool   { return true }
 
+// HomeShard returns the shard whose chain includes the transaction. Cross-shard
+// transactions and state commitments go to the reference chain, every other
+// transaction to the shard it names.
+func (tx *Transaction) HomeShard() uint64 {
+	return HomeShard(tx.data.TxType, tx.data.Shard)
+}
+
+// HomeShard returns the shard whose chain includes a transaction of the given
+// type naming the given shard.
+func HomeShard(txType, shard uint64) uint64 {
+	switch txType {
+	case CrossShard, StateCommit:
+		return 0
+	}
+	return shard
+}
+
 // To returns the recipient address of the transaction.
 // It returns nil if the transaction is a contract creation.
 func (tx *Transaction) To() *common.Address {
@@ -579,10 +640,12 @@ func (ck *CKeys) AddKey(key common.Hash) {
 
 // KeyVal stores both address and data
 type KeyVal struct {
-	Addr    common.Address
-	Balance uint64
-	Nonce   uint64
-	Data    []common.Hash
+	Addr         common.Address
+	Balance      uint64
+	Nonce        uint64
+	Data         []common.Hash
+	Proof        [][]byte   // Merkle proof of the account in the state trie
+	StorageProof [][][]byte // Merkle proof of each value in the storage trie
 }
 
 type CData struct {
@@ -598,6 +661,24 @@ type CrossTx struct {
 	BlockNum     *big.Int
 	Tx           *Transaction
 	AllContracts map[uint64][]*CKeys // shard: list of contracts and addresses
+	RefHash      common.Hash         // Hash of the transaction in the reference chain
+	Seen         time.Time           // Time the transaction was parsed from the reference chain
+
+	// Optimistic cross-shard mode only
+	Origin      uint64 // Reference block that first accepted the transaction
+	LocalCommit uint64 // Local block committed when the transaction was accepted
+	Decided     uint64 // Reference block that validated or rejected the read sets
+	Stale       bool   // Whether some read set went stale before validation
+
+	// Atomic cross-shard mode only
+	Resolved uint64 // Reference block that decided to commit or abort the prepared transaction
+	Aborted  bool   // Whether the decision was to abort
+}
+
+// Validated returns whether the read sets of an optimistic cross-shard
+// transaction were found fresh, allowing shards to execute it.
+func (ctx *CrossTx) Validated() bool {
+	return ctx.Decided != 0 && !ctx.Stale
 }
 
 // SetTransaction sets the transaction
@@ -632,128 +713,189 @@ func (cst CrossShardTxs) AddTransaction(index uint64, tx *CrossTx) {
 	cst.Lock.Unlock()
 }
 
+// decodeUint64 returns the value of a 32 byte ABI word if it fits in 64 bits.
+func decodeUint64(word []byte) (uint64, bool) {
+	for _, b := range word[:24] {
+		if b != 0 {
+			return 0, false
+		}
+	}
+	return binary.BigEndian.Uint64(word[24:32]), true
+}
+
 // GetRWSet to get read-write set per shard of a cross-shard trasnaction
-func GetRWSet(numContracts uint16, index uint16, data []byte) ([]*CKeys, uint16) {
-	var (
-		allKeys []*CKeys
-		u20     = uint16(20)
-		u32     = uint16(32)
-		addr    common.Address
-		numKeys uint16
-	)
+func GetRWSet(numContracts uint16, index int, data []byte) ([]*CKeys, int, error) {
+	var allKeys []*CKeys
 	for i := uint16(0); i < numContracts; i++ {
 		// Extracting keys per contarct
-		addr = common.BytesToAddress(data[index : index+u20])
-		index += u20
-		numKeys = binary.BigEndian.Uint16(data[index : index+2])
+		if len(data)-index < common.AddressLength+2 {
+			return nil, 0, ErrShortCrossTx
+		}
+		addr := common.BytesToAddress(data[index : index+common.AddressLength])
+		index += common.AddressLength
+		numKeys := int(binary.BigEndian.Uint16(data[index : index+2]))
 		index += 2
+		if (len(data)-index)/(common.HashLength+1) < numKeys {
+			return nil, 0, ErrShortCrossTx
+		}
 		cKeys := &CKeys{Addr: addr, Keys: []common.Hash{}}
-		for k := uint16(0); k < numKeys; k++ {
-			key := common.BytesToHash(data[index : index+u32])
-			index += u32
+		for k := 0; k < numKeys; k++ {
+			key := common.BytesToHash(data[index : index+common.HashLength])
+			index += common.HashLength
 			cKeys.Keys = append(cKeys.Keys, key)
 			// Checking whether the key is written to or not, if so
 			// add to writekeys
-			isWrite := int(data[index]) == 1
-			if isWrite {
+			switch data[index] {
+			case 0:
+			case 1:
 				cKeys.WKeys = append(cKeys.WKeys, key)
+			default:
+				return nil, 0, ErrCrossTxEncoding
 			}
 			index++
 		}
 		// Adding all keys to a list
 		allKeys = append(allKeys, cKeys)
 	}
-	return allKeys, index
+	return allKeys, index, nil
 }
 
-// GetAllRWSet return all read-write set used in a cross-shard transaction
-func GetAllRWSet(numShards uint16, data []byte) (map[uint64][]*CKeys, []uint64, uint16) {
+// GetAllRWSet return all read-write set used in a cross-shard transaction,
+// along with the index of the call following them in data.
+func GetAllRWSet(data []byte) (map[uint64][]*CKeys, []uint64, int, error) {
+	if len(data) < 3 {
+		return nil, nil, 0, ErrShortCrossTx
+	}
+	if data[0] != crossTxVersion {
+		return nil, nil, 0, ErrCrossTxVersion
+	}
 	var (
-		index        = uint16(0)
-		numContracts uint16
-		allKeys      []*CKeys // list of addr:keys for a given shard
+		numShards    = binary.BigEndian.Uint16(data[1:3])
+		index        = 3
 		shards       []uint64
 		allContracts = make(map[uint64][]*CKeys) // map shard: {list of addr:keys}
 	)
-
 	for i := uint16(0); i < numShards; i++ {
-		shard := binary.BigEndian.Uint16(data[index : index+2])
-		shards = append(shards, uint64(shard))
+		if len(data)-index < 4 {
+			return nil, nil, 0, ErrShortCrossTx
+		}
+		shard := uint64(binary.BigEndian.Uint16(data[index : index+2]))
 		index += 2
-		numContracts = binary.BigEndian.Uint16(data[index : index+2])
+		if _, ok := allContracts[shard]; ok {
+			return nil, nil, 0, ErrDuplicateShard
+		}
+		numContracts := binary.BigEndian.Uint16(data[index : index+2])
 		index += 2
-		if numContracts > 0 {
-			allKeys, index = GetRWSet(numContracts, index, data)
+
+		allKeys, next, err := GetRWSet(numContracts, index, data)
+		if err != nil {
+			return nil, nil, 0, err
 		}
-		allContracts[uint64(shard)] = allKeys
+		index = next
+		shards = append(shards, shard)
+		allContracts[shard] = allKeys
 	}
-	return allContracts, shards, index
+	return allContracts, shards, index, nil
 }
 
-// ParseCrossTxData parsed data
-func ParseCrossTxData(numShards uint16, data []byte) *CrossTx {
+// ParseCrossTxData parses the read-write sets and the call carried by the
+// payload of a cross-shard transaction.
+func ParseCrossTxData(data []byte) (*CrossTx, error) {
 	var (
-		index    uint16
-		addrSize = uint16(20)
-		// u4       = uint16(4)
-		u8 = uint16(8)
-		// u16      = uint16(16)
-		// u20 = uint16(20)
-		u32 = uint16(32)
+		err   error
+		index int
+		ctx   = &CrossTx{}
 	)
-	ctx := &CrossTx{
-		Shards:       []uint64{},
-		AllContracts: make(map[uint64][]*CKeys),
-	}
-	ctx.AllContracts, ctx.Shards, index = GetAllRWSet(numShards, data)
-
-	sender := common.BytesToAddress(data[index : index+addrSize])
-	index += addrSize
-	nonce := binary.BigEndian.Uint64(data[index : index+u8])
-	index += u8
-	value := new(big.Int)
-	value.SetBytes(data[index : index+u32])
-	index += u32
-	receiver := common.BytesToAddress(data[index : index+addrSize])
-	index += addrSize
-	gasLimit := binary.BigEndian.Uint64(data[index : index+u8])
-	index += u8
-	gasPrice := binary.BigEndian.Uint64(data[index : index+u8])
-	index += u8
-
-	tx := NewCrossTransaction(CrossShardLocal, uint64(nonce), uint64(0), receiver, sender, value, gasLimit, big.NewInt(int64(gasPrice)), data[index:])
+	if ctx.AllContracts, ctx.Shards, index, err = GetAllRWSet(data); err != nil {
+		return nil, err
+	}
+	if len(data)-index < crossTxHeaderLen {
+		return nil, ErrShortCrossTx
+	}
+	sender := common.BytesToAddress(data[index : index+common.AddressLength])
+	index += common.AddressLength
+	nonce := binary.BigEndian.Uint64(data[index : index+8])
+	index += 8
+	value := new(big.Int).SetBytes(data[index : index+32])
+	index += 32
+	receiver := common.BytesToAddress(data[index : index+common.AddressLength])
+	index += common.AddressLength
+	gasLimit := binary.BigEndian.Uint64(data[index : index+8])
+	index += 8
+	gasPrice := binary.BigEndian.Uint64(data[index : index+8])
+	index += 8
+
+	tx := NewCrossTransaction(CrossShardLocal, nonce, uint64(0), receiver, sender, value, gasLimit, new(big.Int).SetUint64(gasPrice), data[index:])
 	ctx.SetTransaction(tx)
 
 	log.Debug("New Cross shard Transaction", "hash", ctx.Tx.Hash(), "from", ctx.Tx.From(), "to", ctx.Tx.To(), "nonce", ctx.Tx.Nonce(), "value", ctx.Tx.Value(), "params", hex.EncodeToString(data[index:]))
-	return ctx
-}
-
-// DecodeCrossTx extracts shards
-func DecodeCrossTx(myshard uint64, data []byte) (uint64, []uint64, bool) {
-	elemSize := uint64(32)
-	lenData := data[2*elemSize+elemSize-8 : 3*elemSize]
-	length := binary.BigEndian.Uint64(lenData)
-	index := 3 * elemSize
+	return ctx, nil
+}
+
+// DecodeCrossTx extracts the shards involved in a cross-shard transaction from
+// its call data, and returns them along with the payload carrying the
+// read-write sets and the call. The shards have to be the ones the read-write
+// sets of the payload are listed for, in the same order, as the reference
+// chain locks them for the shards of the call data while shards run the
+// transaction with the read-write sets.
+func DecodeCrossTx(myshard uint64, data []byte) ([]byte, []uint64, bool, error) {
+	if len(data) < 4+3*32 {
+		return nil, nil, false, ErrShortCrossTx
+	}
+	data = data[4:]
+	length, ok := decodeUint64(data[64:96])
+	if !ok || length > uint64(len(data)-96)/32 {
+		return nil, nil, false, ErrShortCrossTx
+	}
+	// Only the layout emitted by EncodeCrossTx is accepted
+	if offset, ok := decodeUint64(data[0:32]); !ok || offset != 0x40 {
+		return nil, nil, false, ErrCrossTxEncoding
+	}
+	if offset, ok := decodeUint64(data[32:64]); !ok || offset != 0x40+32*(1+length) {
+		return nil, nil, false, ErrCrossTxEncoding
+	}
 	var (
+		index    = 96
 		involved = false
 		shards   []uint64
-		u24      = uint64(24)
-		u32      = uint64(32)
 	)
 	for i := uint64(0); i < length; i++ {
-		shardData := data[index+u24 : index+u32]
-		index += u32
-		shard := binary.BigEndian.Uint64(shardData)
+		shard, ok := decodeUint64(data[index : index+32])
+		if !ok {
+			return nil, nil, false, ErrCrossTxEncoding
+		}
+		index += 32
 		if shard == myshard {
 			involved = true
 		}
 		shards = append(shards, shard)
 	}
-	return index, shards, involved
+	if len(data)-index < 32 {
+		return nil, nil, false, ErrShortCrossTx
+	}
+	size, ok := decodeUint64(data[index : index+32])
+	index += 32
+	if !ok || size > uint64(len(data)-index) {
+		return nil, nil, false, ErrShortCrossTx
+	}
+	payload := data[index : index+int(size)]
+	_, listed, _, err := GetAllRWSet(payload)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if len(listed) != len(shards) {
+		return nil, nil, false, ErrCrossTxShards
+	}
+	for i, shard := range shards {
+		if listed[i] != shard {
+			return nil, nil, false, ErrCrossTxShards
+		}
+	}
+	return payload, shards, involved, nil
 }
 
 // DecodeStateCommit returns the commiitted block num, reproted rs block num
-func DecodeStateCommit(stx *Transaction) (uint64, uint64, uint64, common.Hash, common.Hash) {
+func DecodeStateCommit(stx *Transaction) (uint64, uint64, uint64, common.Hash, common.Hash, error) {
 	var (
 		u32    = 32
 		u24    = 24
@@ -764,6 +906,9 @@ func DecodeStateCommit(stx *Transaction) (uint64, uint64, uint64, common.Hash, c
 		root   common.Hash
 		bHash  common.Hash
 	)
+	if len(stx.data.Payload) < stateCommitLen {
+		return 0, 0, 0, common.Hash{}, common.Hash{}, ErrShortStateCommit
+	}
 	data := stx.Data()[4:]
 	shard = binary.BigEndian.Uint64(data[index+u24 : index+u32])
 	index += u32
@@ -773,8 +918,317 @@ func DecodeStateCommit(stx *Transaction) (uint64, uint64, uint64, common.Hash, c
 	index += u32
 	root = common.BytesToHash(data[index : index+u32])
 	index += u32
-	bHash = common.BytesToHash(data[index:])
-	return shard, commit, report, root, bHash
+	bHash = common.BytesToHash(data[index : index+u32])
+	return shard, commit, report, root, bHash, nil
+}
+
+// encodeRWSet appends the read-write set of a single shard in the layout
+// expected by GetAllRWSet.
+func encodeRWSet(buf []byte, shard uint64, contracts []*CKeys, seen map[common.Address]bool) ([]byte, error) {
+	if len(contracts) == 0 {
+		return nil, ErrEmptyShard
+	}
+	if shard > math.MaxUint16 || len(contracts) > math.MaxUint16 {
+		return nil, ErrRWSetTooLarge
+	}
+	buf = append(buf, byte(shard>>8), byte(shard))
+	buf = append(buf, byte(len(contracts)>>8), byte(len(contracts)))
+	for _, ck := range contracts {
+		if seen[ck.Addr] {
+			return nil, ErrDuplicateContract
+		}
+		seen[ck.Addr] = true
+		if len(ck.Keys) > math.MaxUint16 {
+			return nil, ErrRWSetTooLarge
+		}
+		keys := make(map[common.Hash]bool, len(ck.Keys))
+		for _, key := range ck.Keys {
+			if _, ok := keys[key]; ok {
+				return nil, ErrDuplicateKey
+			}
+			keys[key] = false
+		}
+		for _, key := range ck.WKeys {
+			write, ok := keys[key]
+			if !ok {
+				return nil, ErrUnreadWriteKey
+			}
+			if write {
+				return nil, ErrDuplicateKey
+			}
+			keys[key] = true
+		}
+		buf = append(buf, ck.Addr.Bytes()...)
+		buf = append(buf, byte(len(ck.Keys)>>8), byte(len(ck.Keys)))
+		for _, key := range ck.Keys {
+			buf = append(buf, key.Bytes()...)
+			if keys[key] {
+				buf = append(buf, 1)
+			} else {
+				buf = append(buf, 0)
+			}
+		}
+	}
+	return buf, nil
+}
+
+// EncodeCrossTx returns the call data submitting a cross-shard transaction to
+// the reference contract. The read-write sets of every shard are listed in
+// the order of shards and followed by the call executed by the shards, which
+// must be a CrossShardLocal transaction. Malformed input is rejected so that
+// the result can always be parsed by ParseCrossTxData.
+func EncodeCrossTx(selector []byte, shards []uint64, contracts map[uint64][]*CKeys, tx *Transaction) ([]byte, error) {
+	if len(selector) != 4 {
+		return nil, ErrInvalidSelector
+	}
+	if len(shards) == 0 {
+		return nil, ErrNoShards
+	}
+	if tx.To() == nil {
+		return nil, ErrMissingReceiver
+	}
+	if tx.Value().BitLen() > 256 || !tx.GasPrice().IsUint64() {
+		return nil, ErrValueOverflow
+	}
+	listed := make(map[uint64]bool, len(shards))
+	for _, shard := range shards {
+		if listed[shard] {
+			return nil, ErrDuplicateShard
+		}
+		listed[shard] = true
+	}
+	for shard := range contracts {
+		if !listed[shard] {
+			return nil, ErrUnlistedShard
+		}
+	}
+	// Read-write sets
+	var (
+		payload = []byte{crossTxVersion, byte(len(shards) >> 8), byte(len(shards))}
+		seen    = make(map[common.Address]bool)
+		err     error
+	)
+	for _, shard := range shards {
+		if payload, err = encodeRWSet(payload, shard, contracts[shard], seen); err != nil {
+			return nil, err
+		}
+	}
+	if len(payload)-3 > maxRWSetSize {
+		return nil, ErrRWSetTooLarge
+	}
+	// Inner call
+	var word [32]byte
+	payload = append(payload, tx.From().Bytes()...)
+	binary.BigEndian.PutUint64(word[:8], tx.Nonce())
+	payload = append(payload, word[:8]...)
+	payload = append(payload, common.LeftPadBytes(tx.Value().Bytes(), 32)...)
+	payload = append(payload, tx.To().Bytes()...)
+	binary.BigEndian.PutUint64(word[:8], tx.Gas())
+	payload = append(payload, word[:8]...)
+	binary.BigEndian.PutUint64(word[:8], tx.GasPrice().Uint64())
+	payload = append(payload, word[:8]...)
+	payload = append(payload, tx.Data()...)
+
+	// ABI encoding of (uint256[] shards, bytes payload)
+	n := uint64(len(shards))
+	data := make([]byte, 4, 4+(5+n)*32+uint64(len(payload))+31)
+	copy(data, selector)
+	data = append(data, common.LeftPadBytes(new(big.Int).SetUint64(0x40).Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(new(big.Int).SetUint64(0x40+32*(1+n)).Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(new(big.Int).SetUint64(n).Bytes(), 32)...)
+	for _, shard := range shards {
+		data = append(data, common.LeftPadBytes(new(big.Int).SetUint64(shard).Bytes(), 32)...)
+	}
+	data = append(data, common.LeftPadBytes(new(big.Int).SetUint64(uint64(len(payload))).Bytes(), 32)...)
+	data = append(data, common.RightPadBytes(payload, (len(payload)+31)/32*32)...)
+	return data, nil
+}
+
+// EncodeStateCommit returns the call data reporting header as the latest
+// committed block of shard. The header is appended after the contract
+// arguments so that its committed seals attest the commitment, followed by
+// the read versions of the shard if it runs cross-shard transactions
+// optimistically and its votes if it commits them atomically.
+func EncodeStateCommit(shard uint64, header *Header, versions *ReadVersions, votes *CrossTxVotes) ([]byte, error) {
+	enc, err := rlp.EncodeToBytes(header)
+	if err != nil {
+		return nil, err
+	}
+	// Votes follow the versions, which are left empty if there are none
+	if versions == nil && votes != nil {
+		versions = new(ReadVersions)
+	}
+	if versions != nil {
+		venc, err := rlp.EncodeToBytes(versions)
+		if err != nil {
+			return nil, err
+		}
+		enc = append(enc, venc...)
+	}
+	if votes != nil {
+		venc, err := rlp.EncodeToBytes(votes)
+		if err != nil {
+			return nil, err
+		}
+		enc = append(enc, venc...)
+	}
+	data := make([]byte, stateCommitLen, stateCommitLen+len(enc))
+	start := copy(data, stateCommitSelector)
+	binary.BigEndian.PutUint64(data[start+24:start+32], shard)
+	start += 32
+	binary.BigEndian.PutUint64(data[start+24:start+32], header.Number.Uint64())
+	start += 32
+	binary.BigEndian.PutUint64(data[start+24:start+32], header.RefNumber.Uint64())
+	start += 32
+	start += copy(data[start:], header.Root.Bytes())
+	copy(data[start:], header.Hash().Bytes())
+	return append(data, enc...), nil
+}
+
+// DecodeStateCommitHeader returns the shard header attesting a state commitment
+// after checking that it is the block being reported.
+func DecodeStateCommitHeader(stx *Transaction) (*Header, error) {
+	data := stx.Data()
+	if len(data) <= stateCommitLen {
+		return nil, ErrMissingAttestation
+	}
+	_, _, rest, err := rlp.Split(data[stateCommitLen:])
+	if err != nil {
+		return nil, err
+	}
+	header := new(Header)
+	if err := rlp.DecodeBytes(data[stateCommitLen:len(data)-len(rest)], header); err != nil {
+		return nil, err
+	}
+	shard, commit, report, root, bHash, err := DecodeStateCommit(stx)
+	if err != nil {
+		return nil, err
+	}
+	if header.Shard != shard || header.Number.Uint64() != commit || header.RefNumber.Uint64() != report {
+		return nil, ErrCommitMismatch
+	}
+	if header.Root != root || header.Hash() != bHash {
+		return nil, ErrCommitMismatch
+	}
+	return header, nil
+}
+
+// ReadVersions are the versions of the read sets of the optimistic cross-shard
+// transactions a shard has prepared, proven against its committed state. The
+// versions are kept in the storage of a registry account, keyed by the local
+// hash of every transaction and offset by one so that zero means unprepared.
+type ReadVersions struct {
+	Txs   []common.Hash // Local hashes of the prepared transactions
+	Proof *KeyVal       `rlp:"nil"` // Registry slots of Txs
+}
+
+// stateCommitTrailer returns the items following the attested header of a
+// state commitment.
+func stateCommitTrailer(stx *Transaction) ([]byte, error) {
+	data := stx.Data()
+	if len(data) <= stateCommitLen {
+		return nil, ErrMissingAttestation
+	}
+	_, _, rest, err := rlp.Split(data[stateCommitLen:])
+	return rest, err
+}
+
+// DecodeStateCommitVersions returns the read versions following the attested
+// header of a state commitment, or nil if it carries none.
+func DecodeStateCommitVersions(stx *Transaction) (*ReadVersions, error) {
+	rest, err := stateCommitTrailer(stx)
+	if err != nil || len(rest) == 0 {
+		return nil, err
+	}
+	_, _, tail, err := rlp.Split(rest)
+	if err != nil {
+		return nil, err
+	}
+	versions := new(ReadVersions)
+	if err := rlp.DecodeBytes(rest[:len(rest)-len(tail)], versions); err != nil {
+		return nil, err
+	}
+	if versions.Proof == nil && len(versions.Txs) == 0 {
+		return nil, nil
+	}
+	return versions, nil
+}
+
+// Verify checks the read versions against the state root of the committed
+// block and returns the version of every listed transaction. Transactions
+// the registry holds no version for are left out.
+func (rv *ReadVersions) Verify(root common.Hash, registry common.Address) (map[common.Hash]uint64, error) {
+	if rv.Proof == nil || rv.Proof.Addr != registry {
+		return nil, ErrVersionRegistry
+	}
+	if err := VerifyKeyVal(root, rv.Txs, rv.Proof); err != nil {
+		return nil, err
+	}
+	versions := make(map[common.Hash]uint64, len(rv.Txs))
+	for i, hash := range rv.Txs {
+		if val := rv.Proof.Data[i].Big(); val.Sign() > 0 && val.IsUint64() {
+			versions[hash] = val.Uint64() - 1
+		}
+	}
+	return versions, nil
+}
+
+// Votes of a shard on an atomic cross-shard transaction, as stored in the
+// registry account of the shard.
+const (
+	VoteCommit = uint64(1) // The shard executed the transaction successfully
+	VoteAbort  = uint64(2) // The execution failed on the shard
+)
+
+// CrossTxVotes are the votes of a shard on the atomic cross-shard transactions
+// it has prepared, proven against its committed state. The votes are kept in
+// the storage of a registry account, keyed by the local hash of every
+// transaction.
+type CrossTxVotes struct {
+	Txs   []common.Hash // Local hashes of the prepared transactions
+	Proof *KeyVal       // Registry slots of Txs
+}
+
+// DecodeStateCommitVotes returns the votes following the read versions of a
+// state commitment, or nil if it carries none.
+func DecodeStateCommitVotes(stx *Transaction) (*CrossTxVotes, error) {
+	rest, err := stateCommitTrailer(stx)
+	if err != nil || len(rest) == 0 {
+		return nil, err
+	}
+	_, _, rest, err = rlp.Split(rest)
+	if err != nil || len(rest) == 0 {
+		return nil, err
+	}
+	votes := new(CrossTxVotes)
+	if err := rlp.DecodeBytes(rest, votes); err != nil {
+		return nil, err
+	}
+	return votes, nil
+}
+
+// Verify checks the votes against the state root of the committed block and
+// returns whether the shard votes to commit every listed transaction.
+// Transactions the registry holds no vote for are left out.
+func (cv *CrossTxVotes) Verify(root common.Hash, registry common.Address) (map[common.Hash]bool, error) {
+	if cv.Proof == nil || cv.Proof.Addr != registry {
+		return nil, ErrVoteRegistry
+	}
+	if err := VerifyKeyVal(root, cv.Txs, cv.Proof); err != nil {
+		return nil, err
+	}
+	votes := make(map[common.Hash]bool, len(cv.Txs))
+	for i, hash := range cv.Txs {
+		if val := cv.Proof.Data[i].Big(); val.IsUint64() {
+			switch val.Uint64() {
+			case VoteCommit:
+				votes[hash] = true
+			case VoteAbort:
+				votes[hash] = false
+			}
+		}
+	}
+	return votes, nil
 }
 
 // Commitment of a particular shard
@@ -848,40 +1302,14 @@ func (cm *Commitments) CommitNum(shard uint64) uint64 {
 	return uint64(0)
 }
 
-// RWLock stores read write locks
+// RWLock guards the cross-shard bookkeeping shared by the chains and the miner
 type RWLock struct {
-	Mu    sync.RWMutex
-	Locks map[common.Address]*CLock
+	Mu sync.RWMutex
 }
 
 // NewRWLock creates new instance of RWLock
 func NewRWLock() *RWLock {
-	return &RWLock{
-		Mu:    sync.RWMutex{},
-		Locks: make(map[common.Address]*CLock),
-	}
-}
-
-// ResetLock cleans existing values
-func (rwl *RWLock) ResetLock() {
-	rwl.Mu.Lock()
-	defer rwl.Mu.Unlock()
-	rwl.Locks = make(map[common.Address]*CLock)
-}
-
-// CLock stores currently locked keys of a contract
-type CLock struct {
-	Addr    common.Address
-	ClockMu sync.RWMutex
-	Keys    map[common.Hash]int
-}
-
-// NewCLock creates a new lock instance for an address
-func NewCLock(addr common.Address) *CLock {
-	return &CLock{
-		Addr: addr,
-		Keys: make(map[common.Hash]int),
-	}
+	return &RWLock{}
 }
 
 // DataCache stores foreign data for one block
@@ -913,39 +1341,57 @@ func NewDataCache(bnum uint64, status bool) *DataCache {
 	}
 }
 
-// AddData adds data corresponding to keys
-func (dc *DataCache) AddData(shard uint64, vals []*KeyVal) {
+// AddData adds data corresponding to keys. Every value must carry a merkle
+// proof against the committed state root of the shard, otherwise none of the
+// values are added.
+func (dc *DataCache) AddData(shard uint64, vals []*KeyVal) error {
 	dc.DataCacheMu.Lock()
 	defer dc.DataCacheMu.Unlock()
-	if !dc.ShardStatus[shard] && len(vals) > 0 {
-		// For each contract in vals
-		for _, values := range vals {
-			caddr := values.Addr
-			cdata := &CData{
-				Addr:    caddr,
-				Nonce:   values.Nonce,
-				Balance: values.Balance,
-				Data:    make(map[common.Hash]common.Hash),
-			}
-
-			data := values.Data // extract the data from values
-			lenData := len(data)
-			keys := dc.Keyval[caddr].Keys
-			// for each key in keys, add the corresponding value in cdata
-			for i := 0; i < lenData; i++ {
-				key := keys[i]
-				val := data[i]
-				cdata.Data[key] = val
-			}
-			dc.Values[caddr] = cdata // add the received values to dc.Values
-			// log.Info("@ds adding data for", "addr", caddr, "len", len(cdata.Data))
+	if dc.ShardStatus[shard] || len(vals) == 0 {
+		return nil
+	}
+	commit := dc.Commits[shard]
+	if commit == nil {
+		return ErrNoCommitment
+	}
+	// Verify the whole response before touching the cache
+	received := make(map[common.Address]*KeyVal)
+	for _, values := range vals {
+		caddr := values.Addr
+		if lshard, ok := dc.AddrToShard[caddr]; !ok || lshard != shard {
+			return ErrUnexpectedData
+		}
+		if err := VerifyKeyVal(commit.StateRoot, dc.Keyval[caddr].Keys, values); err != nil {
+			return err
+		}
+		received[caddr] = values
+	}
+	for caddr, lshard := range dc.AddrToShard {
+		if _, ok := received[caddr]; lshard == shard && !ok {
+			return ErrMissingForeignData
+		}
+	}
+	// For each contract in vals
+	for caddr, values := range received {
+		cdata := &CData{
+			Addr:    caddr,
+			Nonce:   values.Nonce,
+			Balance: values.Balance,
+			Data:    make(map[common.Hash]common.Hash),
 		}
-		dc.ShardStatus[shard] = true
-		dc.Received++
-		if dc.Received == dc.Required {
-			dc.Status = true
+		keys := dc.Keyval[caddr].Keys
+		// for each key in keys, add the corresponding value in cdata
+		for i, key := range keys {
+			cdata.Data[key] = values.Data[i]
 		}
+		dc.Values[caddr] = cdata // add the received values to dc.Values
 	}
+	dc.ShardStatus[shard] = true
+	dc.Received++
+	if dc.Received == dc.Required {
+		dc.Status = true
+	}
+	return nil
 }
 
 // InitKeys adds transaction detail
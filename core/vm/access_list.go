@@ -0,0 +1,110 @@
+// Copyright 2015 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// AccessListTracer is a Tracer recording the accounts and storage keys
+// touched by a call, as needed for the read-write set of a cross-shard
+// transaction. Keys are reported in the order they were first accessed.
+type AccessListTracer struct {
+	accounts []common.Address
+	keys     map[common.Address]*types.CKeys
+	written  map[common.Address]map[common.Hash]bool
+}
+
+// NewAccessListTracer returns a new access list tracer.
+func NewAccessListTracer() *AccessListTracer {
+	return &AccessListTracer{
+		keys:    make(map[common.Address]*types.CKeys),
+		written: make(map[common.Address]map[common.Hash]bool),
+	}
+}
+
+// touch records an account accessed by the call.
+func (t *AccessListTracer) touch(addr common.Address) {
+	if _, ok := PrecompiledContractsByzantium[addr]; ok {
+		return
+	}
+	if _, ok := t.keys[addr]; !ok {
+		t.accounts = append(t.accounts, addr)
+		t.keys[addr] = &types.CKeys{Addr: addr, Keys: []common.Hash{}}
+		t.written[addr] = make(map[common.Hash]bool)
+	}
+}
+
+// access records a storage key accessed by the call.
+func (t *AccessListTracer) access(addr common.Address, key common.Hash, write bool) {
+	t.touch(addr)
+	ck, written := t.keys[addr], t.written[addr]
+	wrote, ok := written[key]
+	if !ok {
+		ck.AddKey(key)
+	}
+	if write && !wrote {
+		ck.WKeys = append(ck.WKeys, key)
+	}
+	written[key] = wrote || write
+}
+
+// CaptureStart records the sender and receiver of the call.
+func (t *AccessListTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	t.touch(from)
+	t.touch(to)
+	return nil
+}
+
+// CaptureState records the accounts and storage keys accessed by op.
+func (t *AccessListTracer) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	switch op {
+	case SLOAD:
+		t.access(contract.Address(), common.BigToHash(stack.peek()), false)
+	case SSTORE:
+		t.access(contract.Address(), common.BigToHash(stack.peek()), true)
+	case BALANCE, EXTCODESIZE, EXTCODECOPY, EXTCODEHASH:
+		t.touch(common.BigToAddress(stack.peek()))
+	case CALL, CALLCODE, DELEGATECALL, STATICCALL:
+		t.touch(common.BigToAddress(stack.Back(1)))
+	}
+	return nil
+}
+
+// CaptureFault implements the Tracer interface.
+func (t *AccessListTracer) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd implements the Tracer interface.
+func (t *AccessListTracer) CaptureEnd(output []byte, gasUsed uint64, time time.Duration, err error) error {
+	return nil
+}
+
+// AccessList returns the keys accessed in every touched account, in the
+// order the accounts were first touched.
+func (t *AccessListTracer) AccessList() []*types.CKeys {
+	list := make([]*types.CKeys, len(t.accounts))
+	for i, addr := range t.accounts {
+		list[i] = t.keys[addr]
+	}
+	return list
+}
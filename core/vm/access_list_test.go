@@ -0,0 +1,66 @@
+// Copyright 2015 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestAccessListCapture(t *testing.T) {
+	var (
+		tracer   = NewAccessListTracer()
+		from     = common.HexToAddress("0x1001")
+		other    = common.HexToAddress("0xaa")
+		contract = NewContract(AccountRef(from), AccountRef(common.HexToAddress("0xcc")), new(big.Int), 0)
+	)
+	capture := func(op OpCode, args ...int64) {
+		stack := newstack()
+		for i := len(args) - 1; i >= 0; i-- {
+			stack.push(big.NewInt(args[i]))
+		}
+		tracer.CaptureState(nil, 0, op, 0, 0, NewMemory(), stack, contract, 0, nil)
+	}
+	tracer.CaptureStart(from, contract.Address(), false, nil, 0, new(big.Int))
+	capture(SLOAD, 1)
+	capture(SSTORE, 2, 5)
+	capture(SLOAD, 2)
+	capture(SSTORE, 1, 5)
+	capture(SSTORE, 1, 6)
+	capture(CALL, 0, 0xaa, 0, 0, 0, 0, 0)
+	capture(STATICCALL, 0, 0x02, 0, 0, 0, 0) // precompile
+
+	list := tracer.AccessList()
+	if len(list) != 3 {
+		t.Fatalf("accounts mismatch: have %d, want 3", len(list))
+	}
+	if list[0].Addr != from || len(list[0].Keys) != 0 {
+		t.Errorf("sender mismatch: %v", list[0])
+	}
+	if list[2].Addr != other || len(list[2].Keys) != 0 {
+		t.Errorf("callee mismatch: %v", list[2])
+	}
+	ck := list[1]
+	if ck.Addr != contract.Address() || len(ck.Keys) != 2 || ck.Keys[0] != common.BigToHash(big.NewInt(1)) || ck.Keys[1] != common.BigToHash(big.NewInt(2)) {
+		t.Fatalf("keys mismatch: %v", ck.Keys)
+	}
+	if len(ck.WKeys) != 2 || ck.WKeys[0] != common.BigToHash(big.NewInt(2)) || ck.WKeys[1] != common.BigToHash(big.NewInt(1)) {
+		t.Errorf("written keys mismatch: %v", ck.WKeys)
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package bls implements BLS signatures over the BLS12-381 curve. Public keys
+// live in G1 and signatures in G2, so signatures of many signers on the same
+// message aggregate into a single one that verifies with one pairing check.
+//
+// Aggregation is only safe against rogue keys if every public key comes with a
+// proof of possession of its secret key, checked with VerifyProof.
+package bls
+
+import (
+	"crypto/rand"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	bls12381 "github.com/kilic/bls12-381"
+)
+
+const (
+	PublicKeyLength = 48 // Length of a compressed G1 public key
+	SignatureLength = 96 // Length of a compressed G2 signature
+)
+
+var (
+	// Domain separation tags of signatures and proofs of possession
+	signatureDomain = []byte("BLS_SIG_BLS12381G2_XMD:SHA-256_SSWU_RO_POP_")
+	proofDomain     = []byte("BLS_POP_BLS12381G2_XMD:SHA-256_SSWU_RO_POP_")
+
+	errInvalidPublicKey = errors.New("invalid BLS public key")
+	errInvalidSignature = errors.New("invalid BLS signature")
+	errEmptyAggregate   = errors.New("nothing to aggregate")
+)
+
+// SecretKey is a BLS secret scalar.
+type SecretKey struct {
+	k *bls12381.Fr
+}
+
+// PublicKey is a BLS public key in G1.
+type PublicKey struct {
+	p *bls12381.PointG1
+}
+
+// GenerateKey creates a random secret key.
+func GenerateKey() (*SecretKey, error) {
+	for {
+		k, err := bls12381.NewFr().Rand(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		if !k.IsZero() {
+			return &SecretKey{k}, nil
+		}
+	}
+}
+
+// DeriveKey deterministically derives a secret key from seed, which has to
+// be secret and carry enough entropy itself.
+func DeriveKey(seed []byte) *SecretKey {
+	digest := crypto.Keccak256(seed)
+	for {
+		k := bls12381.NewFr().FromBytes(digest)
+		if !k.IsZero() {
+			return &SecretKey{k}
+		}
+		digest = crypto.Keccak256(digest)
+	}
+}
+
+// PublicKey returns the public key of sk.
+func (sk *SecretKey) PublicKey() *PublicKey {
+	g1 := bls12381.NewG1()
+	return &PublicKey{g1.MulScalar(g1.New(), g1.One(), sk.k)}
+}
+
+// Sign signs msg, returning a compressed signature.
+func (sk *SecretKey) Sign(msg []byte) []byte {
+	return sk.sign(msg, signatureDomain)
+}
+
+// Prove returns the proof of possession of sk, a signature of its own public
+// key under a separate domain.
+func (sk *SecretKey) Prove() []byte {
+	return sk.sign(sk.PublicKey().Bytes(), proofDomain)
+}
+
+func (sk *SecretKey) sign(msg, domain []byte) []byte {
+	g2 := bls12381.NewG2()
+	h, err := g2.HashToCurve(msg, domain)
+	if err != nil {
+		panic(err) // Only fails on domains longer than 255 bytes
+	}
+	return g2.ToCompressed(g2.MulScalar(h, h, sk.k))
+}
+
+// Bytes returns the compressed encoding of pk.
+func (pk *PublicKey) Bytes() []byte {
+	return bls12381.NewG1().ToCompressed(pk.p)
+}
+
+// UnmarshalPublicKey decodes a compressed public key, rejecting the identity
+// and points outside of the prime order subgroup.
+func UnmarshalPublicKey(data []byte) (*PublicKey, error) {
+	g1 := bls12381.NewG1()
+	p, err := g1.FromCompressed(data)
+	if err != nil || g1.IsZero(p) {
+		return nil, errInvalidPublicKey
+	}
+	return &PublicKey{p}, nil
+}
+
+// unmarshalSignature decodes a compressed signature.
+func unmarshalSignature(g2 *bls12381.G2, sig []byte) (*bls12381.PointG2, error) {
+	p, err := g2.FromCompressed(sig)
+	if err != nil || g2.IsZero(p) {
+		return nil, errInvalidSignature
+	}
+	return p, nil
+}
+
+// Verify checks whether sig is a signature of msg by pk.
+func Verify(pk *PublicKey, msg, sig []byte) bool {
+	return verify(pk.p, msg, sig, signatureDomain)
+}
+
+// VerifyProof checks whether proof shows possession of the secret key of pk.
+func VerifyProof(pk *PublicKey, proof []byte) bool {
+	return verify(pk.p, pk.Bytes(), proof, proofDomain)
+}
+
+// VerifyAggregate checks whether sig aggregates signatures of msg by all of
+// pks. The keys must have had their proofs of possession checked.
+func VerifyAggregate(pks []*PublicKey, msg, sig []byte) bool {
+	if len(pks) == 0 {
+		return false
+	}
+	return verify(AggregatePublicKeys(pks).p, msg, sig, signatureDomain)
+}
+
+// verify checks e(pk, H(msg)) == e(g1, sig).
+func verify(pk *bls12381.PointG1, msg, sig, domain []byte) bool {
+	g2 := bls12381.NewG2()
+	s, err := unmarshalSignature(g2, sig)
+	if err != nil {
+		return false
+	}
+	h, err := g2.HashToCurve(msg, domain)
+	if err != nil {
+		return false
+	}
+	engine := bls12381.NewEngine()
+	engine.AddPair(bls12381.NewG1().New().Set(pk), h)
+	engine.AddPairInv(engine.G1.One(), s)
+	return engine.Check()
+}
+
+// AggregatePublicKeys sums pks into the public key verifying aggregates of
+// their signatures.
+func AggregatePublicKeys(pks []*PublicKey) *PublicKey {
+	g1 := bls12381.NewG1()
+	sum := g1.Zero()
+	for _, pk := range pks {
+		g1.Add(sum, sum, pk.p)
+	}
+	return &PublicKey{sum}
+}
+
+// AggregateSignatures sums compressed signatures into a single one.
+func AggregateSignatures(sigs [][]byte) ([]byte, error) {
+	if len(sigs) == 0 {
+		return nil, errEmptyAggregate
+	}
+	g2 := bls12381.NewG2()
+	sum := g2.Zero()
+	for _, sig := range sigs {
+		s, err := unmarshalSignature(g2, sig)
+		if err != nil {
+			return nil, err
+		}
+		g2.Add(sum, sum, s)
+	}
+	return g2.ToCompressed(sum), nil
+}
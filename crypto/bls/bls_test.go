@@ -0,0 +1,110 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bls
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSignVerify(t *testing.T) {
+	sk, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	pk := sk.PublicKey()
+	msg := []byte("committed seal")
+
+	sig := sk.Sign(msg)
+	if len(sig) != SignatureLength {
+		t.Fatalf("signature length mismatch: have %d, want %d", len(sig), SignatureLength)
+	}
+	if !Verify(pk, msg, sig) {
+		t.Errorf("valid signature rejected")
+	}
+	if Verify(pk, []byte("other message"), sig) {
+		t.Errorf("signature of another message accepted")
+	}
+	other, _ := GenerateKey()
+	if Verify(other.PublicKey(), msg, sig) {
+		t.Errorf("signature accepted for another key")
+	}
+	// Proofs of possession don't double as signatures
+	if !VerifyProof(pk, sk.Prove()) {
+		t.Errorf("valid proof of possession rejected")
+	}
+	if Verify(pk, pk.Bytes(), sk.Prove()) || VerifyProof(pk, sk.Sign(pk.Bytes())) {
+		t.Errorf("signature domains not separated")
+	}
+}
+
+func TestPublicKeyEncoding(t *testing.T) {
+	pk := DeriveKey([]byte("seed")).PublicKey()
+	enc := pk.Bytes()
+	if len(enc) != PublicKeyLength {
+		t.Fatalf("public key length mismatch: have %d, want %d", len(enc), PublicKeyLength)
+	}
+	dec, err := UnmarshalPublicKey(enc)
+	if err != nil {
+		t.Fatalf("failed to decode public key: %v", err)
+	}
+	if !bytes.Equal(dec.Bytes(), enc) {
+		t.Errorf("public key mismatch after round trip")
+	}
+	if !bytes.Equal(DeriveKey([]byte("seed")).PublicKey().Bytes(), enc) {
+		t.Errorf("key derivation not deterministic")
+	}
+	// The identity is not a valid public key
+	infinity := make([]byte, PublicKeyLength)
+	infinity[0] = 0xc0
+	if _, err := UnmarshalPublicKey(infinity); err != errInvalidPublicKey {
+		t.Errorf("identity key: have %v, want %v", err, errInvalidPublicKey)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	msg := []byte("committed seal")
+	var (
+		pks  []*PublicKey
+		sigs [][]byte
+	)
+	for i := 0; i < 4; i++ {
+		sk := DeriveKey([]byte{byte(i)})
+		pks = append(pks, sk.PublicKey())
+		sigs = append(sigs, sk.Sign(msg))
+	}
+	agg, err := AggregateSignatures(sigs)
+	if err != nil {
+		t.Fatalf("failed to aggregate: %v", err)
+	}
+	if !VerifyAggregate(pks, msg, agg) {
+		t.Errorf("valid aggregate rejected")
+	}
+	if VerifyAggregate(pks[:3], msg, agg) {
+		t.Errorf("aggregate accepted for a subset of the signers")
+	}
+	partial, _ := AggregateSignatures(sigs[:3])
+	if VerifyAggregate(pks, msg, partial) {
+		t.Errorf("partial aggregate accepted for all signers")
+	}
+	if VerifyAggregate(nil, msg, agg) {
+		t.Errorf("aggregate accepted without signers")
+	}
+	if _, err := AggregateSignatures([][]byte{sigs[0], make([]byte, SignatureLength)}); err != errInvalidSignature {
+		t.Errorf("malformed signature: have %v, want %v", err, errInvalidSignature)
+	}
+}
@@ -186,6 +186,64 @@ func (b *EthAPIBackend) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscri
 	return b.eth.BlockChain().SubscribeLogsEvent(ch)
 }
 
+// SubscribeCrossShardEvent subscribes to the cross-shard progress made by the
+// local chain and, on shard nodes, by the reference chain it follows.
+func (b *EthAPIBackend) SubscribeCrossShardEvent(ch chan<- core.CrossShardEvent) event.Subscription {
+	subs := []event.Subscription{b.eth.BlockChain().SubscribeCrossShardEvent(ch)}
+	if ref := b.eth.referenceChain(); ref != b.eth.BlockChain() {
+		subs = append(subs, ref.SubscribeCrossShardEvent(ch))
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		for _, sub := range subs {
+			sub.Unsubscribe()
+		}
+		return nil
+	})
+}
+
+// ShardCommitments returns the latest commitment of every shard known after
+// the head of the reference chain.
+func (b *EthAPIBackend) ShardCommitments(ctx context.Context) (map[uint64]*types.Commitment, error) {
+	refchain := b.eth.RefChain()
+	head := refchain.CurrentBlock().NumberU64()
+
+	commits := make(map[uint64]*types.Commitment)
+	for shard := uint64(1); shard < b.eth.NumShard(); shard++ {
+		if commit := refchain.Commitment(shard, head); commit != nil {
+			commits[shard] = commit
+		}
+	}
+	return commits, nil
+}
+
+// CommittedState returns the state of the local shard block number, with the
+// values of the accounts of other shards in foreign written over it.
+func (b *EthAPIBackend) CommittedState(ctx context.Context, number uint64, foreign []*types.CData) (vm.MinimalApiState, *types.Header, error) {
+	header := b.eth.BlockChain().GetHeaderByNumber(number)
+	if header == nil {
+		return nil, nil, errors.New("committed block not found")
+	}
+	publicState, privateState, err := b.eth.BlockChain().StateAt(header.Root)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, cdata := range foreign {
+		publicState.SetNonce(cdata.Addr, cdata.Nonce)
+		publicState.SetBalance(cdata.Addr, new(big.Int).SetUint64(cdata.Balance))
+		for key, val := range cdata.Data {
+			publicState.SetState(cdata.Addr, key, val)
+		}
+	}
+	return EthAPIState{publicState, privateState}, header, nil
+}
+
+// GetStateData fetches keys from the state of shard at root, verified against
+// it, and returns whether each account exists.
+func (b *EthAPIBackend) GetStateData(ctx context.Context, shard uint64, root common.Hash, keys []*types.CKeys) ([]*types.KeyVal, []bool, error) {
+	return b.eth.protocolManager.GetStateData(ctx, shard, root, keys)
+}
+
 func (b *EthAPIBackend) SendTx(ctx context.Context, signedTx *types.Transaction) error {
 	// validation for node need to happen here and cannot be done as a part of
 	// validateTx in tx_pool.go as tx_pool validation will happen in every node
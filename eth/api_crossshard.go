@@ -0,0 +1,110 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// PublicCrossShardAPI provides receipts of cross-shard transactions spanning
+// the reference chain and the shards executing them.
+type PublicCrossShardAPI struct {
+	e *Ethereum
+}
+
+// NewPublicCrossShardAPI creates a new API serving cross-shard receipts.
+func NewPublicCrossShardAPI(e *Ethereum) *PublicCrossShardAPI {
+	return &PublicCrossShardAPI{e}
+}
+
+// CrossShardReceipt links a cross-shard transaction on the reference chain to
+// its executions on the involved shards.
+type CrossShardReceipt struct {
+	RefHash        common.Hash            `json:"refHash"`
+	RefBlockNumber uint64                 `json:"refBlockNumber"`
+	RefBlockHash   common.Hash            `json:"refBlockHash"`
+	LocalHash      *common.Hash           `json:"localHash,omitempty"` // Hash of the call executed by the shards
+	Status         string                 `json:"status"`              // Progress, as reported by shard_crossTxStatus
+	Executions     []*CrossShardExecution `json:"executions"`
+}
+
+// CrossShardExecution is the execution of a cross-shard transaction by one of
+// the involved shards. Only nodes of the shard know the fields of its receipt.
+type CrossShardExecution struct {
+	Shard        uint64           `json:"shard"`
+	BlockNumber  *uint64          `json:"blockNumber,omitempty"`
+	BlockHash    *common.Hash     `json:"blockHash,omitempty"`
+	Status       *uint64          `json:"status,omitempty"`
+	GasUsed      *uint64          `json:"gasUsed,omitempty"`
+	Logs         []*types.Log     `json:"logs,omitempty"`
+	RevertReason string           `json:"revertReason,omitempty"`
+	Commitment   *ShardCommitment `json:"commitment"` // Commitment finalising the execution, if any yet
+}
+
+// GetCrossShardReceipt returns the receipt of a cross-shard transaction, given
+// its reference chain hash or, while it is pending, the hash executed by the
+// shards. It returns nil if the transaction is unknown.
+func (api *PublicCrossShardAPI) GetCrossShardReceipt(hash common.Hash) (*CrossShardReceipt, error) {
+	ref := api.e.referenceChain()
+	status := NewPublicShardAPI(api.e).CrossTxStatus(hash)
+	if status == nil {
+		return nil, nil
+	}
+	receipt := &CrossShardReceipt{
+		RefHash:        status.RefHash,
+		RefBlockNumber: status.RefNum,
+		LocalHash:      status.LocalHash,
+		Status:         status.Status,
+		Executions:     []*CrossShardExecution{},
+	}
+	if header := ref.GetHeaderByNumber(status.RefNum); header != nil {
+		receipt.RefBlockHash = header.Hash()
+	}
+	for _, shard := range status.Shards {
+		if shard == uint64(0) {
+			continue
+		}
+		exec := &CrossShardExecution{Shard: shard}
+		if commit := ref.FinalisingCommitment(shard, status.RefNum); commit != nil {
+			exec.Commitment = newShardCommitment(commit)
+		}
+		if shard == api.e.MyShard() && status.LocalHash != nil {
+			api.fillExecution(exec, *status.LocalHash)
+		}
+		receipt.Executions = append(receipt.Executions, exec)
+	}
+	return receipt, nil
+}
+
+// fillExecution completes exec with the receipt of the local shard's execution
+// of hash, if the shard chain includes it.
+func (api *PublicCrossShardAPI) fillExecution(exec *CrossShardExecution, hash common.Hash) {
+	blockHash, number, index := rawdb.ReadTxLookupEntry(api.e.ChainDb(), hash)
+	if blockHash == (common.Hash{}) {
+		return
+	}
+	receipts := api.e.BlockChain().GetReceiptsByHash(blockHash)
+	if index >= uint64(len(receipts)) {
+		return
+	}
+	receipt := receipts[index]
+	exec.BlockNumber, exec.BlockHash = &number, &blockHash
+	exec.Status, exec.GasUsed = &receipt.Status, &receipt.GasUsed
+	exec.Logs, exec.RevertReason = receipt.Logs, receipt.RevertReason
+}
@@ -0,0 +1,241 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var errUnknownRefBlock = errors.New("unknown reference block")
+
+// PublicShardAPI provides an API to inspect the cross-shard bookkeeping of
+// the node.
+type PublicShardAPI struct {
+	e *Ethereum
+}
+
+// NewPublicShardAPI creates a new API to inspect the cross-shard bookkeeping.
+func NewPublicShardAPI(e *Ethereum) *PublicShardAPI {
+	return &PublicShardAPI{e}
+}
+
+// ShardInfo is the sharding configuration and cross-shard progress of a node.
+type ShardInfo struct {
+	MyShard        uint64               `json:"myShard"`
+	NumShard       uint64               `json:"numShard"`
+	RefNodes       uint64               `json:"refNodes"`
+	RefHead        uint64               `json:"refHead"`        // Latest processed reference block
+	RefHeadersOnly bool                 `json:"refHeadersOnly"` // Whether the reference chain is followed by headers only
+	Peers          map[uint64]int       `json:"peers"`          // Number of connected peers of every shard
+	Commits        []*ShardCommitment   `json:"commits"`        // Latest known commitment of every shard
+	LastCtx        map[uint64]uint64    `json:"lastCtx"`        // Latest reference block with a cross-shard transaction, by shard
+	LastUnlock     map[uint64]uint64    `json:"lastUnlock"`     // Reference block at which the locks of a shard were last released
+	Topology       *types.ShardTopology `json:"topology,omitempty"`
+}
+
+// ShardCommitment is a state commitment of a shard block on the reference chain.
+type ShardCommitment struct {
+	Shard     uint64      `json:"shard"`
+	BlockNum  uint64      `json:"blockNumber"` // Committed shard block
+	RefNum    uint64      `json:"refNumber"`   // Latest reference block processed by the committed block
+	StateRoot common.Hash `json:"stateRoot"`
+	BHash     common.Hash `json:"blockHash"`
+}
+
+func newShardCommitment(commit *types.Commitment) *ShardCommitment {
+	return &ShardCommitment{Shard: commit.Shard, BlockNum: commit.BlockNum, RefNum: commit.RefNum, StateRoot: commit.StateRoot, BHash: commit.BHash}
+}
+
+// Info returns the sharding configuration of the node along with its view of
+// the progress of every shard.
+func (api *PublicShardAPI) Info() *ShardInfo {
+	var (
+		ref   = api.e.referenceChain()
+		head  = ref.CurrentBlock().NumberU64()
+		state = ref.CrossShardState()
+	)
+	info := &ShardInfo{
+		MyShard:        api.e.MyShard(),
+		NumShard:       api.e.NumShard(),
+		RefNodes:       api.e.config.RefNodes,
+		RefHead:        head,
+		RefHeadersOnly: ref.HeadersOnly(),
+		Peers:          make(map[uint64]int),
+		Commits:        []*ShardCommitment{},
+		LastCtx:        make(map[uint64]uint64),
+		LastUnlock:     make(map[uint64]uint64),
+		Topology:       ref.ShardTopology(head),
+	}
+	pm := api.e.protocolManager
+	pm.cousinPeerLock.RLock()
+	for shard, peers := range pm.cousinPeers {
+		info.Peers[shard] = peers.Len()
+	}
+	pm.cousinPeerLock.RUnlock()
+
+	for _, commit := range state.Commits {
+		info.Commits = append(info.Commits, newShardCommitment(commit))
+	}
+	if state.LatestCommit != nil {
+		info.Commits = append(info.Commits, newShardCommitment(state.LatestCommit))
+	}
+	for shard := uint64(1); shard < uint64(len(state.LastCtx)); shard++ {
+		info.LastCtx[shard] = state.LastCtx[shard]
+		info.LastUnlock[shard] = state.LastUnlock[shard]
+	}
+	return info
+}
+
+// refNumber resolves a reference block number, defaulting to the latest one.
+func (api *PublicShardAPI) refNumber(number *rpc.BlockNumber) (uint64, error) {
+	head := api.e.referenceChain().CurrentBlock().NumberU64()
+	if number == nil || *number == rpc.LatestBlockNumber || *number == rpc.PendingBlockNumber {
+		return head, nil
+	}
+	if refNum := uint64(number.Int64()); refNum <= head {
+		return refNum, nil
+	}
+	return 0, errUnknownRefBlock
+}
+
+// GetCommitment returns the latest commitment of shard known after the given
+// reference block, or the latest one if none is specified.
+func (api *PublicShardAPI) GetCommitment(shard uint64, number *rpc.BlockNumber) (*ShardCommitment, error) {
+	refNum, err := api.refNumber(number)
+	if err != nil {
+		return nil, err
+	}
+	commit := api.e.referenceChain().Commitment(shard, refNum)
+	if commit == nil {
+		return nil, nil
+	}
+	return newShardCommitment(commit), nil
+}
+
+// PendingCrossTx is a cross-shard transaction waiting to be executed by the
+// local shard.
+type PendingCrossTx struct {
+	Index     uint64                    `json:"index"` // Position in the reference block
+	RefHash   common.Hash               `json:"refHash"`
+	LocalHash common.Hash               `json:"localHash"`
+	Shards    []uint64                  `json:"shards"`
+	From      common.Address            `json:"from"`
+	To        *common.Address           `json:"to"`
+	Contracts map[uint64][]*types.CKeys `json:"contracts"` // Read-write set of every involved shard
+	Seen      time.Time                 `json:"seen"`      // Time the transaction was parsed from the reference chain
+}
+
+// PendingCrossTxs returns the cross-shard transactions of a reference block
+// still waiting to be executed by the local shard.
+func (api *PublicShardAPI) PendingCrossTxs(number rpc.BlockNumber) ([]*PendingCrossTx, error) {
+	refNum, err := api.refNumber(&number)
+	if err != nil {
+		return nil, err
+	}
+	ctxs := api.e.referenceChain().PendingCrossTxs(refNum)
+	pending := make([]*PendingCrossTx, 0, len(ctxs))
+	for index, ctx := range ctxs {
+		pending = append(pending, &PendingCrossTx{
+			Index:     index,
+			RefHash:   ctx.RefHash,
+			LocalHash: ctx.Tx.Hash(),
+			Shards:    ctx.Shards,
+			From:      ctx.Tx.From(),
+			To:        ctx.Tx.To(),
+			Contracts: ctx.AllContracts,
+			Seen:      ctx.Seen,
+		})
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Index < pending[j].Index })
+	return pending, nil
+}
+
+// DataCacheStatus is the progress of collecting the foreign data needed by the
+// cross-shard transactions of a reference block.
+type DataCacheStatus struct {
+	RefNum    uint64                    `json:"refNum"`
+	Ready     bool                      `json:"ready"`
+	Required  int                       `json:"required"`  // Number of foreign shards data is needed from
+	Received  int                       `json:"received"`  // Number of foreign shards data arrived from
+	Shards    map[uint64]bool           `json:"shards"`    // Whether the data of every involved shard is complete
+	Contracts map[common.Address]uint64 `json:"contracts"` // Shard of every contract whose data is needed
+}
+
+// DataCacheStatus returns the progress of collecting foreign data for the
+// cross-shard transactions of a reference block, or nil if the block did not
+// need any.
+func (api *PublicShardAPI) DataCacheStatus(number rpc.BlockNumber) (*DataCacheStatus, error) {
+	refNum, err := api.refNumber(&number)
+	if err != nil {
+		return nil, err
+	}
+	dc, _ := api.e.referenceChain().Dc(refNum)
+	if dc == nil {
+		return nil, nil
+	}
+	dc.DataCacheMu.RLock()
+	defer dc.DataCacheMu.RUnlock()
+
+	status := &DataCacheStatus{
+		RefNum:    dc.RefNum,
+		Ready:     dc.Status,
+		Required:  dc.Required,
+		Received:  dc.Received,
+		Shards:    make(map[uint64]bool, len(dc.ShardStatus)),
+		Contracts: make(map[common.Address]uint64, len(dc.AddrToShard)),
+	}
+	for shard, done := range dc.ShardStatus {
+		status.Shards[shard] = done
+	}
+	for addr, shard := range dc.AddrToShard {
+		status.Contracts[addr] = shard
+	}
+	return status, nil
+}
+
+// LockedKeys returns the keys of a contract of shard locked by cross-shard
+// transactions, mapped to the number of readers holding them or -1 for write
+// locks.
+func (api *PublicShardAPI) LockedKeys(shard uint64, addr common.Address) map[common.Hash]int {
+	return api.e.referenceChain().LockedKeys(shard, addr)
+}
+
+// CrossTxStatus returns how far a cross-shard transaction has progressed. It
+// is looked up by its reference chain hash or, while it is still pending, by
+// the hash of the call executed by the shards.
+func (api *PublicShardAPI) CrossTxStatus(hash common.Hash) *core.CrossTxStatus {
+	status := api.e.referenceChain().CrossTxStatus(hash)
+	if status == nil || status.LocalHash == nil || api.e.MyShard() == uint64(0) {
+		return status
+	}
+	switch status.Status {
+	case core.CrossTxRejected, core.CrossTxAborted:
+	default:
+		if blockHash, _, _ := rawdb.ReadTxLookupEntry(api.e.ChainDb(), *status.LocalHash); blockHash != (common.Hash{}) {
+			status.Status = core.CrossTxExecuted
+		}
+	}
+	return status
+}
@@ -0,0 +1,178 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// newTestShardNode creates a shard 1 node out of 3 shards whose reference
+// chain holds the given cross-shard transactions pending at its genesis, after
+// which shard 1 committed block 3 and shard 2 block 5.
+func newTestShardNode(t *testing.T, ctxs ...*types.CrossTx) (*Ethereum, map[uint64]*types.DataCache) {
+	var (
+		refDb       = ethdb.NewMemDatabase()
+		chainDb     = ethdb.NewMemDatabase()
+		gspec       = &core.Genesis{Config: params.TestChainConfig}
+		commitments = make(map[uint64]*types.Commitments)
+		pending     = make(map[uint64]types.CrossShardTxs)
+		foreignData = make(map[uint64]*types.DataCache)
+		latest      = &types.Commitment{Shard: 1}
+		lastCommit  = make(map[uint64]*types.Commitment)
+		lastCtx     = make(map[uint64]uint64)
+	)
+	genesis := gspec.MustCommit(refDb)
+	rawdb.WriteCrossShardCheckpoint(refDb, genesis.Hash(), 0, &rawdb.CrossShardCheckpoint{
+		Commits:      []*types.Commitment{{Shard: 2, BlockNum: 5}},
+		LatestCommit: &types.Commitment{Shard: 1, BlockNum: 3},
+	})
+	refchain, err := core.NewBlockChain(refDb, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, true, 1, 3, commitments, pending, latest, foreignData, sync.RWMutex{}, types.NewRWLock(), lastCommit, lastCtx)
+	if err != nil {
+		t.Fatalf("failed to create reference chain: %v", err)
+	}
+	pending[0] = types.NewCrossShardTxs()
+	for i, ctx := range ctxs {
+		pending[0].AddTransaction(uint64(i), ctx)
+	}
+	e := &Ethereum{
+		config:          &Config{RefNodes: 4},
+		myShard:         1,
+		numShard:        3,
+		refchain:        refchain,
+		chainDb:         chainDb,
+		protocolManager: &ProtocolManager{cousinPeers: map[uint64]*peerSet{0: newPeerSet(), 2: newPeerSet()}},
+	}
+	return e, foreignData
+}
+
+// pendingCrossTx creates a cross-shard transaction of shards 1 and 2 accepted
+// in reference block 0, writing key of addr on shard 1.
+func pendingCrossTx(nonce uint64, addr common.Address, key common.Hash) *types.CrossTx {
+	tx := types.NewCrossTransaction(types.CrossShardLocal, nonce, 1, addr, common.Address{0x0f}, big.NewInt(0), 100000, big.NewInt(1), nil)
+	return &types.CrossTx{
+		Shards:       []uint64{1, 2},
+		BlockNum:     big.NewInt(0),
+		Tx:           tx,
+		RefHash:      common.BigToHash(new(big.Int).SetUint64(nonce + 1)),
+		AllContracts: map[uint64][]*types.CKeys{1: {{Addr: addr, Keys: []common.Hash{key}, WKeys: []common.Hash{key}}}},
+	}
+}
+
+func TestShardAPI(t *testing.T) {
+	var (
+		addr = common.Address{0x0c}
+		key  = common.HexToHash("0x0a")
+	)
+	first, second := pendingCrossTx(0, addr, key), pendingCrossTx(1, addr, key)
+	e, foreignData := newTestShardNode(t, first, second)
+	api := NewPublicShardAPI(e)
+
+	// The node reports its shard and the peers of every other shard
+	info := api.Info()
+	if info.MyShard != 1 || info.NumShard != 3 || info.RefNodes != 4 || info.RefHead != 0 {
+		t.Errorf("info mismatch: %+v", info)
+	}
+	if len(info.Peers) != 2 || info.Peers[2] != 0 {
+		t.Errorf("peer counts mismatch: %v", info.Peers)
+	}
+	// Commitments are looked up in the checkpoint of the reference block
+	for shard, want := range map[uint64]uint64{1: 3, 2: 5} {
+		if commit, err := api.GetCommitment(shard, nil); err != nil || commit == nil || commit.Shard != shard || commit.BlockNum != want {
+			t.Errorf("commitment of shard %d mismatch: have %+v, %v", shard, commit, err)
+		}
+	}
+	if commit, err := api.GetCommitment(0, nil); commit != nil || err != nil {
+		t.Errorf("commitment of the reference shard: have %+v, %v", commit, err)
+	}
+	// Only known reference blocks are looked up
+	future := rpc.BlockNumber(1)
+	if _, err := api.GetCommitment(2, &future); err != errUnknownRefBlock {
+		t.Errorf("commitment of a future block: have %v, want %v", err, errUnknownRefBlock)
+	}
+	if _, err := api.PendingCrossTxs(future); err != errUnknownRefBlock {
+		t.Errorf("pending transactions of a future block: have %v, want %v", err, errUnknownRefBlock)
+	}
+	// Pending transactions are listed in the order of the reference block
+	pending, err := api.PendingCrossTxs(rpc.LatestBlockNumber)
+	if err != nil {
+		t.Fatalf("failed to list pending transactions: %v", err)
+	}
+	if len(pending) != 2 {
+		t.Fatalf("pending transaction count mismatch: have %d, want 2", len(pending))
+	}
+	for i, ctx := range []*types.CrossTx{first, second} {
+		if have := pending[i]; have.Index != uint64(i) || have.RefHash != ctx.RefHash || have.LocalHash != ctx.Tx.Hash() || have.From != ctx.Tx.From() || *have.To != addr {
+			t.Errorf("pending transaction %d mismatch: %+v", i, have)
+		}
+	}
+	// Blocks report the progress of collecting their foreign data
+	if status, err := api.DataCacheStatus(rpc.LatestBlockNumber); err != nil || status == nil || !status.Ready || status.Required != 0 {
+		t.Errorf("data cache of the genesis block mismatch: have %+v, %v", status, err)
+	}
+	dc := types.NewDataCache(0, false)
+	dc.Required, dc.ShardStatus[2], dc.AddrToShard[addr] = 1, false, 2
+	foreignData[0] = dc
+	status, err := api.DataCacheStatus(rpc.LatestBlockNumber)
+	if err != nil {
+		t.Fatalf("failed to report data cache: %v", err)
+	}
+	if status.Ready || status.Required != 1 || status.Received != 0 || len(status.Shards) != 1 || status.Contracts[addr] != 2 {
+		t.Errorf("data cache mismatch: %+v", status)
+	}
+	// Locks are reported by shard
+	e.refchain.LockManager().Acquire(first.RefHash, 0, first.AllContracts)
+	if keys := api.LockedKeys(1, addr); len(keys) != 1 || keys[key] != -1 {
+		t.Errorf("locked keys mismatch: %v", keys)
+	}
+	if keys := api.LockedKeys(2, addr); len(keys) != 0 {
+		t.Errorf("locks reported for a foreign shard: %v", keys)
+	}
+	// Pending transactions are found by either hash until executed locally
+	for _, hash := range []common.Hash{first.RefHash, first.Tx.Hash()} {
+		status := api.CrossTxStatus(hash)
+		if status == nil || status.RefHash != first.RefHash || *status.LocalHash != first.Tx.Hash() || status.Status != core.CrossTxPending {
+			t.Errorf("status of %x mismatch: %+v", hash, status)
+		}
+	}
+	dc.Status = true
+	if status := api.CrossTxStatus(first.RefHash); status == nil || status.Status != core.CrossTxReady {
+		t.Errorf("status with complete foreign data mismatch: %+v", status)
+	}
+	block := types.NewBlock(&types.Header{Number: big.NewInt(1)}, types.Transactions{first.Tx}, nil, nil)
+	rawdb.WriteTxLookupEntries(e.chainDb, block)
+	if status := api.CrossTxStatus(first.RefHash); status == nil || status.Status != core.CrossTxExecuted {
+		t.Errorf("status of executed transaction mismatch: %+v", status)
+	}
+	if status := api.CrossTxStatus(second.RefHash); status == nil || status.Status != core.CrossTxReady {
+		t.Errorf("status of unexecuted transaction mismatch: %+v", status)
+	}
+	if status := api.CrossTxStatus(common.HexToHash("0xff")); status != nil {
+		t.Errorf("status of unknown transaction: %+v", status)
+	}
+}
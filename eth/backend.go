@@ -46,9 +46,11 @@ import (
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics/eventlog"
 	"github.com/ethereum/go-ethereum/miner"
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enr"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
@@ -78,8 +80,6 @@ type Ethereum struct {
 
 	gLocked *types.RWLock
 
-	lockedAddrMap map[uint64]map[common.Address]bool // to store locked address of each shard
-
 	lastCommit map[uint64]*types.Commitment // To store the last rs block that includes a commit
 	lastCtx    map[uint64]uint64            // to store whether a shard is touched by a ctx or not
 
@@ -113,15 +113,22 @@ type Ethereum struct {
 	gasPrice  *big.Int
 	etherbase common.Address
 
-	logdir        string
 	networkID     uint64
 	myShard       uint64
 	numShard      uint64
+	shardOrigin   uint64 // Shard the node was first started in, whose chain is kept in chaindata
+	shardFile     string // File persisting the shard the validator was moved to
 	netRPCService *ethapi.PublicNetAPI
 
+	shardSwitchFeed event.Feed // Announces that the local validator moved to another shard
+
 	lock sync.RWMutex // Protects the variadic fields (e.g. gas price and etherbase)
 }
 
+// ShardSwitchEvent is posted when the reference chain moved the local validator
+// to another shard. The services have to be restarted to join that shard.
+type ShardSwitchEvent struct{ Shard uint64 }
+
 // HACK(joel) this was added just to make the eth chain config visible to RegisterRaftService
 func (s *Ethereum) ChainConfig() *params.ChainConfig {
 	return s.chainConfig
@@ -146,8 +153,25 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 		log.Warn("Sanitizing invalid miner gas price", "provided", config.MinerGasPrice, "updated", DefaultConfig.MinerGasPrice)
 		config.MinerGasPrice = new(big.Int).Set(DefaultConfig.MinerGasPrice)
 	}
+	// Resume in the shard the reference chain moved the local validator to
+	shardFile := ctx.ResolvePath(shardStateFile)
+	moved, err := readShardState(shardFile)
+	if err != nil {
+		return nil, err
+	}
+	shardOrigin := config.MyShard
+	if moved != nil {
+		if moved.Shard != config.MyShard {
+			log.Warn("Resuming in shard the validator was moved to", "configured", config.MyShard, "shard", moved.Shard)
+		}
+		shardOrigin, config.MyShard, config.ShardDatabase = moved.Origin, moved.Shard, moved.Database
+	}
 	// Assemble the Ethereum object
-	chainDb, err := CreateDB(ctx, config, "chaindata")
+	chainData := "chaindata"
+	if config.ShardDatabase != "" {
+		chainData = config.ShardDatabase
+	}
+	chainDb, err := CreateDB(ctx, config, chainData)
 	refDb, rerr := CreateDB(ctx, config, "lightchaindata")
 	if err != nil {
 		return nil, err
@@ -183,6 +207,11 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 		core.WriteQuorumEIP155Activation(refDb)
 	}
 
+	shards, err := shardTopology(chainConfig, config, chainDb, genesisHash)
+	if err != nil {
+		return nil, fmt.Errorf("invalid shard topology: %v", err)
+	}
+
 	eth := &Ethereum{
 		config:          config,
 		chainDb:         chainDb,
@@ -191,10 +220,12 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 		eventMux:        ctx.EventMux,
 		rEventMux:       ctx.REventMux,
 		accountManager:  ctx.AccountManager,
-		engine:          CreateConsensusEngine(ctx, chainConfig, config, config.MyShard, config.NumShard, config.RefNodes, config.MinerNotify, config.MinerNoverify, chainDb, refDb),
+		engine:          CreateConsensusEngine(ctx, chainConfig, config, config.MyShard, config.NumShard, shards, config.MinerNotify, config.MinerNoverify, chainDb, refDb),
 		shutdownChan:    make(chan bool),
 		numShard:        config.NumShard,
 		myShard:         config.MyShard,
+		shardOrigin:     shardOrigin,
+		shardFile:       shardFile,
 		networkID:       config.NetworkId,
 		gasPrice:        config.MinerGasPrice,
 		etherbase:       config.Etherbase,
@@ -209,7 +240,6 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 		gLocked:         types.NewRWLock(),
 		lastCtx:         make(map[uint64]uint64),
 		lastCommit:      make(map[uint64]*types.Commitment),
-		lockedAddrMap:   make(map[uint64]map[common.Address]bool),
 		foreignDataMu:   sync.RWMutex{},
 	}
 
@@ -227,8 +257,13 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 		eth.shardAddMap[i] = addr
 		log.Info("Address created for ", "shard", i, "address", common.BigToAddress(addr))
 	}
-	// eth.logdir = "/Users/sourav/rc/log/"
-	eth.logdir = "/home/ubuntu/rc/"
+	if config.EventLogDir != "" {
+		dir := ctx.ResolvePath(config.EventLogDir)
+		if err := eventlog.Setup(dir, config.EventLogLimit); err != nil {
+			return nil, err
+		}
+		log.Info("Recording cross-shard events", "dir", dir)
+	}
 
 	eth.myLatestCommit = &types.Commitment{Shard: config.MyShard, BlockNum: uint64(0), RefNum: uint64(0)} // Latest committed block
 	// force to set the istanbul etherbase to node key address
@@ -251,10 +286,11 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 			EWASMInterpreter:        config.EWASMInterpreter,
 			EVMInterpreter:          config.EVMInterpreter,
 		}
-		cacheConfig = &core.CacheConfig{Disabled: config.NoPruning, TrieNodeLimit: config.TrieCache, TrieTimeLimit: config.TrieTimeout}
+		cacheConfig    = &core.CacheConfig{Disabled: config.NoPruning, TrieNodeLimit: config.TrieCache, TrieTimeLimit: config.TrieTimeout}
+		refCacheConfig = &core.CacheConfig{Disabled: config.NoPruning, TrieNodeLimit: config.TrieCache, TrieTimeLimit: config.TrieTimeout, HeadersOnly: config.RefHeadersOnly}
 	)
-	eth.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, eth.chainConfig, eth.engine, vmConfig, eth.shouldPreserve, false, config.MyShard, config.NumShard, eth.commitments, eth.pendingCrossTxs, eth.myLatestCommit, eth.foreignData, eth.foreignDataMu, eth.gLocked, eth.lastCommit, eth.lastCtx, eth.lockedAddrMap, eth.logdir)
-	eth.refchain, rerr = core.NewBlockChain(refDb, cacheConfig, eth.chainConfig, eth.engine, vmConfig, eth.shouldPreserve, true, config.MyShard, config.NumShard, eth.commitments, eth.pendingCrossTxs, eth.myLatestCommit, eth.foreignData, eth.foreignDataMu, eth.gLocked, eth.lastCommit, eth.lastCtx, eth.lockedAddrMap, eth.logdir)
+	eth.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, eth.chainConfig, eth.engine, vmConfig, eth.shouldPreserve, false, config.MyShard, config.NumShard, eth.commitments, eth.pendingCrossTxs, eth.myLatestCommit, eth.foreignData, eth.foreignDataMu, eth.gLocked, eth.lastCommit, eth.lastCtx)
+	eth.refchain, rerr = core.NewBlockChain(refDb, refCacheConfig, eth.chainConfig, eth.engine, vmConfig, eth.shouldPreserve, true, config.MyShard, config.NumShard, eth.commitments, eth.pendingCrossTxs, eth.myLatestCommit, eth.foreignData, eth.foreignDataMu, eth.gLocked, eth.lastCommit, eth.lastCtx)
 	if err != nil {
 		return nil, err
 	}
@@ -264,6 +300,9 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 		eth.blockchain.SetHead(compat.RewindTo)
 		rawdb.WriteChainConfig(chainDb, genesisHash, chainConfig)
 	}
+	if shards != nil {
+		eth.referenceChain().SetShardTopology(shards)
+	}
 	eth.bloomIndexer.Start(eth.blockchain)
 	eth.refIndexer.Start(eth.refchain)
 
@@ -272,11 +311,17 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 	}
 	eth.txPool = core.NewTxPool(config.TxPool, eth.chainConfig, eth.refAddress, eth.myShard, eth.shardAddMap, eth.blockchain)
 
-	if eth.protocolManager, err = NewProtocolManager(eth.chainConfig, config.SyncMode, config.NumShard, config.MyShard, config.NetworkId, eth.eventMux, eth.rEventMux, eth.txPool, eth.engine, eth.blockchain, eth.refchain, eth.refAddress, eth.shardAddMap, chainDb, refDb, config.RaftMode, eth.logdir); err != nil {
+	if eth.protocolManager, err = NewProtocolManager(eth.chainConfig, config.SyncMode, config.NumShard, config.MyShard, config.NetworkId, eth.eventMux, eth.rEventMux, eth.txPool, eth.engine, eth.blockchain, eth.refchain, eth.refAddress, eth.shardAddMap, chainDb, refDb, config.RaftMode); err != nil {
 		return nil, err
 	}
+	// Advertise the shard in the node record, so that peers found through
+	// discovery can tell which shard this node serves.
+	entry := eth.shardRecord()
+	for i := range eth.protocolManager.SubProtocols {
+		eth.protocolManager.SubProtocols[i].Attributes = []enr.Entry{entry}
+	}
 
-	eth.miner = miner.New(eth, eth.chainConfig, eth.EventMux(), eth.engine, config.MinerRecommit, config.MinerGasFloor, config.MinerGasCeil, eth.isLocalBlock, eth.commitments, eth.gLocked, eth.lastCommit, eth.lastCtx, eth.shardAddMap, eth.lockedAddrMap, eth.logdir)
+	eth.miner = miner.New(eth, eth.chainConfig, eth.EventMux(), eth.engine, config.MinerRecommit, config.MinerGasFloor, config.MinerGasCeil, eth.isLocalBlock, eth.commitments, eth.gLocked, eth.lastCommit, eth.lastCtx, eth.shardAddMap)
 	eth.miner.SetExtra(makeExtraData(config.MinerExtraData, eth.chainConfig.IsQuorum))
 
 	hexNodeId := fmt.Sprintf("%x", crypto.FromECDSAPub(&ctx.NodeKey().PublicKey)[1:]) // Quorum
@@ -319,8 +364,29 @@ func CreateDB(ctx *node.ServiceContext, config *Config, name string) (ethdb.Data
 	return db, nil
 }
 
+// shardTopology resolves the validators of every shard from the genesis block
+// and checks them against the configured shard layout. Chains that are not
+// sealed by Istanbul have no topology.
+func shardTopology(chainConfig *params.ChainConfig, config *Config, db ethdb.Database, genesisHash common.Hash) (map[uint64][]common.Address, error) {
+	if config.MyShard >= config.NumShard {
+		return nil, fmt.Errorf("%v: shard %d of %d", params.ErrInvalidMyShard, config.MyShard, config.NumShard)
+	}
+	if chainConfig.Istanbul == nil {
+		return nil, nil
+	}
+	genesis := rawdb.ReadHeader(db, genesisHash, 0)
+	if genesis == nil {
+		return nil, errors.New("missing genesis header")
+	}
+	extra, err := types.ExtractIstanbulExtra(genesis)
+	if err != nil {
+		return nil, err
+	}
+	return chainConfig.Istanbul.ShardTopology(config.NumShard, config.RefNodes, extra.Validators)
+}
+
 // CreateConsensusEngine creates the required type of consensus engine instance for an Ethereum service
-func CreateConsensusEngine(ctx *node.ServiceContext, chainConfig *params.ChainConfig, config *Config, myShard, numShard, refNodes uint64, notify []string, noverify bool, db, refdb ethdb.Database) consensus.Engine {
+func CreateConsensusEngine(ctx *node.ServiceContext, chainConfig *params.ChainConfig, config *Config, myShard, numShard uint64, shards map[uint64][]common.Address, notify []string, noverify bool, db, refdb ethdb.Database) consensus.Engine {
 	// If proof-of-authority is requested, set it up
 	if chainConfig.Clique != nil {
 		return clique.New(chainConfig.Clique, db)
@@ -332,8 +398,19 @@ func CreateConsensusEngine(ctx *node.ServiceContext, chainConfig *params.ChainCo
 		}
 		config.Istanbul.ProposerPolicy = istanbul.ProposerPolicy(chainConfig.Istanbul.ProposerPolicy)
 		config.Istanbul.Ceil2Nby3Block = chainConfig.Istanbul.Ceil2Nby3Block
+		config.Istanbul.ShardConsensus = make(map[uint64]istanbul.ShardConsensus)
+		for shard, mode := range chainConfig.Istanbul.ShardConsensus {
+			config.Istanbul.ShardConsensus[shard] = istanbul.ShardConsensus(mode)
+		}
+		config.Istanbul.ShardConsensusBlock = chainConfig.Istanbul.ShardConsensusBlock
+		config.Istanbul.BLSBlock = chainConfig.Istanbul.BLSBlock
+		config.Istanbul.BLSKeys = chainConfig.Istanbul.BLSKeys
+		if chainConfig.Istanbul.ReputationWindow != 0 {
+			config.Istanbul.ReputationWindow = chainConfig.Istanbul.ReputationWindow
+		}
+		config.Istanbul.Weights = chainConfig.Istanbul.Weights
 
-		return istanbulBackend.New(&config.Istanbul, ctx.NodeKey(), myShard, numShard, refNodes, db, refdb)
+		return istanbulBackend.New(&config.Istanbul, ctx.NodeKey(), myShard, numShard, shards, db, refdb)
 	}
 
 	// Otherwise assume proof-of-work
@@ -371,6 +448,11 @@ func (s *Ethereum) APIs() []rpc.API {
 			Version:   "1.0",
 			Service:   NewPublicEthereumAPI(s),
 			Public:    true,
+		}, {
+			Namespace: "eth",
+			Version:   "1.0",
+			Service:   NewPublicCrossShardAPI(s),
+			Public:    true,
 		}, {
 			Namespace: "eth",
 			Version:   "1.0",
@@ -409,6 +491,11 @@ func (s *Ethereum) APIs() []rpc.API {
 			Version:   "1.0",
 			Service:   s.netRPCService,
 			Public:    true,
+		}, {
+			Namespace: "shard",
+			Version:   "1.0",
+			Service:   NewPublicShardAPI(s),
+			Public:    true,
 		},
 	}...)
 	return apis
@@ -595,12 +682,107 @@ func (s *Ethereum) Protocols() []p2p.Protocol {
 	return append(s.protocolManager.SubProtocols, s.lesServer.Protocols()...)
 }
 
+// shardRecord returns the node record entry of the local shard. Nodes validate
+// the reference chain if the reference head assigns their etherbase to it.
+func (s *Ethereum) shardRecord() enr.Shard {
+	entry := enr.Shard{ID: s.myShard}
+	if s.chainConfig.Istanbul == nil {
+		return entry
+	}
+	ref := s.referenceChain()
+	if topology := ref.ShardTopology(ref.CurrentBlock().NumberU64()); topology != nil {
+		shard, ok := topology.ShardOf(s.etherbase)
+		entry.RefValidator = ok && shard == 0
+	}
+	return entry
+}
+
+// referenceChain returns the chain holding the reference blocks, which is the
+// local chain itself on reference nodes.
+func (s *Ethereum) referenceChain() *core.BlockChain {
+	if s.myShard == uint64(0) {
+		return s.blockchain
+	}
+	return s.refchain
+}
+
+// SubscribeShardSwitchEvent registers a subscription of ShardSwitchEvent.
+func (s *Ethereum) SubscribeShardSwitchEvent(ch chan<- ShardSwitchEvent) event.Subscription {
+	return s.shardSwitchFeed.Subscribe(ch)
+}
+
+// PendingShardSwitch returns the shard the local validator moved to, and whether
+// the services still run in the old one.
+func (s *Ethereum) PendingShardSwitch() (uint64, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.config.MyShard, s.config.MyShard != s.myShard
+}
+
+// shardTopologyLoop hands the validator reassignments of the reference chain
+// to the consensus engine until the reference chain is stopped.
+func (s *Ethereum) shardTopologyLoop() {
+	topologyCh := make(chan core.ShardTopologyEvent, 1)
+	topologySub := s.referenceChain().SubscribeShardTopologyEvent(topologyCh)
+	defer topologySub.Unsubscribe()
+
+	// Catch up with reassignments that took effect while the node was down
+	head := s.referenceChain().CurrentBlock().NumberU64()
+	if topology := s.referenceChain().ShardTopology(head); topology != nil {
+		s.applyShardTopology(head, topology.Map())
+	}
+	for {
+		select {
+		case ev := <-topologyCh:
+			s.applyShardTopology(ev.Number, ev.Shards)
+		case <-topologySub.Err():
+			return
+		}
+	}
+}
+
+// applyShardTopology updates the validators of every shard known to the
+// consensus engine. If the local validator was moved, the move is persisted
+// in the instance directory, so that the next start of the service joins its
+// new shard, and announced.
+func (s *Ethereum) applyShardTopology(number uint64, shards map[uint64][]common.Address) {
+	if istanbul, ok := s.engine.(consensus.Istanbul); ok {
+		istanbul.SetShards(shards)
+	}
+	s.lock.RLock()
+	etherbase := s.etherbase
+	s.lock.RUnlock()
+
+	for shard, validators := range shards {
+		for _, validator := range validators {
+			if validator != etherbase || shard == s.myShard {
+				continue
+			}
+			log.Warn("Local validator moved to another shard", "number", number, "shard", s.myShard, "new", shard)
+			state := newShardState(s.shardOrigin, shard)
+			if err := writeShardState(s.shardFile, state); err != nil {
+				log.Error("Failed to persist shard switch", "shard", shard, "err", err)
+			}
+			s.lock.Lock()
+			s.config.MyShard, s.config.ShardDatabase = state.Shard, state.Database
+			s.lock.Unlock()
+			s.shardSwitchFeed.Send(ShardSwitchEvent{Shard: shard})
+			return
+		}
+	}
+}
+
 // Start implements node.Service, starting all internal goroutines needed by the
 // Ethereum protocol implementation.
 func (s *Ethereum) Start(srvr *p2p.Server) error {
 	// Start the bloom bits servicing goroutines
 	s.startBloomHandlers(params.BloomBitsBlocks)
 
+	// Follow the validator reassignments voted on the reference chain
+	if _, ok := s.engine.(consensus.Istanbul); ok {
+		go s.shardTopologyLoop()
+	}
+
 	// Start the RPC service
 	s.netRPCService = ethapi.NewPublicNetAPI(srvr, s.NetVersion())
 
@@ -624,7 +806,9 @@ func (s *Ethereum) Start(srvr *p2p.Server) error {
 // Ethereum protocol.
 func (s *Ethereum) Stop() error {
 	s.bloomIndexer.Close()
+	s.refIndexer.Close()
 	s.blockchain.Stop()
+	s.refchain.Stop()
 	s.engine.Close()
 	s.protocolManager.Stop()
 	if s.lesServer != nil {
@@ -636,6 +820,7 @@ func (s *Ethereum) Stop() error {
 	s.rEventMux.Stop()
 
 	s.chainDb.Close()
+	s.refDb.Close()
 	close(s.shutdownChan)
 	return nil
 }
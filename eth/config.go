@@ -95,13 +95,21 @@ type Config struct {
 	SyncMode  downloader.SyncMode
 	NoPruning bool
 
+	// Follow the reference chain by headers and cross-shard receipt proofs (shard nodes only)
+	RefHeadersOnly bool `toml:",omitempty"`
+
+	// Cross-shard event log options
+	EventLogDir   string `toml:",omitempty"` // Directory of the JSON-lines event log (empty = disabled)
+	EventLogLimit uint   `toml:",omitempty"` // Size in bytes after which event files are rotated
+
 	// Light client options
 	LightServ  int `toml:",omitempty"` // Maximum percentage of time allowed for serving LES requests
 	LightPeers int `toml:",omitempty"` // Maximum number of LES client peers
 
 	// Database options
-	SkipBcVersionCheck bool `toml:"-"`
-	DatabaseHandles    int  `toml:"-"`
+	SkipBcVersionCheck bool   `toml:"-"`
+	DatabaseHandles    int    `toml:"-"`
+	ShardDatabase      string `toml:"-"` // Database of the shard chain once the node moved shards (empty = chaindata), restored from the instance directory
 	DatabaseCache      int
 	TrieCache          int
 	TrieTimeout        time.Duration
@@ -33,6 +33,7 @@ import (
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/params"
 )
 
@@ -318,7 +319,7 @@ func (d *Downloader) GetShardID(id string) uint64 {
 			}
 		}
 	}
-	return 4096
+	return p2p.UnknownShard
 }
 
 // UnregisterPeer remove a peer from the known list, preventing any action from
@@ -28,6 +28,7 @@ import (
 	ethereum "github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
@@ -271,6 +272,97 @@ func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc
 	return rpcSub, nil
 }
 
+// CrossShardCriteria selects the cross-shard progress events to subscribe to.
+// Empty fields match every event.
+type CrossShardCriteria struct {
+	Kinds  []string      `json:"kinds"`  // Progress kinds, e.g. "accepted", "ready", "executed" or "stateCommitted"
+	Hashes []common.Hash `json:"hashes"` // Reference chain or local hashes of cross-shard transactions
+	Shards []uint64      `json:"shards"` // Shards making the progress or involved in the transaction
+}
+
+// matches returns whether ev is selected by the criteria.
+func (crit *CrossShardCriteria) matches(ev *core.CrossShardEvent) bool {
+	if crit == nil {
+		return true
+	}
+	if len(crit.Kinds) > 0 {
+		found := false
+		for _, kind := range crit.Kinds {
+			if kind == ev.Kind {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(crit.Hashes) > 0 {
+		found := false
+		for _, hash := range crit.Hashes {
+			if hash == ev.RefHash || (ev.LocalHash != nil && hash == *ev.LocalHash) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(crit.Shards) > 0 {
+		found := false
+		for _, shard := range crit.Shards {
+			if shard == ev.Shard {
+				found = true
+			}
+			for _, involved := range ev.Shards {
+				if shard == involved {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// CrossShard creates a subscription that fires when a cross-shard transaction
+// is accepted on the reference chain, has its foreign data complete on a
+// shard, is executed by a shard or aborted, and when the state commitment of
+// a shard lands on the reference chain.
+func (api *PublicFilterAPI) CrossShard(ctx context.Context, crit *CrossShardCriteria) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		events := make(chan core.CrossShardEvent)
+		eventsSub := api.backend.SubscribeCrossShardEvent(events)
+
+		for {
+			select {
+			case ev := <-events:
+				if crit.matches(&ev) {
+					notifier.Notify(rpcSub.ID, ev)
+				}
+			case <-rpcSub.Err():
+				eventsSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				eventsSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
 // FilterCriteria represents a request to create a new filter.
 // Same as ethereum.FilterQuery but with UnmarshalJSON() method.
 type FilterCriteria ethereum.FilterQuery
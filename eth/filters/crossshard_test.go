@@ -0,0 +1,107 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// crossShardBackend delivers cross-shard progress events from a feed.
+type crossShardBackend struct {
+	Backend
+	feed event.Feed
+}
+
+func (b *crossShardBackend) SubscribeCrossShardEvent(ch chan<- core.CrossShardEvent) event.Subscription {
+	return b.feed.Subscribe(ch)
+}
+
+func TestCrossShardSubscription(t *testing.T) {
+	backend := new(crossShardBackend)
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", &PublicFilterAPI{backend: backend}); err != nil {
+		t.Fatalf("failed to register API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	var (
+		committed, aborted, other = common.Hash{1}, common.Hash{2}, common.Hash{3}
+		local                     = common.Hash{4}
+	)
+	subscribe := func(crit *CrossShardCriteria) (chan core.CrossShardEvent, *rpc.ClientSubscription) {
+		ch := make(chan core.CrossShardEvent, 16)
+		sub, err := client.EthSubscribe(context.Background(), ch, "crossShard", crit)
+		if err != nil {
+			t.Fatalf("failed to subscribe: %v", err)
+		}
+		return ch, sub
+	}
+	byHash, sub := subscribe(&CrossShardCriteria{Hashes: []common.Hash{committed, local, aborted}})
+	defer sub.Unsubscribe()
+	decided, sub := subscribe(&CrossShardCriteria{Kinds: []string{core.CrossTxVoted, core.CrossTxAborted}, Shards: []uint64{0}})
+	defer sub.Unsubscribe()
+
+	// One transaction is prepared by the shards and committed, the other one
+	// aborted, while unrelated progress is made in between
+	events := []core.CrossShardEvent{
+		{Kind: core.CrossTxAccepted, RefHash: committed, Shard: 0, Shards: []uint64{1, 2}},
+		{Kind: core.CrossTxAccepted, RefHash: aborted, Shard: 0, Shards: []uint64{1, 2}},
+		{Kind: core.CrossTxAccepted, RefHash: other, Shard: 0, Shards: []uint64{2}},
+		{Kind: core.CrossTxReady, RefHash: common.Hash{}, LocalHash: &local, Shard: 1, Shards: []uint64{1, 2}},
+		{Kind: core.StateCommitted, RefHash: common.Hash{5}, Shard: 2},
+		{Kind: core.CrossTxAborted, RefHash: aborted, Shard: 0, Shards: []uint64{1, 2}},
+		{Kind: core.CrossTxVoted, RefHash: committed, Shard: 0, Shards: []uint64{1, 2}},
+		{Kind: core.CrossTxCommitted, RefHash: committed, Shard: 0, Shards: []uint64{1, 2}},
+	}
+	// Subscriptions start listening asynchronously
+	for deadline := time.Now().Add(time.Second); backend.feed.Send(events[0]) < 2; {
+		if time.Now().After(deadline) {
+			t.Fatalf("subscriptions not listening")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, ev := range events[1:] {
+		backend.feed.Send(ev)
+	}
+	check := func(name string, ch chan core.CrossShardEvent, want []core.CrossShardEvent) {
+		for i, want := range want {
+			select {
+			case ev := <-ch:
+				if ev.Kind != want.Kind || ev.RefHash != want.RefHash || ev.Shard != want.Shard {
+					t.Errorf("%s: event %d mismatch: have %+v, want %+v", name, i, ev, want)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("%s: event %d not delivered", name, i)
+			}
+		}
+		select {
+		case ev := <-ch:
+			t.Errorf("%s: unexpected event %+v", name, ev)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	check("by hash", byHash, []core.CrossShardEvent{events[0], events[1], events[3], events[5], events[6], events[7]})
+	check("decided", decided, []core.CrossShardEvent{events[5], events[6]})
+}
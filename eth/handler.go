@@ -17,14 +17,12 @@
 package eth
 
 import (
-	"encoding/binary"
-	"encoding/hex"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
 	"math/big"
-	"os"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -42,6 +40,7 @@ import (
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics/eventlog"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/params"
@@ -56,11 +55,30 @@ const (
 	// The number is referenced from the size of tx pool.
 	txChanSize = 4096
 
+	// rChainHeadChanSize is the size of channel listening to reference ChainHeadEvent.
+	rChainHeadChanSize = 10
+
 	// minimim number of peers to broadcast new blocks to
 	minBroadcastPeers = 4
 
 	// minimun number of peers to request data
 	minRequestPeers = 2
+
+	// maxUnforwardedTxs is the number of transactions of another shard kept
+	// while no peer of that shard is connected.
+	maxUnforwardedTxs = 1024
+
+	// refProofsChanSize is the size of channel delivering reference proofs.
+	refProofsChanSize = 16
+
+	// directDataRequest is the reference number of state data requests whose
+	// answer is delivered to a waiting caller instead of a data cache. The
+	// count of such requests is their id.
+	directDataRequest = math.MaxUint64
+
+	// stateDataTimeout is the time allowance for peers to answer a direct
+	// state data request.
+	stateDataTimeout = 5 * time.Second
 )
 
 var (
@@ -71,6 +89,12 @@ var (
 // not compatible (low protocol version restrictions and high requirements).
 var errIncompatibleConfig = errors.New("incompatible configuration")
 
+var (
+	errNoShardPeers     = errors.New("no peers to request state data from")
+	errMissingStateData = errors.New("state data not available")
+	errStateDataTimeout = errors.New("state data request timed out")
+)
+
 func errResp(code errCode, format string, v ...interface{}) error {
 	return fmt.Errorf("%v - %v", code, fmt.Sprintf(format, v...))
 }
@@ -93,7 +117,6 @@ type ProtocolManager struct {
 	chainconfig *params.ChainConfig
 	maxPeers    int
 
-	logdir          string
 	downloader      *downloader.Downloader
 	rDownloader     *downloader.Downloader
 	fetcher         *fetcher.Fetcher
@@ -102,14 +125,31 @@ type ProtocolManager struct {
 	shardAddMap     map[uint64]*big.Int
 	shardAddMapLock sync.RWMutex
 
+	dataRequests   map[uint64]time.Time // Time foreign data of a reference block was first requested
+	dataRequestsMu sync.Mutex
+
+	stateRequests   map[uint64]chan []*types.KeyVal // Direct state data requests awaiting an answer, by id
+	stateRequestID  uint64                          // Id of the latest direct state data request
+	stateRequestsMu sync.Mutex
+
+	unforwarded   map[uint64]types.Transactions // Transactions of other shards waiting for a peer of their shard
+	unforwardedMu sync.Mutex
+
+	refProofsCh      chan *refProofsPacket // Reference proofs delivered to the header-only reference sync
+	refProofsSyncing int32                 // Flag whether the header-only reference sync is running
+
 	SubProtocols []p2p.Protocol
 
 	eventMux      *event.TypeMux
 	rEventMux     *event.TypeMux
 	txsCh         chan core.NewTxsEvent
 	txsSub        event.Subscription
+	fwdTxsCh      chan core.ForwardTxsEvent
+	fwdTxsSub     event.Subscription
 	minedBlockSub *event.TypeMuxSubscription
 	refBlockSub   *event.TypeMuxSubscription
+	rChainHeadCh  chan core.ChainHeadEvent
+	rChainHeadSub event.Subscription
 
 	// channels for fetcher, syncer, txsyncLoop
 	newPeerCh   chan *peer
@@ -128,7 +168,7 @@ type ProtocolManager struct {
 
 // NewProtocolManager returns a new Ethereum sub protocol manager. The Ethereum sub protocol manages peers capable
 // with the Ethereum network.
-func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, numShard, myshard, networkID uint64, mux, rmux *event.TypeMux, txpool txPool, engine consensus.Engine, blockchain, refchain *core.BlockChain, refAddress common.Address, shardAddMap map[uint64]*big.Int, chaindb, refdb ethdb.Database, raftMode bool, logdir string) (*ProtocolManager, error) {
+func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, numShard, myshard, networkID uint64, mux, rmux *event.TypeMux, txpool txPool, engine consensus.Engine, blockchain, refchain *core.BlockChain, refAddress common.Address, shardAddMap map[uint64]*big.Int, chaindb, refdb ethdb.Database, raftMode bool) (*ProtocolManager, error) {
 	// Create the protocol manager with the base fields
 	manager := &ProtocolManager{
 		numShard:      numShard,
@@ -144,6 +184,10 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, nu
 		refAddress:    refAddress,
 		chainconfig:   config,
 		cousinPeers:   make(map[uint64]*peerSet),
+		dataRequests:  make(map[uint64]time.Time),
+		stateRequests: make(map[uint64]chan []*types.KeyVal),
+		unforwarded:   make(map[uint64]types.Transactions),
+		refProofsCh:   make(chan *refProofsPacket, refProofsChanSize),
 		shardAddMap:   make(map[uint64]*big.Int),
 		newPeerCh:     make(chan *peer),
 		noMorePeers:   make(chan struct{}),
@@ -152,7 +196,6 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, nu
 		rQuitSync:     make(chan struct{}),
 		raftMode:      raftMode,
 		engine:        engine,
-		logdir:        logdir,
 	}
 
 	// manager.shardAddMapLock.Lock()
@@ -182,13 +225,14 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, nu
 			continue
 		}
 		// Compatible; initialise the sub-protocol
-		version := version // Closure for the run
+		version, length := version, protocol.Lengths[i] // Closure for the run
 		manager.SubProtocols = append(manager.SubProtocols, p2p.Protocol{
 			Name:    protocol.Name,
 			Version: version,
-			Length:  protocol.Lengths[i],
+			Length:  length,
 			Run: func(p *p2p.Peer, shard uint64, rw p2p.MsgReadWriter) error {
 				peer := manager.newPeer(shard, int(version), p, rw)
+				peer.sharded = length > RefProofsMsg
 				select {
 				case manager.newPeerCh <- peer:
 					manager.wg.Add(1)
@@ -265,7 +309,7 @@ func (pm *ProtocolManager) GetShardID(id string) uint64 {
 			}
 		}
 	}
-	return 4096
+	return p2p.UnknownShard
 }
 
 func (pm *ProtocolManager) removePeer(id string) {
@@ -305,6 +349,8 @@ func (pm *ProtocolManager) Start(maxPeers int) {
 	// broadcast transactions
 	pm.txsCh = make(chan core.NewTxsEvent, txChanSize)
 	pm.txsSub = pm.txpool.SubscribeNewTxsEvent(pm.txsCh)
+	pm.fwdTxsCh = make(chan core.ForwardTxsEvent, txChanSize)
+	pm.fwdTxsSub = pm.txpool.SubscribeForwardTxsEvent(pm.fwdTxsCh)
 	go pm.txBroadcastLoop()
 
 	if !pm.raftMode {
@@ -313,6 +359,13 @@ func (pm *ProtocolManager) Start(maxPeers int) {
 		pm.refBlockSub = pm.eventMux.Subscribe(core.NewRefBlockEvent{})
 		go pm.minedBroadcastLoop()
 		go pm.fetchForeignDataLoop()
+
+		// retry foreign data requests that were not answered
+		if pm.myshard != uint64(0) {
+			pm.rChainHeadCh = make(chan core.ChainHeadEvent, rChainHeadChanSize)
+			pm.rChainHeadSub = pm.refchain.SubscribeChainHeadEvent(pm.rChainHeadCh)
+			go pm.refetchForeignDataLoop()
+		}
 	} else {
 		// We set this immediately in raft mode to make sure the miner never drops
 		// incoming txes. Raft mode doesn't use the fetcher or downloader, and so
@@ -329,8 +382,13 @@ func (pm *ProtocolManager) Stop() {
 	log.Info("Stopping Ethereum protocol")
 
 	pm.txsSub.Unsubscribe() // quits txBroadcastLoop
+	pm.fwdTxsSub.Unsubscribe()
 	if !pm.raftMode {
 		pm.minedBlockSub.Unsubscribe() // quits blockBroadcastLoop
+		pm.refBlockSub.Unsubscribe()   // quits fetchForeignDataLoop
+		if pm.rChainHeadSub != nil {
+			pm.rChainHeadSub.Unsubscribe() // quits refetchForeignDataLoop
+		}
 	}
 
 	// Quit the sync loop.
@@ -363,38 +421,41 @@ func (pm *ProtocolManager) newPeer(shard uint64, pv int, p *p2p.Peer, rw p2p.Msg
 // handle is the callback invoked to manage the life cycle of an eth peer. When
 // this function terminates, the peer is disconnected.
 func (pm *ProtocolManager) handle(p *peer) error {
+	p.Log().Debug("Peer connected", "shard", p.Shard(), "myshard", pm.myshard, "name", p.Name())
 
-	peerShard := p.Shard()
-	// For each shard, put a threshold on the number of peers.
-	pm.cousinPeerLock.Lock()
-	if pm.cousinPeers[peerShard] == nil {
-		pm.cousinPeers[peerShard] = newPeerSet()
+	// Execute the Ethereum handshake. Reference nodes keep the reference
+	// chain in their main chain.
+	refchain := pm.refchain
+	if pm.myshard == uint64(0) {
+		refchain = pm.blockchain
 	}
-	pm.cousinPeerLock.Unlock()
-	pm.cousinPeerLock.RLock()
-	if pm.cousinPeers[peerShard].Len() >= pm.maxPeers && !p.Peer.Info().Network.Trusted {
-		pm.cousinPeerLock.RUnlock()
-		return p2p.DiscTooManyCousinPeers
-	}
-	pm.cousinPeerLock.RUnlock()
-	p.Log().Debug("Peer connected", "shard", peerShard, "myshard", pm.myshard, "name", p.Name())
-
-	// Execute the Ethereum handshake
 	var (
-		genesis = pm.blockchain.Genesis()
+		genesis = refchain.Genesis()
 		head    = pm.blockchain.CurrentHeader()
-		rHead   = pm.refchain.CurrentHeader()
+		rHead   = refchain.CurrentHeader()
 		hash    = head.Hash()
 		rHash   = rHead.Hash()
 		number  = head.Number.Uint64()
 		rNumber = rHead.Number.Uint64()
 		td      = pm.blockchain.GetTd(hash, number)
-		rTd     = pm.refchain.GetTd(rHash, rNumber)
+		rTd     = refchain.GetTd(rHash, rNumber)
 	)
-	if err := p.Handshake(pm.myshard, pm.networkID, td, rTd, hash, rHash, genesis.Hash()); err != nil {
+	if err := p.Handshake(pm.myshard, pm.numShard, pm.networkID, td, rTd, hash, rHash, genesis.Hash(), pm.blockchain.Genesis().Hash()); err != nil {
 		p.Log().Debug("Ethereum handshake failed", "err", err)
 		return err
 	}
+	// The peer is classified by the shard verified in the handshake
+	peerShard := p.Shard()
+	// For each shard, put a threshold on the number of peers.
+	pm.cousinPeerLock.Lock()
+	if pm.cousinPeers[peerShard] == nil {
+		pm.cousinPeers[peerShard] = newPeerSet()
+	}
+	if pm.cousinPeers[peerShard].Len() >= pm.maxPeers && !p.Peer.Info().Network.Trusted {
+		pm.cousinPeerLock.Unlock()
+		return p2p.DiscTooManyCousinPeers
+	}
+	pm.cousinPeerLock.Unlock()
 	if rw, ok := p.rw.(*meteredMsgReadWriter); ok {
 		rw.Init(p.version)
 	}
@@ -422,6 +483,8 @@ func (pm *ProtocolManager) handle(p *peer) error {
 
 	if peerShard == pm.myshard {
 		pm.syncTransactions(p)
+	} else {
+		pm.syncUnforwarded(p)
 	}
 
 	// If we're DAO hard-fork aware, validate any remote peer with regard to the hard-fork
@@ -852,6 +915,58 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			log.Debug("Failed to deliver receipts", "err", err)
 		}
 
+	case p.sharded && msg.Code == GetRefProofsMsg:
+		// Decode the retrieval message
+		var query getRefProofsData
+		if err := msg.Decode(&query); err != nil {
+			return errResp(ErrDecode, "%v: %v", msg, err)
+		}
+		// Only nodes executing the reference chain hold the receipts to prove
+		refchain := pm.refchain
+		if pm.myshard == uint64(0) {
+			refchain = pm.blockchain
+		}
+		var (
+			bytes  int
+			proofs []*refProof
+		)
+		for number := query.Origin; !refchain.HeadersOnly() && uint64(len(proofs)) < query.Amount && len(proofs) < downloader.MaxBlockFetch && bytes < softResponseLimit; number++ {
+			block := refchain.GetBlockByNumber(number)
+			if block == nil {
+				break
+			}
+			txs, err := types.ProveRefReceipts(block.Transactions(), refchain.GetReceiptsByHash(block.Hash()))
+			if err != nil {
+				break
+			}
+			proofs = append(proofs, &refProof{Header: block.Header(), Txs: txs})
+			bytes += estHeaderRlpSize
+			for _, tx := range txs {
+				bytes += int(tx.Tx.Size())
+				for _, node := range append(tx.TxProof, tx.ReceiptProof...) {
+					bytes += len(node)
+				}
+			}
+		}
+		return p.SendRefProofs(proofs)
+
+	case p.sharded && msg.Code == RefProofsMsg:
+		// A batch of reference proofs arrived to one of our previous requests
+		var proofs []*refProof
+		if err := msg.Decode(&proofs); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		for _, proof := range proofs {
+			if proof.Header == nil {
+				return errResp(ErrDecode, "msg %v: missing reference header", msg)
+			}
+		}
+		select {
+		case pm.refProofsCh <- &refProofsPacket{peer: p.id, proofs: proofs}:
+		default:
+			log.Debug("Dropped unexpected reference proofs", "peer", p.id, "count", len(proofs))
+		}
+
 	case msg.Code == NewBlockHashesMsg:
 		var announces newBlockHashesData
 		if err := msg.Decode(&announces); err != nil {
@@ -865,6 +980,10 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		unknown := make(newBlockHashesData, 0, len(announces))
 		for _, block := range announces {
 			if block.Ref {
+				// Header-only reference chains pick up new blocks through sync
+				if pm.refchain.HeadersOnly() {
+					continue
+				}
 				if !pm.refchain.HasBlock(block.Hash, block.Number) {
 					unknown = append(unknown, block)
 				}
@@ -890,7 +1009,6 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 
 		// Mark the peer as owning the block and schedule it for import
 		p.MarkBlock(ref, request.Block.Hash())
-		pm.fetcher.Enqueue(p.id, request.Block)
 
 		// Assuming the block is importable by the peer, but possibly not yet done so,
 		// calculate the head hash and TD that the peer truly must have.
@@ -898,6 +1016,12 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			trueHead = request.Block.ParentHash()
 			trueTD   = new(big.Int).Sub(request.TD, request.Block.Difficulty())
 		)
+		if ref && pm.refchain.HeadersOnly() {
+			// Header-only reference chains can not import full blocks, sync their proofs instead
+			trueHead, trueTD = request.Block.Hash(), request.TD
+		} else {
+			pm.fetcher.Enqueue(p.id, request.Block)
+		}
 		// Update the peer's total difficulty if better than the previous
 		if _, td := p.Head(ref); trueTD.Cmp(td) > 0 {
 			p.SetHead(ref, trueHead, trueTD)
@@ -971,13 +1095,19 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		vals := request.Vals
 		log.Debug("Received response from", "pshard", p.Shard(), "num", refNum, "root", root)
 
-		dresp := pm.logdir + "dresp" // + strconv.Itoa(int(pm.myshard))
-		drespf, err := os.OpenFile(dresp, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			log.Error("Can't open dresp file", "error", err)
+		if refNum == directDataRequest {
+			pm.stateRequestsMu.Lock()
+			if ch, ok := pm.stateRequests[request.Count]; ok {
+				select {
+				case ch <- vals:
+				default:
+				}
+			}
+			pm.stateRequestsMu.Unlock()
+			return nil
 		}
-		fmt.Fprintln(drespf, refNum, p.Shard(), len(vals), root.Hex(), p.ID(), time.Now().Unix())
-		drespf.Close()
+		foreignDataRespCounter.Inc(1)
+		eventlog.Emit("dataresp", "ref", refNum, "shard", p.Shard(), "count", len(vals), "root", root, "peer", p.ID())
 		go pm.AddFetchedData(refNum, p.Shard(), vals)
 
 	default:
@@ -997,14 +1127,24 @@ func (pm *ProtocolManager) AddFetchedData(refNum, pshard uint64, vals []*types.K
 		dc.DataCacheMu.RLock()
 		if !dc.ShardStatus[pshard] {
 			dc.DataCacheMu.RUnlock()
-			dc.AddData(pshard, vals)
+			if err := dc.AddData(pshard, vals); err != nil {
+				foreignDataRejectCounter.Inc(1)
+				log.Warn("Rejected foreign data", "refnum", refNum, "shard", pshard, "err", err)
+				return
+			}
 
 			dc.DataCacheMu.RLock()
 			status := dc.Status
 			dc.DataCacheMu.RUnlock()
 			log.Debug("Foreign Data added", "refnum", refNum, "shard", pshard, "status", status)
 			if status {
-				go pm.blockchain.PostForeignDataEvent(refNum)
+				pm.dataRequestsMu.Lock()
+				if requested, ok := pm.dataRequests[refNum]; ok {
+					foreignDataFetchTimer.UpdateSince(requested)
+					delete(pm.dataRequests, refNum)
+				}
+				pm.dataRequestsMu.Unlock()
+				go pm.blockchain.ForeignDataReady(refNum)
 			}
 		} else {
 			dc.DataCacheMu.RUnlock()
@@ -1016,19 +1156,36 @@ func (pm *ProtocolManager) AddFetchedData(refNum, pshard uint64, vals []*types.K
 func (pm *ProtocolManager) FetchData(start, end uint64) {
 	for refNum := start; refNum <= end; refNum++ {
 		dc, status := pm.blockchain.Dc(refNum)
-		if !status {
-			for shard := range dc.ShardStatus {
-				if shard != pm.myshard {
-					dc.DataCacheMu.RLock()
-					root := dc.Commits[shard].StateRoot
-					dc.DataCacheMu.RUnlock()
-					go pm.FetchDataShard(refNum, shard, root)
+		if !status && dc != nil {
+			dc.DataCacheMu.RLock()
+			for shard, received := range dc.ShardStatus {
+				if shard != pm.myshard && !received && dc.Commits[shard] != nil {
+					go pm.FetchDataShard(refNum, shard, dc.Commits[shard].StateRoot)
 				}
 			}
+			dc.DataCacheMu.RUnlock()
 		}
 	}
 }
 
+// RefetchData requests the foreign data still missing for reference blocks
+// below head again, unless the deadline of their transactions has passed.
+func (pm *ProtocolManager) RefetchData(head uint64) {
+	for _, refNum := range pm.blockchain.IncompleteDataCaches() {
+		if refNum >= head {
+			continue
+		}
+		if _, decided := pm.refchain.AbortedCrossTxs(refNum); decided {
+			pm.dataRequestsMu.Lock()
+			delete(pm.dataRequests, refNum)
+			pm.dataRequestsMu.Unlock()
+			continue
+		}
+		log.Debug("Retrying foreign data request", "refnum", refNum, "head", head)
+		pm.FetchData(refNum, refNum)
+	}
+}
+
 // FetchDataShard sends request for each data
 func (pm *ProtocolManager) FetchDataShard(refNum, shard uint64, root common.Hash) {
 	var (
@@ -1046,6 +1203,11 @@ func (pm *ProtocolManager) FetchDataShard(refNum, shard uint64, root common.Hash
 	dc.DataCacheMu.RUnlock()
 
 	pm.cousinPeerLock.RLock()
+	if pm.cousinPeers[shard] == nil {
+		pm.cousinPeerLock.RUnlock()
+		log.Warn("No peers to request foreign data from", "refnum", refNum, "shard", shard)
+		return
+	}
 	peers := pm.cousinPeers[shard].PeersWithoutRequest(refNum)
 	pm.cousinPeerLock.RUnlock()
 	// Send the data request to a sqrt(N) nodes, where N is the number of nodes
@@ -1059,17 +1221,82 @@ func (pm *ProtocolManager) FetchDataShard(refNum, shard uint64, root common.Hash
 		requestLen = len(peers)
 	}
 	requests := peers[:uint64(requestLen)]
-	dreq := pm.logdir + "dreq" // + strconv.Itoa(int(pm.myshard))
-	dreqf, err := os.OpenFile(dreq, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Error("Can't open dreqFile", "err", err)
+	if len(requests) > 0 {
+		pm.dataRequestsMu.Lock()
+		if _, ok := pm.dataRequests[refNum]; !ok {
+			pm.dataRequests[refNum] = time.Now()
+		}
+		pm.dataRequestsMu.Unlock()
 	}
 	for _, peer := range requests {
-		fmt.Fprintln(dreqf, refNum, shard, count, root.Hex(), peer.ID(), time.Now().Unix())
+		foreignDataReqCounter.Inc(1)
+		eventlog.Emit("datareq", "ref", refNum, "shard", shard, "count", count, "root", root, "peer", peer.ID())
 		peer.SendDataRequest(refNum, count, root, keys)
 	}
-	dreqf.Close()
-	return
+}
+
+// GetStateData fetches keys from the state of shard at root, asking peers of
+// the shard if it is not the local one. The first answer whose proofs verify
+// against root is returned along with whether each account exists.
+func (pm *ProtocolManager) GetStateData(ctx context.Context, shard uint64, root common.Hash, keys []*types.CKeys) ([]*types.KeyVal, []bool, error) {
+	if shard == pm.myshard {
+		vals := pm.blockchain.StateData(root, keys)
+		if vals == nil {
+			return nil, nil, errMissingStateData
+		}
+		exists, err := types.VerifyStateData(root, keys, vals)
+		return vals, exists, err
+	}
+	pm.cousinPeerLock.RLock()
+	var peers []*peer
+	if pm.cousinPeers[shard] != nil {
+		for _, p := range pm.cousinPeers[shard].Peers() {
+			peers = append(peers, p)
+		}
+	}
+	pm.cousinPeerLock.RUnlock()
+	if len(peers) == 0 {
+		return nil, nil, errNoShardPeers
+	}
+	if len(peers) > minRequestPeers {
+		peers = peers[:minRequestPeers]
+	}
+	ch := make(chan []*types.KeyVal, len(peers))
+	pm.stateRequestsMu.Lock()
+	pm.stateRequestID++
+	id := pm.stateRequestID
+	pm.stateRequests[id] = ch
+	pm.stateRequestsMu.Unlock()
+
+	defer func() {
+		pm.stateRequestsMu.Lock()
+		delete(pm.stateRequests, id)
+		pm.stateRequestsMu.Unlock()
+	}()
+	for _, p := range peers {
+		p.SendDataRequest(directDataRequest, id, root, keys)
+	}
+	timeout := time.NewTimer(stateDataTimeout)
+	defer timeout.Stop()
+
+	for answers := 0; answers < len(peers); answers++ {
+		select {
+		case vals := <-ch:
+			exists, err := types.VerifyStateData(root, keys, vals)
+			if err != nil {
+				log.Debug("Rejected state data", "shard", shard, "root", root, "err", err)
+				continue
+			}
+			return vals, exists, nil
+		case <-timeout.C:
+			return nil, nil, errStateDataTimeout
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-pm.quitSync:
+			return nil, nil, errStateDataTimeout
+		}
+	}
+	return nil, nil, errMissingStateData
 }
 
 // BroadcastBlock will either propagate a block to a subset of it's peers, or
@@ -1181,26 +1408,19 @@ func (pm *ProtocolManager) BroadcastBlock(block *types.Block, propagate bool) {
 				}
 				log.Trace("Propagated block", "hash", hash, "recipients", len(transfer), "duration", common.PrettyDuration(time.Since(block.ReceivedAt)))
 
-				shardByte := make([]byte, 32)
-				blkNumByte := make([]byte, 32)
-				refBlkNumByte := make([]byte, 32)
-				binary.BigEndian.PutUint64(shardByte[24:], pm.myshard)
-				binary.BigEndian.PutUint64(blkNumByte[24:], block.NumberU64())
-				binary.BigEndian.PutUint64(refBlkNumByte[24:], block.RefNumberU64())
-
-				var start int
-				dataLen := 5*32 + 4
-				data := make([]byte, dataLen)
-				funcAddress, _ := hex.DecodeString("8a31297a")
-				start += copy(data[start:], funcAddress)
-				start += copy(data[start:], shardByte)
-				start += copy(data[start:], blkNumByte)
-				start += copy(data[start:], refBlkNumByte)
-				start += copy(data[start:], block.Root().Bytes())
-				start += copy(data[start:], block.Hash().Bytes())
-
+				data, err := types.EncodeStateCommit(pm.myshard, block.Header(), pm.blockchain.ReadVersions(block.Header()), pm.blockchain.CrossTxVotes(block.Header()))
+				if err != nil {
+					log.Error("Failed to encode state commitment", "number", block.Number(), "hash", hash, "err", err)
+					return
+				}
+				// The attested header makes the call data considerably larger
+				gas, err := core.IntrinsicGas(data, false, true)
+				if err != nil {
+					log.Error("Failed to compute state commitment gas", "number", block.Number(), "hash", hash, "err", err)
+					return
+				}
 				// NewTransaction(txType, nonce, shard, to, amount, gasLimit, gasPrice, data)
-				stateTx := types.NewTransaction(types.StateCommit, block.RefNumberU64()+block.NumberU64()-1, pm.myshard, pm.refAddress, big.NewInt(0), pm.stateGasLimit, pm.stateGasPrice, data)
+				stateTx := types.NewTransaction(types.StateCommit, block.RefNumberU64()+block.NumberU64()-1, pm.myshard, pm.refAddress, big.NewInt(0), pm.stateGasLimit+gas, pm.stateGasPrice, data)
 				var txs []*types.Transaction
 				txs = append(txs, stateTx)
 				pm.cousinPeerLock.RLock()
@@ -1219,7 +1439,7 @@ func (pm *ProtocolManager) BroadcastBlock(block *types.Block, propagate bool) {
 				for _, peer := range rTransfer {
 					peer.AsyncSendTransactions(txs)
 				}
-				log.Debug("Propagated state committment", "number", block.Number(), "bh", block.Hash(), "th", stateTx.Hash(), "val", stateTx.Value().Uint64(), "data", hex.EncodeToString(data))
+				log.Debug("Propagated state committment", "number", block.Number(), "bh", block.Hash(), "th", stateTx.Hash(), "val", stateTx.Value().Uint64(), "size", len(data))
 			}
 		}
 		return
@@ -1283,7 +1503,8 @@ func (pm *ProtocolManager) BroadcastBlock(block *types.Block, propagate bool) {
 }
 
 // BroadcastTxs will propagate a batch of transactions to all peers which are not known to
-// already have the given transaction.
+// already have the given transaction. Transactions of other shards are forwarded
+// to the peers of the shard including them.
 func (pm *ProtocolManager) BroadcastTxs(txs types.Transactions) {
 	var txset = make(map[*peer]types.Transactions)
 
@@ -1295,16 +1516,21 @@ func (pm *ProtocolManager) BroadcastTxs(txs types.Transactions) {
 	// arise here, and we should add logic to send to *all* peers in raft mode.
 
 	for _, tx := range txs {
+		shard := tx.HomeShard()
+		var peers []*peer
 		pm.cousinPeerLock.RLock()
-		if pm.cousinPeers[pm.myshard] == nil {
-			pm.cousinPeers[pm.myshard] = newPeerSet()
+		if set := pm.cousinPeers[shard]; set != nil {
+			peers = set.PeersWithoutTx(tx.Hash())
 		}
-		peers := pm.cousinPeers[pm.myshard].PeersWithoutTx(tx.Hash())
 		pm.cousinPeerLock.RUnlock()
+		if shard != pm.myshard && len(peers) == 0 {
+			pm.queueUnforwarded(shard, tx)
+			continue
+		}
 		for _, peer := range peers {
 			txset[peer] = append(txset[peer], tx)
 		}
-		log.Trace("Broadcast transaction", "hash", tx.Hash(), "recipients", len(peers))
+		log.Trace("Broadcast transaction", "hash", tx.Hash(), "shard", shard, "recipients", len(peers))
 	}
 	// FIXME include this again: peers = peers[:int(math.Sqrt(float64(len(peers))))]
 	for peer, txs := range txset {
@@ -1312,6 +1538,38 @@ func (pm *ProtocolManager) BroadcastTxs(txs types.Transactions) {
 	}
 }
 
+// queueUnforwarded keeps a transaction of another shard until a peer of that
+// shard connects. The oldest transactions are dropped once too many wait.
+func (pm *ProtocolManager) queueUnforwarded(shard uint64, tx *types.Transaction) {
+	pm.unforwardedMu.Lock()
+	defer pm.unforwardedMu.Unlock()
+
+	queue := append(pm.unforwarded[shard], tx)
+	if len(queue) > maxUnforwardedTxs {
+		log.Warn("Dropping transaction never forwarded to its shard", "hash", queue[0].Hash(), "shard", shard)
+		queue = queue[1:]
+	}
+	pm.unforwarded[shard] = queue
+	log.Debug("No peers to forward transaction to, keeping it", "hash", tx.Hash(), "shard", shard, "queued", len(queue))
+}
+
+// syncUnforwarded hands the transactions kept for the shard of p over to it.
+func (pm *ProtocolManager) syncUnforwarded(p *peer) {
+	pm.unforwardedMu.Lock()
+	txs := pm.unforwarded[p.Shard()]
+	delete(pm.unforwarded, p.Shard())
+	pm.unforwardedMu.Unlock()
+
+	if len(txs) == 0 {
+		return
+	}
+	log.Debug("Forwarding kept transactions", "peer", p.id, "shard", p.Shard(), "count", len(txs))
+	select {
+	case pm.txsyncCh <- &txsync{p, txs}:
+	case <-pm.quitSync:
+	}
+}
+
 // Mined broadcast loop
 func (pm *ProtocolManager) minedBroadcastLoop() {
 	// automatically stops if unsubscribe
@@ -1331,11 +1589,28 @@ func (pm *ProtocolManager) fetchForeignDataLoop() {
 	}
 }
 
+// refetchForeignDataLoop retries the missing foreign data on every new head of
+// the reference chain, independently of the miner.
+func (pm *ProtocolManager) refetchForeignDataLoop() {
+	for {
+		select {
+		case ev := <-pm.rChainHeadCh:
+			pm.RefetchData(ev.Block.NumberU64())
+
+		// Err() channel will be closed when unsubscribing.
+		case <-pm.rChainHeadSub.Err():
+			return
+		}
+	}
+}
+
 func (pm *ProtocolManager) txBroadcastLoop() {
 	for {
 		select {
 		case event := <-pm.txsCh:
 			pm.BroadcastTxs(event.Txs)
+		case event := <-pm.fwdTxsCh:
+			pm.BroadcastTxs(event.Txs)
 
 		// Err() channel will be closed when unsubscribing.
 		case <-pm.txsSub.Err():
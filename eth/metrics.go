@@ -55,6 +55,11 @@ var (
 	miscInTrafficMeter        = metrics.NewRegisteredMeter("eth/misc/in/traffic", nil)
 	miscOutPacketsMeter       = metrics.NewRegisteredMeter("eth/misc/out/packets", nil)
 	miscOutTrafficMeter       = metrics.NewRegisteredMeter("eth/misc/out/traffic", nil)
+
+	foreignDataReqCounter    = metrics.NewRegisteredCounter("eth/foreign/requests", nil)
+	foreignDataRespCounter   = metrics.NewRegisteredCounter("eth/foreign/responses", nil)
+	foreignDataRejectCounter = metrics.NewRegisteredCounter("eth/foreign/rejected", nil)
+	foreignDataFetchTimer    = metrics.NewRegisteredTimer("eth/foreign/fetch", nil) // From the first request until all data of a reference block arrived
 )
 
 // meteredMsgReadWriter is a wrapper around a p2p.MsgReadWriter, capable of
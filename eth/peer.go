@@ -41,6 +41,8 @@ const (
 	maxKnownTxs    = 32768 // Maximum transactions hashes to keep in the known list (prevent DOS)
 	maxKnownBlocks = 1024  // Maximum block hashes to keep in the known list (prevent DOS)
 
+	maxKnownRequests = 1024 // Maximum reference numbers to remember data requests for
+
 	// maxQueuedTxs is the maximum number of transaction lists to queue up before
 	// dropping broadcasts. This is a sensitive number as a transaction list might
 	// contain a single transaction, or thousands.
@@ -85,6 +87,7 @@ type peer struct {
 
 	shard    uint64
 	version  int         // Protocol version negotiated
+	sharded  bool        // Whether the negotiated version carries the shard genesis and reference proofs
 	forkDrop *time.Timer // Timed connection dropper if forks aren't validated in time
 
 	head  common.Hash
@@ -97,6 +100,7 @@ type peer struct {
 	knownTxs     mapset.Set                // Set of transaction hashes known to be known by this peer
 	knownBlocks  mapset.Set                // Set of block hashes known to be known by this peer
 	rKnownBlocks mapset.Set                // Set of Reference block hashes known by this peer
+	requests     mapset.Set                // Set of reference numbers whose data was requested from this peer
 	queuedTxs    chan []*types.Transaction // Queue of transactions to broadcast to the peer
 	queuedProps  chan *propEvent           // Queue of blocks to broadcast to the peer
 	queuedAnns   chan *types.Block         // Queue of blocks to announce to the peer
@@ -113,6 +117,7 @@ func newPeer(shard uint64, version int, p *p2p.Peer, rw p2p.MsgReadWriter) *peer
 		knownTxs:     mapset.NewSet(),
 		knownBlocks:  mapset.NewSet(),
 		rKnownBlocks: mapset.NewSet(),
+		requests:     mapset.NewSet(),
 		queuedTxs:    make(chan []*types.Transaction, maxQueuedTxs),
 		queuedProps:  make(chan *propEvent, maxQueuedProps),
 		queuedAnns:   make(chan *types.Block, maxQueuedAnns),
@@ -232,6 +237,16 @@ func (p *peer) MarkTransaction(hash common.Hash) {
 	p.knownTxs.Add(hash)
 }
 
+// MarkRequest marks the foreign data of a reference block as requested from
+// the peer, so that retries prefer peers that were not asked yet.
+func (p *peer) MarkRequest(refNum uint64) {
+	// If we reached the memory allowance, drop a previously requested number
+	for p.requests.Cardinality() >= maxKnownRequests {
+		p.requests.Pop()
+	}
+	p.requests.Add(refNum)
+}
+
 // Send writes an RLP-encoded message with the given code.
 // data should encode as an RLP list.
 func (p *peer) Send(msgcode uint64, data interface{}) error {
@@ -324,6 +339,7 @@ func (p *peer) AsyncSendNewBlock(ref bool, block *types.Block, td *big.Int) {
 
 // SendDataRequest sends a data request to remote peer
 func (p *peer) SendDataRequest(refNum, count uint64, root common.Hash, keys []*types.CKeys) error {
+	p.MarkRequest(refNum)
 	return p2p.Send(p.rw, GetStateDataMsg, &getStateData{Root: root, RefNum: refNum, Count: count, Keys: keys})
 }
 
@@ -401,15 +417,27 @@ func (p *peer) RequestReceipts(shard uint64, hashes []common.Hash) error {
 	return p2p.Send(p.rw, GetReceiptsMsg, getReceiptsData{Hashes: hashes, Shard: shard})
 }
 
+// RequestRefProofs fetches the proofs of a batch of consecutive reference
+// blocks, starting at origin.
+func (p *peer) RequestRefProofs(origin, amount uint64) error {
+	p.Log().Debug("Fetching batch of reference proofs", "count", amount, "from", origin)
+	return p2p.Send(p.rw, GetRefProofsMsg, &getRefProofsData{Origin: origin, Amount: amount})
+}
+
+// SendRefProofs sends a batch of reference block proofs to the remote peer.
+func (p *peer) SendRefProofs(proofs []*refProof) error {
+	return p2p.Send(p.rw, RefProofsMsg, proofs)
+}
+
 // Handshake executes the eth protocol handshake, negotiating version number,
-// network IDs, difficulties, head and genesis blocks.
-func (p *peer) Handshake(shard, network uint64, td, rTd *big.Int, head, rHead common.Hash, genesis common.Hash) error {
+// network IDs, shards, difficulties, head and genesis blocks.
+func (p *peer) Handshake(shard, numShard, network uint64, td, rTd *big.Int, head, rHead common.Hash, genesis, shardGenesis common.Hash) error {
 	// Send out own handshake in a new thread
 	errc := make(chan error, 2)
 	var status statusData // safe to read after two values have been received from errc
 
 	go func() {
-		errc <- p2p.Send(p.rw, StatusMsg, &statusData{
+		status := &statusData{
 			ProtocolVersion: uint32(p.version),
 			ShardId:         shard,
 			NetworkId:       network,
@@ -418,10 +446,16 @@ func (p *peer) Handshake(shard, network uint64, td, rTd *big.Int, head, rHead co
 			CurrentBlock:    head,
 			RCurrentBlock:   rHead,
 			GenesisBlock:    genesis,
-		})
+			ShardGenesis:    shardGenesis,
+		}
+		if p.sharded {
+			errc <- p2p.Send(p.rw, StatusMsg, status)
+		} else {
+			errc <- p2p.Send(p.rw, StatusMsg, status.legacy())
+		}
 	}()
 	go func() {
-		errc <- p.readStatus(network, &status, genesis)
+		errc <- p.readStatus(shard, numShard, network, &status, genesis, shardGenesis)
 	}()
 	timeout := time.NewTimer(handshakeTimeout)
 	defer timeout.Stop()
@@ -435,6 +469,7 @@ func (p *peer) Handshake(shard, network uint64, td, rTd *big.Int, head, rHead co
 			return p2p.DiscReadTimeout
 		}
 	}
+	p.shard = status.ShardId
 
 	if shard == status.ShardId {
 		p.td, p.head = status.TD, status.CurrentBlock
@@ -451,7 +486,7 @@ func (p *peer) Handshake(shard, network uint64, td, rTd *big.Int, head, rHead co
 	return nil
 }
 
-func (p *peer) readStatus(network uint64, status *statusData, genesis common.Hash) (err error) {
+func (p *peer) readStatus(shard, numShard, network uint64, status *statusData, genesis, shardGenesis common.Hash) (err error) {
 	msg, err := p.rw.ReadMsg()
 	if err != nil {
 		return err
@@ -462,8 +497,16 @@ func (p *peer) readStatus(network uint64, status *statusData, genesis common.Has
 	if msg.Size > ProtocolMaxMsgSize {
 		return errResp(ErrMsgTooLarge, "%v > %v", msg.Size, ProtocolMaxMsgSize)
 	}
-	// Decode the handshake and make sure everything matches
-	if err := msg.Decode(&status); err != nil {
+	// Decode the handshake and make sure everything matches. Versions without
+	// the shard genesis leave it empty.
+	if p.sharded {
+		err = msg.Decode(status)
+	} else {
+		var legacy statusData63
+		err = msg.Decode(&legacy)
+		*status = legacy.upgrade()
+	}
+	if err != nil {
 		return errResp(ErrDecode, "msg %v: %v", msg, err)
 	}
 	if status.GenesisBlock != genesis {
@@ -475,6 +518,18 @@ func (p *peer) readStatus(network uint64, status *statusData, genesis common.Has
 	if int(status.ProtocolVersion) != p.version {
 		return errResp(ErrProtocolVersionMismatch, "%d (!= %d)", status.ProtocolVersion, p.version)
 	}
+	// The claimed shard must exist and match the one the peer advertised or was
+	// configured with, if any, and peers of our own shard must share our shard
+	// chain.
+	if status.ShardId >= numShard {
+		return errResp(ErrShardIdMismatch, "%d (>= %d shards)", status.ShardId, numShard)
+	}
+	if p.shard != p2p.UnknownShard && status.ShardId != p.shard {
+		return errResp(ErrShardIdMismatch, "%d (!= advertised %d)", status.ShardId, p.shard)
+	}
+	if p.sharded && status.ShardId == shard && status.ShardGenesis != shardGenesis {
+		return errResp(ErrGenesisBlockMismatch, "shard %x (!= %x)", status.ShardGenesis[:8], shardGenesis[:8])
+	}
 	return nil
 }
 
@@ -623,15 +678,22 @@ func (ps *peerSet) PeersWithoutBlock(hash common.Hash) []*peer {
 	return list
 }
 
-// PeersWithoutRequest retrieves a list of peers to whom the
-// the data request are not sent yet
-// @sourav, todo: as of now we are returning the entire
-// list of peers, we have to fix this later!
+// PeersWithoutRequest retrieves a list of peers to whom the data request of
+// a reference block was not sent yet. Once every peer has been asked, all of
+// them are returned again.
 func (ps *peerSet) PeersWithoutRequest(number uint64) []*peer {
 	ps.lock.RLock()
 	defer ps.lock.RUnlock()
 
 	list := make([]*peer, 0, len(ps.peers))
+	for _, p := range ps.peers {
+		if !p.requests.Contains(number) {
+			list = append(list, p)
+		}
+	}
+	if len(list) > 0 {
+		return list
+	}
 	for _, p := range ps.peers {
 		list = append(list, p)
 	}
@@ -0,0 +1,146 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+var (
+	testGenesis      = common.HexToHash("0x01")
+	testShardGenesis = common.HexToHash("0x02")
+)
+
+// handshake runs the handshake of a shard 1 node out of 3 shards against a
+// remote node advertising shard advertised and sending status.
+func handshake(advertised uint64, sharded bool, status interface{}) (*peer, error) {
+	local, remote := p2p.MsgPipe()
+	defer local.Close()
+	defer remote.Close()
+
+	version := eth64
+	if !sharded {
+		version = eth63
+	}
+	p := newPeer(advertised, version, p2p.NewPeer(enode.ID{1}, "peer", nil), local)
+	p.sharded = sharded
+
+	errc := make(chan error, 2)
+	go func() {
+		msg, err := remote.ReadMsg()
+		if err == nil {
+			err = msg.Discard()
+		}
+		errc <- err
+	}()
+	go func() {
+		errc <- p2p.Send(remote, StatusMsg, status)
+	}()
+	err := p.Handshake(1, 3, DefaultConfig.NetworkId, big.NewInt(1), big.NewInt(1), common.Hash{}, common.Hash{}, testGenesis, testShardGenesis)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errc; err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func TestHandshakeShards(t *testing.T) {
+	status := func(shard uint64, shardGenesis common.Hash) *statusData {
+		return &statusData{
+			ProtocolVersion: eth64,
+			ShardId:         shard,
+			NetworkId:       DefaultConfig.NetworkId,
+			TD:              big.NewInt(2),
+			RTD:             big.NewInt(3),
+			GenesisBlock:    testGenesis,
+			ShardGenesis:    shardGenesis,
+		}
+	}
+	tests := []struct {
+		advertised uint64
+		status     *statusData
+		wantErr    error
+	}{
+		{
+			advertised: 1, status: status(1, testShardGenesis),
+		},
+		{
+			advertised: p2p.UnknownShard, status: status(2, common.Hash{}),
+		},
+		{
+			advertised: 1, status: status(2, testShardGenesis),
+			wantErr: errResp(ErrShardIdMismatch, "2 (!= advertised 1)"),
+		},
+		{
+			advertised: p2p.UnknownShard, status: status(1, common.HexToHash("0x03")),
+			wantErr: errResp(ErrGenesisBlockMismatch, "shard %x (!= %x)", common.HexToHash("0x03").Bytes()[:8], testShardGenesis.Bytes()[:8]),
+		},
+		{
+			advertised: p2p.UnknownShard, status: status(3, common.Hash{}),
+			wantErr: errResp(ErrShardIdMismatch, "3 (>= 3 shards)"),
+		},
+	}
+	for i, test := range tests {
+		p, err := handshake(test.advertised, true, test.status)
+		if test.wantErr != nil {
+			if err == nil || err.Error() != test.wantErr.Error() {
+				t.Errorf("test %d: error mismatch: have %v, want %v", i, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: handshake failed: %v", i, err)
+			continue
+		}
+		if p.Shard() != test.status.ShardId {
+			t.Errorf("test %d: shard mismatch: have %d, want %d", i, p.Shard(), test.status.ShardId)
+		}
+	}
+}
+
+func TestHandshakeLegacy(t *testing.T) {
+	// Versions predating the shard genesis exchange the legacy status
+	status := &statusData63{
+		ProtocolVersion: eth63,
+		ShardId:         1,
+		NetworkId:       DefaultConfig.NetworkId,
+		TD:              big.NewInt(2),
+		RTD:             big.NewInt(3),
+		GenesisBlock:    testGenesis,
+	}
+	p, err := handshake(1, false, status)
+	if err != nil {
+		t.Fatalf("legacy handshake failed: %v", err)
+	}
+	if td := p.td; td.Cmp(status.TD) != 0 {
+		t.Errorf("difficulty mismatch: have %v, want %v", td, status.TD)
+	}
+	// Sharded versions do not accept the legacy status
+	status.ProtocolVersion = eth64
+	if _, err := handshake(1, true, status); err == nil {
+		t.Errorf("legacy status accepted by a sharded version")
+	}
+}
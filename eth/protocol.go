@@ -32,16 +32,17 @@ import (
 const (
 	eth62 = 62
 	eth63 = 63
+	eth64 = 64
 )
 
 // ProtocolName is the official short name of the protocol used during capability negotiation.
 var ProtocolName = "eth"
 
 // ProtocolVersions are the supported versions of the eth protocol (first is primary).
-var ProtocolVersions = []uint{eth63, eth62}
+var ProtocolVersions = []uint{eth64, eth63, eth62}
 
 // ProtocolLengths are the number of implemented message corresponding to different protocol versions.
-var ProtocolLengths = []uint64{17, 8}
+var ProtocolLengths = []uint64{20, 17, 8}
 
 const ProtocolMaxMsgSize = 10 * 1024 * 1024 // Maximum cap on the size of a protocol message
 
@@ -64,6 +65,12 @@ const (
 	NodeDataMsg    = 0x0e
 	GetReceiptsMsg = 0x0f
 	ReceiptsMsg    = 0x10
+
+	// Protocol messages belonging to eth/64, leaving 0x11 to consensus engines.
+	// They carry reference chain proofs for shard nodes following it by headers
+	// only.
+	GetRefProofsMsg = 0x12
+	RefProofsMsg    = 0x13
 )
 
 type errCode int
@@ -110,6 +117,37 @@ type txPool interface {
 	// SubscribeNewTxsEvent should return an event subscription of
 	// NewTxsEvent and send events to the given channel.
 	SubscribeNewTxsEvent(chan<- core.NewTxsEvent) event.Subscription
+
+	// SubscribeForwardTxsEvent should return an event subscription of
+	// ForwardTxsEvent and send events to the given channel.
+	SubscribeForwardTxsEvent(chan<- core.ForwardTxsEvent) event.Subscription
+}
+
+// statusData63 is the network packet for the status message of versions
+// predating the shard genesis.
+type statusData63 struct {
+	ProtocolVersion uint32
+	ShardId         uint64
+	NetworkId       uint64
+	TD              *big.Int
+	RTD             *big.Int
+	CurrentBlock    common.Hash
+	RCurrentBlock   common.Hash
+	GenesisBlock    common.Hash
+}
+
+// upgrade converts a legacy status message, leaving the shard genesis empty.
+func (s *statusData63) upgrade() statusData {
+	return statusData{
+		ProtocolVersion: s.ProtocolVersion,
+		ShardId:         s.ShardId,
+		NetworkId:       s.NetworkId,
+		TD:              s.TD,
+		RTD:             s.RTD,
+		CurrentBlock:    s.CurrentBlock,
+		RCurrentBlock:   s.RCurrentBlock,
+		GenesisBlock:    s.GenesisBlock,
+	}
 }
 
 // statusData is the network packet for the status message.
@@ -121,7 +159,22 @@ type statusData struct {
 	RTD             *big.Int
 	CurrentBlock    common.Hash
 	RCurrentBlock   common.Hash
-	GenesisBlock    common.Hash
+	GenesisBlock    common.Hash // Genesis of the reference chain
+	ShardGenesis    common.Hash // Genesis of the sender's shard chain
+}
+
+// legacy converts the status message for versions predating the shard genesis.
+func (s *statusData) legacy() *statusData63 {
+	return &statusData63{
+		ProtocolVersion: s.ProtocolVersion,
+		ShardId:         s.ShardId,
+		NetworkId:       s.NetworkId,
+		TD:              s.TD,
+		RTD:             s.RTD,
+		CurrentBlock:    s.CurrentBlock,
+		RCurrentBlock:   s.RCurrentBlock,
+		GenesisBlock:    s.GenesisBlock,
+	}
 }
 
 // getStateData to request data
@@ -167,6 +220,20 @@ type getReceiptsData struct {
 	Hashes []common.Hash
 }
 
+// getRefProofsData is a query for the proofs of consecutive reference blocks.
+type getRefProofsData struct {
+	Origin uint64 // Number of the first reference block to retrieve
+	Amount uint64 // Maximum number of blocks to retrieve
+}
+
+// refProof is a reference block header along with the proofs of its
+// cross-shard transactions and their receipts, as built by
+// types.ProveRefReceipts.
+type refProof struct {
+	Header *types.Header
+	Txs    []*types.RefTxProof
+}
+
 // hashOrNumber is a combined field for specifying an origin block.
 type hashOrNumber struct {
 	Hash   common.Hash // Block hash from which to retrieve headers (excludes Number)
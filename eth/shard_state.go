@@ -0,0 +1,80 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// shardStateFile is the file of the instance directory recording the shard the
+// node runs in once the reference chain moved its validator.
+const shardStateFile = "shard.json"
+
+// shardState is the shard a node runs in along with the database of its chain,
+// persisted so that restarts stay in the shard the validator was moved to.
+type shardState struct {
+	Origin   uint64 `json:"origin"`   // Shard the node was first started in, whose chain is kept in chaindata
+	Shard    uint64 `json:"shard"`    // Shard the node runs in
+	Database string `json:"database"` // Database of the chain of Shard
+}
+
+// newShardState returns the state of a node of shard origin moved to shard.
+func newShardState(origin, shard uint64) *shardState {
+	database := "chaindata"
+	if shard != origin {
+		database = fmt.Sprintf("chaindata-shard%d", shard)
+	}
+	return &shardState{Origin: origin, Shard: shard, Database: database}
+}
+
+// readShardState loads the shard state persisted at path. It returns nil if
+// the node never moved shards or has no persistent storage.
+func readShardState(path string) (*shardState, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	state := new(shardState)
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid shard state %s: %v", path, err)
+	}
+	return state, nil
+}
+
+// writeShardState persists the shard state at path, replacing the previous one
+// atomically. Nodes without persistent storage keep nothing.
+func writeShardState(path string, state *shardState) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestShardState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shard-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, shardStateFile)
+
+	// Nodes that never moved have no state
+	if state, err := readShardState(path); state != nil || err != nil {
+		t.Fatalf("state of unmoved node: have %v, %v", state, err)
+	}
+	// Moves are persisted along with the database of the new shard
+	moved := newShardState(1, 2)
+	if moved.Database != "chaindata-shard2" {
+		t.Errorf("database mismatch: have %s, want chaindata-shard2", moved.Database)
+	}
+	if err := writeShardState(path, moved); err != nil {
+		t.Fatalf("failed to write state: %v", err)
+	}
+	state, err := readShardState(path)
+	if err != nil {
+		t.Fatalf("failed to read state: %v", err)
+	}
+	if !reflect.DeepEqual(state, moved) {
+		t.Errorf("state mismatch: have %+v, want %+v", state, moved)
+	}
+	// Moving back to the first shard returns to its original database
+	if back := newShardState(state.Origin, 1); back.Database != "chaindata" {
+		t.Errorf("database of origin mismatch: have %s, want chaindata", back.Database)
+	}
+	// Nodes without persistent storage keep nothing
+	if err := writeShardState("", moved); err != nil {
+		t.Errorf("failed to skip ephemeral state: %v", err)
+	}
+	if state, err := readShardState(""); state != nil || err != nil {
+		t.Errorf("ephemeral state: have %v, %v", state, err)
+	}
+}
@@ -36,6 +36,8 @@ const (
 	// This is the target size for the packs of transactions sent by txsyncLoop.
 	// A pack can get larger than this if a single transactions exceeds this size.
 	txsyncPackSize = 100 * 1024
+
+	refProofsTimeout = 10 * time.Second // Time allowance for a peer to answer a reference proofs request
 )
 
 type txsync struct {
@@ -212,6 +214,12 @@ func (pm *ProtocolManager) synchronise(ref bool, peer *peer) {
 	if pTd.Cmp(td) <= 0 {
 		return
 	}
+	if ref && pm.refchain.HeadersOnly() {
+		if peer.sharded {
+			pm.syncRefProofs(peer)
+		}
+		return
+	}
 	// Otherwise try to sync with the downloader
 	mode := downloader.FullSync
 
@@ -288,3 +296,73 @@ func (pm *ProtocolManager) synchronise(ref bool, peer *peer) {
 		}
 	}
 }
+
+// refProofsPacket is a batch of reference proofs delivered by a peer.
+type refProofsPacket struct {
+	peer   string
+	proofs []*refProof
+}
+
+// syncRefProofs extends a header-only reference chain with the blocks known
+// to peer, verifying the receipt proofs of their cross-shard transactions.
+func (pm *ProtocolManager) syncRefProofs(peer *peer) {
+	if !atomic.CompareAndSwapInt32(&pm.refProofsSyncing, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&pm.refProofsSyncing, 0)
+
+	for {
+		origin := pm.refchain.CurrentBlock().NumberU64() + 1
+		if err := peer.RequestRefProofs(origin, uint64(downloader.MaxBlockFetch)); err != nil {
+			return
+		}
+		proofs, ok := pm.waitRefProofs(peer.id, origin)
+		if !ok || len(proofs) == 0 {
+			return
+		}
+		headers := make([]*types.Header, len(proofs))
+		refTxs := make([][]*types.RefTx, len(proofs))
+		for i, proof := range proofs {
+			txs, err := types.VerifyRefReceipts(proof.Header, proof.Txs)
+			if err != nil {
+				log.Warn("Invalid reference proofs", "peer", peer.id, "number", proof.Header.Number, "err", err)
+				pm.removePeer(peer.id)
+				return
+			}
+			headers[i], refTxs[i] = proof.Header, txs
+		}
+		if n, err := pm.refchain.InsertRefHeaders(headers, refTxs); err != nil {
+			log.Warn("Failed to insert reference headers", "peer", peer.id, "number", headers[n].Number, "err", err)
+			pm.removePeer(peer.id)
+			return
+		}
+		if len(proofs) < downloader.MaxBlockFetch {
+			return
+		}
+	}
+}
+
+// waitRefProofs waits for the answer of peer to a reference proofs request
+// starting at origin, dropping stale answers to earlier requests.
+func (pm *ProtocolManager) waitRefProofs(peer string, origin uint64) ([]*refProof, bool) {
+	timeout := time.NewTimer(refProofsTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case packet := <-pm.refProofsCh:
+			if packet.peer != peer {
+				continue
+			}
+			if len(packet.proofs) > 0 && packet.proofs[0].Header.Number.Uint64() != origin {
+				continue
+			}
+			return packet.proofs, true
+		case <-timeout.C:
+			log.Debug("Reference proofs request timed out", "peer", peer, "origin", origin)
+			return nil, false
+		case <-pm.quitSync:
+			return nil, false
+		}
+	}
+}
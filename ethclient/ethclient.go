@@ -509,6 +509,45 @@ func (ec *Client) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64
 	return uint64(hex), nil
 }
 
+// EstimateCrossShardAccessList returns the shards, accounts and storage keys
+// accessed by msg when run as the call of a cross-shard transaction against
+// the committed state of every shard. Accounts are grouped per shard holding
+// them; shards may be nil and only places accounts existing on several shards.
+func (ec *Client) EstimateCrossShardAccessList(ctx context.Context, msg ethereum.CallMsg, shards map[common.Address]uint64) ([]uint64, []ethereum.CrossShardContract, error) {
+	var result struct {
+		Shards    []hexutil.Uint64 `json:"shards"`
+		Contracts []struct {
+			Shard   hexutil.Uint64 `json:"shard"`
+			Address common.Address `json:"address"`
+			Reads   []common.Hash  `json:"reads"`
+			Writes  []common.Hash  `json:"writes"`
+		} `json:"contracts"`
+	}
+	arg := toCallArg(msg).(map[string]interface{})
+	owners := make(map[common.Address]hexutil.Uint64, len(shards))
+	for addr, shard := range shards {
+		owners[addr] = hexutil.Uint64(shard)
+	}
+	arg["shards"] = owners
+	if err := ec.c.CallContext(ctx, &result, "eth_estimateCrossShardAccessList", arg); err != nil {
+		return nil, nil, err
+	}
+	involved := make([]uint64, len(result.Shards))
+	for i, shard := range result.Shards {
+		involved[i] = uint64(shard)
+	}
+	contracts := make([]ethereum.CrossShardContract, len(result.Contracts))
+	for i, contract := range result.Contracts {
+		contracts[i] = ethereum.CrossShardContract{
+			Shard:   uint64(contract.Shard),
+			Address: contract.Address,
+			Reads:   contract.Reads,
+			Writes:  contract.Writes,
+		}
+	}
+	return involved, contracts, nil
+}
+
 // SendTransaction injects a signed transaction into the pending pool for execution.
 //
 // If the transaction was a contract creation use the TransactionReceipt method to get the
@@ -525,6 +564,14 @@ func (ec *Client) SendTransaction(ctx context.Context, tx *types.Transaction, ar
 	}
 }
 
+// SendCrossShardTransaction signs a cross-shard transaction with the account of
+// msg.From on the node and submits it to the reference chain.
+func (ec *Client) SendCrossShardTransaction(ctx context.Context, msg ethereum.CrossShardMsg) (common.Hash, error) {
+	var hash common.Hash
+	err := ec.c.CallContext(ctx, &hash, "eth_sendCrossShardTransaction", toCrossShardArg(msg))
+	return hash, err
+}
+
 // Quorum
 //
 // Retrieve encrypted payload hash from the private transaction manager if configured
@@ -554,3 +601,38 @@ func toCallArg(msg ethereum.CallMsg) interface{} {
 	}
 	return arg
 }
+
+func toCrossShardArg(msg ethereum.CrossShardMsg) interface{} {
+	shards := make([]hexutil.Uint64, len(msg.Shards))
+	for i, shard := range msg.Shards {
+		shards[i] = hexutil.Uint64(shard)
+	}
+	contracts := make([]interface{}, len(msg.Contracts))
+	for i, contract := range msg.Contracts {
+		contracts[i] = map[string]interface{}{
+			"shard":   hexutil.Uint64(contract.Shard),
+			"address": contract.Address,
+			"reads":   contract.Reads,
+			"writes":  contract.Writes,
+		}
+	}
+	call := toCallArg(msg.Call).(map[string]interface{})
+	if msg.Call.From == (common.Address{}) {
+		delete(call, "from") // defaults to the sender of the transaction
+	}
+	call["nonce"] = hexutil.Uint64(msg.CallNonce)
+	arg := map[string]interface{}{
+		"from":      msg.From,
+		"selector":  hexutil.Bytes(msg.Selector),
+		"shards":    shards,
+		"contracts": contracts,
+		"call":      call,
+	}
+	if msg.Gas != 0 {
+		arg["gas"] = hexutil.Uint64(msg.Gas)
+	}
+	if msg.GasPrice != nil {
+		arg["gasPrice"] = (*hexutil.Big)(msg.GasPrice)
+	}
+	return arg
+}
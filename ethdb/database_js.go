@@ -42,6 +42,11 @@ func (db *LDBDatabase) Put(key []byte, value []byte) error {
 	return errNotSupported
 }
 
+// SyncPut puts the given key / value to the database and flushes it to disk
+func (db *LDBDatabase) SyncPut(key []byte, value []byte) error {
+	return errNotSupported
+}
+
 func (db *LDBDatabase) Has(key []byte) (bool, error) {
 	return false, errNotSupported
 }
@@ -54,6 +54,25 @@ func TestLDB_PutGet(t *testing.T) {
 	testPutGet(db, t)
 }
 
+func TestLDB_SyncPut(t *testing.T) {
+	db, remove := newTestLDB()
+	defer remove()
+
+	var putter ethdb.SyncPutter = db
+	for _, v := range test_values {
+		if err := putter.SyncPut([]byte(v), []byte(v)); err != nil {
+			t.Fatalf("sync put failed: %v", err)
+		}
+		data, err := db.Get([]byte(v))
+		if err != nil {
+			t.Fatalf("get failed: %v", err)
+		}
+		if !bytes.Equal(data, []byte(v)) {
+			t.Fatalf("get returned wrong result, got %q expected %q", string(data), v)
+		}
+	}
+}
+
 func TestMemoryDB_PutGet(t *testing.T) {
 	testPutGet(ethdb.NewMemDatabase(), t)
 }
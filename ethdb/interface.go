@@ -30,6 +30,12 @@ type Deleter interface {
 	Delete(key []byte) error
 }
 
+// SyncPutter wraps the write operation of databases able to flush it to disk
+// before returning.
+type SyncPutter interface {
+	SyncPut(key []byte, value []byte) error
+}
+
 // Database wraps all database operations. All methods are safe for concurrent use.
 type Database interface {
 	Putter
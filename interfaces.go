@@ -123,6 +123,28 @@ type CallMsg struct {
 	Data     []byte   // input data, usually an ABI-encoded contract method invocation
 }
 
+// CrossShardContract lists the storage keys of a contract read and written by
+// a cross-shard transaction.
+type CrossShardContract struct {
+	Shard   uint64
+	Address common.Address
+	Reads   []common.Hash // keys only read by the transaction
+	Writes  []common.Hash // keys written by the transaction
+}
+
+// CrossShardMsg contains parameters for cross-shard transactions submitted to
+// the reference chain.
+type CrossShardMsg struct {
+	From      common.Address // the account signing the reference chain transaction
+	Gas       uint64         // if 0, a default limit is derived from the encoded size
+	GasPrice  *big.Int       // wei <-> gas exchange ratio
+	Selector  []byte         // reference contract method accepting the transaction
+	Shards    []uint64       // shards involved in the transaction
+	Contracts []CrossShardContract
+	Call      CallMsg // call executed by the involved shards
+	CallNonce uint64  // nonce of the call sender on the shard holding its account
+}
+
 // A ContractCaller provides contract calls, essentially transactions that are executed by
 // the EVM but not mined into the blockchain. ContractCall is a low-level method to
 // execute such calls. For applications which are structured around specific contracts,
@@ -22,6 +22,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"sort"
 	"strings"
 	"time"
 
@@ -742,6 +743,11 @@ func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr
 	if state == nil || err != nil {
 		return nil, 0, false, err
 	}
+	return s.applyCall(ctx, args, state, header, vmCfg, timeout)
+}
+
+// applyCall executes the given call on state, the state of header.
+func (s *PublicBlockChainAPI) applyCall(ctx context.Context, args CallArgs, state vm.MinimalApiState, header *types.Header, vmCfg vm.Config, timeout time.Duration) ([]byte, uint64, bool, error) {
 	// Set sender address or use a default if none specified
 	addr := args.From
 	if addr == (common.Address{}) {
@@ -881,6 +887,200 @@ func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (h
 	return hexutil.Uint64(hi), nil
 }
 
+// maxAccessListRounds is the number of times a cross-shard call is traced
+// again with the newly fetched foreign data before its read-write set is
+// considered unstable.
+const maxAccessListRounds = 8
+
+// CrossShardAccessListArgs represents the arguments for estimating the
+// read-write set of a cross-shard call. Shards optionally assigns accounts to
+// the shard holding them, for accounts present in the state of several shards.
+type CrossShardAccessListArgs struct {
+	CallArgs
+	Shards map[common.Address]hexutil.Uint64 `json:"shards"`
+}
+
+// CrossShardAccessList is the read-write set of a cross-shard call, in the
+// format accepted by SendCrossShardTransaction.
+type CrossShardAccessList struct {
+	Shards    []hexutil.Uint64         `json:"shards"`
+	Contracts []CrossShardContractArgs `json:"contracts"`
+	Gas       hexutil.Uint64           `json:"gas"`
+	Failed    bool                     `json:"failed"`
+}
+
+// EstimateCrossShardAccessList runs the inner call of a cross-shard transaction
+// against the latest committed state of every shard and returns every account
+// and storage key it accesses, grouped per shard. Values of other shards are
+// fetched with their proofs against the commitments known to the reference
+// chain, and the call is traced again until the accessed keys stop changing.
+// An account is held by the local shard if it exists there, otherwise by the
+// shard whose committed state proves it.
+func (s *PublicBlockChainAPI) EstimateCrossShardAccessList(ctx context.Context, args CrossShardAccessListArgs) (*CrossShardAccessList, error) {
+	commits, err := s.b.ShardCommitments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	myshard := s.b.CurrentBlock().Header().Shard
+	number := uint64(0)
+	if commit := commits[myshard]; commit != nil {
+		number = commit.BlockNum
+	}
+	var (
+		homes   = make(map[common.Address]uint64)       // Shard holding each accessed account
+		foreign = make(map[common.Address]*types.CData) // Verified values of accounts of other shards
+	)
+	for round := 0; round < maxAccessListRounds; round++ {
+		values := make([]*types.CData, 0, len(foreign))
+		for _, cdata := range foreign {
+			values = append(values, cdata)
+		}
+		state, header, err := s.b.CommittedState(ctx, number, values)
+		if err != nil {
+			return nil, err
+		}
+		tracer := vm.NewAccessListTracer()
+		_, gas, failed, err := s.applyCall(ctx, args.CallArgs, state, header, vm.Config{Debug: true, Tracer: tracer}, 5*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		accessed := tracer.AccessList()
+		if err := s.placeAccounts(ctx, state, myshard, commits, accessed, args.Shards, homes, foreign); err != nil {
+			return nil, err
+		}
+		// Fetch the keys of other shards the call read from the local copy
+		missing := make(map[uint64][]*types.CKeys)
+		for _, ck := range accessed {
+			shard := homes[ck.Addr]
+			if shard == myshard {
+				continue
+			}
+			var keys []common.Hash
+			for _, key := range ck.Keys {
+				if _, ok := foreign[ck.Addr].Data[key]; !ok {
+					keys = append(keys, key)
+				}
+			}
+			if len(keys) > 0 {
+				missing[shard] = append(missing[shard], &types.CKeys{Addr: ck.Addr, Keys: keys})
+			}
+		}
+		if len(missing) == 0 {
+			return crossShardAccessList(accessed, homes, gas, failed), nil
+		}
+		for shard, keys := range missing {
+			vals, _, err := s.b.GetStateData(ctx, shard, commits[shard].StateRoot, keys)
+			if err != nil {
+				return nil, err
+			}
+			for i, kv := range vals {
+				for j, key := range keys[i].Keys {
+					foreign[kv.Addr].Data[key] = kv.Data[j]
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("read-write set still changing after %d rounds", maxAccessListRounds)
+}
+
+// placeAccounts assigns the accounts in accessed not placed yet to the shard
+// holding them, recording the committed account fields of foreign ones.
+func (s *PublicBlockChainAPI) placeAccounts(ctx context.Context, state vm.MinimalApiState, myshard uint64, commits map[uint64]*types.Commitment, accessed []*types.CKeys, hints map[common.Address]hexutil.Uint64, homes map[common.Address]uint64, foreign map[common.Address]*types.CData) error {
+	var (
+		probe  []*types.CKeys
+		owners = make(map[common.Address][]uint64)
+	)
+	for _, ck := range accessed {
+		if _, ok := homes[ck.Addr]; ok {
+			continue
+		}
+		if shard, ok := hints[ck.Addr]; ok {
+			homes[ck.Addr] = uint64(shard)
+			if uint64(shard) != myshard {
+				owners[ck.Addr] = []uint64{uint64(shard)}
+				probe = append(probe, &types.CKeys{Addr: ck.Addr})
+			}
+			continue
+		}
+		if state.GetCodeHash(ck.Addr) != (common.Hash{}) {
+			homes[ck.Addr] = myshard
+			continue
+		}
+		probe = append(probe, &types.CKeys{Addr: ck.Addr})
+	}
+	if len(probe) == 0 {
+		return nil
+	}
+	for shard, commit := range commits {
+		if shard == myshard {
+			continue
+		}
+		vals, exists, err := s.b.GetStateData(ctx, shard, commit.StateRoot, probe)
+		if err != nil {
+			return err
+		}
+		for i, kv := range vals {
+			if home, ok := homes[kv.Addr]; ok && home != shard {
+				continue
+			}
+			if exists[i] || homes[kv.Addr] == shard {
+				owners[kv.Addr] = append(owners[kv.Addr], shard)
+				foreign[kv.Addr] = &types.CData{Addr: kv.Addr, Balance: kv.Balance, Nonce: kv.Nonce, Data: make(map[common.Hash]common.Hash)}
+			}
+		}
+	}
+	for _, ck := range probe {
+		if _, ok := homes[ck.Addr]; ok {
+			if foreign[ck.Addr] == nil {
+				return fmt.Errorf("no commitment known for shard %d of account %x", homes[ck.Addr], ck.Addr)
+			}
+			continue
+		}
+		switch len(owners[ck.Addr]) {
+		case 0:
+			// Accounts created by the call are held by the local shard
+			homes[ck.Addr] = myshard
+		case 1:
+			homes[ck.Addr] = owners[ck.Addr][0]
+		default:
+			return fmt.Errorf("account %x exists on shards %v, its shard must be given", ck.Addr, owners[ck.Addr])
+		}
+	}
+	return nil
+}
+
+// crossShardAccessList groups the accessed keys per shard.
+func crossShardAccessList(accessed []*types.CKeys, homes map[common.Address]uint64, gas uint64, failed bool) *CrossShardAccessList {
+	var (
+		result = &CrossShardAccessList{Gas: hexutil.Uint64(gas), Failed: failed}
+		seen   = make(map[uint64]bool)
+	)
+	for _, ck := range accessed {
+		shard := hexutil.Uint64(homes[ck.Addr])
+		if !seen[uint64(shard)] {
+			seen[uint64(shard)] = true
+			result.Shards = append(result.Shards, shard)
+		}
+		contract := CrossShardContractArgs{Shard: shard, Address: ck.Addr, Reads: []common.Hash{}, Writes: ck.WKeys}
+		written := make(map[common.Hash]bool, len(ck.WKeys))
+		for _, key := range ck.WKeys {
+			written[key] = true
+		}
+		for _, key := range ck.Keys {
+			if !written[key] {
+				contract.Reads = append(contract.Reads, key)
+			}
+		}
+		if contract.Writes == nil {
+			contract.Writes = []common.Hash{}
+		}
+		result.Contracts = append(result.Contracts, contract)
+	}
+	sort.Slice(result.Shards, func(i, j int) bool { return result.Shards[i] < result.Shards[j] })
+	sort.SliceStable(result.Contracts, func(i, j int) bool { return result.Contracts[i].Shard < result.Contracts[j].Shard })
+	return result
+}
+
 // ExecutionResult groups all structured logs emitted by the EVM
 // while replaying a transaction in debug mode as well as transaction
 // execution status, the amount of gas used and the return value
@@ -1332,6 +1532,10 @@ func (args *SendTxArgs) setDefaults(ctx context.Context, b Backend) error {
 		args.Value = new(hexutil.Big)
 	}
 	if args.Nonce == nil {
+		// The local pool only tracks the nonces of the local shard
+		if home := types.HomeShard(uint64(*args.TxType), uint64(*args.Shard)); home != b.CurrentBlock().Shard() {
+			return fmt.Errorf("nonce not specified for a transaction of shard %d", home)
+		}
 		nonce, err := b.GetPoolNonce(ctx, args.From)
 		if err != nil {
 			return err
@@ -1362,7 +1566,11 @@ func (args *SendTxArgs) toTransaction() *types.Transaction {
 // TODO: this submits a signed transaction, if it is a signed private transaction that should already be recorded in the tx.
 // submitTransaction is a helper function that submits tx to txPool and logs a message.
 func submitTransaction(ctx context.Context, b Backend, tx *types.Transaction) (common.Hash, error) {
-	if err := b.SendTx(ctx, tx); err != nil {
+	if err := b.SendTx(ctx, tx); err == core.ErrForwarded {
+		// The receipt has to be queried from a node of the shard of the transaction
+		log.Info("Forwarded transaction to its shard", "fullhash", tx.Hash().Hex(), "shard", tx.HomeShard())
+		return tx.Hash(), nil
+	} else if err != nil {
 		return common.Hash{}, err
 	}
 	if tx.To() == nil {
@@ -1452,6 +1660,148 @@ func (s *PublicTransactionPoolAPI) SendTransaction(ctx context.Context, args Sen
 
 }
 
+// CrossShardContractArgs lists the storage keys of a contract accessed by a
+// cross-shard transaction. Keys in Writes are read as well and must not be
+// repeated in Reads.
+type CrossShardContractArgs struct {
+	Shard   hexutil.Uint64 `json:"shard"`
+	Address common.Address `json:"address"`
+	Reads   []common.Hash  `json:"reads"`
+	Writes  []common.Hash  `json:"writes"`
+}
+
+// CrossShardCallArgs represents the call executed by every shard involved in
+// a cross-shard transaction. Nonce is the sender's nonce on the shard holding
+// its account, which the reference chain nonce says nothing about.
+type CrossShardCallArgs struct {
+	From     *common.Address `json:"from"`
+	To       *common.Address `json:"to"`
+	Gas      *hexutil.Uint64 `json:"gas"`
+	GasPrice *hexutil.Big    `json:"gasPrice"`
+	Value    *hexutil.Big    `json:"value"`
+	Nonce    *hexutil.Uint64 `json:"nonce"`
+	Data     hexutil.Bytes   `json:"data"`
+}
+
+// CrossShardArgs represents the arguments to submit a new cross-shard
+// transaction to the reference chain.
+type CrossShardArgs struct {
+	From      common.Address           `json:"from"`
+	Gas       *hexutil.Uint64          `json:"gas"`
+	GasPrice  *hexutil.Big             `json:"gasPrice"`
+	Nonce     *hexutil.Uint64          `json:"nonce"`
+	Selector  hexutil.Bytes            `json:"selector"`
+	Shards    []hexutil.Uint64         `json:"shards"`
+	Contracts []CrossShardContractArgs `json:"contracts"`
+	Call      CrossShardCallArgs       `json:"call"`
+}
+
+// setDefaults is a helper function that fills in default values for unspecified
+// fields of the transaction and of its inner call.
+func (args *CrossShardArgs) setDefaults(ctx context.Context, b Backend) error {
+	if args.Call.To == nil {
+		return types.ErrMissingReceiver
+	}
+	if args.Call.From != nil && *args.Call.From != args.From {
+		return fmt.Errorf("call sender %x differs from transaction sender %x", *args.Call.From, args.From)
+	}
+	if args.Call.Nonce == nil {
+		return fmt.Errorf("call nonce not specified")
+	}
+	if args.GasPrice == nil {
+		price, err := b.SuggestPrice(ctx)
+		if err != nil {
+			return err
+		}
+		args.GasPrice = (*hexutil.Big)(price)
+	}
+	if args.Nonce == nil {
+		nonce, err := b.GetPoolNonce(ctx, args.From)
+		if err != nil {
+			return err
+		}
+		args.Nonce = (*hexutil.Uint64)(&nonce)
+	}
+	if args.Call.From == nil {
+		args.Call.From = &args.From
+	}
+	if args.Call.Gas == nil {
+		args.Call.Gas = new(hexutil.Uint64)
+		*(*uint64)(args.Call.Gas) = 90000
+	}
+	if args.Call.GasPrice == nil {
+		args.Call.GasPrice = args.GasPrice
+	}
+	if args.Call.Value == nil {
+		args.Call.Value = new(hexutil.Big)
+	}
+	return nil
+}
+
+// toTransaction encodes the shards, read-write sets and inner call into a
+// transaction to the reference contract, rejecting malformed read-write sets.
+func (args *CrossShardArgs) toTransaction() (*types.Transaction, error) {
+	shards := make([]uint64, len(args.Shards))
+	for i, shard := range args.Shards {
+		shards[i] = uint64(shard)
+	}
+	contracts := make(map[uint64][]*types.CKeys)
+	for _, contract := range args.Contracts {
+		ck := &types.CKeys{Addr: contract.Address, Keys: []common.Hash{}}
+		ck.Keys = append(ck.Keys, contract.Reads...)
+		ck.Keys = append(ck.Keys, contract.Writes...)
+		ck.WKeys = append(ck.WKeys, contract.Writes...)
+		contracts[uint64(contract.Shard)] = append(contracts[uint64(contract.Shard)], ck)
+	}
+	call := types.NewCrossTransaction(types.CrossShardLocal, uint64(*args.Call.Nonce), 0, *args.Call.To, *args.Call.From, (*big.Int)(args.Call.Value), uint64(*args.Call.Gas), (*big.Int)(args.Call.GasPrice), args.Call.Data)
+	data, err := types.EncodeCrossTx(args.Selector, shards, contracts, call)
+	if err != nil {
+		return nil, err
+	}
+	gas := uint64(90000)
+	if args.Gas != nil {
+		gas = uint64(*args.Gas)
+	} else if intrinsic, err := core.IntrinsicGas(data, false, true); err == nil {
+		gas += intrinsic
+	}
+	return types.NewTransaction(types.CrossShard, uint64(*args.Nonce), 0, types.RefAddress(), new(big.Int), gas, (*big.Int)(args.GasPrice), data), nil
+}
+
+// SendCrossShardTransaction creates a cross-shard transaction from the given
+// shards, read-write sets and inner call, signs it and submits it to the
+// transaction pool for inclusion in the reference chain.
+func (s *PublicTransactionPoolAPI) SendCrossShardTransaction(ctx context.Context, args CrossShardArgs) (common.Hash, error) {
+	// Look up the wallet containing the requested signer
+	account := accounts.Account{Address: args.From}
+
+	wallet, err := s.b.AccountManager().Find(account)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if args.Nonce == nil {
+		// Hold the addresse's mutex around signing to prevent concurrent assignment of
+		// the same nonce to multiple accounts.
+		s.nonceLock.LockAddr(args.From)
+		defer s.nonceLock.UnlockAddr(args.From)
+	}
+	if err := args.setDefaults(ctx, s.b); err != nil {
+		return common.Hash{}, err
+	}
+	tx, err := args.toTransaction()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	var chainID *big.Int
+	if config := s.b.ChainConfig(); config.IsEIP155(s.b.CurrentBlock().Number()) {
+		chainID = config.ChainID
+	}
+	signed, err := wallet.SignTx(account, tx, chainID)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return submitTransaction(ctx, s.b, signed)
+}
+
 // SendRawTransaction will add the signed transaction to the transaction pool.
 // The sender is responsible for signing the transaction and using the correct nonce.
 func (s *PublicTransactionPoolAPI) SendRawTransaction(ctx context.Context, encodedTx hexutil.Bytes) (common.Hash, error) {
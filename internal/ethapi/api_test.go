@@ -0,0 +1,123 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// testChain is an empty chain a transaction pool runs on.
+type testChain struct {
+	statedb       *state.StateDB
+	chainHeadFeed event.Feed
+}
+
+func (c *testChain) IsProcessed(common.Hash) bool { return false }
+
+func (c *testChain) CurrentBlock() *types.Block {
+	return types.NewBlock(&types.Header{GasLimit: 1000000}, nil, nil, nil)
+}
+
+func (c *testChain) GetBlock(common.Hash, uint64) *types.Block { return c.CurrentBlock() }
+
+func (c *testChain) GetBlockByNumber(uint64) *types.Block { return c.CurrentBlock() }
+
+func (c *testChain) StateAt(common.Hash) (*state.StateDB, *state.StateDB, error) {
+	return c.statedb, c.statedb, nil
+}
+
+func (c *testChain) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
+	return c.chainHeadFeed.Subscribe(ch)
+}
+
+// poolBackend submits transactions to a transaction pool.
+type poolBackend struct {
+	Backend
+	pool *core.TxPool
+}
+
+func (b *poolBackend) SendTx(ctx context.Context, tx *types.Transaction) error {
+	return b.pool.AddLocal(tx)
+}
+
+func TestSubmitForwardedTransaction(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(ethdb.NewMemDatabase()))
+	config := core.DefaultTxPoolConfig
+	config.Journal = ""
+	pool := core.NewTxPool(config, params.TestChainConfig, common.Address{}, 1, nil, &testChain{statedb: statedb})
+	defer pool.Stop()
+
+	forwarded := make(chan core.ForwardTxsEvent, 1)
+	sub := pool.SubscribeForwardTxsEvent(forwarded)
+	defer sub.Unsubscribe()
+
+	var (
+		ctx     = context.Background()
+		backend = &poolBackend{pool: pool}
+		signer  = types.NewEIP155Signer(params.TestChainConfig.ChainID)
+		key, _  = crypto.GenerateKey()
+	)
+	// Transactions of other shards are handed over to the peers of their shard
+	// without being checked against the local state
+	tx, _ := types.SignTx(types.NewTransaction(types.IntraShard, 0, 2, common.Address{1}, big.NewInt(1), params.TxGas, big.NewInt(1), nil), signer, key)
+	hash, err := submitTransaction(ctx, backend, tx)
+	if err != nil || hash != tx.Hash() {
+		t.Fatalf("forwarded transaction: have %x, %v, want %x, nil", hash, err, tx.Hash())
+	}
+	select {
+	case ev := <-forwarded:
+		if ev.Shard != 2 || len(ev.Txs) != 1 || ev.Txs[0].Hash() != tx.Hash() {
+			t.Errorf("forward event mismatch: shard %d, %d transactions", ev.Shard, len(ev.Txs))
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("transaction not forwarded")
+	}
+	if pending, queued := pool.Stats(); pending != 0 || queued != 0 {
+		t.Errorf("forwarded transaction pooled: %d pending, %d queued", pending, queued)
+	}
+	// Transactions are only forwarded once
+	if _, err := submitTransaction(ctx, backend, tx); err == nil {
+		t.Errorf("transaction forwarded twice")
+	}
+	// Invalid transactions of other shards are not forwarded
+	invalid, _ := types.SignTx(types.NewTransaction(types.IntraShard, 0, 2, common.Address{1}, big.NewInt(1), 2000000, big.NewInt(1), nil), signer, key)
+	if _, err := submitTransaction(ctx, backend, invalid); err != core.ErrGasLimit {
+		t.Errorf("transaction over the gas limit: have %v, want %v", err, core.ErrGasLimit)
+	}
+	// Transactions of the local shard are still checked against its state
+	local, _ := types.SignTx(types.NewTransaction(types.IntraShard, 0, 1, common.Address{1}, big.NewInt(1), params.TxGas, big.NewInt(1), nil), signer, key)
+	if _, err := submitTransaction(ctx, backend, local); err != core.ErrInsufficientFunds {
+		t.Errorf("unfunded local transaction: have %v, want %v", err, core.ErrInsufficientFunds)
+	}
+	select {
+	case ev := <-forwarded:
+		t.Errorf("unexpected forward to shard %d", ev.Shard)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
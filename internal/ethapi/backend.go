@@ -66,6 +66,11 @@ type Backend interface {
 	TxPoolContent() (map[common.Address]types.Transactions, map[common.Address]types.Transactions)
 	SubscribeNewTxsEvent(chan<- core.NewTxsEvent) event.Subscription
 
+	// Sharding API
+	ShardCommitments(ctx context.Context) (map[uint64]*types.Commitment, error)
+	CommittedState(ctx context.Context, number uint64, foreign []*types.CData) (vm.MinimalApiState, *types.Header, error)
+	GetStateData(ctx context.Context, shard uint64, root common.Hash, keys []*types.CKeys) ([]*types.KeyVal, []bool, error)
+
 	ChainConfig() *params.ChainConfig
 	CurrentBlock() *types.Block
 }
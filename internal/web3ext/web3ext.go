@@ -28,6 +28,7 @@ var Modules = map[string]string{
 	"net":              Net_JS,
 	"personal":         Personal_JS,
 	"rpc":              RPC_JS,
+	"shard":            Shard_JS,
 	"shh":              Shh_JS,
 	"swarmfs":          SWARMFS_JS,
 	"txpool":           TxPool_JS,
@@ -477,6 +478,11 @@ web3._extend({
 			params: 1,
 			inputFormatter: [web3._extend.formatters.inputTransactionFormatter]
 		}),
+		new web3._extend.Method({
+			name: 'getCrossShardReceipt',
+			call: 'eth_getCrossShardReceipt',
+			params: 1
+		}),
 		new web3._extend.Method({
 			name: 'getRawTransaction',
 			call: 'eth_getRawTransactionByHash',
@@ -501,6 +507,16 @@ web3._extend({
 			call: 'eth_storageRoot',
 			params: 2,
 			inputFormatter: [web3._extend.formatters.inputAddressFormatter, null]
+		}),
+		new web3._extend.Method({
+			name: 'sendCrossShardTransaction',
+			call: 'eth_sendCrossShardTransaction',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'estimateCrossShardAccessList',
+			call: 'eth_estimateCrossShardAccessList',
+			params: 1
 		})
 	],
 	properties: [
@@ -577,6 +593,50 @@ web3._extend({
 	]
 });
 `
+
+const Shard_JS = `
+web3._extend({
+	property: 'shard',
+	methods: [
+		new web3._extend.Method({
+			name: 'getCommitment',
+			call: 'shard_getCommitment',
+			params: 2,
+			inputFormatter: [null, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'pendingCrossTxs',
+			call: 'shard_pendingCrossTxs',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'dataCacheStatus',
+			call: 'shard_dataCacheStatus',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'lockedKeys',
+			call: 'shard_lockedKeys',
+			params: 2,
+			inputFormatter: [null, web3._extend.formatters.inputAddressFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'crossTxStatus',
+			call: 'shard_crossTxStatus',
+			params: 1
+		}),
+	],
+	properties: [
+		new web3._extend.Property({
+			name: 'info',
+			getter: 'shard_info'
+		}),
+	]
+});
+`
+
 const Personal_JS = `
 web3._extend({
 	property: 'personal',
@@ -931,6 +991,43 @@ web3._extend({
 			call: 'istanbul_discard',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'proposeMove',
+			call: 'istanbul_proposeMove',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'discardMove',
+			call: 'istanbul_discardMove',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'getShardTopology',
+			call: 'istanbul_getShardTopology',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getShardCheckpoint',
+			call: 'istanbul_getShardCheckpoint',
+			params: 2,
+			inputFormatter: [null, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getShardBlockProof',
+			call: 'istanbul_getShardBlockProof',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'verifyShardBlock',
+			call: 'istanbul_verifyShardBlock',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'getBLSKey',
+			call: 'istanbul_getBLSKey',
+			params: 0
+		}),
 
 		new web3._extend.Method({
 			name: 'getSignersFromBlock',
@@ -950,6 +1047,10 @@ web3._extend({
 			name: 'candidates',
 			getter: 'istanbul_candidates'
 		}),
+		new web3._extend.Property({
+			name: 'moves',
+			getter: 'istanbul_moves'
+		}),
 		new web3._extend.Property({
 			name: 'nodeAddress',
 			getter: 'istanbul_nodeAddress'
@@ -18,6 +18,7 @@ package les
 
 import (
 	"context"
+	"fmt"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/accounts"
@@ -112,6 +113,18 @@ func (b *LesApiBackend) GetEVM(ctx context.Context, msg core.Message, apiState v
 	return vm.NewEVM(context, nil, statedb, statedb, b.eth.chainConfig, vmCfg), statedb.Error, nil
 }
 
+func (b *LesApiBackend) ShardCommitments(ctx context.Context) (map[uint64]*types.Commitment, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func (b *LesApiBackend) CommittedState(ctx context.Context, number uint64, foreign []*types.CData) (vm.MinimalApiState, *types.Header, error) {
+	return nil, nil, fmt.Errorf("not supported")
+}
+
+func (b *LesApiBackend) GetStateData(ctx context.Context, shard uint64, root common.Hash, keys []*types.CKeys) ([]*types.KeyVal, []bool, error) {
+	return nil, nil, fmt.Errorf("not supported")
+}
+
 func (b *LesApiBackend) SendTx(ctx context.Context, signedTx *types.Transaction) error {
 	return b.eth.txPool.Add(ctx, signedTx)
 }
@@ -164,6 +177,15 @@ func (b *LesApiBackend) SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEven
 	return b.eth.blockchain.SubscribeRemovedLogsEvent(ch)
 }
 
+// SubscribeCrossShardEvent returns a subscription that never fires, as light
+// clients do not track cross-shard transactions.
+func (b *LesApiBackend) SubscribeCrossShardEvent(ch chan<- core.CrossShardEvent) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
 func (b *LesApiBackend) Downloader() *downloader.Downloader {
 	return b.eth.Downloader()
 }
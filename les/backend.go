@@ -102,7 +102,7 @@ func New(ctx *node.ServiceContext, config *eth.Config) (*LightEthereum, error) {
 		peers:          peers,
 		reqDist:        newRequestDistributor(peers, quitSync),
 		accountManager: ctx.AccountManager,
-		engine:         eth.CreateConsensusEngine(ctx, chainConfig, config, uint64(0), uint64(0), uint64(0), nil, false, chainDb, nil),
+		engine:         eth.CreateConsensusEngine(ctx, chainConfig, config, uint64(0), uint64(0), nil, nil, false, chainDb, nil),
 		shutdownChan:   make(chan bool),
 		networkId:      config.NetworkId,
 		bloomRequests:  make(chan chan *bloombits.Retrieval),
@@ -0,0 +1,65 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package eventlog records structured cross-shard events as JSON lines in
+// size-rotated files. Recording is disabled until Setup is called.
+package eventlog
+
+import (
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// DefaultLimit is the size in bytes after which an event file is rotated.
+const DefaultLimit = 16 * 1024 * 1024
+
+var (
+	logger  = log.New()
+	enabled int32
+)
+
+func init() {
+	logger.SetHandler(log.DiscardHandler())
+}
+
+// Setup starts recording events into dir, starting a new file whenever the
+// current one grows beyond limit bytes (0 = DefaultLimit).
+func Setup(dir string, limit uint) error {
+	if limit == 0 {
+		limit = DefaultLimit
+	}
+	handler, err := log.RotatingFileHandler(dir, limit, log.JSONFormat())
+	if err != nil {
+		return err
+	}
+	logger.SetHandler(log.SyncHandler(handler))
+	atomic.StoreInt32(&enabled, 1)
+	return nil
+}
+
+// Enabled returns whether events are being recorded. Callers should check it
+// before assembling expensive event fields.
+func Enabled() bool {
+	return atomic.LoadInt32(&enabled) == 1
+}
+
+// Emit records an event with the given key/value pairs.
+func Emit(event string, ctx ...interface{}) {
+	if Enabled() {
+		logger.Info(event, ctx...)
+	}
+}
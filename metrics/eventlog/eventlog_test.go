@@ -0,0 +1,71 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eventlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Tests that events are written as JSON lines and rotated once the size limit
+// of a file is reached.
+func TestEventRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	Emit("dropped", "number", 0)
+	if err := Setup(dir, 64); err != nil {
+		t.Fatalf("failed to set up event log: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		Emit("refblock", "number", i)
+		// Rotated files are named after the time of their first event
+		time.Sleep(20 * time.Millisecond)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("event file count mismatch: have %d, want 3", len(files))
+	}
+	for i, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var event map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				t.Fatalf("file %d: invalid event %q: %v", i, scanner.Text(), err)
+			}
+			if event["msg"] != "refblock" || event["number"] != float64(i) {
+				t.Errorf("file %d: event mismatch: %v", i, event)
+			}
+		}
+		f.Close()
+	}
+}
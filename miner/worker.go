@@ -20,7 +20,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"math/big"
 	"os"
 	"sync"
@@ -32,11 +31,14 @@ import (
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/consensus/misc"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/lock"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/metrics/eventlog"
 	"github.com/ethereum/go-ethereum/params"
 )
 
@@ -80,6 +82,12 @@ const (
 	staleThreshold = 7
 )
 
+var (
+	crossTxIncludedCounter = metrics.NewRegisteredCounter("miner/crossshard/included", nil)
+	crossTxConflictCounter = metrics.NewRegisteredCounter("miner/crossshard/conflicts", nil) // Deferred due to locked keys
+	refReorgCounter        = metrics.NewRegisteredCounter("miner/crossshard/reorgs", nil)
+)
+
 // environment is the worker's current environment and holds all of the current state information.
 type environment struct {
 	signer types.Signer
@@ -98,6 +106,9 @@ type environment struct {
 	privateReceipts []*types.Receipt
 	// Leave this publicState named state, add privateState which most code paths can just ignore
 	privateState *state.StateDB
+
+	refStart uint64            // First reference block processed by the block
+	pinned   *core.PinnedState // State local transactions may not change
 }
 
 // task contains all information for consensus engine sealing and result submitting.
@@ -144,19 +155,17 @@ type worker struct {
 	refNumber   uint64                        // Last know reference block
 	commitments map[uint64]*types.Commitments // Known commitments for each shard
 
-	logdir       string
 	addrShardMap map[common.Address]uint64 // Which commit address belong to which map!
 
-	gLocked       *types.RWLock                      // Currently locked keys, to be used by rs nodes
-	lockedAddrMap map[uint64]map[common.Address]bool // shard: address mapping for locked contracts
-	cUnlocked     map[common.Address]*types.CLock
-	cLocked       map[common.Address]*types.CLock
+	gLocked *types.RWLock     // Guards the cross-shard bookkeeping, to be used by rs nodes
+	covered map[uint64]uint64 // Reference block reported by the state commits of the current work, by shard
 
 	lastCommit map[uint64]*types.Commitment // To store the last rs block that includes a commit
 	lastCtx    map[uint64]uint64            // to store whether a shard is touched by a ctx or not
 
 	foreignDataCh   chan core.ForeignDataEvent
 	foreignDataSub  event.Subscription
+	rForeignDataSub event.Subscription
 	crossWorkCh     chan struct{}
 	pendingResultCh chan struct{}
 	stopProcessCh   chan struct{}
@@ -217,7 +226,7 @@ type worker struct {
 	resubmitHook func(time.Duration, time.Duration) // Method to call upon updating resubmitting interval.
 }
 
-func newWorker(config *params.ChainConfig, engine consensus.Engine, eth Backend, mux *event.TypeMux, recommit time.Duration, gasFloor, gasCeil uint64, isLocalBlock func(*types.Block) bool, commitments map[uint64]*types.Commitments, gLocked *types.RWLock, lastCommit map[uint64]*types.Commitment, lastCtx map[uint64]uint64, shardAddMap map[uint64]*big.Int, lockedAddrMap map[uint64]map[common.Address]bool, logdir string) *worker {
+func newWorker(config *params.ChainConfig, engine consensus.Engine, eth Backend, mux *event.TypeMux, recommit time.Duration, gasFloor, gasCeil uint64, isLocalBlock func(*types.Block) bool, commitments map[uint64]*types.Commitments, gLocked *types.RWLock, lastCommit map[uint64]*types.Commitment, lastCtx map[uint64]uint64, shardAddMap map[uint64]*big.Int) *worker {
 	worker := &worker{
 		config:             config,
 		engine:             engine,
@@ -247,16 +256,13 @@ func newWorker(config *params.ChainConfig, engine consensus.Engine, eth Backend,
 		commitments:        commitments,
 		foreignDataCh:      make(chan core.ForeignDataEvent),
 		gLocked:            gLocked,
-		cLocked:            make(map[common.Address]*types.CLock),
-		cUnlocked:          make(map[common.Address]*types.CLock),
+		covered:            make(map[uint64]uint64),
 		lastCommit:         lastCommit,
 		lastCtx:            lastCtx,
-		lockedAddrMap:      lockedAddrMap,
 		crossWorkCh:        make(chan struct{}),
 		pendingResultCh:    make(chan struct{}),
 		stopProcessCh:      make(chan struct{}),
 		addrShardMap:       make(map[common.Address]uint64),
-		logdir:             logdir,
 	}
 
 	if _, ok := engine.(consensus.Istanbul); ok || !config.IsQuorum || config.Clique != nil {
@@ -267,6 +273,7 @@ func newWorker(config *params.ChainConfig, engine consensus.Engine, eth Backend,
 		worker.chainSideSub = eth.BlockChain().SubscribeChainSideEvent(worker.chainSideCh)
 		worker.rChainHeadSub = eth.RefChain().SubscribeChainHeadEvent(worker.rChainHeadCh)
 		worker.foreignDataSub = eth.BlockChain().SubscribeForeignDataEvent(worker.foreignDataCh)
+		worker.rForeignDataSub = eth.RefChain().SubscribeForeignDataEvent(worker.foreignDataCh)
 
 		// Fixing the gas limit for the entire blockchain.
 		worker.gasLimit = core.CalcGasLimit(worker.chain.GetBlockByNumber(uint64(0)), worker.gasFloor, worker.gasCeil)
@@ -476,13 +483,8 @@ func (w *worker) newWorkLoop(recommit time.Duration) {
 				if reorg {
 					if parentNum > commitNum {
 						// Logging re-org stats
-						reorg := w.logdir + "reorg"
-						reorgf, err := os.OpenFile(reorg, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-						if err != nil {
-							log.Error("Can't open rtime file", "error", err)
-						}
-						fmt.Fprintln(reorgf, newRefNum, parentNum, commitNum, time.Now().Unix())
-						reorgf.Close()
+						refReorgCounter.Inc(1)
+						eventlog.Emit("reorg", "ref", newRefNum, "parent", parentNum, "commit", commitNum)
 						// Resetting trasnaction pool and chain head!
 						w.eth.TxPool().ResetHead(commitNum)
 						w.chain.SetHead(commitNum)
@@ -553,6 +555,7 @@ func (w *worker) mainLoop() {
 	defer w.chainSideSub.Unsubscribe()
 	defer w.rChainHeadSub.Unsubscribe()
 	defer w.foreignDataSub.Unsubscribe()
+	defer w.rForeignDataSub.Unsubscribe()
 
 	for {
 		select {
@@ -808,36 +811,48 @@ func (w *worker) commitPendingBlock(work uint64, env *environment, dc *types.Dat
 		env.header.Coinbase = w.coinbase
 	}
 
+	aborted, _ := w.eth.RefChain().AbortedCrossTxs(work)
 	cTxs := w.chain.CrossTxsLocked(work) // This function internaly acquires lock!
 	for _, ctx := range cTxs.Txs {
+		if aborted[ctx.RefHash] {
+			log.Debug("Skipping aborted cross-shard transaction", "num", work, "hash", ctx.RefHash)
+			continue
+		}
+		// Optimistic transactions are executed once validated, in the deciding block
+		tdc := dc
+		if w.chain.OptimisticCrossShard(work) {
+			if ctx.BlockNum.Uint64() == work || !ctx.Validated() {
+				continue
+			}
+			tdc, _ = w.chain.Dc(ctx.BlockNum.Uint64())
+		}
 		tx := ctx.Tx
 		env.state.Prepare(tx.Hash(), common.Hash{}, env.tcount)
 		env.privateState.Prepare(tx.Hash(), common.Hash{}, env.tcount)
-		w.commitPendingTransaction(tx, env, dc)
+		w.commitPendingTransaction(tx, ctx, env, tdc)
 		env.tcount++
 	}
 	log.Debug("Finished processing block", "num", work)
 	return nil
 }
 
-func (w *worker) commitPendingTransaction(tx *types.Transaction, env *environment, dc *types.DataCache) ([]*types.Log, error) {
+func (w *worker) commitPendingTransaction(tx *types.Transaction, ctx *types.CrossTx, env *environment, dc *types.DataCache) ([]*types.Log, error) {
+	coinbase := w.coinbase
+	if w.chain.AtomicCrossShard(ctx.BlockNum.Uint64()) {
+		receipt := core.PrepareCrossTransaction(w.config, w.chain, &coinbase, env.gasPool, dc, env.state, env.header, tx, ctx, &env.header.GasUsed, vm.Config{})
+		env.txs = append(env.txs, tx)
+		env.receipts = append(env.receipts, receipt)
+		return receipt.Logs, nil
+	}
 	snap := env.state.Snapshot()
 	psnap := env.privateState.Snapshot()
-	coinbase := w.coinbase
 	receipt, _, _, err := core.ApplyTransaction(w.config, w.chain, &coinbase, env.gasPool, dc, env.state, env.privateState, env.header, tx, &env.header.GasUsed, vm.Config{})
 	if err != nil {
 		env.state.RevertToSnapshot(snap)
 		env.privateState.RevertToSnapshot(psnap)
 		log.Debug("Skipping pending transaction", "thash", tx.Hash(), "error", err)
 
-		// Create a dummy recipt if the transaction failed
-		root := env.state.IntermediateRoot(false)
-		receipt = types.NewReceipt(root.Bytes(), true, env.header.GasUsed)
-		receipt.TxHash = tx.Hash()
-		receipt.GasUsed = tx.Gas()
-		// Set the receipt logs and create a bloom for filtering
-		receipt.Logs = env.state.GetLogs(tx.Hash())
-		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		receipt = core.FailedCrossShardReceipt(w.config, env.header, env.state, tx, env.header.GasUsed, err)
 	}
 
 	env.txs = append(env.txs, tx)
@@ -868,9 +883,10 @@ func (w *worker) makeCurrent(reorg bool, parent *types.Block, header *types.Head
 	start := parent.RefNumberU64() + uint64(1)
 	end := header.RefNumber.Uint64()
 	curr := start
+	w.chain.ApplyCrossTxDecisions(env.state, header, start)
 	for curr <= end {
 		dc, status := w.chain.Dc(curr)
-		if !status {
+		if (!status || w.chain.OptimisticCrossShard(curr)) && !w.crossTxsReady(curr, dc) {
 			select {
 			case <-w.foreignDataCh:
 				continue
@@ -881,6 +897,9 @@ func (w *worker) makeCurrent(reorg bool, parent *types.Block, header *types.Head
 		}
 		curr++
 	}
+	env.refStart = start
+	env.pinned = w.chain.PinnedState(env.state, header, start)
+
 	// when 08 is processed ancestors contain 07 (quick block)
 	for _, ancestor := range w.chain.GetBlocksFromHash(parent.Hash(), 7) {
 		for _, uncle := range ancestor.Uncles() {
@@ -895,6 +914,43 @@ func (w *worker) makeCurrent(reorg bool, parent *types.Block, header *types.Head
 	return nil
 }
 
+// crossTxsReady returns whether every cross-shard transaction of reference
+// block work that was not aborted has all of its foreign data available, once
+// their deadline passed. Transactions that are not aborted at their deadline
+// wait for the complete data of work instead. In optimistic mode only the
+// transactions validated in work are executed, with the data of the block
+// they were accepted in, and cannot be aborted anymore.
+func (w *worker) crossTxsReady(work uint64, dc *types.DataCache) bool {
+	optimistic := w.chain.OptimisticCrossShard(work)
+	aborted, decided := w.eth.RefChain().AbortedCrossTxs(work)
+	if !optimistic && (!decided || dc == nil) {
+		return false
+	}
+	myshard := w.eth.MyShard()
+	for _, ctx := range w.chain.CrossTxs(work).Txs {
+		tdc := dc
+		if optimistic {
+			if ctx.BlockNum.Uint64() == work || !ctx.Validated() {
+				continue
+			}
+			if tdc, _ = w.chain.Dc(ctx.BlockNum.Uint64()); tdc == nil {
+				return false
+			}
+		} else if aborted[ctx.RefHash] {
+			continue
+		}
+		tdc.DataCacheMu.RLock()
+		for _, shard := range ctx.Shards {
+			if shard != myshard && !tdc.ShardStatus[shard] {
+				tdc.DataCacheMu.RUnlock()
+				return false
+			}
+		}
+		tdc.DataCacheMu.RUnlock()
+	}
+	return true
+}
+
 // commitUncle adds the given block to uncle block set, returns error if failed to add.
 func (w *worker) commitUncle(env *environment, uncle *types.Header) error {
 	hash := uncle.Hash()
@@ -952,6 +1008,9 @@ func (w *worker) commitTransaction(tx *types.Transaction, coinbase common.Addres
 	privateSnap := w.current.privateState.Snapshot()
 
 	receipt, privateReceipt, _, err := core.ApplyTransaction(w.config, w.chain, &coinbase, w.current.gasPool, nil, w.current.state, w.current.privateState, w.current.header, tx, &w.current.header.GasUsed, vm.Config{})
+	if err == nil {
+		err = w.current.pinned.Verify(w.current.state)
+	}
 	if err != nil {
 		w.current.state.RevertToSnapshot(snap)
 		w.current.privateState.RevertToSnapshot(privateSnap)
@@ -1309,10 +1368,8 @@ func (w *worker) commitNewWork(reorg bool, interrupt *int32, noempty bool, times
 	}
 
 	if w.eth.MyShard() == uint64(0) {
-		// Resetting cLockedAddr and cUnlockedAdd
 		w.gLocked.Mu.Lock()
-		w.cLocked = make(map[common.Address]*types.CLock)
-		w.cUnlocked = make(map[common.Address]*types.CLock)
+		w.covered = make(map[uint64]uint64)
 
 		// Split the pending transactions into state commitment and cross-shard txs
 		stateTxs, crossTxs := make(map[common.Address]types.Transactions), pending
@@ -1398,7 +1455,11 @@ func (w *worker) NewValidStateCommitments(stateTxs map[common.Address]types.Tran
 
 		// Itereate through all state commits
 		for _, tx := range txs {
-			_, commit, report, _, _ := types.DecodeStateCommit(tx)
+			if err := w.chain.VerifyStateCommit(tx); err != nil {
+				log.Debug("Discarding unattested state commit", "shard", shard, "hash", tx.Hash(), "err", err)
+				continue
+			}
+			_, commit, report, _, _, _ := types.DecodeStateCommit(tx)
 			// Only accept if no new cross-shard transactions are added after reproted block!
 			if report >= lastCtx {
 				if report > maxRef {
@@ -1417,54 +1478,29 @@ func (w *worker) NewValidStateCommitments(stateTxs map[common.Address]types.Tran
 		}
 		if maxTx != nil { // Add to new commits
 			newCommits[addr] = types.Transactions{maxTx}
-			_, commit, report, _, _ := types.DecodeStateCommit(maxTx)
+			_, commit, report, _, _, _ := types.DecodeStateCommit(maxTx)
 			log.Debug("Adding state commits", "shard", shard, "report", report, "commit", commit)
-			w.unlockKeys(shard)
+			w.covered[shard] = report
 		}
 	}
 	return newCommits
 }
 
-// unlockKeys ulocks currently locked key
-func (w *worker) unlockKeys(shard uint64) {
-	// This function assumes that gLocked.Mu is already held!
-	lockedAddrs := w.lockedAddrMap[shard] // list of currently locked address of a shard
-	// If no locked address for a particular shard, then return
-	if len(lockedAddrs) > 0 {
-		// For every locked contract of a shard
-		for addr := range lockedAddrs {
-			// Iniitlialize unlocked address if not already initialized
-			if _, uaok := w.cUnlocked[addr]; !uaok {
-				w.cUnlocked[addr] = types.NewCLock(addr)
-			}
-		}
-	}
-}
-
 // NewValidCrossTransactions extracts the current valid cross-shard transactions
+// whose keys can be locked, giving precedence to the longest waiting ones.
 func (w *worker) NewValidCrossTransactions(crossTxs map[common.Address]types.Transactions) map[common.Address]types.Transactions {
 	// This function assumes thta w.gLocked.Mu lock is already held!
 	var (
-		newCtxs   = make(map[common.Address]types.Transactions)
-		numShards int
-		index     uint64
-		start     = 0
-		others    = 0
-		end       = 0
-		u32       = uint64(32)
-		data      []byte
-		shards    []uint64
+		newCtxs = make(map[common.Address]types.Transactions)
+		reqs    []*lock.Request
+		waiting = make(map[common.Hash]bool)
+		start   = 0
+		others  = 0
+		end     = 0
 	)
-	// Opening the file to log attempted transactions
-	attempt := w.logdir + "attempt"
-	attemptf, err := os.OpenFile(attempt, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Error("Can't open rtime file", "error", err)
-	}
-
-	for creator, txs := range crossTxs {
-		start += len(txs)
-		for _, tx := range txs {
+	for creator, ctxs := range crossTxs {
+		start += len(ctxs)
+		for _, tx := range ctxs {
 			// If the transaction is not cross-shard
 			if tx.TxType() != types.CrossShard {
 				others = others + 1
@@ -1475,106 +1511,57 @@ func (w *worker) NewValidCrossTransactions(crossTxs map[common.Address]types.Tra
 				continue
 			}
 
-			data = tx.Data()[4:]
-			index, shards, _ = types.DecodeCrossTx(uint64(0), data) // To remove shard information
-			numShards = len(shards)
-			index = index + u32 + uint64(2) // (index + size of data + numshard)
+			payload, _, _, err := types.DecodeCrossTx(uint64(0), tx.Data())
+			if err != nil {
+				log.Debug("Discarding malformed cross-shard transaction", "hash", tx.Hash(), "err", err)
+				others = others + 1
+				continue
+			}
 			// Fetch all read-write keys of a transaction
-			allKyes, _, _ := types.GetAllRWSet(uint16(numShards), data[index:])
-			// If can inlucde the latest transaction
-			include := false
-			if include = w.checkTxStatus(allKyes); include {
-				if _, cok := newCtxs[creator]; !cok {
-					newCtxs[creator] = types.Transactions{}
-				}
-				newCtxs[creator] = append(newCtxs[creator], tx)
-				end = end + 1
-				w.updateLockStatus(allKyes)
+			allKeys, _, _, err := types.GetAllRWSet(payload)
+			if err != nil {
+				log.Debug("Discarding malformed cross-shard transaction", "hash", tx.Hash(), "err", err)
+				others = others + 1
+				continue
 			}
-
-			// The transaction can not be included due to conflict.
-			fmt.Fprintln(attemptf, tx.Hash().Hex(), include, time.Now().Unix())
+			reqs = append(reqs, &lock.Request{Hash: tx.Hash(), Sender: creator, Keys: allKeys})
+			waiting[tx.Hash()] = true
 		}
 	}
-	// Closing the file
-	attemptf.Close()
-	log.Info("@ctx, Returning NewValidCrossTransactions", "start", start, "end", end, "others", others)
-	return newCtxs
-}
-
-// updateLockStatus temporarily locks additional keys
-func (w *worker) updateLockStatus(allKeys map[uint64][]*types.CKeys) {
-	// This method assumes that the w.gLocked.Mu method is already held
-	for _, shardKeys := range allKeys {
-		for _, cKeys := range shardKeys {
-			addr := cKeys.Addr
-			if _, caok := w.cLocked[addr]; !caok {
-				w.cLocked[addr] = types.NewCLock(addr)
-			}
-			for _, key := range cKeys.Keys {
-				if _, kok := w.cLocked[addr].Keys[key]; !kok {
-					w.cLocked[addr].Keys[key] = 0
-				}
-				w.cLocked[addr].Keys[key] = w.cLocked[addr].Keys[key] + 1
-			}
-			for _, key := range cKeys.WKeys {
-				w.cLocked[addr].Keys[key] = -1
-			}
+	// Optimistic transactions are admitted without waiting for locks
+	granted := make(map[common.Hash]bool)
+	if w.chain.OptimisticCrossShard(w.current.header.Number.Uint64()) {
+		for _, req := range reqs {
+			granted[req.Hash] = true
 		}
-	}
-}
-
-// checkTxStatus returns true if the transaction is eligible, otherwise return false
-func (w *worker) checkTxStatus(allKeys map[uint64][]*types.CKeys) bool {
-	// This method assumes that the w.gLocked.Mu method is already held
-	for _, shardKeys := range allKeys {
-		for _, cKeys := range shardKeys {
-			addr := cKeys.Addr
-			lockMap := make(map[common.Hash]bool)
-			// Initialize lockMap base on read and write lock
-			for _, key := range cKeys.Keys {
-				lockMap[key] = false
-			}
-			for _, key := range cKeys.WKeys {
-				lockMap[key] = true
-			}
-			if w.checkLockStatus(addr, lockMap) {
-				return false
-			}
+	} else {
+		for _, req := range w.chain.LockManager().Schedule(reqs, w.covered) {
+			granted[req.Hash] = true
 		}
 	}
-	return true
-}
-
-// To check whether any key of a particular contract is locked; return true if locked
-// otherwise return false
-func (w *worker) checkLockStatus(addr common.Address, addrKeys map[common.Hash]bool) bool {
-	// This method assumes that w.gLocked.Mu is held
-	_, galok := w.gLocked.Locks[addr] // globally locked
-	_, calok := w.cLocked[addr]       // locally locked
-
-	// Contract not locked
-	if !galok && !calok {
-		return false
-	}
-
-	// If current locked on any key
-	if calok {
-		cLockedKeys := w.cLocked[addr].Keys
-		for key, kval := range addrKeys {
-			if cval, cok := cLockedKeys[key]; cok && (cval < 0 || kval) {
-				return true
+	// Keep the nonce order of every creator, leaving out the transactions that
+	// have to wait for locks and the ones following them
+	for creator, ctxs := range crossTxs {
+		blocked := false
+		for _, tx := range ctxs {
+			if !waiting[tx.Hash()] {
+				continue
 			}
+			include := !blocked && granted[tx.Hash()]
+			blocked = !include
+			if include {
+				newCtxs[creator] = append(newCtxs[creator], tx)
+				end = end + 1
+				crossTxIncludedCounter.Inc(1)
+			} else {
+				// The transaction waits behind conflicting locks
+				crossTxConflictCounter.Inc(1)
+			}
+			eventlog.Emit("attempt", "hash", tx.Hash(), "include", include)
 		}
 	}
-
-	if _, ualok := w.cUnlocked[addr]; !ualok && galok {
-		if w.chain.CheckGLock(addr, addrKeys) {
-			return true
-		}
-	}
-	// Either unlocked or not present in global lock
-	return false
+	log.Info("@ctx, Returning NewValidCrossTransactions", "start", start, "end", end, "others", others)
+	return newCtxs
 }
 
 // commit runs any post-transaction state modifications, assembles the final block
@@ -1595,6 +1582,9 @@ func (w *worker) commit(uncles []*types.Header, interval func(), update bool, st
 
 	s := w.current.state.Copy()
 	ps := w.current.privateState.Copy()
+	if err := w.chain.PrepareCrossTxs(s, w.current.header, w.current.refStart); err != nil {
+		return err
+	}
 	block, err := w.engine.Finalize(w.chain, w.current.header, s, w.current.txs, uncles, w.current.receipts)
 	if err != nil {
 		return err
@@ -365,22 +365,21 @@ func (c *Config) parsePersistentNodes(path string) map[uint64][]*enode.Node {
 		log.Error(fmt.Sprintf("Can't load node file %s: %v", path, err))
 		return nil
 	}
-	// Interpret the list as a discovery node array
+	// Interpret the list as a discovery node array. Nodes advertise their shard
+	// in their node record, "shard:N" markers only serve older nodes.
 	var (
-		shardID uint64
+		shardID = p2p.UnknownShard
 		err     error
 	)
 	var nodes = make(map[uint64][]*enode.Node)
 	for _, url := range nodelist {
 		if url == "" {
 			continue
-		} else if url[0:5] == "shard" {
-
+		} else if strings.HasPrefix(url, "shard:") {
 			if shardID, err = strconv.ParseUint(url[6:], 10, 64); err != nil {
-				log.Warn("Shard ID parsing failed")
+				log.Warn("Shard ID parsing failed", "marker", url)
+				shardID = p2p.UnknownShard
 			}
-			// log.Info("Extracted Shard ID", "shard", shardID)
-			nodes[shardID] = []*enode.Node{}
 			continue
 		}
 		node, err := enode.ParseV4(url)
@@ -77,7 +77,7 @@ type dialstate struct {
 	dialing       map[enode.ID]connFlag
 	lookupBuf     []*enode.Node // current discovery lookup results
 	randomNodes   []*enode.Node // filled from Table
-	static        map[uint64]map[enode.ID]*dialTask
+	static        map[enode.ID]*dialTask
 	hist          *dialHistory
 
 	start     time.Time     // time when the dialer was first used
@@ -132,33 +132,30 @@ func newDialState(self enode.ID, static map[uint64][]*enode.Node, bootnodes []*e
 		ntab:        ntab,
 		self:        self,
 		netrestrict: netrestrict,
-		static:      make(map[uint64]map[enode.ID]*dialTask),
+		static:      make(map[enode.ID]*dialTask),
 		dialing:     make(map[enode.ID]connFlag),
 		bootnodes:   make([]*enode.Node, len(bootnodes)),
 		randomNodes: make([]*enode.Node, maxdyn/2),
 		hist:        new(dialHistory),
 	}
 	copy(s.bootnodes, bootnodes)
-	for shard, nodeList := range static {
+	for _, nodeList := range static {
 		for _, n := range nodeList {
-			s.addStatic(shard, n)
+			s.addStatic(n)
 		}
 	}
 	return s
 }
 
-func (s *dialstate) addStatic(shard uint64, n *enode.Node) {
+func (s *dialstate) addStatic(n *enode.Node) {
 	// This overwrites the task instead of updating an existing
 	// entry, giving users the opportunity to force a resolve operation.
-	if s.static[shard] == nil {
-		s.static[shard] = make(map[enode.ID]*dialTask)
-	}
-	s.static[shard][n.ID()] = &dialTask{flags: staticDialedConn, dest: n}
+	s.static[n.ID()] = &dialTask{flags: staticDialedConn, dest: n}
 }
 
-func (s *dialstate) removeStatic(shard uint64, n *enode.Node) {
+func (s *dialstate) removeStatic(n *enode.Node) {
 	// This removes a task so future attempts to connect will not be made.
-	delete(s.static[shard], n.ID())
+	delete(s.static, n.ID())
 	// This removes a previous dial timestamp so that application
 	// can force a server to reconnect with chosen peer immediately.
 	s.hist.remove(n.ID())
@@ -171,8 +168,7 @@ func (s *dialstate) newTasks(nRunning int, cousinPeers map[uint64]map[enode.ID]*
 
 	var newtasks []task
 	addDial := func(flag connFlag, n *enode.Node) bool {
-		shardID := GetShardID(n.ID())
-		if err := s.checkDial(n, cousinPeers[shardID]); err != nil {
+		if err := s.checkDial(n, cousinPeers); err != nil {
 			log.Trace("Skipping dial candidate", "id", n.ID(), "addr", &net.TCPAddr{IP: n.IP(), Port: n.TCP()}, "err", err)
 			return false
 		}
@@ -201,30 +197,17 @@ func (s *dialstate) newTasks(nRunning int, cousinPeers map[uint64]map[enode.ID]*
 	s.hist.expire(now)
 
 	// Create dials for static nodes if they are not connected.
-	for shard, static := range s.static {
-		for id, t := range static {
-			err := s.checkDial(t.dest, cousinPeers[shard])
-			switch err {
-			case errNotWhitelisted, errSelf:
-				log.Warn("Removing static dial candidate", "id", t.dest.ID, "addr", &net.TCPAddr{IP: t.dest.IP(), Port: t.dest.TCP()}, "err", err)
-				delete(static, t.dest.ID())
-			case nil:
-				s.dialing[id] = t.flags
-				newtasks = append(newtasks, t)
-			}
+	for id, t := range s.static {
+		err := s.checkDial(t.dest, cousinPeers)
+		switch err {
+		case errNotWhitelisted, errSelf:
+			log.Warn("Removing static dial candidate", "id", t.dest.ID, "addr", &net.TCPAddr{IP: t.dest.IP(), Port: t.dest.TCP()}, "err", err)
+			delete(s.static, t.dest.ID())
+		case nil:
+			s.dialing[id] = t.flags
+			newtasks = append(newtasks, t)
 		}
 	}
-	// for id, t := range s.static {
-	// 	err := s.checkDial(t.dest, peers)
-	// 	switch err {
-	// 	case errNotWhitelisted, errSelf:
-	// 		log.Warn("Removing static dial candidate", "id", t.dest.ID, "addr", &net.TCPAddr{IP: t.dest.IP(), Port: t.dest.TCP()}, "err", err)
-	// 		delete(s.static, t.dest.ID())
-	// 	case nil:
-	// 		s.dialing[id] = t.flags
-	// 		newtasks = append(newtasks, t)
-	// 	}
-	// }
 
 	/**
 	// @sourav, todo: as of now, I am commenting out these. We can try to
@@ -288,12 +271,12 @@ var (
 	errNotWhitelisted   = errors.New("not contained in netrestrict whitelist")
 )
 
-func (s *dialstate) checkDial(n *enode.Node, peers map[enode.ID]*Peer) error {
+func (s *dialstate) checkDial(n *enode.Node, cousinPeers map[uint64]map[enode.ID]*Peer) error {
 	_, dialing := s.dialing[n.ID()]
 	switch {
 	case dialing:
 		return errAlreadyDialing
-	case peers[n.ID()] != nil:
+	case connectedPeer(cousinPeers, n.ID()) != nil:
 		return errAlreadyConnected
 	case n.ID() == s.self:
 		return errSelf
@@ -122,6 +122,15 @@ func (n *Node) HasRaftPort() bool {
 	return n.RaftPort() > 0
 }
 
+// Shard returns the shard advertised by the node, if any.
+func (n *Node) Shard() (enr.Shard, bool) {
+	var shard enr.Shard
+	if err := n.Load(&shard); err != nil {
+		return enr.Shard{}, false
+	}
+	return shard, true
+}
+
 // UDP returns the TCP port of the node.
 func (n *Node) TCP() int {
 	var port enr.TCP
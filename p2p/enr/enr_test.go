@@ -81,6 +81,18 @@ func TestGetSetUDP(t *testing.T) {
 	assert.Equal(t, port, port2)
 }
 
+// TestGetSetShard tests encoding/decoding and setting/getting of the Shard key.
+func TestGetSetShard(t *testing.T) {
+	for _, shard := range []Shard{{ID: 0, RefValidator: true}, {ID: 3}} {
+		var r Record
+		r.Set(shard)
+
+		var shard2 Shard
+		require.NoError(t, r.Load(&shard2))
+		assert.Equal(t, shard, shard2)
+	}
+}
+
 func TestLoadErrors(t *testing.T) {
 	var r Record
 	ip4 := IP{127, 0, 0, 1}
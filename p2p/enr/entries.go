@@ -86,6 +86,41 @@ type Hostname string
 
 func (v Hostname) ENRKey() string { return "hostname" }
 
+// Shard is the "shard" key, which holds the shard the node belongs to and
+// whether it validates the reference chain.
+type Shard struct {
+	ID           uint64
+	RefValidator bool
+}
+
+func (v Shard) ENRKey() string { return "shard" }
+
+// EncodeRLP implements rlp.Encoder.
+func (v Shard) EncodeRLP(w io.Writer) error {
+	var flags uint
+	if v.RefValidator {
+		flags = 1
+	}
+	return rlp.Encode(w, []interface{}{v.ID, flags})
+}
+
+// DecodeRLP implements rlp.Decoder.
+func (v *Shard) DecodeRLP(s *rlp.Stream) error {
+	var dec struct {
+		ID    uint64
+		Flags uint
+		Rest  []rlp.RawValue `rlp:"tail"`
+	}
+	if err := s.Decode(&dec); err != nil {
+		return err
+	}
+	if dec.Flags > 1 {
+		return fmt.Errorf("invalid shard flags %d", dec.Flags)
+	}
+	v.ID, v.RefValidator = dec.ID, dec.Flags == 1
+	return nil
+}
+
 // EncodeRLP implements rlp.Encoder.
 func (v IP) EncodeRLP(w io.Writer) error {
 	if ip4 := net.IP(v).To4(); ip4 != nil {
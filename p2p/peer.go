@@ -139,6 +139,18 @@ func (p *Peer) Node() *enode.Node {
 	return p.rw.node
 }
 
+// Shard returns the shard the remote node belongs to, or UnknownShard if it
+// did not advertise one.
+func (p *Peer) Shard() uint64 {
+	return p.rw.shard.ID
+}
+
+// RefValidator reports whether the remote node advertised itself as a
+// validator of the reference chain.
+func (p *Peer) RefValidator() bool {
+	return p.rw.shard.RefValidator
+}
+
 // Name returns the node name that the remote node advertised.
 func (p *Peer) Name() string {
 	return p.rw.name
@@ -362,8 +374,7 @@ func (p *Peer) startProtocols(writeStart <-chan struct{}, writeErr chan<- error)
 		}
 		p.log.Trace(fmt.Sprintf("Starting protocol %s/%d", proto.Name, proto.Version))
 		go func() {
-			shard := GetShardID(p.ID())
-			err := proto.Run(p, shard, rw)
+			err := proto.Run(p, p.Shard(), rw)
 			if err == nil {
 				p.log.Trace(fmt.Sprintf("Protocol %s/%d returned", proto.Name, proto.Version))
 				err = errProtocolReturned
@@ -440,6 +451,8 @@ type PeerInfo struct {
 		Inbound       bool   `json:"inbound"`
 		Trusted       bool   `json:"trusted"`
 		Static        bool   `json:"static"`
+		Shard         uint64 `json:"shard"`        // Shard advertised by the remote node
+		RefValidator  bool   `json:"refValidator"` // Whether the remote node validates the reference chain
 	} `json:"network"`
 	Protocols map[string]interface{} `json:"protocols"` // Sub-protocol specific metadata fields
 }
@@ -464,6 +477,8 @@ func (p *Peer) Info() *PeerInfo {
 	info.Network.Inbound = p.rw.is(inboundConn)
 	info.Network.Trusted = p.rw.is(trustedConn)
 	info.Network.Static = p.rw.is(staticDialedConn)
+	info.Network.Shard = p.Shard()
+	info.Network.RefValidator = p.RefValidator()
 
 	// Gather all the running protocol infos
 	for _, proto := range p.running {
@@ -159,7 +159,6 @@ type Config struct {
 	Logger log.Logger `toml:",omitempty"`
 }
 
-var nodeMapping map[uint64][]enode.ID // To store shard to id mapping of each connected nodesar
 // Server manages all peer connections.
 type Server struct {
 	// Config fields may not be modified while the server is running.
@@ -175,6 +174,7 @@ type Server struct {
 
 	nodedb       *enode.DB
 	localnode    *enode.LocalNode
+	shards       *shardTable
 	ntab         discoverTable
 	listener     net.Listener
 	ourHandshake *protoHandshake
@@ -228,6 +228,7 @@ type conn struct {
 	cont  chan error // The run loop uses cont to signal errors to SetupConn.
 	caps  []Cap      // valid after the protocol handshake
 	name  string     // valid after the protocol handshake
+	shard enr.Shard  // shard of the remote node, refined by the protocol handshake
 }
 
 type transport interface {
@@ -467,8 +468,6 @@ func (srv *Server) Start() (err error) {
 	srv.peerOp = make(chan peerOpFunc)
 	srv.peerOpDone = make(chan struct{})
 
-	nodeMapping = make(map[uint64][]enode.ID)
-
 	if err := srv.setupLocalNode(); err != nil {
 		return err
 	}
@@ -481,12 +480,7 @@ func (srv *Server) Start() (err error) {
 		return err
 	}
 
-	// Filling up the node mapping
-	for shard, nodes := range srv.StaticNodesAll {
-		for _, node := range nodes {
-			nodeMapping[shard] = append(nodeMapping[shard], node.ID())
-		}
-	}
+	srv.shards = newShardTable(srv.StaticNodesAll)
 
 	dynPeers := srv.maxDialedConns()
 	dialer := newDialState(srv.localnode.ID(), srv.StaticNodesAll, srv.BootstrapNodes, srv.ntab, dynPeers, srv.NetRestrict)
@@ -630,19 +624,8 @@ func (srv *Server) setupListening() error {
 type dialer interface {
 	newTasks(running int, peers map[uint64]map[enode.ID]*Peer, now time.Time) []task
 	taskDone(task, time.Time)
-	addStatic(uint64, *enode.Node)
-	removeStatic(uint64, *enode.Node)
-}
-
-func GetShardID(nodeID enode.ID) uint64 {
-	for shard, nodes := range nodeMapping {
-		for _, node := range nodes {
-			if node == nodeID {
-				return shard
-			}
-		}
-	}
-	return uint64(4096)
+	addStatic(*enode.Node)
+	removeStatic(*enode.Node)
 }
 
 func (srv *Server) run(dialstate dialer) {
@@ -671,10 +654,6 @@ func (srv *Server) run(dialstate dialer) {
 		}
 	}
 
-	for k := range nodeMapping {
-		cousinPeers[k] = make(map[enode.ID]*Peer)
-	}
-
 	// removes t from runningTasks
 	delTask := func(t task) {
 		for i := range runningTasks {
@@ -718,16 +697,14 @@ running:
 			// ephemeral static peer list. Add it to the dialer,
 			// it will keep the node connected.
 			srv.log.Trace("Adding static node", "node", n)
-			shardID := GetShardID(n.ID())
-			dialstate.addStatic(shardID, n)
+			dialstate.addStatic(n)
 		case n := <-srv.removestatic:
 			// This channel is used by RemovePeer to send a
 			// disconnect request to a peer and begin the
 			// stop keeping the node connected.
-			shardID := GetShardID(n.ID())
 			srv.log.Trace("Removing static node", "node", n)
-			dialstate.removeStatic(shardID, n)
-			if p, ok := cousinPeers[shardID][n.ID()]; ok {
+			dialstate.removeStatic(n)
+			if p := connectedPeer(cousinPeers, n.ID()); p != nil {
 				p.Disconnect(DiscRequested)
 			}
 		case n := <-srv.addtrusted:
@@ -735,9 +712,8 @@ running:
 			// to the trusted node set.
 			srv.log.Trace("Adding trusted node", "node", n)
 			trusted[n.ID()] = true
-			shardID := GetShardID(n.ID())
 			// Mark any already-connected peer as trusted
-			if p, ok := cousinPeers[shardID][n.ID()]; ok {
+			if p := connectedPeer(cousinPeers, n.ID()); p != nil {
 				p.rw.set(trustedConn, true)
 			}
 		case n := <-srv.removetrusted:
@@ -748,8 +724,7 @@ running:
 				delete(trusted, n.ID())
 			}
 			// Unmark any already-connected peer as trusted
-			shardID := GetShardID(n.ID())
-			if p, ok := cousinPeers[shardID][n.ID()]; ok {
+			if p := connectedPeer(cousinPeers, n.ID()); p != nil {
 				p.rw.set(trustedConn, false)
 			}
 		case op := <-srv.peerOp:
@@ -772,17 +747,16 @@ running:
 				c.flags |= trustedConn
 			}
 			// TODO: track in-progress inbound node IDs (pre-Peer) to avoid dialing them.
-			shardID := GetShardID(c.node.ID())
 			select {
-			case c.cont <- srv.encHandshakeChecks(cousinPeers[shardID], inboundCount, c):
+			case c.cont <- srv.encHandshakeChecks(cousinPeers, inboundCount, c):
 			case <-srv.quit:
 				break running
 			}
 		case c := <-srv.addpeer:
 			// At this point the connection is past the protocol handshake.
 			// Its capabilities are known and the remote identity is verified.
-			shardID := GetShardID(c.node.ID())
-			err := srv.protoHandshakeChecks(cousinPeers[shardID], inboundCount, c)
+			shardID := c.shard.ID
+			err := srv.protoHandshakeChecks(cousinPeers, inboundCount, c)
 			if err == nil {
 				// The handshakes are done and it passed all checks.
 				p := newPeer(c, srv.Protocols)
@@ -795,6 +769,9 @@ running:
 				srv.log.Debug("Adding p2p peer", "name", name, "addr", c.fd.RemoteAddr(), "peers", len(cousinPeers[shardID])+1)
 				log.Info("Adding p2p peer", "name", name, "addr", c.fd.RemoteAddr(), "peers", len(cousinPeers[shardID])+1)
 				go srv.runPeer(p)
+				if cousinPeers[shardID] == nil {
+					cousinPeers[shardID] = make(map[enode.ID]*Peer)
+				}
 				cousinPeers[shardID][c.node.ID()] = p
 				if p.Inbound() {
 					inboundCount++
@@ -810,7 +787,7 @@ running:
 			}
 		case pd := <-srv.delpeer:
 			// A peer disconnected.
-			shardID := GetShardID(pd.ID())
+			shardID := pd.Shard()
 			d := common.PrettyDuration(mclock.Now() - pd.created)
 			pd.log.Debug("Removing p2p peer", "duration", d, "peers", len(cousinPeers[shardID])-1, "req", pd.requested, "err", pd.err)
 			delete(cousinPeers[shardID], pd.ID())
@@ -848,23 +825,23 @@ running:
 	}
 }
 
-func (srv *Server) protoHandshakeChecks(peers map[enode.ID]*Peer, inboundCount int, c *conn) error {
+func (srv *Server) protoHandshakeChecks(cousinPeers map[uint64]map[enode.ID]*Peer, inboundCount int, c *conn) error {
 	// Drop connections with no matching protocols.
 	if len(srv.Protocols) > 0 && countMatchingProtocols(srv.Protocols, c.caps) == 0 {
 		return DiscUselessPeer
 	}
 	// Repeat the encryption handshake checks because the
 	// peer set might have changed between the handshakes.
-	return srv.encHandshakeChecks(peers, inboundCount, c)
+	return srv.encHandshakeChecks(cousinPeers, inboundCount, c)
 }
 
-func (srv *Server) encHandshakeChecks(peers map[enode.ID]*Peer, inboundCount int, c *conn) error {
+func (srv *Server) encHandshakeChecks(cousinPeers map[uint64]map[enode.ID]*Peer, inboundCount int, c *conn) error {
 	switch {
-	case !c.is(trustedConn|staticDialedConn) && len(peers) >= srv.MaxPeers:
+	case !c.is(trustedConn|staticDialedConn) && len(cousinPeers[c.shard.ID]) >= srv.MaxPeers:
 		return DiscTooManyPeers
 	case !c.is(trustedConn) && c.is(inboundConn) && inboundCount >= srv.maxInboundConns():
 		return DiscTooManyPeers
-	case peers[c.node.ID()] != nil:
+	case connectedPeer(cousinPeers, c.node.ID()) != nil:
 		return DiscAlreadyConnected
 	case c.node.ID() == srv.localnode.ID():
 		return DiscSelf
@@ -990,6 +967,7 @@ func (srv *Server) setupConn(c *conn, flags connFlag, dialDest *enode.Node) erro
 	} else {
 		c.node = nodeFromConn(remotePubkey, c.fd)
 	}
+	c.shard = srv.shards.lookup(c.node)
 	clog := srv.log.New("id", c.node.ID(), "addr", c.fd.RemoteAddr(), "conn", c.flags)
 
 	// If raft is running, check if the dialing node is in the raft cluster
@@ -1040,8 +1018,11 @@ func (srv *Server) setupConn(c *conn, flags connFlag, dialDest *enode.Node) erro
 		clog.Trace("Rejected peer before protocol handshake", "err", err)
 		return err
 	}
-	// Run the protocol handshake
-	phs, err := c.doProtoHandshake(srv.ourHandshake)
+	// Run the protocol handshake, exchanging node records to learn the shard
+	// of peers found without one.
+	ours := *srv.ourHandshake
+	ours.Rest = handshakeRecord(srv.localnode.Node())
+	phs, err := c.doProtoHandshake(&ours)
 	if err != nil {
 		clog.Trace("Failed proto handshake", "err", err)
 		return err
@@ -1050,6 +1031,9 @@ func (srv *Server) setupConn(c *conn, flags connFlag, dialDest *enode.Node) erro
 		clog.Trace("Wrong devp2p handshake identity", "phsid", fmt.Sprintf("%x", phs.ID))
 		return DiscUnexpectedIdentity
 	}
+	if n := nodeFromHandshake(phs, c.node.ID()); n != nil {
+		c.shard = srv.shards.lookup(n)
+	}
 	c.caps, c.name = phs.Caps, phs.Name
 	err = srv.checkpoint(c, srv.addpeer)
 	if err != nil {
@@ -0,0 +1,103 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// UnknownShard is the shard of nodes which neither advertise a shard in their
+// node record nor are listed under one in the static nodes file.
+const UnknownShard = ^uint64(0)
+
+// shardTable tracks the shard of remote nodes. Shards advertised in node
+// records take precedence over the static nodes file, which only serves
+// nodes that predate the shard record key.
+type shardTable struct {
+	lock   sync.RWMutex
+	shards map[enode.ID]enr.Shard
+}
+
+func newShardTable(static map[uint64][]*enode.Node) *shardTable {
+	t := &shardTable{shards: make(map[enode.ID]enr.Shard)}
+	for shard, nodes := range static {
+		if shard == UnknownShard {
+			continue
+		}
+		for _, n := range nodes {
+			t.shards[n.ID()] = enr.Shard{ID: shard}
+		}
+	}
+	return t
+}
+
+// lookup returns the shard of a node, remembering it if the node record
+// carries one.
+func (t *shardTable) lookup(n *enode.Node) enr.Shard {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if shard, ok := n.Shard(); ok {
+		t.shards[n.ID()] = shard
+		return shard
+	}
+	if shard, ok := t.shards[n.ID()]; ok {
+		return shard
+	}
+	return enr.Shard{ID: UnknownShard}
+}
+
+// handshakeRecord encodes the local node record for the protocol handshake.
+func handshakeRecord(n *enode.Node) []rlp.RawValue {
+	blob, err := rlp.EncodeToBytes(n.Record())
+	if err != nil {
+		return nil
+	}
+	return []rlp.RawValue{blob}
+}
+
+// nodeFromHandshake returns the node record sent along with a protocol
+// handshake, or nil if the remote side did not send a valid record of
+// its own.
+func nodeFromHandshake(hs *protoHandshake, id enode.ID) *enode.Node {
+	if len(hs.Rest) == 0 {
+		return nil
+	}
+	var r enr.Record
+	if err := rlp.DecodeBytes(hs.Rest[0], &r); err != nil {
+		return nil
+	}
+	n, err := enode.New(enode.ValidSchemes, &r)
+	if err != nil || n.ID() != id {
+		return nil
+	}
+	return n
+}
+
+// connectedPeer returns the peer with the given id in any shard.
+func connectedPeer(peers map[uint64]map[enode.ID]*Peer, id enode.ID) *Peer {
+	for _, shard := range peers {
+		if p, ok := shard[id]; ok {
+			return p
+		}
+	}
+	return nil
+}
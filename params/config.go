@@ -21,8 +21,10 @@ import (
 	"fmt"
 	"math"
 	"math/big"
+	"sort"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 )
 
 // Genesis hashes to enforce below configs on.
@@ -133,19 +135,19 @@ var (
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, new(EthashConfig), nil, nil, false, 32, 50, big.NewInt(0)}
+	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, new(EthashConfig), nil, nil, false, 32, 50, big.NewInt(0), 0, big.NewInt(0), nil, nil, nil}
 
 	// AllCliqueProtocolChanges contains every protocol change (EIPs) introduced
 	// and accepted by the Ethereum core developers into the Clique consensus.
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, &CliqueConfig{Period: 0, Epoch: 30000}, nil, false, 32, 32, big.NewInt(0)}
+	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, &CliqueConfig{Period: 0, Epoch: 30000}, nil, false, 32, 32, big.NewInt(0), 0, big.NewInt(0), nil, nil, nil}
 
-	TestChainConfig = &ChainConfig{big.NewInt(10), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, new(EthashConfig), nil, nil, false, 32, 32, big.NewInt(0)}
+	TestChainConfig = &ChainConfig{big.NewInt(10), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, new(EthashConfig), nil, nil, false, 32, 32, big.NewInt(0), 0, big.NewInt(0), nil, nil, nil}
 	TestRules       = TestChainConfig.Rules(new(big.Int))
 
-	QuorumTestChainConfig = &ChainConfig{big.NewInt(10), big.NewInt(0), nil, false, nil, common.Hash{}, nil, nil, nil, nil, nil, new(EthashConfig), nil, nil, true, 64, 32, big.NewInt(0)}
+	QuorumTestChainConfig = &ChainConfig{big.NewInt(10), big.NewInt(0), nil, false, nil, common.Hash{}, nil, nil, nil, nil, nil, new(EthashConfig), nil, nil, true, 64, 32, big.NewInt(0), 0, big.NewInt(0), nil, nil, nil}
 )
 
 // TrustedCheckpoint represents a set of post-processed trie roots (CHT and
@@ -196,6 +198,38 @@ type ChainConfig struct {
 	//
 	// QIP714Block implements the permissions related changes
 	QIP714Block *big.Int `json:"qip714Block,omitempty"`
+
+	// CrossShardTimeout is the number of reference blocks after which a
+	// cross-shard transaction not yet reported by every involved shard is
+	// aborted once CrossShardAbortBlock is reached (0 = DefaultCrossShardTimeout).
+	CrossShardTimeout uint64 `json:"crossShardTimeout,omitempty"`
+
+	// CrossShardReceiptBlock is the block from which the receipts of failed
+	// cross-shard executions carry the post-Byzantium status and the gas the
+	// block used, rather than an intermediate state root (nil = never).
+	CrossShardReceiptBlock *big.Int `json:"crossShardReceiptBlock,omitempty"`
+
+	// OptimisticCrossShardBlock is the reference block from which cross-shard
+	// transactions are accepted without locking their keys (nil = never).
+	// Shards report the versions of the read sets in their state commitments
+	// and transactions whose read sets went stale are accepted again in a later
+	// reference block.
+	OptimisticCrossShardBlock *big.Int `json:"optimisticCrossShardBlock,omitempty"`
+
+	// AtomicCrossShardBlock is the reference block from which cross-shard
+	// transactions are committed in two phases (nil = never). Shards buffer
+	// the effects of their part and vote in their state commitments, and the
+	// reference chain decides whether all of them are applied. It may not be
+	// set along with OptimisticCrossShardBlock.
+	AtomicCrossShardBlock *big.Int `json:"atomicCrossShardBlock,omitempty"`
+
+	// CrossShardAbortBlock is the reference block from which the optimistic
+	// and atomic cross-shard transactions some involved shard did not report
+	// within CrossShardTimeout reference blocks are aborted (nil = never).
+	// The abort is decided on the reference chain, and as shards only apply
+	// these transactions once decided, it holds for all of them. Transactions
+	// run with locks are never aborted, as shards apply them right away.
+	CrossShardAbortBlock *big.Int `json:"crossShardAbortBlock,omitempty"`
 }
 
 // EthashConfig is the consensus engine configs for proof-of-work based sealing.
@@ -219,9 +253,95 @@ func (c *CliqueConfig) String() string {
 
 // IstanbulConfig is the consensus engine configs for Istanbul based sealing.
 type IstanbulConfig struct {
-	Epoch          uint64   `json:"epoch"`                    // Epoch length to reset votes and checkpoint
-	ProposerPolicy uint64   `json:"policy"`                   // The policy for proposer selection
-	Ceil2Nby3Block *big.Int `json:"ceil2Nby3Block,omitempty"` // Number of confirmations required to move from one state to next [2F + 1 to Ceil(2N/3)]
+	Epoch            uint64   `json:"epoch"`                      // Epoch length to reset votes and checkpoint
+	ProposerPolicy   uint64   `json:"policy"`                     // The policy for proposer selection (0 = round robin, 1 = sticky, 2 = weighted, 3 = reputation)
+	Ceil2Nby3Block   *big.Int `json:"ceil2Nby3Block,omitempty"`   // Number of confirmations required to move from one state to next [2F + 1 to Ceil(2N/3)]
+	BLSBlock         *big.Int `json:"blsBlock,omitempty"`         // Block from which committed seals are aggregated BLS signatures (nil = never)
+	ReputationWindow uint64   `json:"reputationWindow,omitempty"` // Number of blocks a proposer causing a round change is skipped for
+
+	Shards              map[uint64][]common.Address `json:"shards,omitempty"`              // Validators of every shard (empty = split the genesis validators)
+	ShardConsensus      map[uint64]uint64           `json:"shardConsensus,omitempty"`      // Consensus of every shard committee (0 = crash-fault fast path, 1 = full PBFT, missing = 0)
+	ShardConsensusBlock map[uint64]*big.Int         `json:"shardConsensusBlock,omitempty"` // Block from which a shard committee runs full PBFT (missing = genesis)
+	BLSKeys             map[common.Address]*BLSKey  `json:"blsKeys,omitempty"`             // BLS keys registered by the validators
+	Weights             map[common.Address]uint64   `json:"weights,omitempty"`             // Proposer weights of the validators (missing = 1)
+}
+
+// Consensus modes of shard committees.
+const (
+	ShardFastPath uint64 = iota // Crash-fault fast path committing on F+1 votes
+	ShardFullPBFT               // Full PBFT with locking and 2F+1 quorums
+)
+
+// BLSKey is the BLS public key a validator signs committed seals with after
+// the BLS fork, along with the proof of possession of its secret key.
+type BLSKey struct {
+	PublicKey hexutil.Bytes `json:"publicKey"`
+	Proof     hexutil.Bytes `json:"proof"`
+}
+
+// IsBLS returns whether num is either equal to the BLS fork block or greater.
+func (c *IstanbulConfig) IsBLS(num *big.Int) bool {
+	return isForked(c.BLSBlock, num)
+}
+
+// ShardConsensusFork returns the block from which the committee of shard runs
+// full PBFT, or nil if it stays on the fast path.
+func (c *IstanbulConfig) ShardConsensusFork(shard uint64) *big.Int {
+	if c.ShardConsensus[shard] != ShardFullPBFT {
+		return nil
+	}
+	if block := c.ShardConsensusBlock[shard]; block != nil {
+		return block
+	}
+	return big.NewInt(0)
+}
+
+// IsFullPBFT returns whether the committee of shard runs full PBFT at block
+// num.
+func (c *IstanbulConfig) IsFullPBFT(shard uint64, num *big.Int) bool {
+	return isForked(c.ShardConsensusFork(shard), num)
+}
+
+// CheckShardConsensus checks that every shard committee runs a known consensus
+// mode, and that activation blocks are only set for shards running full PBFT.
+func (c *IstanbulConfig) CheckShardConsensus() error {
+	for shard, mode := range c.ShardConsensus {
+		if mode != ShardFastPath && mode != ShardFullPBFT {
+			return fmt.Errorf("Genesis has unknown consensus mode %d for shard %d", mode, shard)
+		}
+	}
+	for shard := range c.ShardConsensusBlock {
+		if c.ShardConsensus[shard] != ShardFullPBFT {
+			return fmt.Errorf("Genesis activates full PBFT on shard %d, which runs the fast path", shard)
+		}
+	}
+	return nil
+}
+
+// consensusShards returns the shards for which either c or other sets a
+// consensus mode, in ascending order.
+func (c *IstanbulConfig) consensusShards(other *IstanbulConfig) []uint64 {
+	seen := make(map[uint64]bool)
+	var shards []uint64
+	for _, modes := range []map[uint64]uint64{c.ShardConsensus, other.ShardConsensus} {
+		for shard := range modes {
+			if !seen[shard] {
+				seen[shard] = true
+				shards = append(shards, shard)
+			}
+		}
+	}
+	sort.Slice(shards, func(i, j int) bool { return shards[i] < shards[j] })
+	return shards
+}
+
+// EpochLength returns the number of blocks after which votes are reset and
+// passed shard reassignments take effect.
+func (c *IstanbulConfig) EpochLength() uint64 {
+	if c.Epoch == 0 {
+		return DefaultIstanbulEpoch
+	}
+	return c.Epoch
 }
 
 // String implements the stringer interface, returning the consensus engine details.
@@ -269,9 +389,43 @@ func (c *ChainConfig) IsValid() error {
 		return errors.New("Genesis max code size must be between 24 and 128")
 	}
 
+	if err := c.CheckShardConsensus(); err != nil {
+		return err
+	}
+	return c.CheckCrossShard()
+}
+
+// CheckShardConsensus checks the consensus modes of the Istanbul shard
+// committees, if any.
+func (c *ChainConfig) CheckShardConsensus() error {
+	if c.Istanbul == nil {
+		return nil
+	}
+	return c.Istanbul.CheckShardConsensus()
+}
+
+// CheckCrossShard checks that at most one way of running cross-shard
+// transactions other than locking is enabled, and that deadline aborts are
+// only enabled along with one.
+func (c *ChainConfig) CheckCrossShard() error {
+	if c.OptimisticCrossShardBlock != nil && c.AtomicCrossShardBlock != nil {
+		return errors.New("Genesis cannot enable both optimistic and atomic cross-shard transactions")
+	}
+	if c.CrossShardAbortBlock != nil && c.OptimisticCrossShardBlock == nil && c.AtomicCrossShardBlock == nil {
+		return errors.New("Genesis cannot abort cross-shard transactions that are neither optimistic nor atomic")
+	}
 	return nil
 }
 
+// CrossShardDeadline returns the number of reference blocks a cross-shard
+// transaction may remain unreported before it is aborted.
+func (c *ChainConfig) CrossShardDeadline() uint64 {
+	if c.CrossShardTimeout == 0 {
+		return DefaultCrossShardTimeout
+	}
+	return c.CrossShardTimeout
+}
+
 // IsHomestead returns whether num is either equal to the homestead block or greater.
 func (c *ChainConfig) IsHomestead(num *big.Int) bool {
 	return isForked(c.HomesteadBlock, num)
@@ -319,6 +473,31 @@ func (c *ChainConfig) IsQIP714(num *big.Int) bool {
 	return isForked(c.QIP714Block, num)
 }
 
+// IsCrossShardReceipt returns whether num is either equal to the cross-shard
+// receipt fork block or greater.
+func (c *ChainConfig) IsCrossShardReceipt(num *big.Int) bool {
+	return isForked(c.CrossShardReceiptBlock, num)
+}
+
+// IsOptimisticCrossShard returns whether cross-shard transactions accepted in
+// reference block num are validated by read versions instead of locks.
+func (c *ChainConfig) IsOptimisticCrossShard(num *big.Int) bool {
+	return isForked(c.OptimisticCrossShardBlock, num)
+}
+
+// IsAtomicCrossShard returns whether cross-shard transactions accepted in
+// reference block num are committed in two phases.
+func (c *ChainConfig) IsAtomicCrossShard(num *big.Int) bool {
+	return isForked(c.AtomicCrossShardBlock, num)
+}
+
+// IsCrossShardAbort returns whether the optimistic and atomic cross-shard
+// transactions accepted in reference block num are aborted once their
+// deadline passes.
+func (c *ChainConfig) IsCrossShardAbort(num *big.Int) bool {
+	return isForked(c.CrossShardAbortBlock, num)
+}
+
 // GasTable returns the gas table corresponding to the current phase (homestead or homestead reprice).
 //
 // The returned GasTable's fields shouldn't, under any circumstances, be changed.
@@ -393,9 +572,31 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int, isQuor
 	if c.Istanbul != nil && newcfg.Istanbul != nil && isForkIncompatible(c.Istanbul.Ceil2Nby3Block, newcfg.Istanbul.Ceil2Nby3Block, head) {
 		return newCompatError("Ceil 2N/3 fork block", c.Istanbul.Ceil2Nby3Block, newcfg.Istanbul.Ceil2Nby3Block)
 	}
+	if c.Istanbul != nil && newcfg.Istanbul != nil && isForkIncompatible(c.Istanbul.BLSBlock, newcfg.Istanbul.BLSBlock, head) {
+		return newCompatError("BLS committed seals fork block", c.Istanbul.BLSBlock, newcfg.Istanbul.BLSBlock)
+	}
+	if c.Istanbul != nil && newcfg.Istanbul != nil {
+		for _, shard := range c.Istanbul.consensusShards(newcfg.Istanbul) {
+			if isForkIncompatible(c.Istanbul.ShardConsensusFork(shard), newcfg.Istanbul.ShardConsensusFork(shard), head) {
+				return newCompatError(fmt.Sprintf("shard %d full PBFT fork block", shard), c.Istanbul.ShardConsensusFork(shard), newcfg.Istanbul.ShardConsensusFork(shard))
+			}
+		}
+	}
 	if isForkIncompatible(c.QIP714Block, newcfg.QIP714Block, head) {
 		return newCompatError("permissions fork block", c.QIP714Block, newcfg.QIP714Block)
 	}
+	if isForkIncompatible(c.CrossShardReceiptBlock, newcfg.CrossShardReceiptBlock, head) {
+		return newCompatError("cross-shard receipt fork block", c.CrossShardReceiptBlock, newcfg.CrossShardReceiptBlock)
+	}
+	if isForkIncompatible(c.OptimisticCrossShardBlock, newcfg.OptimisticCrossShardBlock, head) {
+		return newCompatError("optimistic cross-shard fork block", c.OptimisticCrossShardBlock, newcfg.OptimisticCrossShardBlock)
+	}
+	if isForkIncompatible(c.AtomicCrossShardBlock, newcfg.AtomicCrossShardBlock, head) {
+		return newCompatError("atomic cross-shard fork block", c.AtomicCrossShardBlock, newcfg.AtomicCrossShardBlock)
+	}
+	if isForkIncompatible(c.CrossShardAbortBlock, newcfg.CrossShardAbortBlock, head) {
+		return newCompatError("cross-shard abort fork block", c.CrossShardAbortBlock, newcfg.CrossShardAbortBlock)
+	}
 	return nil
 }
 
@@ -87,6 +87,78 @@ func TestCheckCompatible(t *testing.T) {
 				RewindTo:     9,
 			},
 		},
+		{
+			stored: &ChainConfig{Istanbul: &IstanbulConfig{BLSBlock: big.NewInt(10)}},
+			new:    &ChainConfig{Istanbul: &IstanbulConfig{}},
+			head:   30,
+			wantErr: &ConfigCompatError{
+				What:         "BLS committed seals fork block",
+				StoredConfig: big.NewInt(10),
+				NewConfig:    nil,
+				RewindTo:     9,
+			},
+		},
+		{
+			stored: &ChainConfig{Istanbul: &IstanbulConfig{ShardConsensus: map[uint64]uint64{1: ShardFullPBFT}}},
+			new:    &ChainConfig{Istanbul: &IstanbulConfig{ShardConsensus: map[uint64]uint64{1: ShardFullPBFT}, ShardConsensusBlock: map[uint64]*big.Int{1: big.NewInt(40)}}},
+			head:   30,
+			wantErr: &ConfigCompatError{
+				What:         "shard 1 full PBFT fork block",
+				StoredConfig: big.NewInt(0),
+				NewConfig:    big.NewInt(40),
+				RewindTo:     0,
+			},
+		},
+		{
+			stored:  &ChainConfig{Istanbul: &IstanbulConfig{}},
+			new:     &ChainConfig{Istanbul: &IstanbulConfig{ShardConsensus: map[uint64]uint64{2: ShardFullPBFT}, ShardConsensusBlock: map[uint64]*big.Int{2: big.NewInt(40)}}},
+			head:    30,
+			wantErr: nil,
+		},
+		{
+			stored: &ChainConfig{CrossShardReceiptBlock: big.NewInt(10)},
+			new:    &ChainConfig{},
+			head:   30,
+			wantErr: &ConfigCompatError{
+				What:         "cross-shard receipt fork block",
+				StoredConfig: big.NewInt(10),
+				NewConfig:    nil,
+				RewindTo:     9,
+			},
+		},
+		{
+			stored: &ChainConfig{OptimisticCrossShardBlock: big.NewInt(10)},
+			new:    &ChainConfig{OptimisticCrossShardBlock: big.NewInt(20)},
+			head:   15,
+			wantErr: &ConfigCompatError{
+				What:         "optimistic cross-shard fork block",
+				StoredConfig: big.NewInt(10),
+				NewConfig:    big.NewInt(20),
+				RewindTo:     9,
+			},
+		},
+		{
+			stored: &ChainConfig{},
+			new:    &ChainConfig{AtomicCrossShardBlock: big.NewInt(10)},
+			head:   30,
+			wantErr: &ConfigCompatError{
+				What:         "atomic cross-shard fork block",
+				StoredConfig: nil,
+				NewConfig:    big.NewInt(10),
+				RewindTo:     9,
+			},
+		},
+		{
+			stored: &ChainConfig{AtomicCrossShardBlock: big.NewInt(0)},
+			new:    &ChainConfig{AtomicCrossShardBlock: big.NewInt(0), CrossShardAbortBlock: big.NewInt(10)},
+			head:   30,
+			wantErr: &ConfigCompatError{
+				What:         "cross-shard abort fork block",
+				StoredConfig: nil,
+				NewConfig:    big.NewInt(10),
+				RewindTo:     9,
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -96,3 +168,36 @@ func TestCheckCompatible(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckCrossShard(t *testing.T) {
+	config := &ChainConfig{OptimisticCrossShardBlock: big.NewInt(0)}
+	if err := config.CheckCrossShard(); err != nil {
+		t.Errorf("optimistic mode rejected: %v", err)
+	}
+	config.AtomicCrossShardBlock = big.NewInt(10)
+	if err := config.CheckCrossShard(); err == nil {
+		t.Errorf("optimistic and atomic modes accepted together")
+	}
+	config = &ChainConfig{CrossShardAbortBlock: big.NewInt(0)}
+	if err := config.CheckCrossShard(); err == nil {
+		t.Errorf("deadline aborts accepted for locked transactions")
+	}
+}
+
+func TestCheckShardConsensus(t *testing.T) {
+	config := &IstanbulConfig{ShardConsensus: map[uint64]uint64{1: ShardFastPath, 2: ShardFullPBFT}, ShardConsensusBlock: map[uint64]*big.Int{2: big.NewInt(10)}}
+	if err := config.CheckShardConsensus(); err != nil {
+		t.Errorf("known modes rejected: %v", err)
+	}
+	if config.IsFullPBFT(2, big.NewInt(9)) || !config.IsFullPBFT(2, big.NewInt(10)) || config.IsFullPBFT(1, big.NewInt(10)) {
+		t.Errorf("full PBFT activation mismatch")
+	}
+	config.ShardConsensusBlock[1] = big.NewInt(10)
+	if err := config.CheckShardConsensus(); err == nil {
+		t.Errorf("activation block accepted for a shard on the fast path")
+	}
+	config = &IstanbulConfig{ShardConsensus: map[uint64]uint64{1: 2}}
+	if err := config.CheckShardConsensus(); err == nil {
+		t.Errorf("unknown mode accepted")
+	}
+}
@@ -81,6 +81,9 @@ const (
 
 	MaxCodeSize = 24576 // Maximum bytecode to permit for a contract
 
+	DefaultCrossShardTimeout uint64 = 32    // Reference blocks before an unreported cross-shard transaction is aborted, past the abort fork
+	DefaultIstanbulEpoch     uint64 = 30000 // Blocks between Istanbul checkpoints if the chain config sets none
+
 	// Precompiled contract gas prices
 
 	EcrecoverGas               uint64 = 3000   // Elliptic curve sender recovery gas price
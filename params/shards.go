@@ -0,0 +1,137 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package params
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	// ErrInvalidMyShard is returned if the local shard is not part of the network.
+	ErrInvalidMyShard = errors.New("local shard exceeds the number of shards")
+
+	// ErrShardOutOfRange is returned if validators are assigned to a shard
+	// beyond the number of shards.
+	ErrShardOutOfRange = errors.New("validators assigned to unknown shard")
+
+	// ErrEmptyShard is returned if a shard has no validators.
+	ErrEmptyShard = errors.New("shard without validators")
+
+	// ErrUnknownShardValidator is returned if a shard member is not a genesis
+	// validator.
+	ErrUnknownShardValidator = errors.New("shard validator missing from genesis validators")
+
+	// ErrDuplicateShardValidator is returned if a validator is assigned twice.
+	ErrDuplicateShardValidator = errors.New("validator assigned more than once")
+
+	// ErrUnassignedValidator is returned if a genesis validator has no shard.
+	ErrUnassignedValidator = errors.New("genesis validator not assigned to any shard")
+
+	// ErrRefNodesMismatch is returned if the number of reference validators
+	// disagrees with the configured number of reference nodes.
+	ErrRefNodesMismatch = errors.New("reference shard size does not match reference nodes")
+
+	// ErrUnevenShards is returned if the genesis validators cannot be split
+	// evenly over the shards.
+	ErrUnevenShards = errors.New("validators not evenly divisible over shards")
+)
+
+// ShardTopology returns the validators of every shard of a network with
+// numShard shards, including the reference shard 0. Without an explicit
+// Shards map the first refNodes genesis validators form the reference shard
+// and the remaining ones are split evenly over the other shards. A non-zero
+// refNodes must match the size of the reference shard.
+func (c *IstanbulConfig) ShardTopology(numShard, refNodes uint64, validators []common.Address) (map[uint64][]common.Address, error) {
+	if numShard == 0 {
+		return nil, ErrEmptyShard
+	}
+	shards := c.Shards
+	if len(shards) == 0 {
+		var err error
+		if shards, err = splitValidators(numShard, refNodes, validators); err != nil {
+			return nil, err
+		}
+	}
+	genesis := make(map[common.Address]bool, len(validators))
+	for _, addr := range validators {
+		genesis[addr] = true
+	}
+	assigned := make(map[common.Address]uint64)
+	for shard, members := range shards {
+		if shard >= numShard {
+			return nil, fmt.Errorf("%v: shard %d of %d", ErrShardOutOfRange, shard, numShard)
+		}
+		for _, addr := range members {
+			if !genesis[addr] {
+				return nil, fmt.Errorf("%v: %x in shard %d", ErrUnknownShardValidator, addr, shard)
+			}
+			if prev, ok := assigned[addr]; ok {
+				return nil, fmt.Errorf("%v: %x in shards %d and %d", ErrDuplicateShardValidator, addr, prev, shard)
+			}
+			assigned[addr] = shard
+		}
+	}
+	for shard := uint64(0); shard < numShard; shard++ {
+		if len(shards[shard]) == 0 {
+			return nil, fmt.Errorf("%v: shard %d", ErrEmptyShard, shard)
+		}
+	}
+	for _, addr := range validators {
+		if _, ok := assigned[addr]; !ok {
+			return nil, fmt.Errorf("%v: %x", ErrUnassignedValidator, addr)
+		}
+	}
+	if refNodes != 0 && uint64(len(shards[0])) != refNodes {
+		return nil, fmt.Errorf("%v: have %d, want %d", ErrRefNodesMismatch, len(shards[0]), refNodes)
+	}
+	topology := make(map[uint64][]common.Address, numShard)
+	for shard := uint64(0); shard < numShard; shard++ {
+		topology[shard] = append([]common.Address{}, shards[shard]...)
+	}
+	return topology, nil
+}
+
+// splitValidators assigns the first refNodes validators to the reference
+// shard and splits the remaining ones evenly over the other shards.
+func splitValidators(numShard, refNodes uint64, validators []common.Address) (map[uint64][]common.Address, error) {
+	total := uint64(len(validators))
+	if numShard == 1 && refNodes == 0 {
+		refNodes = total
+	}
+	if refNodes > total {
+		return nil, fmt.Errorf("%v: have %d validators, want %d", ErrRefNodesMismatch, total, refNodes)
+	}
+	shards := map[uint64][]common.Address{0: validators[:refNodes]}
+	if numShard == 1 {
+		if refNodes != total {
+			return nil, fmt.Errorf("%v: have %d validators, want %d", ErrRefNodesMismatch, total, refNodes)
+		}
+		return shards, nil
+	}
+	perShard := (total - refNodes) / (numShard - 1)
+	if perShard*(numShard-1) != total-refNodes {
+		return nil, fmt.Errorf("%v: %d validators over %d shards", ErrUnevenShards, total-refNodes, numShard-1)
+	}
+	for shard := uint64(1); shard < numShard; shard++ {
+		start := refNodes + (shard-1)*perShard
+		shards[shard] = validators[start : start+perShard]
+	}
+	return shards, nil
+}
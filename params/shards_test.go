@@ -0,0 +1,86 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package params
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestShardTopology(t *testing.T) {
+	var validators []common.Address
+	for i := 1; i <= 7; i++ {
+		validators = append(validators, common.BigToAddress(big.NewInt(int64(i))))
+	}
+	v := validators
+	tests := []struct {
+		shards   map[uint64][]common.Address
+		numShard uint64
+		refNodes uint64
+		want     map[uint64][]common.Address
+		err      error
+	}{
+		// Genesis validators split by the number of reference nodes
+		{numShard: 3, refNodes: 3, want: map[uint64][]common.Address{0: v[:3], 1: v[3:5], 2: v[5:7]}},
+		{numShard: 1, want: map[uint64][]common.Address{0: v}},
+		{numShard: 1, refNodes: 7, want: map[uint64][]common.Address{0: v}},
+		{numShard: 1, refNodes: 3, err: ErrRefNodesMismatch},
+		{numShard: 3, refNodes: 2, err: ErrUnevenShards},
+		{numShard: 3, refNodes: 8, err: ErrRefNodesMismatch},
+		{numShard: 3, refNodes: 7, err: ErrEmptyShard},
+		// Explicit shard membership
+		{
+			shards:   map[uint64][]common.Address{0: {v[6], v[0]}, 1: v[1:4], 2: v[4:6]},
+			numShard: 3,
+			want:     map[uint64][]common.Address{0: {v[6], v[0]}, 1: v[1:4], 2: v[4:6]},
+		},
+		{
+			shards:   map[uint64][]common.Address{0: v[:2], 1: v[2:4], 2: v[4:7]},
+			numShard: 3,
+			refNodes: 2,
+			want:     map[uint64][]common.Address{0: v[:2], 1: v[2:4], 2: v[4:7]},
+		},
+		{shards: map[uint64][]common.Address{0: v[:2], 1: v[2:4], 2: v[4:7]}, numShard: 3, refNodes: 3, err: ErrRefNodesMismatch},
+		{shards: map[uint64][]common.Address{0: v[:2], 1: v[2:7]}, numShard: 3, err: ErrEmptyShard},
+		{shards: map[uint64][]common.Address{0: v[:2], 1: v[2:4], 3: v[4:7]}, numShard: 3, err: ErrShardOutOfRange},
+		{shards: map[uint64][]common.Address{0: v[:3], 1: v[2:4], 2: v[4:7]}, numShard: 3, err: ErrDuplicateShardValidator},
+		{shards: map[uint64][]common.Address{0: v[:2], 1: v[2:4], 2: v[4:6]}, numShard: 3, err: ErrUnassignedValidator},
+		{shards: map[uint64][]common.Address{0: v[:2], 1: v[2:4], 2: {v[4], v[5], v[6], common.Address{}}}, numShard: 3, err: ErrUnknownShardValidator},
+		{numShard: 0, err: ErrEmptyShard},
+	}
+	for i, tt := range tests {
+		config := &IstanbulConfig{Shards: tt.shards}
+		topology, err := config.ShardTopology(tt.numShard, tt.refNodes, validators)
+		if tt.err != nil {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err.Error()) {
+				t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(topology, tt.want) {
+			t.Errorf("test %d: topology mismatch: have %v, want %v", i, topology, tt.want)
+		}
+	}
+}